@@ -0,0 +1,37 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/db"
+)
+
+// SetBroadcastQueue sets the queue used to send the transactions, without it the transactions are sent directly to the backend
+func (w *Worker) SetBroadcastQueue(q *db.BroadcastQueue) {
+	w.broadcastQueue = q
+}
+
+// SendRawTransaction sends the transaction to the backend, using the broadcast queue if it is set
+func (w *Worker) SendRawTransaction(hex string) (string, error) {
+	if w.broadcastQueue != nil {
+		return w.broadcastQueue.Send(hex)
+	}
+	return w.chain.SendRawTransaction(hex)
+}
+
+// GetBroadcast returns the state of the transaction sent through the broadcast queue
+func (w *Worker) GetBroadcast(txid string) (*db.BroadcastTx, error) {
+	if w.broadcastQueue == nil {
+		return nil, NewAPIError("Broadcast queue is not enabled", true)
+	}
+	txid = strings.ToLower(strings.TrimSpace(txid))
+	tx, err := w.db.GetBroadcastTx(txid)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBroadcastTx %v", txid)
+	}
+	if tx == nil {
+		return nil, NewAPIError("Broadcast not found", true)
+	}
+	return tx, nil
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// Coin selection strategies
+const (
+	// CoinSelectionBranchAndBound searches for a set of inputs that does not need change, falls back to largest first
+	CoinSelectionBranchAndBound = "bnb"
+	// CoinSelectionLargestFirst selects the largest utxos until the amount is covered
+	CoinSelectionLargestFirst = "largest"
+	// CoinSelectionPrivacy spends whole addresses to avoid linking more addresses and leaving remnants on them
+	CoinSelectionPrivacy = "privacy"
+)
+
+// Policies of inclusion of unconfirmed utxos to the coin selection
+const (
+	// UnconfirmedNone excludes all unconfirmed utxos
+	UnconfirmedNone = "none"
+	// UnconfirmedChange includes only the unconfirmed utxos of the change addresses
+	UnconfirmedChange = "change"
+	// UnconfirmedAll includes all unconfirmed utxos
+	UnconfirmedAll = "all"
+)
+
+// bnbMaxTries limits the number of the steps of the branch and bound search
+const bnbMaxTries = 100000
+
+// CoinSelectionParams are the parameters of the coin selection for an xpub
+type CoinSelectionParams struct {
+	// Amount is the value of the single recipient output in the base units
+	Amount big.Int
+	// FeeRate is the fee rate in satoshis per vbyte
+	FeeRate float64
+	// Strategy is one of the CoinSelection* strategies, CoinSelectionBranchAndBound if empty
+	Strategy string
+	// Unconfirmed is one of the Unconfirmed* policies, UnconfirmedNone if empty
+	Unconfirmed string
+	// Gap is the xpub addresses gap
+	Gap int
+}
+
+// coinCandidate is an utxo that can be spent with its value reduced by the fee of its input
+type coinCandidate struct {
+	utxo      *Utxo
+	effective int64
+}
+
+// coinSelectionSizes returns the virtual sizes of the input and of the output of the type of the xpub addresses
+// and if the transaction is segwit; P2SH addresses of an xpub are considered to be P2SH-P2WPKH
+func coinSelectionSizes(addrDesc bchain.AddressDescriptor) (int, int, bool, error) {
+	l := len(addrDesc)
+	switch {
+	case l == 25 && addrDesc[0] == 0x76:
+		return 148, 34, false, nil
+	case l == 23 && addrDesc[0] == 0xa9:
+		return 91, 32, true, nil
+	case l == 22 && addrDesc[0] == 0x00:
+		return 68, 31, true, nil
+	case l == 34 && addrDesc[0] == 0x51:
+		return 58, 43, true, nil
+	}
+	return 0, 0, false, NewAPIError("Coin selection is not supported for this type of xpub", true)
+}
+
+// selectBranchAndBound searches depth first for the set of candidates with the effective value between target and target+costOfChange,
+// minimizing the excess; the candidates must be sorted by the effective value descending
+func selectBranchAndBound(candidates []coinCandidate, target, costOfChange int64) []coinCandidate {
+	var remaining int64
+	for i := range candidates {
+		remaining += candidates[i].effective
+	}
+	if remaining < target {
+		return nil
+	}
+	var best, selection []int
+	bestExcess := int64(math.MaxInt64)
+	tries := 0
+	var search func(i int, value, remaining int64)
+	search = func(i int, value, remaining int64) {
+		if tries >= bnbMaxTries {
+			return
+		}
+		tries++
+		if value > target+costOfChange {
+			return
+		}
+		if value >= target {
+			if value-target < bestExcess {
+				bestExcess = value - target
+				best = append(best[:0], selection...)
+			}
+			return
+		}
+		if i == len(candidates) || value+remaining < target {
+			return
+		}
+		remaining -= candidates[i].effective
+		selection = append(selection, i)
+		search(i+1, value+candidates[i].effective, remaining)
+		selection = selection[:len(selection)-1]
+		// omitting the candidate with the same value as the omitted one leads to the already explored sets
+		j := i + 1
+		for j < len(candidates) && candidates[j].effective == candidates[i].effective {
+			remaining -= candidates[j].effective
+			j++
+		}
+		search(j, value, remaining)
+	}
+	search(0, 0, remaining)
+	if best == nil {
+		return nil
+	}
+	r := make([]coinCandidate, len(best))
+	for i, j := range best {
+		r[i] = candidates[j]
+	}
+	return r
+}
+
+// selectLargestFirst selects the candidates sorted by the effective value descending until the target is reached
+func selectLargestFirst(candidates []coinCandidate, target int64) []coinCandidate {
+	var value int64
+	for i := range candidates {
+		value += candidates[i].effective
+		if value >= target {
+			return candidates[:i+1]
+		}
+	}
+	return nil
+}
+
+// selectPrivacy selects all candidates of one address with the smallest value that reaches the target,
+// if there is no such address, whole addresses are added from the largest until the target is reached
+func selectPrivacy(candidates []coinCandidate, target int64) []coinCandidate {
+	type addressGroup struct {
+		candidates []coinCandidate
+		value      int64
+	}
+	var groups []*addressGroup
+	byAddress := make(map[string]*addressGroup)
+	for _, c := range candidates {
+		g, found := byAddress[c.utxo.Address]
+		if !found {
+			g = &addressGroup{}
+			byAddress[c.utxo.Address] = g
+			groups = append(groups, g)
+		}
+		g.candidates = append(g.candidates, c)
+		g.value += c.effective
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].value > groups[j].value })
+	for i := len(groups) - 1; i >= 0; i-- {
+		if groups[i].value >= target {
+			return groups[i].candidates
+		}
+	}
+	var r []coinCandidate
+	var value int64
+	for _, g := range groups {
+		r = append(r, g.candidates...)
+		value += g.value
+		if value >= target {
+			return r
+		}
+	}
+	return nil
+}
+
+// feeForVsize returns the fee of the given virtual size rounded up
+func feeForVsize(vsize int, feeRate float64) int64 {
+	return int64(math.Ceil(float64(vsize) * feeRate))
+}
+
+// SelectXpubCoins selects the utxos of the xpub to pay the amount to one recipient output of the same type as the xpub addresses.
+// Immature coinbase utxos are never selected, the unconfirmed utxos according to the policy in params.
+// The change, if it is not dust, is sent to the first unused change address of the xpub, an error is returned if there is no unused change address.
+func (w *Worker) SelectXpubCoins(xpub string, params *CoinSelectionParams) (*CoinSelection, error) {
+	start := time.Now()
+	if params.Amount.Sign() <= 0 || !params.Amount.IsInt64() {
+		return nil, NewAPIError("Invalid amount", true)
+	}
+	if params.FeeRate <= 0 || math.IsInf(params.FeeRate, 0) || math.IsNaN(params.FeeRate) {
+		return nil, NewAPIError("Invalid feeRate", true)
+	}
+	strategy := params.Strategy
+	switch strategy {
+	case "":
+		strategy = CoinSelectionBranchAndBound
+	case CoinSelectionBranchAndBound, CoinSelectionLargestFirst, CoinSelectionPrivacy:
+	default:
+		return nil, NewAPIError(fmt.Sprintf("Unknown strategy %v", strategy), true)
+	}
+	unconfirmed := params.Unconfirmed
+	switch unconfirmed {
+	case "":
+		unconfirmed = UnconfirmedNone
+	case UnconfirmedNone, UnconfirmedChange, UnconfirmedAll:
+	default:
+		return nil, NewAPIError(fmt.Sprintf("Unknown unconfirmed policy %v", unconfirmed), true)
+	}
+	onlyConfirmed := unconfirmed == UnconfirmedNone
+	data, _, inCache, err := w.getXpubData(xpub, 0, 1, AccountDetailsBasic, &AddressFilter{
+		Vout:          AddressFilterVoutOff,
+		OnlyConfirmed: onlyConfirmed,
+	}, params.Gap)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.addresses) == 0 || len(data.changeAddresses) == 0 {
+		return nil, NewAPIError("Xpub has no addresses", true)
+	}
+	inputVsize, outputVsize, segwit, err := coinSelectionSizes(data.addresses[0].addrDesc)
+	if err != nil {
+		return nil, err
+	}
+	inputFee := feeForVsize(inputVsize, params.FeeRate)
+	minConfirmations := w.chainParser.MinimumCoinbaseConfirmations()
+	var candidates []coinCandidate
+	changeIndex := -1
+	for ci, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
+		for i := range da {
+			ad := &da[i]
+			onlyMempool := false
+			if ad.balance == nil {
+				if onlyConfirmed {
+					if ci == 1 && changeIndex < 0 {
+						changeIndex = i
+					}
+					continue
+				}
+				onlyMempool = true
+			}
+			utxos, err := w.getAddrDescUtxo(ad.addrDesc, ad.balance, onlyConfirmed, onlyMempool)
+			if err != nil {
+				return nil, err
+			}
+			// the first change address without any transaction receives the change
+			if ci == 1 && changeIndex < 0 && ad.balance == nil && len(utxos) == 0 {
+				changeIndex = i
+			}
+			if len(utxos) == 0 {
+				continue
+			}
+			t := w.tokenFromXpubAddress(data, ad, ci, i, AccountDetailsTokens)
+			for j := range utxos {
+				u := &utxos[j]
+				if u.Coinbase && u.Confirmations < minConfirmations {
+					continue
+				}
+				if u.Confirmations == 0 && unconfirmed == UnconfirmedChange && ci == 0 {
+					continue
+				}
+				u.Address = t.Name
+				u.Path = t.Path
+				if effective := (*big.Int)(u.AmountSat).Int64() - inputFee; effective > 0 {
+					candidates = append(candidates, coinCandidate{utxo: u, effective: effective})
+				}
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].effective > candidates[j].effective })
+	overhead := 10
+	if segwit {
+		overhead = 11
+	}
+	amount := params.Amount.Int64()
+	// the target covers the amount and the fee of the transaction without the inputs and the change output
+	target := amount + feeForVsize(overhead+outputVsize, params.FeeRate)
+	changeFee := feeForVsize(outputVsize, params.FeeRate)
+	var selected []coinCandidate
+	switch strategy {
+	case CoinSelectionBranchAndBound:
+		// the change output is worth its fee and the fee of spending it later
+		selected = selectBranchAndBound(candidates, target, changeFee+inputFee)
+		if selected == nil {
+			strategy = CoinSelectionLargestFirst
+			selected = selectLargestFirst(candidates, target)
+		}
+	case CoinSelectionLargestFirst:
+		selected = selectLargestFirst(candidates, target)
+	case CoinSelectionPrivacy:
+		selected = selectPrivacy(candidates, target)
+	}
+	if selected == nil {
+		return nil, NewAPIError("Insufficient funds", true)
+	}
+	var valueIn, effective int64
+	inputs := make(Utxos, len(selected))
+	for i := range selected {
+		inputs[i] = *selected[i].utxo
+		valueIn += (*big.Int)(selected[i].utxo.AmountSat).Int64()
+		effective += selected[i].effective
+	}
+	r := &CoinSelection{
+		Strategy:   strategy,
+		Inputs:     inputs,
+		ValueInSat: (*Amount)(big.NewInt(valueIn)),
+		AmountSat:  (*Amount)(big.NewInt(amount)),
+		FeeRate:    params.FeeRate,
+		Vsize:      overhead + len(inputs)*inputVsize + outputVsize,
+	}
+	change := effective - target - changeFee
+	// all change addresses have the same type, the last one determines the dust threshold if there is no unused one
+	changeAddress := data.changeAddresses[len(data.changeAddresses)-1].addrDesc
+	if changeIndex >= 0 {
+		changeAddress = data.changeAddresses[changeIndex].addrDesc
+	}
+	if change > dustThreshold(changeAddress) {
+		// do not reuse an address, the unused change addresses are derived up to the gap, they can be used by the mempool transactions
+		if changeIndex < 0 {
+			return nil, NewAPIError("No unused change address, increase the gap", true)
+		}
+		r.ChangeSat = (*Amount)(big.NewInt(change))
+		r.Vsize += outputVsize
+		a, _, err := w.chainParser.GetAddressesFromAddrDesc(changeAddress)
+		if err != nil {
+			glog.Errorf("GetAddressesFromAddrDesc error %v, change address %v", err, changeAddress)
+		}
+		if len(a) > 0 {
+			r.ChangeAddress = a[0]
+		}
+		r.ChangePath = fmt.Sprintf("%s/%d/%d", data.basePath, 1, changeIndex)
+	} else {
+		change = 0
+	}
+	r.FeesSat = (*Amount)(big.NewInt(valueIn - amount - change))
+	glog.Info("SelectXpubCoins ", xpub[:16], ", cache ", inCache, ", ", len(candidates), " candidates, ", len(inputs), " selected, ", time.Since(start))
+	return r, nil
+}
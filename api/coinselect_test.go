@@ -0,0 +1,124 @@
+// +build unittest
+
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newCoinCandidates(addresses []string, values ...int64) []coinCandidate {
+	r := make([]coinCandidate, len(values))
+	for i, v := range values {
+		r[i] = coinCandidate{utxo: &Utxo{Vout: int32(i), Address: addresses[i]}, effective: v}
+	}
+	return r
+}
+
+func candidateVouts(candidates []coinCandidate) []int32 {
+	if candidates == nil {
+		return nil
+	}
+	r := make([]int32, len(candidates))
+	for i := range candidates {
+		r[i] = candidates[i].utxo.Vout
+	}
+	return r
+}
+
+func Test_selectBranchAndBound(t *testing.T) {
+	addresses := []string{"a", "b", "c", "d", "e", "f"}
+	tests := []struct {
+		name         string
+		values       []int64
+		target       int64
+		costOfChange int64
+		want         []int32
+	}{
+		{
+			name:   "exact match",
+			values: []int64{5000, 4000, 3000, 2000, 1000},
+			target: 6000,
+			want:   []int32{0, 4},
+		},
+		{
+			name:         "best excess within cost of change",
+			values:       []int64{9000, 5000, 3050, 2990},
+			target:       6000,
+			costOfChange: 100,
+			want:         []int32{2, 3},
+		},
+		{
+			name:         "equal values",
+			values:       []int64{3000, 3000, 3000, 3000, 1000},
+			target:       10000,
+			costOfChange: 10,
+			want:         []int32{0, 1, 2, 4},
+		},
+		{
+			name:         "no match",
+			values:       []int64{5000, 3000},
+			target:       6000,
+			costOfChange: 100,
+		},
+		{
+			name:   "insufficient funds",
+			values: []int64{5000, 3000},
+			target: 9000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := candidateVouts(selectBranchAndBound(newCoinCandidates(addresses, tt.values...), tt.target, tt.costOfChange))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectBranchAndBound() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectLargestFirst(t *testing.T) {
+	candidates := newCoinCandidates([]string{"a", "b", "c"}, 5000, 3000, 1000)
+	if got := candidateVouts(selectLargestFirst(candidates, 7000)); !reflect.DeepEqual(got, []int32{0, 1}) {
+		t.Errorf("selectLargestFirst() = %v, want [0 1]", got)
+	}
+	if got := selectLargestFirst(candidates, 9001); got != nil {
+		t.Errorf("selectLargestFirst() = %v, want nil", candidateVouts(got))
+	}
+}
+
+func Test_selectPrivacy(t *testing.T) {
+	candidates := newCoinCandidates([]string{"a", "b", "a", "c", "b"}, 6000, 5000, 3000, 2000, 1000)
+	tests := []struct {
+		name   string
+		target int64
+		want   []int32
+	}{
+		{
+			name:   "smallest single address",
+			target: 5500,
+			want:   []int32{1, 4},
+		},
+		{
+			name:   "single address",
+			target: 1500,
+			want:   []int32{3},
+		},
+		{
+			name:   "more addresses from the largest",
+			target: 14000,
+			want:   []int32{0, 2, 1, 4},
+		},
+		{
+			name:   "insufficient funds",
+			target: 17001,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := candidateVouts(selectPrivacy(candidates, tt.target)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectPrivacy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/wire"
+	"github.com/trezor/blockbook/bchain"
+)
+
+const (
+	// dustRelayFeePerKb is the default dust relay fee of Bitcoin Core in satoshis per kilo vbyte
+	dustRelayFeePerKb = 3000
+	// absurdFeeRate is the default maximal fee rate accepted by sendrawtransaction of Bitcoin Core in satoshis per vbyte
+	absurdFeeRate = 10000
+)
+
+// txSizes returns the size and the virtual size of the serialized transaction,
+// if the transaction is not in the Bitcoin serialization format, the virtual size is the size
+func txSizes(b []byte) (int, int) {
+	t := wire.MsgTx{}
+	if err := t.Deserialize(bytes.NewReader(b)); err != nil || t.SerializeSize() != len(b) {
+		return len(b), len(b)
+	}
+	weight := t.SerializeSizeStripped()*3 + t.SerializeSize()
+	return len(b), (weight + 3) / 4
+}
+
+// isWitnessProgram returns true if the output script is a segwit output script
+func isWitnessProgram(script []byte) bool {
+	l := len(script)
+	if l < 4 || l > 42 {
+		return false
+	}
+	if script[0] != 0 && (script[0] < 0x51 || script[0] > 0x60) {
+		return false
+	}
+	return int(script[1])+2 == l
+}
+
+// dustThreshold returns the minimal value of the output that is not considered dust,
+// computed in the same way as Bitcoin Core from the size of the output and of the input spending it
+func dustThreshold(script []byte) int64 {
+	// unspendable outputs
+	if len(script) > 0 && script[0] == 0x6a {
+		return 0
+	}
+	size := 8 + wire.VarIntSerializeSize(uint64(len(script))) + len(script)
+	if isWitnessProgram(script) {
+		size += 32 + 4 + 1 + 107/4 + 4
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return int64(size) * dustRelayFeePerKb / 1000
+}
+
+// resolveDecodedTxInput sets the value and the address of the spent output to the input, using the index
+// or the backend for the unconfirmed outputs, and returns the warning if the output is unknown or already spent
+func (w *Worker) resolveDecodedTxInput(vin *Vin) (*TxWarning, error) {
+	ta, err := w.db.GetTxAddresses(vin.Txid)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetTxAddresses %v", vin.Txid)
+	}
+	if ta != nil {
+		if int(vin.Vout) < len(ta.Outputs) {
+			output := &ta.Outputs[vin.Vout]
+			vin.ValueSat = (*Amount)(&output.ValueSat)
+			vin.AddrDesc = output.AddrDesc
+			vin.Addresses, vin.IsAddress, err = output.Addresses(w.chainParser)
+			if err != nil {
+				glog.Errorf("output.Addresses error %v, tx %v, output %v", err, vin.Txid, vin.Vout)
+			}
+			if output.Spent {
+				return &TxWarning{Type: TxWarningSpentInput, N: vin.N, Message: fmt.Sprintf("Input %d spends already spent output %v:%d", vin.N, vin.Txid, vin.Vout)}, nil
+			}
+			return nil, nil
+		}
+	} else {
+		// the output may be in a mempool transaction
+		otx, _, err := w.txCache.GetTransaction(vin.Txid)
+		if err != nil && err != bchain.ErrTxNotFound {
+			return nil, errors.Annotatef(err, "txCache.GetTransaction %v", vin.Txid)
+		}
+		if err == nil && int(vin.Vout) < len(otx.Vout) {
+			vout := &otx.Vout[vin.Vout]
+			vin.ValueSat = (*Amount)(&vout.ValueSat)
+			vin.AddrDesc, vin.Addresses, vin.IsAddress, err = w.getAddressesFromVout(vout)
+			if err != nil {
+				glog.Errorf("getAddressesFromVout error %v, vout %+v", err, vout)
+			}
+			return nil, nil
+		}
+	}
+	return &TxWarning{Type: TxWarningMissingInput, N: vin.N, Message: fmt.Sprintf("Input %d spends unknown output %v:%d", vin.N, vin.Txid, vin.Vout)}, nil
+}
+
+// DecodeTx parses the raw transaction in hex, resolves its inputs and returns its preview with the warnings
+// about the problems that would probably prevent its acceptance or that are likely a mistake.
+// If testMempoolAccept is set, the backend is asked if it would accept the transaction to its mempool.
+func (w *Worker) DecodeTx(txHex string, testMempoolAccept bool) (*DecodedTx, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Decoding of transactions is not supported", true)
+	}
+	txHex = strings.TrimSpace(txHex)
+	b, err := hex.DecodeString(txHex)
+	if err != nil || len(b) == 0 {
+		return nil, NewAPIError("Invalid hex", true)
+	}
+	bchainTx, err := w.chainParser.ParseTx(b)
+	if err != nil {
+		return nil, NewAPIError(fmt.Sprintf("Invalid transaction, %v", err), true)
+	}
+	var warnings []TxWarning
+	var valInSat, valOutSat big.Int
+	inputsKnown := true
+	rbf := false
+	vins := make([]Vin, len(bchainTx.Vin))
+	for i := range bchainTx.Vin {
+		bchainVin := &bchainTx.Vin[i]
+		vin := &vins[i]
+		vin.Txid = bchainVin.Txid
+		vin.N = i
+		vin.Vout = bchainVin.Vout
+		vin.Sequence = int64(bchainVin.Sequence)
+		vin.Hex = bchainVin.ScriptSig.Hex
+		vin.Coinbase = bchainVin.Coinbase
+		// detect explicit Replace-by-Fee transactions as defined by BIP125
+		if bchainVin.Sequence < 0xffffffff-1 {
+			rbf = true
+		}
+		if bchainVin.Txid == "" {
+			inputsKnown = false
+			continue
+		}
+		warning, err := w.resolveDecodedTxInput(vin)
+		if err != nil {
+			return nil, err
+		}
+		if warning != nil {
+			warnings = append(warnings, *warning)
+		}
+		if vin.ValueSat != nil {
+			valInSat.Add(&valInSat, (*big.Int)(vin.ValueSat))
+		} else {
+			inputsKnown = false
+		}
+	}
+	vouts := make([]Vout, len(bchainTx.Vout))
+	for i := range bchainTx.Vout {
+		bchainVout := &bchainTx.Vout[i]
+		vout := &vouts[i]
+		vout.N = i
+		vout.ValueSat = (*Amount)(&bchainVout.ValueSat)
+		valOutSat.Add(&valOutSat, &bchainVout.ValueSat)
+		vout.Hex = bchainVout.ScriptPubKey.Hex
+		vout.AddrDesc, vout.Addresses, vout.IsAddress, err = w.getAddressesFromVout(bchainVout)
+		if err != nil {
+			glog.V(2).Infof("getAddressesFromVout error %v, %v, output %v", err, bchainTx.Txid, bchainVout.N)
+		}
+		script, _ := hex.DecodeString(bchainVout.ScriptPubKey.Hex)
+		if dust := dustThreshold(script); bchainVout.ValueSat.Cmp(big.NewInt(dust)) < 0 {
+			warnings = append(warnings, TxWarning{Type: TxWarningDust, N: i, Message: fmt.Sprintf("Output %d value %v is below the dust threshold %d", i, bchainVout.ValueSat.String(), dust)})
+		}
+	}
+	size, vsize := txSizes(b)
+	tx := &Tx{
+		Txid:        bchainTx.Txid,
+		Version:     bchainTx.Version,
+		Locktime:    bchainTx.LockTime,
+		Vin:         vins,
+		Vout:        vouts,
+		Blockheight: -1,
+		Size:        size,
+		ValueOutSat: (*Amount)(&valOutSat),
+		Hex:         txHex,
+		Rbf:         rbf,
+	}
+	r := &DecodedTx{
+		Tx:    tx,
+		Vsize: vsize,
+	}
+	if inputsKnown {
+		var feesSat big.Int
+		feesSat.Sub(&valInSat, &valOutSat)
+		tx.ValueInSat = (*Amount)(&valInSat)
+		if feesSat.Sign() < 0 {
+			warnings = append(warnings, TxWarning{Type: TxWarningNegativeFee, N: -1, Message: fmt.Sprintf("Value of outputs exceeds value of inputs by %v", new(big.Int).Neg(&feesSat).String())})
+		} else {
+			tx.FeesSat = (*Amount)(&feesSat)
+			if vsize > 0 {
+				r.FeeRate, _ = new(big.Float).Quo(new(big.Float).SetInt(&feesSat), big.NewFloat(float64(vsize))).Float64()
+			}
+			if r.FeeRate > absurdFeeRate || valOutSat.Sign() > 0 && feesSat.Cmp(&valOutSat) > 0 {
+				warnings = append(warnings, TxWarning{Type: TxWarningAbsurdFee, N: -1, Message: fmt.Sprintf("Absurdly high fee %v, fee rate %.2f sat/vB", feesSat.String(), r.FeeRate)})
+			}
+		}
+	}
+	r.Warnings = warnings
+	if testMempoolAccept {
+		res, err := w.chain.TestMempoolAccept(txHex)
+		if err != nil {
+			return nil, NewAPIError(fmt.Sprintf("Mempool acceptance test failed, %v", err), true)
+		}
+		r.MempoolAccept = &MempoolAccept{Allowed: res.Allowed, RejectReason: res.RejectReason}
+	}
+	return r, nil
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/bchain/coins/eth"
+)
+
+// ExportParams are the parameters of the export of the transactions of an address or xpub
+type ExportParams struct {
+	// FromTimestamp and ToTimestamp limit the exported transactions by the block time, 0 means unlimited
+	FromTimestamp int64
+	ToTimestamp   int64
+	// Currency is the fiat currency of the fiat values, no fiat values are computed if empty
+	Currency string
+	// CostBasis enables the FIFO cost basis and realized gain computation, it requires Currency
+	CostBasis bool
+	// Gap is the xpub addresses gap
+	Gap int
+}
+
+// RealizedGain is the FIFO cost basis and the realized gain of the coins disposed by a transaction
+type RealizedGain struct {
+	CostBasis float64 `json:"costBasis"`
+	Proceeds  float64 `json:"proceeds"`
+	Gain      float64 `json:"gain"`
+}
+
+// ExportRow is one exported transaction of an address or xpub
+type ExportRow struct {
+	Txid           string        `json:"txid"`
+	BlockHeight    int           `json:"blockHeight"`
+	BlockTime      int64         `json:"blockTime"`
+	NetAmount      *Amount       `json:"netAmount"`
+	Fee            *Amount       `json:"fee"`
+	Counterparties []string      `json:"counterparties"`
+	Balance        *Amount       `json:"balance"`
+	FiatValue      *FiatValue    `json:"fiatValue,omitempty"`
+	RealizedGain   *RealizedGain `json:"realizedGain,omitempty"`
+}
+
+// ExportCallback is called for each exported row, returning an error stops the export
+type ExportCallback func(row *ExportRow) error
+
+type costBasisLot struct {
+	amount big.Int
+	rate   float64
+}
+
+// exportState carries the running balance and the FIFO lots of acquired coins over the exported transactions
+type exportState struct {
+	balance big.Int
+	lots    []*costBasisLot
+}
+
+// amountToFloat converts the amount in the base units to the float value in the coin units
+func (w *Worker) amountToFloat(a *big.Int) float64 {
+	f, err := strconv.ParseFloat(w.chainParser.AmountToDecimalString(a), 64)
+	if err != nil {
+		glog.Errorf("Error converting amount %v. Error: %v", a, err)
+		return 0
+	}
+	return f
+}
+
+// dispose removes the amount from the FIFO lots and returns the cost basis of the removed coins
+func (w *Worker) dispose(s *exportState, amount *big.Int) float64 {
+	var cost float64
+	var remaining big.Int
+	remaining.Set(amount)
+	for remaining.Sign() > 0 && len(s.lots) > 0 {
+		lot := s.lots[0]
+		var take big.Int
+		if lot.amount.Cmp(&remaining) <= 0 {
+			take.Set(&lot.amount)
+			s.lots = s.lots[1:]
+		} else {
+			take.Set(&remaining)
+			lot.amount.Sub(&lot.amount, &remaining)
+		}
+		cost += w.amountToFloat(&take) * lot.rate
+		remaining.Sub(&remaining, &take)
+	}
+	return cost
+}
+
+// exportCounterparties returns the addresses on the other side of the transaction,
+// the recipients if the account paid the transaction, otherwise the senders; non address outputs are skipped
+func (w *Worker) exportCounterparties(tx *Tx, addrDescs map[string]struct{}, sent bool) []string {
+	cp := make([]string, 0)
+	unique := make(map[string]struct{})
+	add := func(addrDesc bchain.AddressDescriptor, addresses []string, isAddress bool) {
+		if _, own := addrDescs[string(addrDesc)]; own || !isAddress {
+			return
+		}
+		for _, a := range addresses {
+			if _, found := unique[a]; !found {
+				unique[a] = struct{}{}
+				cp = append(cp, a)
+			}
+		}
+	}
+	if sent {
+		for i := range tx.Vout {
+			add(tx.Vout[i].AddrDesc, tx.Vout[i].Addresses, tx.Vout[i].IsAddress)
+		}
+	} else {
+		for i := range tx.Vin {
+			add(tx.Vin[i].AddrDesc, tx.Vin[i].Addresses, tx.Vin[i].IsAddress)
+		}
+	}
+	return cp
+}
+
+// exportRow creates the row of the transaction and updates the running balance and the cost basis lots
+func (w *Worker) exportRow(tx *Tx, addrDescs map[string]struct{}, params *ExportParams, c *fiatRatesCache, s *exportState) *ExportRow {
+	net := w.txNetValue(tx, addrDescs)
+	// the account paid the transaction if it spent any input (in Ethereum the sender is the first input)
+	sent := false
+	for i := range tx.Vin {
+		if _, own := addrDescs[string(tx.Vin[i].AddrDesc)]; own {
+			sent = true
+			break
+		}
+		if w.chainType == bchain.ChainEthereumType {
+			break
+		}
+	}
+	var fee big.Int
+	if sent && tx.FeesSat != nil {
+		fee.Set((*big.Int)(tx.FeesSat))
+	}
+	s.balance.Add(&s.balance, net)
+	var balance big.Int
+	balance.Set(&s.balance)
+	row := &ExportRow{
+		Txid:           tx.Txid,
+		BlockHeight:    tx.Blockheight,
+		BlockTime:      tx.Blocktime,
+		NetAmount:      (*Amount)(net),
+		Fee:            (*Amount)(&fee),
+		Counterparties: w.exportCounterparties(tx, addrDescs, sent),
+		Balance:        (*Amount)(&balance),
+	}
+	if c != nil {
+		fv := &FiatValue{Currency: c.currency, Rate: c.getRate(tx.Blocktime)}
+		if fv.Rate >= 0 {
+			fv.Value = w.amountToFloat(net) * fv.Rate
+		}
+		row.FiatValue = fv
+		if params.CostBasis {
+			row.RealizedGain = w.updateLots(s, net, fv.Rate)
+		}
+	}
+	return row
+}
+
+// updateLots adds the acquired coins to the FIFO lots or disposes the spent coins,
+// it returns the realized gain of the disposed coins, nil for an acquisition
+func (w *Worker) updateLots(s *exportState, net *big.Int, rate float64) *RealizedGain {
+	// the coins with unknown rate are acquired and disposed at zero value
+	if rate < 0 {
+		rate = 0
+	}
+	if net.Sign() > 0 {
+		lot := &costBasisLot{rate: rate}
+		lot.amount.Set(net)
+		s.lots = append(s.lots, lot)
+	} else if net.Sign() < 0 {
+		var disposed big.Int
+		disposed.Neg(net)
+		rg := &RealizedGain{
+			CostBasis: w.dispose(s, &disposed),
+			Proceeds:  w.amountToFloat(&disposed) * rate,
+		}
+		rg.Gain = rg.Proceeds - rg.CostBasis
+		return rg
+	}
+	return nil
+}
+
+type exportTxid struct {
+	txid   string
+	height uint32
+	// the address descriptors of the account affected by the transaction
+	addrDescs []bchain.AddressDescriptor
+}
+
+// exportTxids returns the confirmed txids of the xpub or address ordered by the height ascending
+// and the address descriptors belonging to the account
+func (w *Worker) exportTxids(account string, gap int) ([]exportTxid, map[string]struct{}, error) {
+	var txids []exportTxid
+	addrDescs := make(map[string]struct{})
+	// the account is an xpub if it can be parsed as an xpub, the errors of loading the xpub are returned
+	if _, err := w.chainParser.DerivationBasePath(account); err == nil && w.chainType == bchain.ChainBitcoinType {
+		data, _, _, err := w.getXpubData(account, 0, maxInt, AccountDetailsTxidHistory, &AddressFilter{
+			Vout:          AddressFilterVoutOff,
+			OnlyConfirmed: true,
+		}, gap)
+		if err != nil {
+			return nil, nil, err
+		}
+		unique := make(map[string]int)
+		for _, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
+			for i := range da {
+				ad := &da[i]
+				addrDescs[string(ad.addrDesc)] = struct{}{}
+				for _, t := range ad.txids {
+					j, found := unique[t.txid]
+					if !found {
+						j = len(txids)
+						unique[t.txid] = j
+						txids = append(txids, exportTxid{txid: t.txid, height: t.height})
+					}
+					txids[j].addrDescs = append(txids[j].addrDescs, ad.addrDesc)
+				}
+			}
+		}
+		sort.SliceStable(txids, func(i, j int) bool { return txids[i].height < txids[j].height })
+		return txids, addrDescs, nil
+	}
+	addrDesc, _, err := w.getAddrDescAndNormalizeAddress(account)
+	if err != nil {
+		return nil, nil, err
+	}
+	addrDescs[string(addrDesc)] = struct{}{}
+	own := []bchain.AddressDescriptor{addrDesc}
+	err = w.db.GetAddrDescTransactions(addrDesc, 0, maxUint32, func(txid string, height uint32, indexes []int32) error {
+		txids = append(txids, exportTxid{txid: txid, height: height, addrDescs: own})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// the transactions are returned from the newest
+	for i, j := 0, len(txids)-1; i < j; i, j = i+1, j-1 {
+		txids[i], txids[j] = txids[j], txids[i]
+	}
+	return txids, addrDescs, nil
+}
+
+// exportBalanceChange returns the change of the balance of the account by the transaction computed from the balance history,
+// it is used for the transactions before the exported time range, which do not have to be loaded as a whole
+func (w *Worker) exportBalanceChange(t *exportTxid, addrDescs map[string]struct{}) (*big.Int, error) {
+	var value big.Int
+	for _, addrDesc := range t.addrDescs {
+		bh, err := w.balanceHistoryForTxid(addrDesc, t.txid, 0, maxUint32, addrDescs)
+		if err != nil {
+			return nil, err
+		}
+		if bh != nil {
+			value.Add(&value, (*big.Int)(bh.ReceivedSat))
+			value.Sub(&value, (*big.Int)(bh.SentSat))
+		}
+	}
+	// the balance history does not contain the internal transfers, they are part of the net amount of the exported rows
+	if w.chainType == bchain.ChainEthereumType {
+		bchainTx, _, err := w.txCache.GetTransaction(t.txid)
+		if err != nil {
+			return nil, err
+		}
+		if bchainTx == nil {
+			return &value, nil
+		}
+		if status := eth.GetEthereumTxData(bchainTx).Status; status != eth.TxStatusOK && status != eth.TxStatusUnknown {
+			return &value, nil
+		}
+		its, err := w.chainParser.EthereumTypeGetInternalTransfersFromTx(bchainTx)
+		if err != nil {
+			glog.Errorf("GetInternalTransfersFromTx error %v, %v", err, t.txid)
+		}
+		for i := range its {
+			it := &its[i]
+			if to, err := w.chainParser.GetAddrDescFromAddress(it.To); err == nil {
+				if _, own := addrDescs[string(to)]; own {
+					value.Add(&value, &it.Value)
+				}
+			}
+			if from, err := w.chainParser.GetAddrDescFromAddress(it.From); err == nil {
+				if _, own := addrDescs[string(from)]; own {
+					value.Sub(&value, &it.Value)
+				}
+			}
+		}
+	}
+	return &value, nil
+}
+
+// ExportTxs passes to the callback the confirmed transactions of the xpub or address in the time range ordered from the oldest.
+// The running balance and the cost basis lots are seeded from the balance history of the transactions before the time range
+// and the fiat rates of their blocks, these transactions are not loaded as a whole.
+// Only the txids are kept in memory, the transactions are loaded one by one to support large accounts.
+// All parameter errors are returned before the first call of the callback.
+func (w *Worker) ExportTxs(account string, params *ExportParams, callback ExportCallback) error {
+	start := time.Now()
+	if params.CostBasis && params.Currency == "" {
+		return NewAPIError("Cost basis requires currency", true)
+	}
+	if params.FromTimestamp < 0 || params.ToTimestamp < 0 || params.ToTimestamp != 0 && params.ToTimestamp < params.FromTimestamp {
+		return NewAPIError("Invalid time range", true)
+	}
+	txids, addrDescs, err := w.exportTxids(account, params.Gap)
+	if err != nil {
+		return err
+	}
+	bestheight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return errors.Annotatef(err, "GetBestBlock")
+	}
+	var c *fiatRatesCache
+	if params.Currency != "" {
+		c = w.newFiatRatesCache(params.Currency)
+	}
+	_, _, _, toHeight := w.balanceHistoryHeightsFromTo(0, params.ToTimestamp)
+	var s exportState
+	exported := 0
+	for i := range txids {
+		if txids[i].height > toHeight {
+			break
+		}
+		if blocktime := int64(w.is.GetBlockTime(txids[i].height)); blocktime < params.FromTimestamp {
+			net, err := w.exportBalanceChange(&txids[i], addrDescs)
+			if err != nil {
+				return err
+			}
+			s.balance.Add(&s.balance, net)
+			if params.CostBasis {
+				w.updateLots(&s, net, c.getRate(blocktime))
+			}
+			continue
+		}
+		tx, err := w.txFromTxid(txids[i].txid, bestheight, AccountDetailsTxHistoryLight, nil)
+		if err != nil {
+			return err
+		}
+		row := w.exportRow(tx, addrDescs, params, c, &s)
+		if tx.Blocktime < params.FromTimestamp || params.ToTimestamp != 0 && tx.Blocktime > params.ToTimestamp {
+			continue
+		}
+		if err = callback(row); err != nil {
+			return err
+		}
+		exported++
+	}
+	glog.Info("ExportTxs ", account, ", ", len(txids), " txs, exported ", exported, ", ", time.Since(start))
+	return nil
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/wire"
+	"github.com/martinboehm/btcutil/txscript"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/bchain/coins/btc"
+)
+
+// decodePsbt decodes the PSBT in base64 or in hex
+func decodePsbt(data string) (*btc.Psbt, error) {
+	data = strings.TrimSpace(data)
+	b, err := hex.DecodeString(data)
+	if err != nil {
+		b, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, NewAPIError("Invalid PSBT encoding, expected base64 or hex", true)
+		}
+	}
+	p, err := btc.ParsePsbt(b)
+	if err != nil {
+		return nil, NewAPIError(fmt.Sprintf("Invalid PSBT, %v", err), true)
+	}
+	return p, nil
+}
+
+// resolvePsbtInput sets the value, the address and the spent flag of the output spent by the input i, using the index
+// or the backend for the unconfirmed outputs, and fills the missing utxos of the PSBT input.
+// It returns the value and the script of the spent output, the value is nil if the output is not known.
+func (w *Worker) resolvePsbtInput(p *btc.Psbt, i int, pi *PsbtInput) (*big.Int, []byte, error) {
+	in := &p.Inputs[i]
+	prevOut := &p.UnsignedTx.TxIn[i].PreviousOutPoint
+	var value *big.Int
+	var script []byte
+	ta, err := w.db.GetTxAddresses(pi.Txid)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "GetTxAddresses %v", pi.Txid)
+	}
+	if ta != nil && int(pi.Vout) < len(ta.Outputs) {
+		output := &ta.Outputs[pi.Vout]
+		value = &output.ValueSat
+		// in Bitcoin type coins the address descriptor is the output script
+		script = output.AddrDesc
+		pi.Spent = output.Spent
+	}
+	if in.NonWitnessUtxo == nil || value == nil {
+		bchainTx, _, err := w.txCache.GetTransaction(pi.Txid)
+		if err != nil && err != bchain.ErrTxNotFound {
+			return nil, nil, errors.Annotatef(err, "txCache.GetTransaction %v", pi.Txid)
+		}
+		if err == nil {
+			if value == nil && int(pi.Vout) < len(bchainTx.Vout) {
+				vout := &bchainTx.Vout[pi.Vout]
+				value = &vout.ValueSat
+				script, err = hex.DecodeString(vout.ScriptPubKey.Hex)
+				if err != nil {
+					glog.Errorf("Invalid script hex %v, tx %v, output %v", vout.ScriptPubKey.Hex, pi.Txid, pi.Vout)
+				}
+			}
+			if in.NonWitnessUtxo == nil && bchainTx.Hex != "" {
+				b, err := hex.DecodeString(bchainTx.Hex)
+				if err == nil {
+					tx := wire.NewMsgTx(wire.TxVersion)
+					if err = tx.Deserialize(bytes.NewReader(b)); err == nil && tx.TxHash() == prevOut.Hash {
+						in.NonWitnessUtxo = tx
+					}
+				}
+				if in.NonWitnessUtxo == nil {
+					glog.Errorf("Cannot use hex of tx %v as non witness utxo", pi.Txid)
+				}
+			}
+		}
+	}
+	if in.NonWitnessUtxo != nil && in.NonWitnessUtxo.TxHash() != prevOut.Hash {
+		return nil, nil, NewAPIError(fmt.Sprintf("Non witness utxo of input %d does not match the spent transaction %v", i, pi.Txid), true)
+	}
+	if value == nil {
+		pi.Missing = true
+		// use the value and the script from the PSBT
+		if in.WitnessUtxo != nil {
+			value = big.NewInt(in.WitnessUtxo.Value)
+			script = in.WitnessUtxo.PkScript
+		} else if in.NonWitnessUtxo != nil && int(prevOut.Index) < len(in.NonWitnessUtxo.TxOut) {
+			value = big.NewInt(in.NonWitnessUtxo.TxOut[prevOut.Index].Value)
+			script = in.NonWitnessUtxo.TxOut[prevOut.Index].PkScript
+		}
+	} else if in.WitnessUtxo == nil {
+		// the witness utxo is used for the segwit outputs, also wrapped in P2SH
+		if isWitnessProgram(script) || txscript.IsPayToScriptHash(script) && isWitnessProgram(in.RedeemScript) {
+			in.WitnessUtxo = wire.NewTxOut(value.Int64(), script)
+		}
+	}
+	return value, script, nil
+}
+
+// psbtInputStatus returns the signing status of the PSBT input i
+func psbtInputStatus(p *btc.Psbt, i int, pi *PsbtInput) string {
+	in := &p.Inputs[i]
+	if in.IsFinalized() {
+		return PsbtInputFinalized
+	}
+	if prevScript := p.PrevOutScript(i); prevScript != nil {
+		pi.RequiredSigs = in.RequiredSigs(prevScript)
+	}
+	pi.PartialSigs = len(in.PartialSigs)
+	switch {
+	case pi.PartialSigs == 0:
+		return PsbtInputUnsigned
+	case pi.RequiredSigs > 0 && pi.PartialSigs >= pi.RequiredSigs:
+		return PsbtInputSigned
+	}
+	return PsbtInputPartiallySigned
+}
+
+// AnalyzePsbt parses the PSBT in base64 or hex, fills the utxos of its inputs from the index and returns the fee,
+// the spent inputs and the signing status of the inputs.
+// If finalize is set, the fully signed PSBT is finalized and the signed transaction is returned,
+// if broadcast is set, the finalized transaction is also sent to the backend.
+func (w *Worker) AnalyzePsbt(psbt string, finalize, broadcast bool) (*PsbtAnalysis, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("PSBT is not supported", true)
+	}
+	p, err := decodePsbt(psbt)
+	if err != nil {
+		return nil, err
+	}
+	var valInSat, valOutSat big.Int
+	inputsKnown := true
+	complete := true
+	r := &PsbtAnalysis{Inputs: make([]PsbtInput, len(p.Inputs))}
+	for i := range p.Inputs {
+		prevOut := &p.UnsignedTx.TxIn[i].PreviousOutPoint
+		pi := &r.Inputs[i]
+		pi.N = i
+		pi.Txid = prevOut.Hash.String()
+		pi.Vout = prevOut.Index
+		value, script, err := w.resolvePsbtInput(p, i, pi)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			pi.ValueSat = (*Amount)(value)
+			valInSat.Add(&valInSat, value)
+			pi.Addresses, pi.IsAddress, err = w.chainParser.GetAddressesFromAddrDesc(script)
+			if err != nil {
+				glog.Errorf("GetAddressesFromAddrDesc error %v, tx %v, output %v", err, pi.Txid, pi.Vout)
+			}
+		} else {
+			inputsKnown = false
+		}
+		if pi.Spent {
+			r.SpentInputs = append(r.SpentInputs, i)
+		}
+		pi.NonWitnessUtxo = p.Inputs[i].NonWitnessUtxo != nil
+		pi.WitnessUtxo = p.Inputs[i].WitnessUtxo != nil
+		pi.Status = psbtInputStatus(p, i, pi)
+		if pi.Status != PsbtInputSigned && pi.Status != PsbtInputFinalized {
+			complete = false
+		}
+	}
+	for _, o := range p.UnsignedTx.TxOut {
+		valOutSat.Add(&valOutSat, big.NewInt(o.Value))
+	}
+	r.ValueOutSat = (*Amount)(&valOutSat)
+	if inputsKnown {
+		var feesSat big.Int
+		feesSat.Sub(&valInSat, &valOutSat)
+		r.ValueInSat = (*Amount)(&valInSat)
+		r.FeesSat = (*Amount)(&feesSat)
+	}
+	r.Complete = complete
+	if finalize || broadcast {
+		if !complete {
+			return nil, NewAPIError("PSBT is not fully signed", true)
+		}
+		for i := range p.Inputs {
+			if err = p.FinalizeInput(i); err != nil {
+				return nil, NewAPIError(fmt.Sprintf("Cannot finalize input %d, %v", i, err), true)
+			}
+			r.Inputs[i].Status = PsbtInputFinalized
+		}
+		tx, err := p.Extract()
+		if err != nil {
+			return nil, NewAPIError(err.Error(), true)
+		}
+		var buf bytes.Buffer
+		if err = tx.Serialize(&buf); err != nil {
+			return nil, errors.Annotatef(err, "Serialize")
+		}
+		r.Hex = hex.EncodeToString(buf.Bytes())
+		r.Txid = tx.TxHash().String()
+	}
+	b, err := p.Serialize()
+	if err != nil {
+		return nil, errors.Annotatef(err, "Serialize PSBT")
+	}
+	r.Psbt = base64.StdEncoding.EncodeToString(b)
+	if broadcast {
+		txid, err := w.SendRawTransaction(r.Hex)
+		if err != nil {
+			return nil, NewAPIError(err.Error(), true)
+		}
+		r.Txid = txid
+		r.Sent = true
+	}
+	return r, nil
+}
@@ -139,22 +139,38 @@ type TokenType string
 // ERC20TokenType is Ethereum ERC20 token
 const ERC20TokenType TokenType = "ERC20"
 
+// ERC721TokenType is Ethereum ERC721 non fungible token
+const ERC721TokenType TokenType = "ERC721"
+
+// ERC1155TokenType is Ethereum ERC1155 multi token
+const ERC1155TokenType TokenType = "ERC1155"
+
 // XPUBAddressTokenType is address derived from xpub
 const XPUBAddressTokenType TokenType = "XPUBAddress"
 
 // Token contains info about tokens held by an address
 type Token struct {
-	Type             TokenType `json:"type"`
-	Name             string    `json:"name"`
-	Path             string    `json:"path,omitempty"`
-	Contract         string    `json:"contract,omitempty"`
-	Transfers        int       `json:"transfers"`
-	Symbol           string    `json:"symbol,omitempty"`
-	Decimals         int       `json:"decimals,omitempty"`
-	BalanceSat       *Amount   `json:"balance,omitempty"`
-	TotalReceivedSat *Amount   `json:"totalReceived,omitempty"`
-	TotalSentSat     *Amount   `json:"totalSent,omitempty"`
-	ContractIndex    string    `json:"-"`
+	Type             TokenType         `json:"type"`
+	Name             string            `json:"name"`
+	Path             string            `json:"path,omitempty"`
+	Contract         string            `json:"contract,omitempty"`
+	Transfers        int               `json:"transfers"`
+	Symbol           string            `json:"symbol,omitempty"`
+	Decimals         int               `json:"decimals,omitempty"`
+	BalanceSat       *Amount           `json:"balance,omitempty"`
+	TotalReceivedSat *Amount           `json:"totalReceived,omitempty"`
+	TotalSentSat     *Amount           `json:"totalSent,omitempty"`
+	Ids              []*Amount         `json:"ids,omitempty"`
+	MultiTokenValues []MultiTokenValue `json:"multiTokenValues,omitempty"`
+	Scam             bool              `json:"scam,omitempty"`
+	FiatValue        *FiatValue        `json:"fiatValue,omitempty"`
+	ContractIndex    string            `json:"-"`
+}
+
+// MultiTokenValue contains the amount of ERC1155 token with the id
+type MultiTokenValue struct {
+	Id    *Amount `json:"id,omitempty"`
+	Value *Amount `json:"value,omitempty"`
 }
 
 // TokenTransfer contains info about a token transfer done in a transaction
@@ -166,39 +182,164 @@ type TokenTransfer struct {
 	Name     string    `json:"name"`
 	Symbol   string    `json:"symbol"`
 	Decimals int       `json:"decimals"`
-	Value    *Amount   `json:"value"`
+	Value    *Amount   `json:"value,omitempty"`
+	TokenId  *Amount   `json:"tokenId,omitempty"`
+	Scam     bool      `json:"scam,omitempty"`
+}
+
+// InternalTransferType specifies the type of internal transfer
+type InternalTransferType string
+
+// internal transfer types
+const (
+	CallInternalTransferType         InternalTransferType = "call"
+	CreateInternalTransferType       InternalTransferType = "create"
+	SelfDestructInternalTransferType InternalTransferType = "selfdestruct"
+)
+
+// InternalTransfer contains info about a value transfer done by a contract in a transaction
+type InternalTransfer struct {
+	Type  InternalTransferType `json:"type"`
+	From  string               `json:"from"`
+	To    string               `json:"to"`
+	Value *Amount              `json:"value"`
 }
 
 // EthereumSpecific contains ethereum specific transaction data
 type EthereumSpecific struct {
-	Status   eth.TxStatus `json:"status"` // 1 OK, 0 Fail, -1 pending
-	Nonce    uint64       `json:"nonce"`
-	GasLimit *big.Int     `json:"gasLimit"`
-	GasUsed  *big.Int     `json:"gasUsed"`
-	GasPrice *Amount      `json:"gasPrice"`
-	Data     string       `json:"data,omitempty"`
+	Type                 uint64       `json:"type,omitempty"`
+	Status               eth.TxStatus `json:"status"` // 1 OK, 0 Fail, -1 pending
+	Nonce                uint64       `json:"nonce"`
+	GasLimit             *big.Int     `json:"gasLimit"`
+	GasUsed              *big.Int     `json:"gasUsed"`
+	GasPrice             *Amount      `json:"gasPrice"`
+	MaxFeePerGas         *Amount      `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *Amount      `json:"maxPriorityFeePerGas,omitempty"`
+	EffectiveGasPrice    *Amount      `json:"effectiveGasPrice,omitempty"`
+	Data                 string       `json:"data,omitempty"`
 }
 
 // Tx holds information about a transaction
 type Tx struct {
-	Txid             string            `json:"txid"`
-	Version          int32             `json:"version,omitempty"`
-	Locktime         uint32            `json:"lockTime,omitempty"`
-	Vin              []Vin             `json:"vin"`
-	Vout             []Vout            `json:"vout"`
-	Blockhash        string            `json:"blockHash,omitempty"`
-	Blockheight      int               `json:"blockHeight"`
-	Confirmations    uint32            `json:"confirmations"`
-	Blocktime        int64             `json:"blockTime"`
-	Size             int               `json:"size,omitempty"`
-	ValueOutSat      *Amount           `json:"value"`
-	ValueInSat       *Amount           `json:"valueIn,omitempty"`
-	FeesSat          *Amount           `json:"fees,omitempty"`
-	Hex              string            `json:"hex,omitempty"`
-	Rbf              bool              `json:"rbf,omitempty"`
-	CoinSpecificData json.RawMessage   `json:"coinSpecificData,omitempty"`
-	TokenTransfers   []TokenTransfer   `json:"tokenTransfers,omitempty"`
-	EthereumSpecific *EthereumSpecific `json:"ethereumSpecific,omitempty"`
+	Txid              string             `json:"txid"`
+	Version           int32              `json:"version,omitempty"`
+	Locktime          uint32             `json:"lockTime,omitempty"`
+	Vin               []Vin              `json:"vin"`
+	Vout              []Vout             `json:"vout"`
+	Blockhash         string             `json:"blockHash,omitempty"`
+	Blockheight       int                `json:"blockHeight"`
+	Confirmations     uint32             `json:"confirmations"`
+	Blocktime         int64              `json:"blockTime"`
+	Size              int                `json:"size,omitempty"`
+	ValueOutSat       *Amount            `json:"value"`
+	ValueInSat        *Amount            `json:"valueIn,omitempty"`
+	FeesSat           *Amount            `json:"fees,omitempty"`
+	Hex               string             `json:"hex,omitempty"`
+	Rbf               bool               `json:"rbf,omitempty"`
+	CoinSpecificData  json.RawMessage    `json:"coinSpecificData,omitempty"`
+	TokenTransfers    []TokenTransfer    `json:"tokenTransfers,omitempty"`
+	InternalTransfers []InternalTransfer `json:"internalTransfers,omitempty"`
+	EthereumSpecific  *EthereumSpecific  `json:"ethereumSpecific,omitempty"`
+	FiatValue         *FiatValue         `json:"fiatValue,omitempty"`
+}
+
+// FiatValue contains the fiat rate and the fiat value of a transaction or of a token balance
+// for a transaction, the rate is at the time of the transaction and the value is the net effect of the transaction
+// on the queried address or xpub, negative if funds were sent, or the value of the transaction if queried without an address
+// for a token, the rate is the last available rate of the token; rate -1 means that the rate is not available
+type FiatValue struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+	Value    float64 `json:"value"`
+}
+
+// Types of the warnings about the decoded transactions
+const (
+	TxWarningMissingInput = "missingInput"
+	TxWarningSpentInput   = "spentInput"
+	TxWarningDust         = "dust"
+	TxWarningNegativeFee  = "negativeFee"
+	TxWarningAbsurdFee    = "absurdFee"
+)
+
+// TxWarning is a problem found in a decoded transaction that would probably prevent its acceptance or is likely a mistake
+// N is the index of the input or output, -1 for the warnings about the whole transaction
+type TxWarning struct {
+	Type    string `json:"type"`
+	N       int    `json:"n"`
+	Message string `json:"message"`
+}
+
+// MempoolAccept is the result of the test of the backend if a transaction would be accepted to its mempool
+type MempoolAccept struct {
+	Allowed      bool   `json:"allowed"`
+	RejectReason string `json:"rejectReason,omitempty"`
+}
+
+// DecodedTx is the preview of a raw transaction with the inputs resolved using the index
+// the fee is not set if any of the inputs is unknown, the fee rate is in satoshis per vbyte
+type DecodedTx struct {
+	*Tx
+	Vsize         int            `json:"vsize"`
+	FeeRate       float64        `json:"feeRate,omitempty"`
+	Warnings      []TxWarning    `json:"warnings,omitempty"`
+	MempoolAccept *MempoolAccept `json:"mempoolAccept,omitempty"`
+}
+
+// Signing statuses of the PSBT inputs
+const (
+	PsbtInputUnsigned        = "unsigned"
+	PsbtInputPartiallySigned = "partiallySigned"
+	PsbtInputSigned          = "signed"
+	PsbtInputFinalized       = "finalized"
+)
+
+// PsbtInput is the analyzed input of a PSBT with the spent output resolved using the index
+// RequiredSigs is 0 if the number of signatures cannot be determined from the available scripts
+type PsbtInput struct {
+	N              int      `json:"n"`
+	Txid           string   `json:"txid"`
+	Vout           uint32   `json:"vout"`
+	ValueSat       *Amount  `json:"value,omitempty"`
+	Addresses      []string `json:"addresses,omitempty"`
+	IsAddress      bool     `json:"isAddress"`
+	Spent          bool     `json:"spent,omitempty"`
+	Missing        bool     `json:"missing,omitempty"`
+	NonWitnessUtxo bool     `json:"nonWitnessUtxo"`
+	WitnessUtxo    bool     `json:"witnessUtxo"`
+	PartialSigs    int      `json:"partialSigs"`
+	RequiredSigs   int      `json:"requiredSigs"`
+	Status         string   `json:"status"`
+}
+
+// PsbtAnalysis is the result of the analysis of a PSBT
+// Psbt is the PSBT in base64 enriched by the utxos of the inputs, Hex and Txid are set only if the PSBT was finalized
+type PsbtAnalysis struct {
+	Psbt        string      `json:"psbt"`
+	Inputs      []PsbtInput `json:"inputs"`
+	ValueInSat  *Amount     `json:"valueIn,omitempty"`
+	ValueOutSat *Amount     `json:"value"`
+	FeesSat     *Amount     `json:"fees,omitempty"`
+	SpentInputs []int       `json:"spentInputs,omitempty"`
+	Complete    bool        `json:"complete"`
+	Hex         string      `json:"hex,omitempty"`
+	Txid        string      `json:"txid,omitempty"`
+	Sent        bool        `json:"sent,omitempty"`
+}
+
+// CoinSelection is the result of the coin selection for an xpub
+// Strategy is the strategy really used, the change is not set if it would be dust, then it is added to the fee
+type CoinSelection struct {
+	Strategy      string  `json:"strategy"`
+	Inputs        Utxos   `json:"inputs"`
+	ValueInSat    *Amount `json:"valueIn"`
+	AmountSat     *Amount `json:"amount"`
+	FeesSat       *Amount `json:"fees"`
+	FeeRate       float64 `json:"feeRate"`
+	Vsize         int     `json:"vsize"`
+	ChangeSat     *Amount `json:"change,omitempty"`
+	ChangeAddress string  `json:"changeAddress,omitempty"`
+	ChangePath    string  `json:"changePath,omitempty"`
 }
 
 // FeeStats contains detailed block fee statistics
@@ -246,6 +387,8 @@ type AddressFilter struct {
 	TokensToReturn TokensToReturn
 	// OnlyConfirmed set to true will ignore mempool transactions; mempool is also ignored if FromHeight/ToHeight filter is specified
 	OnlyConfirmed bool
+	// Currency set to a fiat currency adds the fiat value to the returned transactions
+	Currency string
 }
 
 // Address holds information about address and its transactions
@@ -262,14 +405,27 @@ type Address struct {
 	Transactions          []*Tx                 `json:"transactions,omitempty"`
 	Txids                 []string              `json:"txids,omitempty"`
 	Nonce                 string                `json:"nonce,omitempty"`
+	PendingNonce          string                `json:"pendingNonce,omitempty"`
+	QueuedTxids           []string              `json:"queuedTxids,omitempty"`
 	UsedTokens            int                   `json:"usedTokens,omitempty"`
 	Tokens                []Token               `json:"tokens,omitempty"`
 	Erc20Contract         *bchain.Erc20Contract `json:"erc20Contract,omitempty"`
+	IsContract            bool                  `json:"isContract,omitempty"`
+	ContractCreation      *ContractCreation     `json:"contractCreation,omitempty"`
+	Name                  string                `json:"name,omitempty"`
 	// helpers for explorer
 	Filter        string              `json:"-"`
 	XPubAddresses map[string]struct{} `json:"-"`
 }
 
+// ContractCreation contains information about the creation of a contract
+type ContractCreation struct {
+	Creator     string `json:"creator"`
+	Txid        string `json:"txid"`
+	BlockHeight uint32 `json:"blockHeight"`
+	CodeHash    string `json:"codeHash,omitempty"`
+}
+
 // Utxo is one unspent transaction output
 type Utxo struct {
 	Txid          string  `json:"txid"`
@@ -303,13 +459,15 @@ func (a Utxos) Less(i, j int) bool {
 
 // BalanceHistory contains info about one point in time of balance history
 type BalanceHistory struct {
-	Time          uint32             `json:"time"`
-	Txs           uint32             `json:"txs"`
-	ReceivedSat   *Amount            `json:"received"`
-	SentSat       *Amount            `json:"sent"`
-	SentToSelfSat *Amount            `json:"sentToSelf"`
-	FiatRates     map[string]float64 `json:"rates,omitempty"`
-	Txid          string             `json:"txid,omitempty"`
+	Time          uint32  `json:"time"`
+	Txs           uint32  `json:"txs"`
+	ReceivedSat   *Amount `json:"received"`
+	SentSat       *Amount `json:"sent"`
+	SentToSelfSat *Amount `json:"sentToSelf"`
+	// TokenBalanceSat is the balance of the token after the transactions of the item, set only for the history of a token
+	TokenBalanceSat *Amount            `json:"tokenBalance,omitempty"`
+	FiatRates       map[string]float64 `json:"rates,omitempty"`
+	Txid            string             `json:"txid,omitempty"`
 }
 
 // BalanceHistories is array of BalanceHistory
@@ -368,6 +526,20 @@ func (a BalanceHistories) SortAndAggregate(groupByTime uint32) BalanceHistories
 	return bhs
 }
 
+// SetTokenBalances sets the token balance of the sorted BalanceHistories, starting from the balance before the first item
+func (a BalanceHistories) SetTokenBalances(balance *big.Int) {
+	var b big.Int
+	b.Set(balance)
+	for i := range a {
+		bh := &a[i]
+		b.Add(&b, (*big.Int)(bh.ReceivedSat))
+		b.Sub(&b, (*big.Int)(bh.SentSat))
+		var tb big.Int
+		tb.Set(&b)
+		bh.TokenBalanceSat = (*Amount)(&tb)
+	}
+}
+
 // Blocks is list of blocks with paging information
 type Blocks struct {
 	Paging
@@ -399,6 +571,24 @@ type Block struct {
 	Transactions []*Tx `json:"txs,omitempty"`
 }
 
+// EventLog contains an ethereum event log emitted by a contract
+type EventLog struct {
+	Txid        string   `json:"txid"`
+	BlockHeight uint32   `json:"blockHeight"`
+	LogIndex    int      `json:"logIndex"`
+	Contract    string   `json:"contract"`
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"`
+}
+
+// EventLogs contains a page of event logs of a contract with the given first topic
+type EventLogs struct {
+	Paging
+	Contract string     `json:"contract"`
+	Topic0   string     `json:"topic0"`
+	Logs     []EventLog `json:"logs"`
+}
+
 // BlockbookInfo contains information about the running blockbook instance
 type BlockbookInfo struct {
 	Coin              string                       `json:"coin"`
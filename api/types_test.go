@@ -172,3 +172,27 @@ func TestBalanceHistories_SortAndAggregate(t *testing.T) {
 		})
 	}
 }
+
+func TestBalanceHistories_SetTokenBalances(t *testing.T) {
+	a := BalanceHistories{
+		{
+			Time:        1521514800,
+			Txs:         1,
+			ReceivedSat: (*Amount)(big.NewInt(1000)),
+			SentSat:     (*Amount)(big.NewInt(0)),
+		},
+		{
+			Time:        1521518400,
+			Txs:         2,
+			ReceivedSat: (*Amount)(big.NewInt(200)),
+			SentSat:     (*Amount)(big.NewInt(700)),
+		},
+	}
+	a.SetTokenBalances(big.NewInt(50))
+	want := []int64{1050, 550}
+	for i := range a {
+		if got := (*big.Int)(a[i].TokenBalanceSat).Int64(); got != want[i] {
+			t.Errorf("BalanceHistories.SetTokenBalances() [%d] = %v, want %v", i, got, want[i])
+		}
+	}
+}
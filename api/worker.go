@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -31,6 +32,8 @@ type Worker struct {
 	mempool     bchain.Mempool
 	is          *common.InternalState
 	metrics     *common.Metrics
+	// optional, if set, the sent transactions are rebroadcast until they are confirmed
+	broadcastQueue *db.BroadcastQueue
 }
 
 // NewWorker creates new api worker
@@ -132,6 +135,7 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 	var err error
 	var ta *db.TxAddresses
 	var tokens []TokenTransfer
+	var internalTransfers []InternalTransfer
 	var ethSpecific *EthereumSpecific
 	var blockhash string
 	if bchainTx.Confirmations > 0 {
@@ -255,27 +259,25 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 		}
 		pValInSat = &valInSat
 	} else if w.chainType == bchain.ChainEthereumType {
-		ets, err := w.chainParser.EthereumTypeGetErc20FromTx(bchainTx)
+		ets, err := w.chainParser.EthereumTypeGetTokenTransfersFromTx(bchainTx)
 		if err != nil {
-			glog.Errorf("GetErc20FromTx error %v, %v", err, bchainTx)
+			glog.Errorf("GetTokenTransfersFromTx error %v, %v", err, bchainTx)
 		}
-		tokens = w.getTokensFromErc20(ets)
+		tokens = w.getTokensFromTokenTransfers(ets)
+		its, err := w.chainParser.EthereumTypeGetInternalTransfersFromTx(bchainTx)
+		if err != nil {
+			glog.Errorf("GetInternalTransfersFromTx error %v, %v", err, bchainTx)
+		}
+		internalTransfers = getInternalTransfers(its)
 		ethTxData := eth.GetEthereumTxData(bchainTx)
 		// mempool txs do not have fees yet
 		if ethTxData.GasUsed != nil {
-			feesSat.Mul(ethTxData.GasPrice, ethTxData.GasUsed)
+			feesSat.Mul(ethTxData.FeeGasPrice(), ethTxData.GasUsed)
 		}
 		if len(bchainTx.Vout) > 0 {
 			valOutSat = bchainTx.Vout[0].ValueSat
 		}
-		ethSpecific = &EthereumSpecific{
-			GasLimit: ethTxData.GasLimit,
-			GasPrice: (*Amount)(ethTxData.GasPrice),
-			GasUsed:  ethTxData.GasUsed,
-			Nonce:    ethTxData.Nonce,
-			Status:   ethTxData.Status,
-			Data:     ethTxData.Data,
-		}
+		ethSpecific = getEthereumSpecific(ethTxData)
 	}
 	// for now do not return size, we would have to compute vsize of segwit transactions
 	// size:=len(bchainTx.Hex) / 2
@@ -292,23 +294,24 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 		bchainTx.Blocktime = int64(w.mempool.GetTransactionTime(bchainTx.Txid))
 	}
 	r := &Tx{
-		Blockhash:        blockhash,
-		Blockheight:      height,
-		Blocktime:        bchainTx.Blocktime,
-		Confirmations:    bchainTx.Confirmations,
-		FeesSat:          (*Amount)(&feesSat),
-		Locktime:         bchainTx.LockTime,
-		Txid:             bchainTx.Txid,
-		ValueInSat:       (*Amount)(pValInSat),
-		ValueOutSat:      (*Amount)(&valOutSat),
-		Version:          bchainTx.Version,
-		Hex:              bchainTx.Hex,
-		Rbf:              rbf,
-		Vin:              vins,
-		Vout:             vouts,
-		CoinSpecificData: sj,
-		TokenTransfers:   tokens,
-		EthereumSpecific: ethSpecific,
+		Blockhash:         blockhash,
+		Blockheight:       height,
+		Blocktime:         bchainTx.Blocktime,
+		Confirmations:     bchainTx.Confirmations,
+		FeesSat:           (*Amount)(&feesSat),
+		Locktime:          bchainTx.LockTime,
+		Txid:              bchainTx.Txid,
+		ValueInSat:        (*Amount)(pValInSat),
+		ValueOutSat:       (*Amount)(&valOutSat),
+		Version:           bchainTx.Version,
+		Hex:               bchainTx.Hex,
+		Rbf:               rbf,
+		Vin:               vins,
+		Vout:              vouts,
+		CoinSpecificData:  sj,
+		TokenTransfers:    tokens,
+		InternalTransfers: internalTransfers,
+		EthereumSpecific:  ethSpecific,
 	}
 	return r, nil
 }
@@ -381,16 +384,9 @@ func (w *Worker) GetTransactionFromMempoolTx(mempoolTx *bchain.MempoolTx) (*Tx,
 		if len(mempoolTx.Vout) > 0 {
 			valOutSat = mempoolTx.Vout[0].ValueSat
 		}
-		tokens = w.getTokensFromErc20(mempoolTx.Erc20)
+		tokens = w.getTokensFromTokenTransfers(mempoolTx.TokenTransfers)
 		ethTxData := eth.GetEthereumTxDataFromSpecificData(mempoolTx.CoinSpecificData)
-		ethSpecific = &EthereumSpecific{
-			GasLimit: ethTxData.GasLimit,
-			GasPrice: (*Amount)(ethTxData.GasPrice),
-			GasUsed:  ethTxData.GasUsed,
-			Nonce:    ethTxData.Nonce,
-			Status:   ethTxData.Status,
-			Data:     ethTxData.Data,
-		}
+		ethSpecific = getEthereumSpecific(ethTxData)
 	}
 	r := &Tx{
 		Blocktime:        mempoolTx.Blocktime,
@@ -410,36 +406,94 @@ func (w *Worker) GetTransactionFromMempoolTx(mempoolTx *bchain.MempoolTx) (*Tx,
 	return r, nil
 }
 
-func (w *Worker) getTokensFromErc20(erc20 []bchain.Erc20Transfer) []TokenTransfer {
-	tokens := make([]TokenTransfer, len(erc20))
-	for i := range erc20 {
-		e := &erc20[i]
+func getEthereumSpecific(ethTxData *eth.EthereumTxData) *EthereumSpecific {
+	return &EthereumSpecific{
+		Type:                 ethTxData.Type,
+		GasLimit:             ethTxData.GasLimit,
+		GasPrice:             (*Amount)(ethTxData.GasPrice),
+		MaxFeePerGas:         (*Amount)(ethTxData.MaxFeePerGas),
+		MaxPriorityFeePerGas: (*Amount)(ethTxData.MaxPriorityFeePerGas),
+		EffectiveGasPrice:    (*Amount)(ethTxData.EffectiveGasPrice),
+		GasUsed:              ethTxData.GasUsed,
+		Nonce:                ethTxData.Nonce,
+		Status:               ethTxData.Status,
+		Data:                 ethTxData.Data,
+	}
+}
+
+func tokenTypeFromStandard(standard bchain.TokenStandard) TokenType {
+	switch standard {
+	case bchain.TokenStandardERC721:
+		return ERC721TokenType
+	case bchain.TokenStandardERC1155:
+		return ERC1155TokenType
+	}
+	return ERC20TokenType
+}
+
+func (w *Worker) getTokensFromTokenTransfers(transfers []bchain.TokenTransfer) []TokenTransfer {
+	tokens := make([]TokenTransfer, len(transfers))
+	for i := range transfers {
+		e := &transfers[i]
 		cd, err := w.chainParser.GetAddrDescFromAddress(e.Contract)
 		if err != nil {
 			glog.Errorf("GetAddrDescFromAddress error %v, contract %v", err, e.Contract)
 			continue
 		}
-		erc20c, err := w.chain.EthereumTypeGetErc20ContractInfo(cd)
+		erc20c, err := w.getContractInfo(cd)
 		if err != nil {
 			glog.Errorf("GetErc20ContractInfo error %v, contract %v", err, e.Contract)
 		}
 		if erc20c == nil {
 			erc20c = &bchain.Erc20Contract{Name: e.Contract}
 		}
-		tokens[i] = TokenTransfer{
-			Type:     ERC20TokenType,
+		t := TokenTransfer{
+			Type:     tokenTypeFromStandard(e.Standard),
 			Token:    e.Contract,
 			From:     e.From,
 			To:       e.To,
 			Decimals: erc20c.Decimals,
-			Value:    (*Amount)(&e.Tokens),
 			Name:     erc20c.Name,
 			Symbol:   erc20c.Symbol,
+			Scam:     erc20c.Scam,
+		}
+		if e.Standard != bchain.TokenStandardERC721 {
+			t.Value = (*Amount)(&e.Value)
+		}
+		if e.Standard != bchain.TokenStandardERC20 {
+			t.TokenId = (*Amount)(&e.TokenId)
 		}
+		tokens[i] = t
 	}
 	return tokens
 }
 
+func getInternalTransfers(its []bchain.EthereumInternalTransfer) []InternalTransfer {
+	if len(its) == 0 {
+		return nil
+	}
+	r := make([]InternalTransfer, len(its))
+	for i := range its {
+		t := &its[i]
+		var tt InternalTransferType
+		switch t.Type {
+		case bchain.EthereumInternalTransferCreate:
+			tt = CreateInternalTransferType
+		case bchain.EthereumInternalTransferSelfDestruct:
+			tt = SelfDestructInternalTransferType
+		default:
+			tt = CallInternalTransferType
+		}
+		r[i] = InternalTransfer{
+			Type:  tt,
+			From:  t.From,
+			To:    t.To,
+			Value: (*Amount)(&t.Value),
+		}
+	}
+	return r
+}
+
 func (w *Worker) getAddressTxids(addrDesc bchain.AddressDescriptor, mempool bool, filter *AddressFilter, maxResults int) ([]string, error) {
 	var err error
 	txids := make([]string, 0, 4)
@@ -559,6 +613,7 @@ func (w *Worker) txFromTxAddress(txid string, ta *db.TxAddresses, bi *db.BlockIn
 		vin.N = i
 		vin.ValueSat = (*Amount)(&tai.ValueSat)
 		valInSat.Add(&valInSat, &tai.ValueSat)
+		vin.AddrDesc = tai.AddrDesc
 		vin.Addresses, vin.IsAddress, err = tai.Addresses(w.chainParser)
 		if err != nil {
 			glog.Errorf("tai.Addresses error %v, tx %v, input %v, tai %+v", err, txid, i, tai)
@@ -571,6 +626,7 @@ func (w *Worker) txFromTxAddress(txid string, ta *db.TxAddresses, bi *db.BlockIn
 		vout.N = i
 		vout.ValueSat = (*Amount)(&tao.ValueSat)
 		valOutSat.Add(&valOutSat, &tao.ValueSat)
+		vout.AddrDesc = tao.AddrDesc
 		vout.Addresses, vout.IsAddress, err = tao.Addresses(w.chainParser)
 		if err != nil {
 			glog.Errorf("tai.Addresses error %v, tx %v, output %v, tao %+v", err, txid, i, tao)
@@ -618,12 +674,62 @@ func computePaging(count, page, itemsOnPage int) (Paging, int, int, int) {
 	}, from, to, page
 }
 
+// getContractCreation returns the information about the creation of the contract, nil if the address is not a known contract
+func (w *Worker) getContractCreation(addrDesc bchain.AddressDescriptor) (*ContractCreation, error) {
+	cc, err := w.db.GetContractCreation(addrDesc)
+	if err != nil || cc == nil {
+		return nil, err
+	}
+	r := &ContractCreation{
+		Txid:        cc.Txid,
+		BlockHeight: cc.Height,
+	}
+	if creators, _, err := w.chainParser.GetAddressesFromAddrDesc(cc.Creator); err == nil && len(creators) == 1 {
+		r.Creator = creators[0]
+	}
+	if len(cc.CodeHash) > 0 {
+		r.CodeHash = "0x" + hex.EncodeToString(cc.CodeHash)
+	}
+	return r, nil
+}
+
+// getContractInfo returns the metadata of the contract stored in the db
+// if the metadata were not stored yet, they are fetched from the backend and stored, if the address is a token contract
+func (w *Worker) getContractInfo(contract bchain.AddressDescriptor) (*bchain.Erc20Contract, error) {
+	ci, err := w.db.GetContractInfo(contract)
+	if err != nil {
+		return nil, err
+	}
+	if ci != nil && ci.LastUpdate != 0 {
+		return ci.Erc20Contract(contract), nil
+	}
+	c, err := w.chain.EthereumTypeGetErc20ContractInfo(contract)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		// the overridden metadata are returned even if the backend does not know the contract
+		if ci != nil {
+			return ci.Erc20Contract(contract), nil
+		}
+		return nil, nil
+	}
+	if err = w.db.StoreContractMetadata(contract, c); err != nil {
+		glog.Error("StoreContractMetadata ", contract, ": ", err)
+	}
+	if ci != nil {
+		ci.Contract = c
+		return ci.Erc20Contract(contract), nil
+	}
+	return c, nil
+}
+
 func (w *Worker) getEthereumToken(index int, addrDesc, contract bchain.AddressDescriptor, details AccountDetails, txs int) (*Token, error) {
 	var b *big.Int
 	validContract := true
-	ci, err := w.chain.EthereumTypeGetErc20ContractInfo(contract)
+	ci, err := w.getContractInfo(contract)
 	if err != nil {
-		return nil, errors.Annotatef(err, "EthereumTypeGetErc20ContractInfo %v", contract)
+		return nil, errors.Annotatef(err, "getContractInfo %v", contract)
 	}
 	if ci == nil {
 		ci = &bchain.Erc20Contract{}
@@ -634,26 +740,130 @@ func (w *Worker) getEthereumToken(index int, addrDesc, contract bchain.AddressDe
 		}
 		validContract = false
 	}
-	// do not read contract balances etc in case of Basic option
-	if details >= AccountDetailsTokenBalances && validContract {
-		b, err = w.chain.EthereumTypeGetErc20ContractBalance(addrDesc, contract)
-		if err != nil {
-			// return nil, nil, nil, errors.Annotatef(err, "EthereumTypeGetErc20ContractBalance %v %v", addrDesc, c.Contract)
-			glog.Warningf("EthereumTypeGetErc20ContractBalance addr %v, contract %v, %v", addrDesc, contract, err)
-		}
-	} else {
-		b = nil
-	}
-	return &Token{
-		Type:          ERC20TokenType,
-		BalanceSat:    (*Amount)(b),
+	t := &Token{
+		Type:          tokenTypeFromStandard(ci.Standard),
 		Contract:      ci.Contract,
 		Name:          ci.Name,
 		Symbol:        ci.Symbol,
 		Transfers:     txs,
 		Decimals:      ci.Decimals,
+		Scam:          ci.Scam,
 		ContractIndex: strconv.Itoa(index),
-	}, nil
+	}
+	// do not read contract balances etc in case of Basic option
+	if details >= AccountDetailsTokenBalances && validContract {
+		// ERC1155 does not have the balance of the whole contract, the holdings are read from the indexed transfers
+		if ci.Standard != bchain.TokenStandardERC1155 {
+			b, err = w.chain.EthereumTypeGetErc20ContractBalance(addrDesc, contract)
+			if err != nil {
+				// return nil, nil, nil, errors.Annotatef(err, "EthereumTypeGetErc20ContractBalance %v %v", addrDesc, c.Contract)
+				glog.Warningf("EthereumTypeGetErc20ContractBalance addr %v, contract %v, %v", addrDesc, contract, err)
+			}
+			t.BalanceSat = (*Amount)(b)
+		}
+	}
+	return t, nil
+}
+
+// setNftHoldings sets the token ids held by the address to the ERC721 and ERC1155 tokens
+// the indexed transfers of all the tokens are replayed from the oldest in one pass over the transactions of the address
+func (w *Worker) setNftHoldings(tokens []Token, addrDesc bchain.AddressDescriptor) error {
+	type holding struct {
+		id    big.Int
+		value big.Int
+	}
+	type nftToken struct {
+		t        *Token
+		holdings []*holding
+		byId     map[string]*holding
+	}
+	byIndex := make(map[int32]*nftToken)
+	byContract := make(map[string]*nftToken)
+	for i := range tokens {
+		t := &tokens[i]
+		if t.Type == ERC20TokenType {
+			continue
+		}
+		index, err := strconv.Atoi(t.ContractIndex)
+		if err != nil || index <= 0 {
+			continue
+		}
+		nt := &nftToken{t: t, byId: make(map[string]*holding)}
+		byIndex[int32(index)] = nt
+		byContract[strings.ToLower(t.Contract)] = nt
+	}
+	if len(byIndex) == 0 {
+		return nil
+	}
+	addresses, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil || len(addresses) == 0 {
+		return errors.Errorf("Invalid address descriptor %v", addrDesc)
+	}
+	address := addresses[0]
+	var txids []string
+	err = w.db.GetAddrDescTransactions(addrDesc, 0, maxUint32, func(txid string, height uint32, indexes []int32) error {
+		for _, i := range indexes {
+			if i < 0 {
+				i = ^i
+			}
+			if _, found := byIndex[i]; found {
+				txids = append(txids, txid)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the transactions are returned from the newest
+	for i := len(txids) - 1; i >= 0; i-- {
+		tx, _, err := w.txCache.GetTransaction(txids[i])
+		if err != nil {
+			return err
+		}
+		transfers, err := w.chainParser.EthereumTypeGetTokenTransfersFromTx(tx)
+		if err != nil {
+			return err
+		}
+		for j := range transfers {
+			tt := &transfers[j]
+			nt, found := byContract[strings.ToLower(tt.Contract)]
+			if !found || (!strings.EqualFold(tt.From, address) && !strings.EqualFold(tt.To, address)) {
+				continue
+			}
+			value := &tt.Value
+			if tt.Standard == bchain.TokenStandardERC721 {
+				value = big.NewInt(1)
+			}
+			id := tt.TokenId.String()
+			h, found := nt.byId[id]
+			if !found {
+				h = &holding{id: tt.TokenId}
+				nt.byId[id] = h
+				nt.holdings = append(nt.holdings, h)
+			}
+			if strings.EqualFold(tt.From, address) {
+				h.value.Sub(&h.value, value)
+			}
+			if strings.EqualFold(tt.To, address) {
+				h.value.Add(&h.value, value)
+			}
+		}
+	}
+	for _, nt := range byIndex {
+		for _, h := range nt.holdings {
+			if h.value.Sign() <= 0 {
+				continue
+			}
+			if nt.t.Type == ERC721TokenType {
+				nt.t.Ids = append(nt.t.Ids, (*Amount)(&h.id))
+			} else {
+				nt.t.MultiTokenValues = append(nt.t.MultiTokenValues, MultiTokenValue{Id: (*Amount)(&h.id), Value: (*Amount)(&h.value)})
+			}
+		}
+	}
+	return nil
 }
 
 func (w *Worker) getEthereumTypeAddressBalances(addrDesc bchain.AddressDescriptor, details AccountDetails, filter *AddressFilter) (*db.AddrBalance, []Token, *bchain.Erc20Contract, uint64, int, int, error) {
@@ -723,8 +933,13 @@ func (w *Worker) getEthereumTypeAddressBalances(addrDesc bchain.AddressDescripto
 			} else {
 				tokens = tokens[:j]
 			}
+			if details >= AccountDetailsTokenBalances {
+				if err = w.setNftHoldings(tokens, addrDesc); err != nil {
+					glog.Warningf("setNftHoldings addr %v, %v", addrDesc, err)
+				}
+			}
 		}
-		ci, err = w.chain.EthereumTypeGetErc20ContractInfo(addrDesc)
+		ci, err = w.getContractInfo(addrDesc)
 		if err != nil {
 			return nil, nil, nil, 0, 0, 0, err
 		}
@@ -808,6 +1023,9 @@ func (w *Worker) getAddrDescAndNormalizeAddress(address string) (bchain.AddressD
 		// try if the address is not address descriptor converted to string
 		addrDesc, errAd = bchain.AddressDescriptorFromString(address)
 		if errAd != nil {
+			if w.chainType == bchain.ChainEthereumType && eth.IsEnsName(address) {
+				return w.resolveName(address)
+			}
 			return nil, "", NewAPIError(fmt.Sprintf("Invalid address, %v", err), true)
 		}
 	}
@@ -822,6 +1040,54 @@ func (w *Worker) getAddrDescAndNormalizeAddress(address string) (bchain.AddressD
 	return addrDesc, address, nil
 }
 
+// resolveName returns the address descriptor and the address the ENS name resolves to
+func (w *Worker) resolveName(name string) (bchain.AddressDescriptor, string, error) {
+	address, err := w.chain.EthereumTypeResolveName(name)
+	if err == eth.ErrEnsNotSupported {
+		return nil, "", NewAPIError(fmt.Sprintf("Invalid address, %v", err), true)
+	}
+	if err != nil {
+		glog.Errorf("EthereumTypeResolveName %v error %v", name, err)
+		return nil, "", NewAPIError(fmt.Sprintf("Name not resolved, %v", err), true)
+	}
+	if address == "" {
+		return nil, "", NewAPIError(fmt.Sprintf("Name %v not resolved", name), true)
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, "", NewAPIError(fmt.Sprintf("Invalid address, %v", err), true)
+	}
+	return addrDesc, address, nil
+}
+
+// getAddressName returns the name of the address using the reverse resolution, the result is cached in the db
+// the lookup errors are only logged, in such case the cached (possibly outdated) name is returned
+func (w *Worker) getAddressName(addrDesc bchain.AddressDescriptor) string {
+	an, err := w.db.GetAddressName(addrDesc)
+	if err != nil {
+		glog.Errorf("GetAddressName %v error %v", addrDesc, err)
+	}
+	now := time.Now().Unix()
+	if an != nil && time.Duration(now-an.LastUpdate)*time.Second < db.AddressNameTTL {
+		return an.Name
+	}
+	name, err := w.chain.EthereumTypeLookupAddress(addrDesc)
+	if err == eth.ErrEnsNotSupported {
+		return ""
+	}
+	if err != nil {
+		glog.Errorf("EthereumTypeLookupAddress %v error %v", addrDesc, err)
+		if an != nil {
+			return an.Name
+		}
+		return ""
+	}
+	if err = w.db.StoreAddressName(addrDesc, &db.AddressName{Name: name, LastUpdate: now}); err != nil {
+		glog.Errorf("StoreAddressName %v error %v", addrDesc, err)
+	}
+	return name
+}
+
 // GetAddress computes address value and gets transactions for given address
 func (w *Worker) GetAddress(address string, page int, txsOnPage int, option AccountDetails, filter *AddressFilter) (*Address, error) {
 	start := time.Now()
@@ -840,10 +1106,16 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 		uBalSat                  big.Int
 		totalReceived, totalSent *big.Int
 		nonce                    string
+		pendingNonce             string
+		queuedTxids              []string
 		unconfirmedTxs           int
 		nonTokenTxs              int
 		totalResults             int
+		contractCreation         *ContractCreation
+		isContract               bool
+		name                     string
 	)
+	query := address
 	addrDesc, address, err := w.getAddrDescAndNormalizeAddress(address)
 	if err != nil {
 		return nil, err
@@ -855,6 +1127,30 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 			return nil, err
 		}
 		nonce = strconv.Itoa(int(n))
+		if !filter.OnlyConfirmed {
+			var pn uint64
+			pn, queuedTxids = w.mempool.EthereumTypeGetPendingNonce(addrDesc, n)
+			pendingNonce = strconv.Itoa(int(pn))
+		}
+		contractCreation, err = w.getContractCreation(addrDesc)
+		if err != nil {
+			return nil, err
+		}
+		// the creations are not indexed for the blocks before the feature was introduced, ask the backend for the code
+		isContract = contractCreation != nil || erc20c != nil
+		if !isContract {
+			if isContract, err = w.chain.EthereumTypeIsContract(addrDesc); err != nil {
+				glog.Warningf("EthereumTypeIsContract addr %v, %v", addrDesc, err)
+			}
+		}
+		name = w.getAddressName(addrDesc)
+		// the address was found by a name which is not its primary (reverse) name
+		if name == "" && query != address && eth.IsEnsName(query) {
+			name = query
+		}
+		if filter.Currency != "" {
+			w.setFiatValueToTokens(tokens, filter.Currency)
+		}
 	} else {
 		// ba can be nil if the address is only in mempool!
 		ba, err = w.db.GetAddrDescBalance(addrDesc, db.AddressBalanceDetailNoUTXO)
@@ -944,6 +1240,9 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 		totalReceived = ba.ReceivedSat()
 		totalSent = &ba.SentSat
 	}
+	if filter.Currency != "" {
+		w.setFiatValueToTxs(txs, filter.Currency, map[string]struct{}{string(addrDesc): {}})
+	}
 	r := &Address{
 		Paging:                pg,
 		AddrStr:               address,
@@ -958,7 +1257,12 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 		Txids:                 txids,
 		Tokens:                tokens,
 		Erc20Contract:         erc20c,
+		IsContract:            isContract,
+		ContractCreation:      contractCreation,
 		Nonce:                 nonce,
+		PendingNonce:          pendingNonce,
+		QueuedTxids:           queuedTxids,
+		Name:                  name,
 	}
 	glog.Info("GetAddress ", address, ", ", time.Since(start))
 	return r, nil
@@ -1092,7 +1396,7 @@ func (w *Worker) balanceHistoryForTxid(addrDesc bchain.AddressDescriptor, txid s
 					var feesSat big.Int
 					// mempool txs do not have fees yet
 					if ethTxData.GasUsed != nil {
-						feesSat.Mul(ethTxData.GasPrice, ethTxData.GasUsed)
+						feesSat.Mul(ethTxData.FeeGasPrice(), ethTxData.GasUsed)
 					}
 					(*big.Int)(bh.SentSat).Add((*big.Int)(bh.SentSat), &feesSat)
 				}
@@ -1106,7 +1410,7 @@ func (w *Worker) setFiatRateToBalanceHistories(histories BalanceHistories, curre
 	for i := range histories {
 		bh := &histories[i]
 		t := time.Unix(int64(bh.Time), 0)
-		ticker, err := w.db.FiatRatesFindTicker(&t)
+		ticker, err := w.db.FiatRatesGetTicker(&t)
 		if err != nil {
 			glog.Errorf("Error finding ticker by date %v. Error: %v", t, err)
 			continue
@@ -1131,34 +1435,321 @@ func (w *Worker) setFiatRateToBalanceHistories(histories BalanceHistories, curre
 	return nil
 }
 
-// GetBalanceHistory returns history of balance for given address
-func (w *Worker) GetBalanceHistory(address string, fromTimestamp, toTimestamp int64, currencies []string, groupBy uint32) (BalanceHistories, error) {
-	currencies = removeEmpty(currencies)
+// fiatRatesCache caches the rates of one currency by time during a single request
+type fiatRatesCache struct {
+	w        *Worker
+	currency string
+	rates    map[int64]float64
+	lastRate *float64
+}
+
+func (w *Worker) newFiatRatesCache(currency string) *fiatRatesCache {
+	return &fiatRatesCache{
+		w:        w,
+		currency: strings.ToLower(currency),
+		rates:    make(map[int64]float64),
+	}
+}
+
+// getRate returns the rate at the time, the last available rate for the times after the last ticker
+// (usually mempool transactions) or -1 if the rate is not available
+func (c *fiatRatesCache) getRate(unix int64) float64 {
+	if rate, found := c.rates[unix]; found {
+		return rate
+	}
+	rate := float64(-1)
+	t := time.Unix(unix, 0).UTC()
+	ticker, err := c.w.db.FiatRatesGetTicker(&t)
+	if err != nil {
+		glog.Errorf("Error finding ticker by date %v. Error: %v", t, err)
+	} else if ticker != nil {
+		if r, found := ticker.Rates[c.currency]; found {
+			rate = r
+		}
+	} else {
+		rate = c.getLastRate()
+	}
+	c.rates[unix] = rate
+	return rate
+}
+
+func (c *fiatRatesCache) getLastRate() float64 {
+	if c.lastRate == nil {
+		rate := float64(-1)
+		ticker, err := c.w.db.FiatRatesFindLastTicker()
+		if err != nil {
+			glog.Errorf("Error finding last ticker. Error: %v", err)
+		} else if ticker != nil {
+			if r, found := ticker.Rates[c.currency]; found {
+				rate = r
+			}
+		}
+		c.lastRate = &rate
+	}
+	return *c.lastRate
+}
+
+// txNetValue returns the net effect of the transaction on the balance of the addresses in addrDescs
+func (w *Worker) txNetValue(tx *Tx, addrDescs map[string]struct{}) *big.Int {
+	var value big.Int
+	isOwn := func(addrDesc bchain.AddressDescriptor) bool {
+		_, found := addrDescs[string(addrDesc)]
+		return found
+	}
+	if w.chainType == bchain.ChainEthereumType {
+		// the value is transferred only by OK or unknown status (old) transactions, fees are paid always
+		success := tx.EthereumSpecific == nil || tx.EthereumSpecific.Status == eth.TxStatusOK || tx.EthereumSpecific.Status == eth.TxStatusUnknown
+		if len(tx.Vin) > 0 && len(tx.Vout) > 0 {
+			if success && tx.Vout[0].ValueSat != nil {
+				if isOwn(tx.Vout[0].AddrDesc) {
+					value.Add(&value, (*big.Int)(tx.Vout[0].ValueSat))
+				}
+				if isOwn(tx.Vin[0].AddrDesc) {
+					value.Sub(&value, (*big.Int)(tx.Vout[0].ValueSat))
+				}
+			}
+			if isOwn(tx.Vin[0].AddrDesc) && tx.FeesSat != nil {
+				value.Sub(&value, (*big.Int)(tx.FeesSat))
+			}
+		}
+		if success {
+			for i := range tx.InternalTransfers {
+				it := &tx.InternalTransfers[i]
+				if it.Value == nil {
+					continue
+				}
+				if to, err := w.chainParser.GetAddrDescFromAddress(it.To); err == nil && isOwn(to) {
+					value.Add(&value, (*big.Int)(it.Value))
+				}
+				if from, err := w.chainParser.GetAddrDescFromAddress(it.From); err == nil && isOwn(from) {
+					value.Sub(&value, (*big.Int)(it.Value))
+				}
+			}
+		}
+	} else {
+		for i := range tx.Vout {
+			if tx.Vout[i].ValueSat != nil && isOwn(tx.Vout[i].AddrDesc) {
+				value.Add(&value, (*big.Int)(tx.Vout[i].ValueSat))
+			}
+		}
+		for i := range tx.Vin {
+			if tx.Vin[i].ValueSat != nil && isOwn(tx.Vin[i].AddrDesc) {
+				value.Sub(&value, (*big.Int)(tx.Vin[i].ValueSat))
+			}
+		}
+	}
+	return &value
+}
+
+// setFiatValueToTxs sets to the transactions the fiat rate at the block time and the fiat value
+// of the net effect of the transaction on the addresses in addrDescs, or of the value of the transaction if addrDescs is nil
+func (w *Worker) setFiatValueToTxs(txs []*Tx, currency string, addrDescs map[string]struct{}) {
+	c := w.newFiatRatesCache(currency)
+	for _, tx := range txs {
+		if tx == nil {
+			continue
+		}
+		var value *big.Int
+		if addrDescs == nil {
+			value = (*big.Int)(tx.ValueOutSat)
+		} else {
+			value = w.txNetValue(tx, addrDescs)
+		}
+		fv := &FiatValue{
+			Currency: c.currency,
+			Rate:     c.getRate(tx.Blocktime),
+		}
+		if fv.Rate >= 0 && value != nil {
+			v, err := strconv.ParseFloat(w.chainParser.AmountToDecimalString(value), 64)
+			if err != nil {
+				glog.Errorf("Error converting value %v of tx %v. Error: %v", value, tx.Txid, err)
+			} else {
+				fv.Value = v * fv.Rate
+			}
+		}
+		tx.FiatValue = fv
+	}
+}
+
+// setFiatValueToTokens sets to the ERC20 tokens with known rates the last rate of the token and the fiat value of the balance
+func (w *Worker) setFiatValueToTokens(tokens []Token, currency string) {
+	currency = strings.ToLower(currency)
+	for i := range tokens {
+		t := &tokens[i]
+		if t.Type != ERC20TokenType || t.BalanceSat == nil || t.Contract == "" {
+			continue
+		}
+		contract, err := w.chainParser.GetAddrDescFromAddress(t.Contract)
+		if err != nil {
+			continue
+		}
+		ticker, err := w.db.FiatRatesFindLastTokenTicker(contract)
+		if err != nil {
+			glog.Errorf("Error finding token ticker %v. Error: %v", t.Contract, err)
+			continue
+		} else if ticker == nil {
+			continue
+		}
+		fv := &FiatValue{Currency: currency, Rate: -1}
+		if rate, found := ticker.Rates[currency]; found {
+			fv.Rate = rate
+			v, err := strconv.ParseFloat(bchain.AmountToDecimalString((*big.Int)(t.BalanceSat), t.Decimals), 64)
+			if err == nil {
+				fv.Value = v * rate
+			}
+		}
+		t.FiatValue = fv
+	}
+}
+
+// SetTxFiatValue sets to the transaction the fiat rate at the block time and the fiat value of the transaction
+func (w *Worker) SetTxFiatValue(tx *Tx, currency string) {
+	if currency != "" {
+		w.setFiatValueToTxs([]*Tx{tx}, currency, nil)
+	}
+}
+
+// tokenBalanceHistoryForTxid returns the amounts of the token transferred by the transaction to and from the address
+func (w *Worker) tokenBalanceHistoryForTxid(addrDesc, contractDesc bchain.AddressDescriptor, txid string) (*BalanceHistory, error) {
+	bchainTx, height, err := w.txCache.GetTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	if bchainTx == nil {
+		glog.Warning("Inconsistency:  tx ", txid, ": not found in the blockchain")
+		return nil, nil
+	}
+	bh := BalanceHistory{
+		Time:          w.is.GetBlockTime(uint32(height)),
+		Txs:           1,
+		ReceivedSat:   &Amount{},
+		SentSat:       &Amount{},
+		SentToSelfSat: &Amount{},
+		Txid:          txid,
+	}
+	transfers, err := w.chainParser.EthereumTypeGetTokenTransfersFromTx(bchainTx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range transfers {
+		t := &transfers[i]
+		if t.Standard != bchain.TokenStandardERC20 {
+			continue
+		}
+		if d, err := w.chainParser.GetAddrDescFromAddress(t.Contract); err != nil || !bytes.Equal(d, contractDesc) {
+			continue
+		}
+		from, err := w.chainParser.GetAddrDescFromAddress(t.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := w.chainParser.GetAddrDescFromAddress(t.To)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(addrDesc, from) {
+			(*big.Int)(bh.SentSat).Add((*big.Int)(bh.SentSat), &t.Value)
+			if bytes.Equal(addrDesc, to) {
+				(*big.Int)(bh.SentToSelfSat).Add((*big.Int)(bh.SentToSelfSat), &t.Value)
+			}
+		}
+		if bytes.Equal(addrDesc, to) {
+			(*big.Int)(bh.ReceivedSat).Add((*big.Int)(bh.ReceivedSat), &t.Value)
+		}
+	}
+	return &bh, nil
+}
+
+// getTokenBalanceHistory returns the history of the balance of the address in the ERC20 contract, aggregated by groupBy
+// the balance is computed from all token transfers of the address, the items are returned only for the requested time range
+func (w *Worker) getTokenBalanceHistory(addrDesc bchain.AddressDescriptor, contract string, fromUnix, toUnix, toHeight uint32, groupBy uint32) (BalanceHistories, error) {
+	if w.chainType != bchain.ChainEthereumType {
+		return nil, NewAPIError("Balance history of a contract is supported only for Ethereum type coins", true)
+	}
+	contractDesc, err := w.chainParser.GetAddrDescFromAddress(contract)
+	if err != nil {
+		return nil, NewAPIError(fmt.Sprintf("Invalid contract, %v", err), true)
+	}
 	bhs := make(BalanceHistories, 0)
-	start := time.Now()
-	addrDesc, _, err := w.getAddrDescAndNormalizeAddress(address)
+	ca, err := w.db.GetAddrDescContracts(addrDesc)
 	if err != nil {
 		return nil, err
 	}
-	fromUnix, fromHeight, toUnix, toHeight := w.balanceHistoryHeightsFromTo(fromTimestamp, toTimestamp)
-	if fromHeight >= toHeight {
+	if ca == nil {
 		return bhs, nil
 	}
-	txs, err := w.getAddressTxids(addrDesc, false, &AddressFilter{Vout: AddressFilterVoutOff, FromHeight: fromHeight, ToHeight: toHeight}, maxInt)
+	vout := AddressFilterVoutOff
+	for i := range ca.Contracts {
+		if bytes.Equal(contractDesc, ca.Contracts[i].Contract) {
+			vout = i + 1
+			break
+		}
+	}
+	if vout == AddressFilterVoutOff {
+		return bhs, nil
+	}
+	txs, err := w.getAddressTxids(addrDesc, false, &AddressFilter{Vout: vout, ToHeight: toHeight}, maxInt)
 	if err != nil {
 		return nil, err
 	}
-	selfAddrDesc := map[string]struct{}{string(addrDesc): {}}
+	var balance big.Int
 	for txi := len(txs) - 1; txi >= 0; txi-- {
-		bh, err := w.balanceHistoryForTxid(addrDesc, txs[txi], fromUnix, toUnix, selfAddrDesc)
+		bh, err := w.tokenBalanceHistoryForTxid(addrDesc, contractDesc, txs[txi])
 		if err != nil {
 			return nil, err
 		}
-		if bh != nil {
+		if bh == nil || bh.Time >= toUnix {
+			continue
+		}
+		if bh.Time < fromUnix {
+			balance.Add(&balance, (*big.Int)(bh.ReceivedSat))
+			balance.Sub(&balance, (*big.Int)(bh.SentSat))
+		} else {
 			bhs = append(bhs, *bh)
 		}
 	}
 	bha := bhs.SortAndAggregate(groupBy)
+	bha.SetTokenBalances(&balance)
+	return bha, nil
+}
+
+// GetBalanceHistory returns history of balance for given address
+// if contract is specified (only EthereumType), it returns the history of the balance of the token of the contract
+func (w *Worker) GetBalanceHistory(address string, fromTimestamp, toTimestamp int64, currencies []string, groupBy uint32, contract string) (BalanceHistories, error) {
+	currencies = removeEmpty(currencies)
+	bhs := make(BalanceHistories, 0)
+	start := time.Now()
+	addrDesc, _, err := w.getAddrDescAndNormalizeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	fromUnix, fromHeight, toUnix, toHeight := w.balanceHistoryHeightsFromTo(fromTimestamp, toTimestamp)
+	if fromHeight >= toHeight {
+		return bhs, nil
+	}
+	var bha BalanceHistories
+	if contract != "" {
+		bha, err = w.getTokenBalanceHistory(addrDesc, contract, fromUnix, toUnix, toHeight, groupBy)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		txs, err := w.getAddressTxids(addrDesc, false, &AddressFilter{Vout: AddressFilterVoutOff, FromHeight: fromHeight, ToHeight: toHeight}, maxInt)
+		if err != nil {
+			return nil, err
+		}
+		selfAddrDesc := map[string]struct{}{string(addrDesc): {}}
+		for txi := len(txs) - 1; txi >= 0; txi-- {
+			bh, err := w.balanceHistoryForTxid(addrDesc, txs[txi], fromUnix, toUnix, selfAddrDesc)
+			if err != nil {
+				return nil, err
+			}
+			if bh != nil {
+				bhs = append(bhs, *bh)
+			}
+		}
+		bha = bhs.SortAndAggregate(groupBy)
+	}
 	err = w.setFiatRateToBalanceHistories(bha, currencies)
 	if err != nil {
 		return nil, err
@@ -1167,6 +1758,110 @@ func (w *Worker) GetBalanceHistory(address string, fromTimestamp, toTimestamp in
 	return bha, nil
 }
 
+// GetContractLogs returns a page of event logs of the contract with the given first topic in the range of blocks
+func (w *Worker) GetContractLogs(contract, topic0 string, page int, itemsOnPage int, fromHeight, toHeight uint32) (*EventLogs, error) {
+	if w.chainType != bchain.ChainEthereumType {
+		return nil, NewAPIError("Event logs are supported only for Ethereum type coins", true)
+	}
+	if contract == "" {
+		return nil, NewAPIError("Missing contract", true)
+	}
+	contractDesc, err := w.chainParser.GetAddrDescFromAddress(contract)
+	if err != nil {
+		return nil, NewAPIError(fmt.Sprintf("Invalid contract, %v", err), true)
+	}
+	var topic []byte
+	if topic0 != "" {
+		topic, err = eth.DecodeTopic(topic0)
+		if err != nil {
+			return nil, NewAPIError(fmt.Sprintf("Invalid topic0, %v", err), true)
+		}
+	}
+	if toHeight == 0 {
+		toHeight = maxUint32
+	}
+	page--
+	if page < 0 {
+		page = 0
+	}
+	type logRef struct {
+		txid    string
+		height  uint32
+		indexes []int32
+		// the index of the first log of the transaction among all the logs
+		first int
+	}
+	// collect the logs from..to, the iteration stops after the first log behind the page,
+	// therefore the returned count is exact only if there are no more logs
+	collect := func(from, to int) ([]logRef, int, bool, error) {
+		var refs []logRef
+		count := 0
+		more := false
+		err := w.db.GetContractLogs(contractDesc, topic, fromHeight, toHeight, func(txid string, height uint32, indexes []int32) error {
+			if count >= to {
+				more = true
+				return &db.StopIteration{}
+			}
+			if count+len(indexes) > from {
+				refs = append(refs, logRef{txid: txid, height: height, indexes: append([]int32(nil), indexes...), first: count})
+			}
+			count += len(indexes)
+			return nil
+		})
+		return refs, count, more, err
+	}
+	from := page * itemsOnPage
+	to := from + itemsOnPage
+	refs, count, more, err := collect(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var pg Paging
+	if more {
+		pg = Paging{ItemsOnPage: itemsOnPage, Page: page + 1, TotalPages: -1}
+	} else {
+		pg, from, to, _ = computePaging(count, page, itemsOnPage)
+		// the requested page is behind the last log, return the last page
+		if len(refs) == 0 && count > 0 {
+			if refs, _, _, err = collect(from, to); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r := &EventLogs{
+		Paging:   pg,
+		Contract: contract,
+		Topic0:   topic0,
+		Logs:     make([]EventLog, 0, to-from),
+	}
+	for _, ref := range refs {
+		tx, _, err := w.txCache.GetTransaction(ref.txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "txCache.GetTransaction %v", ref.txid)
+		}
+		logs, err := w.chainParser.EthereumTypeGetEventLogsFromTx(tx)
+		if err != nil {
+			return nil, errors.Annotatef(err, "EthereumTypeGetEventLogsFromTx %v", ref.txid)
+		}
+		i := ref.first
+		for _, li := range ref.indexes {
+			if i >= from && i < to && int(li) < len(logs) {
+				l := &logs[li]
+				r.Logs = append(r.Logs, EventLog{
+					Txid:        ref.txid,
+					BlockHeight: ref.height,
+					LogIndex:    int(li),
+					Contract:    l.Contract,
+					Topics:      l.Topics,
+					Data:        l.Data,
+				})
+			}
+			i++
+		}
+	}
+	return r, nil
+}
+
 func (w *Worker) waitForBackendSync() {
 	// wait a short time if blockbook is synchronizing with backend
 	inSync, _, _ := w.is.GetSyncState()
@@ -1382,9 +2077,43 @@ func (w *Worker) getFiatRatesResult(currencies []string, ticker *db.CurrencyRate
 	}, nil
 }
 
-// GetFiatRatesForBlockID returns fiat rates for block height or block hash
-func (w *Worker) GetFiatRatesForBlockID(bid string, currencies []string) (*db.ResultTickerAsString, error) {
+// getTokenContract returns the address descriptor of the token contract, nil if token is empty
+func (w *Worker) getTokenContract(token string) (bchain.AddressDescriptor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	if w.chainType != bchain.ChainEthereumType {
+		return nil, NewAPIError("Token rates are supported only for Ethereum type coins", true)
+	}
+	contract, err := w.chainParser.GetAddrDescFromAddress(token)
+	if err != nil {
+		return nil, NewAPIError(fmt.Sprintf("Invalid token %v, %v", token, err), true)
+	}
+	return contract, nil
+}
+
+// getFiatRatesTicker returns the ticker valid at the time (the last ticker if tickerTime is nil)
+// of the base coin or, if contract is specified, of the token
+func (w *Worker) getFiatRatesTicker(tickerTime *time.Time, contract bchain.AddressDescriptor) (*db.CurrencyRatesTicker, error) {
+	if contract == nil {
+		if tickerTime == nil {
+			return w.db.FiatRatesFindLastTicker()
+		}
+		return w.db.FiatRatesGetTicker(tickerTime)
+	}
+	if tickerTime == nil {
+		return w.db.FiatRatesFindLastTokenTicker(contract)
+	}
+	return w.db.FiatRatesFindTokenTicker(contract, tickerTime)
+}
+
+// GetFiatRatesForBlockID returns fiat rates for block height or block hash, of the token if specified
+func (w *Worker) GetFiatRatesForBlockID(bid string, currencies []string, token string) (*db.ResultTickerAsString, error) {
 	var ticker *db.CurrencyRatesTicker
+	contract, err := w.getTokenContract(token)
+	if err != nil {
+		return nil, err
+	}
 	bi, err := w.getBlockInfoFromBlockID(bid)
 	if err != nil {
 		if err == bchain.ErrBlockNotFound {
@@ -1394,7 +2123,7 @@ func (w *Worker) GetFiatRatesForBlockID(bid string, currencies []string) (*db.Re
 	}
 	dbi := &db.BlockInfo{Time: bi.Time} // get Unix timestamp from block
 	tm := time.Unix(dbi.Time, 0)        // convert it to Time object
-	ticker, err = w.db.FiatRatesFindTicker(&tm)
+	ticker, err = w.getFiatRatesTicker(&tm, contract)
 	if err != nil {
 		return nil, NewAPIError(fmt.Sprintf("Error finding ticker: %v", err), false)
 	} else if ticker == nil {
@@ -1407,9 +2136,13 @@ func (w *Worker) GetFiatRatesForBlockID(bid string, currencies []string) (*db.Re
 	return result, nil
 }
 
-// GetCurrentFiatRates returns last available fiat rates
-func (w *Worker) GetCurrentFiatRates(currencies []string) (*db.ResultTickerAsString, error) {
-	ticker, err := w.db.FiatRatesFindLastTicker()
+// GetCurrentFiatRates returns last available fiat rates, of the token if specified
+func (w *Worker) GetCurrentFiatRates(currencies []string, token string) (*db.ResultTickerAsString, error) {
+	contract, err := w.getTokenContract(token)
+	if err != nil {
+		return nil, err
+	}
+	ticker, err := w.getFiatRatesTicker(nil, contract)
 	if err != nil {
 		return nil, NewAPIError(fmt.Sprintf("Error finding ticker: %v", err), false)
 	} else if ticker == nil {
@@ -1432,18 +2165,22 @@ func makeErrorRates(currencies []string) map[string]float64 {
 	return rates
 }
 
-// GetFiatRatesForTimestamps returns fiat rates for each of the provided dates
-func (w *Worker) GetFiatRatesForTimestamps(timestamps []int64, currencies []string) (*db.ResultTickersAsString, error) {
+// GetFiatRatesForTimestamps returns fiat rates for each of the provided dates, of the token if specified
+func (w *Worker) GetFiatRatesForTimestamps(timestamps []int64, currencies []string, token string) (*db.ResultTickersAsString, error) {
 	if len(timestamps) == 0 {
 		return nil, NewAPIError("No timestamps provided", true)
 	}
 	currencies = removeEmpty(currencies)
+	contract, err := w.getTokenContract(token)
+	if err != nil {
+		return nil, err
+	}
 
 	ret := &db.ResultTickersAsString{}
 	for _, timestamp := range timestamps {
 		date := time.Unix(timestamp, 0)
 		date = date.UTC()
-		ticker, err := w.db.FiatRatesFindTicker(&date)
+		ticker, err := w.getFiatRatesTicker(&date, contract)
 		if err != nil {
 			glog.Errorf("Error finding ticker for date %v. Error: %v", date, err)
 			ret.Tickers = append(ret.Tickers, db.ResultTickerAsString{Timestamp: date.Unix(), Rates: makeErrorRates(currencies)})
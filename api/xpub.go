@@ -530,6 +530,15 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 			}
 		}
 	}
+	if filter.Currency != "" && len(txs) > 0 {
+		addrDescs := make(map[string]struct{}, len(data.addresses)+len(data.changeAddresses))
+		for _, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
+			for i := range da {
+				addrDescs[string(da[i].addrDesc)] = struct{}{}
+			}
+		}
+		w.setFiatValueToTxs(txs, filter.Currency, addrDescs)
+	}
 	var totalReceived big.Int
 	totalReceived.Add(&data.balanceSat, &data.sentSat)
 	addr := Address{
@@ -592,6 +601,92 @@ func (w *Worker) GetXpubUtxo(xpub string, onlyConfirmed bool, gap int) (Utxos, e
 	return r, nil
 }
 
+// XpubAddresses contains the receive (index 0) and change (index 1) addresses derived from an xpub
+// up to the gap after the last address used in a confirmed transaction
+type XpubAddresses struct {
+	BasePath  string
+	Gap       int
+	Addresses [2][]bchain.AddressDescriptor
+	LastUsed  [2]int // -1 if no address is used
+}
+
+// Path returns the derivation path of the address
+func (x *XpubAddresses) Path(change int, index int) string {
+	return fmt.Sprintf("%s/%d/%d", x.BasePath, change, index)
+}
+
+// GetXpubAddresses returns the derived addresses of the xpub
+func (w *Worker) GetXpubAddresses(xpub string, gap int) (*XpubAddresses, error) {
+	data, _, _, err := w.getXpubData(xpub, 0, 1, AccountDetailsBasic, &AddressFilter{
+		Vout:          AddressFilterVoutOff,
+		OnlyConfirmed: true,
+	}, gap)
+	if err != nil {
+		return nil, err
+	}
+	r := XpubAddresses{
+		BasePath: data.basePath,
+		// the gap in xpubData is increased by one
+		Gap: data.gap - 1,
+	}
+	for ci, da := range [][]xpubAddress{data.addresses, data.changeAddresses} {
+		r.LastUsed[ci] = -1
+		r.Addresses[ci] = make([]bchain.AddressDescriptor, len(da))
+		for i := range da {
+			r.Addresses[ci][i] = da[i].addrDesc
+			if da[i].balance != nil {
+				r.LastUsed[ci] = i
+			}
+		}
+	}
+	return &r, nil
+}
+
+// AddressBalanceSat is the confirmed balance of an address and the balance of its mempool transactions
+type AddressBalanceSat struct {
+	Balance            big.Int
+	UnconfirmedBalance big.Int
+}
+
+// GetAddressesBalances returns the balances of the addresses, the confirmed balance is read from the address balance column,
+// the unconfirmed balance is computed from the mempool transactions of the address
+// it does not load the transaction history, unlike GetAddress and GetXpubAddress
+func (w *Worker) GetAddressesBalances(addrDescs []bchain.AddressDescriptor) ([]AddressBalanceSat, error) {
+	balances := make([]AddressBalanceSat, len(addrDescs))
+	txmMap := make(map[string]*Tx)
+	for i, addrDesc := range addrDescs {
+		ba, err := w.db.GetAddrDescBalance(addrDesc, db.AddressBalanceDetailNoUTXO)
+		if err != nil {
+			return nil, err
+		}
+		if ba != nil {
+			balances[i].Balance.Set(&ba.BalanceSat)
+		}
+		newTxids, _, err := w.xpubGetAddressTxids(addrDesc, true, 0, 0, maxInt)
+		if err != nil {
+			return nil, err
+		}
+		for _, txid := range newTxids {
+			tx, found := txmMap[txid.txid]
+			if !found {
+				tx, err = w.GetTransaction(txid.txid, false, true)
+				// mempool transaction may fail
+				if err != nil || tx == nil {
+					glog.Warning("GetTransaction in mempool: ", err)
+					continue
+				}
+				txmMap[txid.txid] = tx
+			}
+			// skip already confirmed txs, mempool may be out of sync
+			if tx.Confirmations == 0 {
+				balances[i].UnconfirmedBalance.Add(&balances[i].UnconfirmedBalance, tx.getAddrVoutValue(addrDesc))
+				balances[i].UnconfirmedBalance.Sub(&balances[i].UnconfirmedBalance, tx.getAddrVinValue(addrDesc))
+			}
+		}
+	}
+	return balances, nil
+}
+
 // GetXpubBalanceHistory returns history of balance for given xpub
 func (w *Worker) GetXpubBalanceHistory(xpub string, fromTimestamp, toTimestamp int64, currencies []string, gap int, groupBy uint32) (BalanceHistories, error) {
 	bhs := make(BalanceHistories, 0)
@@ -34,6 +34,11 @@ func (b *BaseChain) GetMempoolEntry(txid string) (*MempoolEntry, error) {
 	return nil, errors.New("GetMempoolEntry: not supported")
 }
 
+// TestMempoolAccept is not supported by default
+func (b *BaseChain) TestMempoolAccept(tx string) (*MempoolAcceptResult, error) {
+	return nil, errors.New("TestMempoolAccept: not supported")
+}
+
 // EthereumTypeGetBalance is not supported
 func (b *BaseChain) EthereumTypeGetBalance(addrDesc AddressDescriptor) (*big.Int, error) {
 	return nil, errors.New("Not supported")
@@ -44,17 +49,47 @@ func (b *BaseChain) EthereumTypeGetNonce(addrDesc AddressDescriptor) (uint64, er
 	return 0, errors.New("Not supported")
 }
 
+// EthereumTypeIsContract is not supported
+func (b *BaseChain) EthereumTypeIsContract(addrDesc AddressDescriptor) (bool, error) {
+	return false, errors.New("Not supported")
+}
+
 // EthereumTypeEstimateGas is not supported
 func (b *BaseChain) EthereumTypeEstimateGas(params map[string]interface{}) (uint64, error) {
 	return 0, errors.New("Not supported")
 }
 
+// EthereumTypeGetEip1559Fees is not supported
+func (b *BaseChain) EthereumTypeGetEip1559Fees() (*Eip1559Fees, error) {
+	return nil, errors.New("Not supported")
+}
+
 // EthereumTypeGetErc20ContractInfo is not supported
 func (b *BaseChain) EthereumTypeGetErc20ContractInfo(contractDesc AddressDescriptor) (*Erc20Contract, error) {
 	return nil, errors.New("Not supported")
 }
 
+// EthereumTypeRefreshErc20ContractInfo is not supported
+func (b *BaseChain) EthereumTypeRefreshErc20ContractInfo(contractDesc AddressDescriptor) (*Erc20Contract, error) {
+	return nil, errors.New("Not supported")
+}
+
+// EthereumTypeGetTxPoolContent is not supported
+func (b *BaseChain) EthereumTypeGetTxPoolContent() ([]Tx, error) {
+	return nil, errors.New("Not supported")
+}
+
 // EthereumTypeGetErc20ContractBalance is not supported
 func (b *BaseChain) EthereumTypeGetErc20ContractBalance(addrDesc, contractDesc AddressDescriptor) (*big.Int, error) {
 	return nil, errors.New("Not supported")
 }
+
+// EthereumTypeResolveName is not supported
+func (b *BaseChain) EthereumTypeResolveName(name string) (string, error) {
+	return "", errors.New("Not supported")
+}
+
+// EthereumTypeLookupAddress is not supported
+func (b *BaseChain) EthereumTypeLookupAddress(addrDesc AddressDescriptor) (string, error) {
+	return "", errors.New("Not supported")
+}
@@ -116,6 +116,11 @@ func (m *BaseMempool) GetTransactionTime(txid string) uint32 {
 	return e.time
 }
 
+// EthereumTypeGetPendingNonce returns the confirmed nonce, the mempool does not track nonces
+func (m *BaseMempool) EthereumTypeGetPendingNonce(addrDesc AddressDescriptor, confirmedNonce uint64) (uint64, []string) {
+	return confirmedNonce, nil
+}
+
 func (m *BaseMempool) txToMempoolTx(tx *Tx) *MempoolTx {
 	mtx := MempoolTx{
 		Hex:              tx.Hex,
@@ -295,7 +295,27 @@ func (p *BaseParser) DeriveAddressDescriptorsFromTo(xpub string, change uint32,
 	return nil, errors.New("Not supported")
 }
 
-// EthereumTypeGetErc20FromTx is unsupported
-func (p *BaseParser) EthereumTypeGetErc20FromTx(tx *Tx) ([]Erc20Transfer, error) {
+// EthereumTypeGetEventLogsFromTx is unsupported
+func (p *BaseParser) EthereumTypeGetEventLogsFromTx(tx *Tx) ([]EthereumEventLog, error) {
+	return nil, errors.New("Not supported")
+}
+
+// EthereumTypeGetContractCreationFromTx is unsupported
+func (p *BaseParser) EthereumTypeGetContractCreationFromTx(tx *Tx) (*EthereumContractCreation, error) {
+	return nil, errors.New("Not supported")
+}
+
+// EthereumTypeGetNonceFromTx is unsupported
+func (p *BaseParser) EthereumTypeGetNonceFromTx(tx *Tx) (uint64, error) {
+	return 0, errors.New("Not supported")
+}
+
+// EthereumTypeGetTokenTransfersFromTx is unsupported
+func (p *BaseParser) EthereumTypeGetTokenTransfersFromTx(tx *Tx) ([]TokenTransfer, error) {
+	return nil, errors.New("Not supported")
+}
+
+// EthereumTypeGetInternalTransfersFromTx is unsupported
+func (p *BaseParser) EthereumTypeGetInternalTransfersFromTx(tx *Tx) ([]EthereumInternalTransfer, error) {
 	return nil, errors.New("Not supported")
 }
@@ -287,6 +287,11 @@ func (c *blockChainWithMetrics) SendRawTransaction(tx string) (v string, err err
 	return c.b.SendRawTransaction(tx)
 }
 
+func (c *blockChainWithMetrics) TestMempoolAccept(tx string) (v *bchain.MempoolAcceptResult, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("TestMempoolAccept", s, err) }(time.Now())
+	return c.b.TestMempoolAccept(tx)
+}
+
 func (c *blockChainWithMetrics) GetMempoolEntry(txid string) (v *bchain.MempoolEntry, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("GetMempoolEntry", s, err) }(time.Now())
 	return c.b.GetMempoolEntry(txid)
@@ -306,21 +311,51 @@ func (c *blockChainWithMetrics) EthereumTypeGetNonce(addrDesc bchain.AddressDesc
 	return c.b.EthereumTypeGetNonce(addrDesc)
 }
 
+func (c *blockChainWithMetrics) EthereumTypeIsContract(addrDesc bchain.AddressDescriptor) (v bool, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeIsContract", s, err) }(time.Now())
+	return c.b.EthereumTypeIsContract(addrDesc)
+}
+
 func (c *blockChainWithMetrics) EthereumTypeEstimateGas(params map[string]interface{}) (v uint64, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeEstimateGas", s, err) }(time.Now())
 	return c.b.EthereumTypeEstimateGas(params)
 }
 
+func (c *blockChainWithMetrics) EthereumTypeGetEip1559Fees() (v *bchain.Eip1559Fees, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeGetEip1559Fees", s, err) }(time.Now())
+	return c.b.EthereumTypeGetEip1559Fees()
+}
+
 func (c *blockChainWithMetrics) EthereumTypeGetErc20ContractInfo(contractDesc bchain.AddressDescriptor) (v *bchain.Erc20Contract, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeGetErc20ContractInfo", s, err) }(time.Now())
 	return c.b.EthereumTypeGetErc20ContractInfo(contractDesc)
 }
 
+func (c *blockChainWithMetrics) EthereumTypeRefreshErc20ContractInfo(contractDesc bchain.AddressDescriptor) (v *bchain.Erc20Contract, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeRefreshErc20ContractInfo", s, err) }(time.Now())
+	return c.b.EthereumTypeRefreshErc20ContractInfo(contractDesc)
+}
+
+func (c *blockChainWithMetrics) EthereumTypeGetTxPoolContent() (v []bchain.Tx, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeGetTxPoolContent", s, err) }(time.Now())
+	return c.b.EthereumTypeGetTxPoolContent()
+}
+
 func (c *blockChainWithMetrics) EthereumTypeGetErc20ContractBalance(addrDesc, contractDesc bchain.AddressDescriptor) (v *big.Int, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeGetErc20ContractInfo", s, err) }(time.Now())
 	return c.b.EthereumTypeGetErc20ContractBalance(addrDesc, contractDesc)
 }
 
+func (c *blockChainWithMetrics) EthereumTypeResolveName(name string) (v string, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeResolveName", s, err) }(time.Now())
+	return c.b.EthereumTypeResolveName(name)
+}
+
+func (c *blockChainWithMetrics) EthereumTypeLookupAddress(addrDesc bchain.AddressDescriptor) (v string, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("EthereumTypeLookupAddress", s, err) }(time.Now())
+	return c.b.EthereumTypeLookupAddress(addrDesc)
+}
+
 type mempoolWithMetrics struct {
 	mempool bchain.Mempool
 	m       *common.Metrics
@@ -361,3 +396,7 @@ func (c *mempoolWithMetrics) GetAllEntries() (v bchain.MempoolTxidEntries) {
 func (c *mempoolWithMetrics) GetTransactionTime(txid string) uint32 {
 	return c.mempool.GetTransactionTime(txid)
 }
+
+func (c *mempoolWithMetrics) EthereumTypeGetPendingNonce(addrDesc bchain.AddressDescriptor, confirmedNonce uint64) (uint64, []string) {
+	return c.mempool.EthereumTypeGetPendingNonce(addrDesc, confirmedNonce)
+}
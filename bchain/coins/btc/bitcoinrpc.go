@@ -391,6 +391,18 @@ type ResSendRawTransaction struct {
 	Result string           `json:"result"`
 }
 
+// testmempoolaccept
+
+type CmdTestMempoolAccept struct {
+	Method string     `json:"method"`
+	Params [][]string `json:"params"`
+}
+
+type ResTestMempoolAccept struct {
+	Error  *bchain.RPCError             `json:"error"`
+	Result []bchain.MempoolAcceptResult `json:"result"`
+}
+
 // getmempoolentry
 
 type CmdGetMempoolEntry struct {
@@ -837,6 +849,27 @@ func (b *BitcoinRPC) SendRawTransaction(tx string) (string, error) {
 	return res.Result, nil
 }
 
+// TestMempoolAccept tests if the raw transaction would be accepted to the mempool, without sending it
+func (b *BitcoinRPC) TestMempoolAccept(tx string) (*bchain.MempoolAcceptResult, error) {
+	glog.V(1).Info("rpc: testmempoolaccept")
+
+	res := ResTestMempoolAccept{}
+	req := CmdTestMempoolAccept{Method: "testmempoolaccept"}
+	req.Params = [][]string{{tx}}
+	err := b.Call(&req, &res)
+
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(res.Result) != 1 {
+		return nil, errors.New("testmempoolaccept: unexpected result")
+	}
+	return &res.Result[0], nil
+}
+
 // GetMempoolEntry returns mempool data for given transaction
 func (b *BitcoinRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error) {
 	glog.V(1).Info("rpc: getmempoolentry")
@@ -0,0 +1,501 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/wire"
+	"github.com/martinboehm/btcutil/txscript"
+)
+
+// psbtMagic is the prefix of the serialized PSBT
+var psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// maxPsbtItemSize limits the size of a key or a value in the PSBT maps
+const maxPsbtItemSize = 4000000
+
+// types of the PSBT key-value pairs used by blockbook
+const (
+	psbtGlobalUnsignedTx     = 0x00
+	psbtInNonWitnessUtxo     = 0x00
+	psbtInWitnessUtxo        = 0x01
+	psbtInPartialSig         = 0x02
+	psbtInSighashType        = 0x03
+	psbtInRedeemScript       = 0x04
+	psbtInWitnessScript      = 0x05
+	psbtInBip32Derivation    = 0x06
+	psbtInFinalScriptSig     = 0x07
+	psbtInFinalScriptWitness = 0x08
+	psbtMaxStandardPubKeyLen = 65
+	psbtCompressedPubKeyLen  = 33
+)
+
+// ErrPsbtUnsupportedScript is returned if the input cannot be finalized because of the unsupported type of the script
+var ErrPsbtUnsupportedScript = errors.New("Unsupported script type")
+
+// PsbtKV is a key-value pair of a PSBT map
+type PsbtKV struct {
+	Key   []byte
+	Value []byte
+}
+
+// PsbtPartialSig is a signature of an input by one public key
+type PsbtPartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// PsbtInput contains the parsed fields of a PSBT input, the other key-value pairs are kept in Unknowns
+type PsbtInput struct {
+	NonWitnessUtxo     *wire.MsgTx
+	WitnessUtxo        *wire.TxOut
+	PartialSigs        []PsbtPartialSig
+	RedeemScript       []byte
+	WitnessScript      []byte
+	FinalScriptSig     []byte
+	FinalScriptWitness [][]byte
+	Unknowns           []PsbtKV
+}
+
+// PsbtOutput contains the key-value pairs of a PSBT output
+type PsbtOutput struct {
+	Unknowns []PsbtKV
+}
+
+// Psbt is a partially signed bitcoin transaction as defined by BIP174
+// only the fields needed to analyze and finalize the transaction are parsed, the other key-value pairs are kept unchanged
+type Psbt struct {
+	UnsignedTx *wire.MsgTx
+	Unknowns   []PsbtKV
+	Inputs     []PsbtInput
+	Outputs    []PsbtOutput
+}
+
+func readPsbtMap(r io.Reader) ([]PsbtKV, error) {
+	var kvs []PsbtKV
+	keys := make(map[string]struct{})
+	for {
+		key, err := wire.ReadVarBytes(r, 0, maxPsbtItemSize, "key")
+		if err != nil {
+			return nil, err
+		}
+		// zero length key is the separator of the maps
+		if len(key) == 0 {
+			return kvs, nil
+		}
+		if _, found := keys[string(key)]; found {
+			return nil, errors.Errorf("Duplicate key %x", key)
+		}
+		keys[string(key)] = struct{}{}
+		value, err := wire.ReadVarBytes(r, 0, maxPsbtItemSize, "value")
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, PsbtKV{Key: key, Value: value})
+	}
+}
+
+func writePsbtMap(w io.Writer, kvs []PsbtKV) error {
+	sort.Slice(kvs, func(i, j int) bool { return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0 })
+	for i := range kvs {
+		if err := wire.WriteVarBytes(w, 0, kvs[i].Key); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(w, 0, kvs[i].Value); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+func parseTxOut(b []byte) (*wire.TxOut, error) {
+	if len(b) < 9 {
+		return nil, errors.New("Invalid witness utxo")
+	}
+	r := bytes.NewReader(b[8:])
+	script, err := wire.ReadVarBytes(r, 0, maxPsbtItemSize, "script")
+	if err != nil || r.Len() != 0 {
+		return nil, errors.New("Invalid witness utxo")
+	}
+	return wire.NewTxOut(int64(binary.LittleEndian.Uint64(b)), script), nil
+}
+
+func serializeTxOut(o *wire.TxOut) []byte {
+	var buf bytes.Buffer
+	var v [8]byte
+	binary.LittleEndian.PutUint64(v[:], uint64(o.Value))
+	buf.Write(v[:])
+	wire.WriteVarBytes(&buf, 0, o.PkScript)
+	return buf.Bytes()
+}
+
+func parseWitness(b []byte) ([][]byte, error) {
+	r := bytes.NewReader(b)
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil || n > uint64(len(b)) {
+		return nil, errors.New("Invalid final script witness")
+	}
+	witness := make([][]byte, n)
+	for i := range witness {
+		if witness[i], err = wire.ReadVarBytes(r, 0, maxPsbtItemSize, "witness"); err != nil {
+			return nil, errors.New("Invalid final script witness")
+		}
+	}
+	return witness, nil
+}
+
+func serializeWitness(witness [][]byte) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarInt(&buf, 0, uint64(len(witness)))
+	for _, item := range witness {
+		wire.WriteVarBytes(&buf, 0, item)
+	}
+	return buf.Bytes()
+}
+
+func parsePsbtInput(kvs []PsbtKV) (*PsbtInput, error) {
+	in := &PsbtInput{}
+	var err error
+	for _, kv := range kvs {
+		keyData := kv.Key[1:]
+		// only the partial signature has the data in the key, the other known types with the key data are kept as unknown
+		if kv.Key[0] != psbtInPartialSig && len(keyData) != 0 {
+			in.Unknowns = append(in.Unknowns, kv)
+			continue
+		}
+		switch kv.Key[0] {
+		case psbtInNonWitnessUtxo:
+			tx := wire.NewMsgTx(wire.TxVersion)
+			if err = tx.Deserialize(bytes.NewReader(kv.Value)); err != nil {
+				return nil, errors.Annotatef(err, "non witness utxo")
+			}
+			in.NonWitnessUtxo = tx
+			continue
+		case psbtInWitnessUtxo:
+			if in.WitnessUtxo, err = parseTxOut(kv.Value); err != nil {
+				return nil, err
+			}
+			continue
+		case psbtInPartialSig:
+			if len(keyData) != psbtCompressedPubKeyLen && len(keyData) != psbtMaxStandardPubKeyLen {
+				return nil, errors.New("Invalid partial signature public key")
+			}
+			in.PartialSigs = append(in.PartialSigs, PsbtPartialSig{PubKey: keyData, Signature: kv.Value})
+			continue
+		case psbtInRedeemScript:
+			in.RedeemScript = kv.Value
+			continue
+		case psbtInWitnessScript:
+			in.WitnessScript = kv.Value
+			continue
+		case psbtInFinalScriptSig:
+			in.FinalScriptSig = kv.Value
+			continue
+		case psbtInFinalScriptWitness:
+			if in.FinalScriptWitness, err = parseWitness(kv.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		in.Unknowns = append(in.Unknowns, kv)
+	}
+	return in, nil
+}
+
+func (in *PsbtInput) keyValues() []PsbtKV {
+	kvs := append([]PsbtKV{}, in.Unknowns...)
+	if in.NonWitnessUtxo != nil {
+		var buf bytes.Buffer
+		in.NonWitnessUtxo.Serialize(&buf)
+		kvs = append(kvs, PsbtKV{Key: []byte{psbtInNonWitnessUtxo}, Value: buf.Bytes()})
+	}
+	if in.WitnessUtxo != nil {
+		kvs = append(kvs, PsbtKV{Key: []byte{psbtInWitnessUtxo}, Value: serializeTxOut(in.WitnessUtxo)})
+	}
+	for _, ps := range in.PartialSigs {
+		kvs = append(kvs, PsbtKV{Key: append([]byte{psbtInPartialSig}, ps.PubKey...), Value: ps.Signature})
+	}
+	if in.RedeemScript != nil {
+		kvs = append(kvs, PsbtKV{Key: []byte{psbtInRedeemScript}, Value: in.RedeemScript})
+	}
+	if in.WitnessScript != nil {
+		kvs = append(kvs, PsbtKV{Key: []byte{psbtInWitnessScript}, Value: in.WitnessScript})
+	}
+	if in.FinalScriptSig != nil {
+		kvs = append(kvs, PsbtKV{Key: []byte{psbtInFinalScriptSig}, Value: in.FinalScriptSig})
+	}
+	if in.FinalScriptWitness != nil {
+		kvs = append(kvs, PsbtKV{Key: []byte{psbtInFinalScriptWitness}, Value: serializeWitness(in.FinalScriptWitness)})
+	}
+	return kvs
+}
+
+// ParsePsbt parses the serialized PSBT
+func ParsePsbt(b []byte) (*Psbt, error) {
+	if !bytes.HasPrefix(b, psbtMagic) {
+		return nil, errors.New("Invalid PSBT magic")
+	}
+	r := bytes.NewReader(b[len(psbtMagic):])
+	globals, err := readPsbtMap(r)
+	if err != nil {
+		return nil, errors.Annotatef(err, "global map")
+	}
+	p := &Psbt{}
+	for _, kv := range globals {
+		if len(kv.Key) == 1 && kv.Key[0] == psbtGlobalUnsignedTx {
+			tx := wire.NewMsgTx(wire.TxVersion)
+			// the unsigned transaction is always serialized in the non witness format
+			if err = tx.DeserializeNoWitness(bytes.NewReader(kv.Value)); err != nil {
+				return nil, errors.Annotatef(err, "unsigned tx")
+			}
+			for _, in := range tx.TxIn {
+				if len(in.SignatureScript) > 0 || len(in.Witness) > 0 {
+					return nil, errors.New("Unsigned tx has signatures")
+				}
+			}
+			p.UnsignedTx = tx
+		} else {
+			p.Unknowns = append(p.Unknowns, kv)
+		}
+	}
+	if p.UnsignedTx == nil {
+		return nil, errors.New("Missing unsigned tx")
+	}
+	p.Inputs = make([]PsbtInput, len(p.UnsignedTx.TxIn))
+	for i := range p.Inputs {
+		kvs, err := readPsbtMap(r)
+		if err != nil {
+			return nil, errors.Annotatef(err, "input %d", i)
+		}
+		in, err := parsePsbtInput(kvs)
+		if err != nil {
+			return nil, errors.Annotatef(err, "input %d", i)
+		}
+		p.Inputs[i] = *in
+	}
+	p.Outputs = make([]PsbtOutput, len(p.UnsignedTx.TxOut))
+	for i := range p.Outputs {
+		if p.Outputs[i].Unknowns, err = readPsbtMap(r); err != nil {
+			return nil, errors.Annotatef(err, "output %d", i)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("Unexpected data after PSBT")
+	}
+	return p, nil
+}
+
+// Serialize returns the PSBT in the binary format, the key-value pairs of the maps are sorted by the keys
+func (p *Psbt) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+	var tx bytes.Buffer
+	if err := p.UnsignedTx.SerializeNoWitness(&tx); err != nil {
+		return nil, err
+	}
+	globals := append([]PsbtKV{{Key: []byte{psbtGlobalUnsignedTx}, Value: tx.Bytes()}}, p.Unknowns...)
+	if err := writePsbtMap(&buf, globals); err != nil {
+		return nil, err
+	}
+	for i := range p.Inputs {
+		if err := writePsbtMap(&buf, p.Inputs[i].keyValues()); err != nil {
+			return nil, err
+		}
+	}
+	for i := range p.Outputs {
+		if err := writePsbtMap(&buf, append([]PsbtKV{}, p.Outputs[i].Unknowns...)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// IsFinalized returns true if the input has the final scriptSig or the final witness
+func (in *PsbtInput) IsFinalized() bool {
+	return in.FinalScriptSig != nil || in.FinalScriptWitness != nil
+}
+
+// PrevOutScript returns the script of the output spent by the input i, or nil if the PSBT does not contain the utxo
+func (p *Psbt) PrevOutScript(i int) []byte {
+	in := &p.Inputs[i]
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo.PkScript
+	}
+	if in.NonWitnessUtxo != nil {
+		index := p.UnsignedTx.TxIn[i].PreviousOutPoint.Index
+		if int(index) < len(in.NonWitnessUtxo.TxOut) {
+			return in.NonWitnessUtxo.TxOut[index].PkScript
+		}
+	}
+	return nil
+}
+
+// signingScript returns the script that defines the signatures needed to spend the output with the script
+// and flags if the input is wrapped in P2SH and if it is a segwit input
+func (in *PsbtInput) signingScript(prevScript []byte) ([]byte, bool, bool, error) {
+	script := prevScript
+	p2sh := false
+	if txscript.IsPayToScriptHash(script) {
+		if in.RedeemScript == nil {
+			return nil, false, false, errors.New("Missing redeem script")
+		}
+		script = in.RedeemScript
+		p2sh = true
+	}
+	if txscript.IsPayToWitnessScriptHash(script) {
+		if in.WitnessScript == nil {
+			return nil, false, false, errors.New("Missing witness script")
+		}
+		return in.WitnessScript, p2sh, true, nil
+	}
+	return script, p2sh, txscript.IsPayToWitnessPubKeyHash(script), nil
+}
+
+// RequiredSigs returns the number of signatures needed to spend the output with the script,
+// or 0 if it cannot be determined
+func (in *PsbtInput) RequiredSigs(prevScript []byte) int {
+	script, _, _, err := in.signingScript(prevScript)
+	if err != nil {
+		return 0
+	}
+	switch txscript.GetScriptClass(script) {
+	case txscript.PubKeyHashTy, txscript.WitnessV0PubKeyHashTy:
+		return 1
+	case txscript.MultiSigTy:
+		_, m, err := txscript.CalcMultiSigStats(script)
+		if err == nil {
+			return m
+		}
+	}
+	return 0
+}
+
+func (in *PsbtInput) partialSig(pubKey []byte) []byte {
+	for _, ps := range in.PartialSigs {
+		if bytes.Equal(ps.PubKey, pubKey) {
+			return ps.Signature
+		}
+	}
+	return nil
+}
+
+// multisigSignatures returns the signatures of the multisig script ordered by the public keys in the script
+func (in *PsbtInput) multisigSignatures(script []byte) ([][]byte, error) {
+	_, m, err := txscript.CalcMultiSigStats(script)
+	if err != nil {
+		return nil, err
+	}
+	pushes, err := txscript.PushedData(script)
+	if err != nil {
+		return nil, err
+	}
+	var sigs [][]byte
+	for _, pubKey := range pushes {
+		if sig := in.partialSig(pubKey); sig != nil {
+			sigs = append(sigs, sig)
+			if len(sigs) == m {
+				return sigs, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("Missing signatures, %d of %d", len(sigs), m)
+}
+
+// singleSignature returns the only signature and the public key of the input
+func (in *PsbtInput) singleSignature() ([]byte, []byte, error) {
+	if len(in.PartialSigs) != 1 {
+		return nil, nil, errors.Errorf("Expected one signature, got %d", len(in.PartialSigs))
+	}
+	return in.PartialSigs[0].Signature, in.PartialSigs[0].PubKey, nil
+}
+
+// FinalizeInput creates the final scriptSig and witness of the input i from the partial signatures and removes the data needed only for signing,
+// the inputs spending P2PKH, P2WPKH, multisig and P2WSH multisig outputs, also wrapped in P2SH, are supported
+func (p *Psbt) FinalizeInput(i int) error {
+	in := &p.Inputs[i]
+	if in.IsFinalized() {
+		return nil
+	}
+	prevScript := p.PrevOutScript(i)
+	if prevScript == nil {
+		return errors.New("Missing utxo")
+	}
+	script, p2sh, segwit, err := in.signingScript(prevScript)
+	if err != nil {
+		return err
+	}
+	var pushes, witness [][]byte
+	multisig := false
+	switch txscript.GetScriptClass(script) {
+	case txscript.PubKeyHashTy, txscript.WitnessV0PubKeyHashTy:
+		sig, pubKey, err := in.singleSignature()
+		if err != nil {
+			return err
+		}
+		pushes = [][]byte{sig, pubKey}
+	case txscript.MultiSigTy:
+		if pushes, err = in.multisigSignatures(script); err != nil {
+			return err
+		}
+		multisig = true
+	default:
+		return ErrPsbtUnsupportedScript
+	}
+	b := txscript.NewScriptBuilder()
+	if segwit {
+		if multisig {
+			// the dummy element consumed by OP_CHECKMULTISIG
+			witness = append([][]byte{{}}, pushes...)
+			witness = append(witness, in.WitnessScript)
+		} else {
+			witness = pushes
+		}
+	} else {
+		if multisig {
+			b.AddOp(txscript.OP_0)
+		}
+		for _, d := range pushes {
+			b.AddData(d)
+		}
+	}
+	if p2sh {
+		b.AddData(in.RedeemScript)
+	}
+	scriptSig, err := b.Script()
+	if err != nil {
+		return err
+	}
+	if len(scriptSig) > 0 {
+		in.FinalScriptSig = scriptSig
+	}
+	in.FinalScriptWitness = witness
+	in.PartialSigs = nil
+	in.RedeemScript = nil
+	in.WitnessScript = nil
+	unknowns := in.Unknowns[:0]
+	for _, kv := range in.Unknowns {
+		if kv.Key[0] != psbtInSighashType && kv.Key[0] != psbtInBip32Derivation {
+			unknowns = append(unknowns, kv)
+		}
+	}
+	in.Unknowns = unknowns
+	return nil
+}
+
+// Extract returns the signed transaction from the PSBT with all inputs finalized
+func (p *Psbt) Extract() (*wire.MsgTx, error) {
+	tx := p.UnsignedTx.Copy()
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if !in.IsFinalized() {
+			return nil, errors.Errorf("Input %d is not finalized", i)
+		}
+		tx.TxIn[i].SignatureScript = in.FinalScriptSig
+		tx.TxIn[i].Witness = in.FinalScriptWitness
+	}
+	return tx, nil
+}
@@ -0,0 +1,230 @@
+// +build unittest
+
+package btc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/martinboehm/btcd/wire"
+)
+
+func hexToBytes(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParsePsbt(t *testing.T) {
+	// spends an output of P2SH-P2WPKH with a partial signature and an unknown output
+	psbt := "cHNidP8BAH4CAAAAAgcbI8Q/ibydvyK1p6vCE0cwulbXSHvvXbfZveqK5OIFAAAAAAD/////day0lIbWuyJA/b7ypCH1+45MQ7/1ihxrUz04CfWe/e8BAAAAAP////8BQB8AAAAAAAAZdqkUP4uj/aO6e2n1gYCG4SIjxt0l48iIrAAAAAAAIgICIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIJMAYCAQECAQEBAQQWABQREREREREREREREREREREREREREQAAAA=="
+	b, err := base64.StdEncoding.DecodeString(psbt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParsePsbt(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Inputs) != 2 || len(p.Outputs) != 1 {
+		t.Fatalf("ParsePsbt got %d inputs, %d outputs", len(p.Inputs), len(p.Outputs))
+	}
+	in := &p.Inputs[0]
+	if got := hex.EncodeToString(in.RedeemScript); got != "00141111111111111111111111111111111111111111" {
+		t.Errorf("RedeemScript = %v", got)
+	}
+	wantSigs := []PsbtPartialSig{{
+		PubKey:    hexToBytes(t, "022222222222222222222222222222222222222222222222222222222222222222"),
+		Signature: hexToBytes(t, "300602010102010101"),
+	}}
+	if !reflect.DeepEqual(in.PartialSigs, wantSigs) {
+		t.Errorf("PartialSigs = %+v, want %+v", in.PartialSigs, wantSigs)
+	}
+	if p.Inputs[1].PartialSigs != nil || p.Inputs[1].IsFinalized() {
+		t.Errorf("Input 1 is not empty %+v", p.Inputs[1])
+	}
+	s, err := p.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s, b) {
+		t.Errorf("Serialize = %v, want %v", base64.StdEncoding.EncodeToString(s), psbt)
+	}
+}
+
+func TestParsePsbt_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		psbt string
+		want string
+	}{
+		{
+			name: "invalid magic",
+			psbt: "70736274000100",
+			want: "Invalid PSBT magic",
+		},
+		{
+			name: "missing unsigned tx",
+			psbt: "70736274ff00",
+			want: "Missing unsigned tx",
+		},
+		{
+			name: "duplicate key",
+			psbt: "70736274ff0100010001000100",
+			want: "global map: Duplicate key 00",
+		},
+		{
+			name: "unsigned tx with signature",
+			psbt: "70736274ff01003d020000000111111111111111111111111111111111111111111111111111111111111111110000000001aaffffffff010000000000000000000000000000",
+			want: "Unsigned tx has signatures",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePsbt(hexToBytes(t, tt.psbt))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("ParsePsbt() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPsbt_FinalizeInput(t *testing.T) {
+	pubKey1 := hexToBytes(t, "021111111111111111111111111111111111111111111111111111111111111111")
+	pubKey2 := hexToBytes(t, "022222222222222222222222222222222222222222222222222222222222222222")
+	pubKey3 := hexToBytes(t, "023333333333333333333333333333333333333333333333333333333333333333")
+	sig1 := hexToBytes(t, "30060201010201010101")
+	sig3 := hexToBytes(t, "30060201030201030101")
+	// 2 of 3 multisig of pubKey1, pubKey2, pubKey3
+	multisig := hexToBytes(t, "5221021111111111111111111111111111111111111111111111111111111111111111210222222222222222222222222222222222222222222222222222222222222222222102333333333333333333333333333333333333333333333333333333333333333353ae")
+	tests := []struct {
+		name          string
+		prevScript    string
+		input         PsbtInput
+		wantRequired  int
+		wantScriptSig string
+		wantWitness   []string
+		wantErr       string
+	}{
+		{
+			name:          "P2PKH",
+			prevScript:    "76a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac",
+			input:         PsbtInput{PartialSigs: []PsbtPartialSig{{PubKey: pubKey1, Signature: sig1}}},
+			wantRequired:  1,
+			wantScriptSig: "0a30060201010201010101" + "21" + hex.EncodeToString(pubKey1),
+		},
+		{
+			name:         "P2WPKH",
+			prevScript:   "00143f8ba3fda3ba7b69f5818086e12223c6dd25e3c8",
+			input:        PsbtInput{PartialSigs: []PsbtPartialSig{{PubKey: pubKey1, Signature: sig1}}},
+			wantRequired: 1,
+			wantWitness:  []string{hex.EncodeToString(sig1), hex.EncodeToString(pubKey1)},
+		},
+		{
+			name:       "P2SH multisig",
+			prevScript: "a914e921fc4912a315078f370d959f2c4f7b6d2a683c87",
+			input: PsbtInput{
+				PartialSigs:  []PsbtPartialSig{{PubKey: pubKey3, Signature: sig3}, {PubKey: pubKey1, Signature: sig1}},
+				RedeemScript: multisig,
+				Unknowns:     []PsbtKV{{Key: []byte{psbtInSighashType}, Value: []byte{1, 0, 0, 0}}},
+			},
+			wantRequired:  2,
+			wantScriptSig: "00" + "0a30060201010201010101" + "0a30060201030201030101" + "4c69" + hex.EncodeToString(multisig),
+		},
+		{
+			name:       "P2SH-P2WSH multisig",
+			prevScript: "a914e921fc4912a315078f370d959f2c4f7b6d2a683c87",
+			input: PsbtInput{
+				PartialSigs:   []PsbtPartialSig{{PubKey: pubKey3, Signature: sig3}, {PubKey: pubKey1, Signature: sig1}},
+				RedeemScript:  hexToBytes(t, "00201111111111111111111111111111111111111111111111111111111111111111"),
+				WitnessScript: multisig,
+			},
+			wantRequired:  2,
+			wantScriptSig: "2200201111111111111111111111111111111111111111111111111111111111111111",
+			wantWitness:   []string{"", hex.EncodeToString(sig1), hex.EncodeToString(sig3), hex.EncodeToString(multisig)},
+		},
+		{
+			name:       "P2WSH multisig missing signature",
+			prevScript: "00201111111111111111111111111111111111111111111111111111111111111111",
+			input: PsbtInput{
+				PartialSigs:   []PsbtPartialSig{{PubKey: pubKey2, Signature: sig1}},
+				WitnessScript: multisig,
+			},
+			wantRequired: 2,
+			wantErr:      "Missing signatures, 1 of 2",
+		},
+		{
+			name:       "P2SH missing redeem script",
+			prevScript: "a914e921fc4912a315078f370d959f2c4f7b6d2a683c87",
+			input:      PsbtInput{PartialSigs: []PsbtPartialSig{{PubKey: pubKey1, Signature: sig1}}},
+			wantErr:    "Missing redeem script",
+		},
+		{
+			name:       "unsupported script",
+			prevScript: "6a0401020304",
+			input:      PsbtInput{PartialSigs: []PsbtPartialSig{{PubKey: pubKey1, Signature: sig1}}},
+			wantErr:    ErrPsbtUnsupportedScript.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := wire.NewMsgTx(2)
+			tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+			tx.AddTxOut(wire.NewTxOut(1000, hexToBytes(t, "76a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac")))
+			p := &Psbt{UnsignedTx: tx, Inputs: []PsbtInput{tt.input}, Outputs: make([]PsbtOutput, 1)}
+			p.Inputs[0].WitnessUtxo = wire.NewTxOut(2000, hexToBytes(t, tt.prevScript))
+			if got := p.Inputs[0].RequiredSigs(p.PrevOutScript(0)); got != tt.wantRequired {
+				t.Errorf("RequiredSigs() = %v, want %v", got, tt.wantRequired)
+			}
+			err := p.FinalizeInput(0)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("FinalizeInput() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := &p.Inputs[0]
+			if got := hex.EncodeToString(in.FinalScriptSig); got != tt.wantScriptSig {
+				t.Errorf("FinalScriptSig = %v, want %v", got, tt.wantScriptSig)
+			}
+			var witness []string
+			for _, w := range in.FinalScriptWitness {
+				witness = append(witness, hex.EncodeToString(w))
+			}
+			if !reflect.DeepEqual(witness, tt.wantWitness) {
+				t.Errorf("FinalScriptWitness = %v, want %v", witness, tt.wantWitness)
+			}
+			if in.PartialSigs != nil || in.RedeemScript != nil || in.WitnessScript != nil || len(in.Unknowns) != 0 {
+				t.Errorf("Signing data not removed %+v", in)
+			}
+			signed, err := p.Extract()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(signed.TxIn[0].SignatureScript, in.FinalScriptSig) {
+				t.Errorf("Extract() SignatureScript = %x", signed.TxIn[0].SignatureScript)
+			}
+			// finalized input survives the serialization
+			b, err := p.Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pp, err := ParsePsbt(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pp.Inputs[0].FinalScriptSig, in.FinalScriptSig) || len(pp.Inputs[0].FinalScriptWitness) != len(in.FinalScriptWitness) {
+				t.Errorf("Parsed finalized input %+v, want %+v", pp.Inputs[0], in)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package eth
+
+import (
+	"context"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// rpcCallTrace is a frame of the call trace returned by the callTracer of the backend
+type rpcCallTrace struct {
+	Type  string          `json:"type"`
+	From  string          `json:"from"`
+	To    string          `json:"to"`
+	Value string          `json:"value"`
+	Error string          `json:"error"`
+	Calls []*rpcCallTrace `json:"calls"`
+}
+
+// rpcTraceResult is the result of tracing of one transaction of a block
+type rpcTraceResult struct {
+	Result *rpcCallTrace `json:"result"`
+	Error  string        `json:"error"`
+}
+
+// rpcInternalTransfer is a value transfer done by a contract during the execution of a transaction
+type rpcInternalTransfer struct {
+	Type  bchain.EthereumInternalTransferType `json:"type"`
+	From  string                              `json:"from"`
+	To    string                              `json:"to"`
+	Value string                              `json:"value"`
+}
+
+var callTracer = map[string]interface{}{"tracer": "callTracer"}
+
+func hasValue(value string) bool {
+	v, err := hexutil.DecodeBig(value)
+	return err == nil && v.Sign() > 0
+}
+
+func appendInternalTransfer(transfers []rpcInternalTransfer, t bchain.EthereumInternalTransferType, trace *rpcCallTrace) []rpcInternalTransfer {
+	value := trace.Value
+	if value == "" {
+		value = "0x0"
+	}
+	return append(transfers, rpcInternalTransfer{
+		Type:  t,
+		From:  EIP55AddressFromAddress(trace.From),
+		To:    EIP55AddressFromAddress(trace.To),
+		Value: value,
+	})
+}
+
+func processCallTrace(trace *rpcCallTrace, transfers []rpcInternalTransfer) []rpcInternalTransfer {
+	for _, c := range trace.Calls {
+		// reverted calls do not transfer any value, including their subcalls
+		if c.Error != "" {
+			continue
+		}
+		switch c.Type {
+		case "CALL":
+			if hasValue(c.Value) {
+				transfers = appendInternalTransfer(transfers, bchain.EthereumInternalTransferCall, c)
+			}
+		case "CREATE", "CREATE2":
+			transfers = appendInternalTransfer(transfers, bchain.EthereumInternalTransferCreate, c)
+		case "SELFDESTRUCT":
+			transfers = appendInternalTransfer(transfers, bchain.EthereumInternalTransferSelfDestruct, c)
+		}
+		transfers = processCallTrace(c, transfers)
+	}
+	return transfers
+}
+
+// getInternalTransfersFromCallTrace flattens the call trace of a transaction to the list of internal transfers
+// the top level call is the transaction itself, only the contract creation is reported as it has no to address in the transaction
+func getInternalTransfersFromCallTrace(trace *rpcCallTrace) []rpcInternalTransfer {
+	if trace == nil || trace.Error != "" {
+		return nil
+	}
+	var transfers []rpcInternalTransfer
+	if trace.Type == "CREATE" || trace.Type == "CREATE2" {
+		transfers = appendInternalTransfer(transfers, bchain.EthereumInternalTransferCreate, trace)
+	}
+	return processCallTrace(trace, transfers)
+}
+
+func (b *EthereumRPC) getInternalTransfersForBlock(blockHash string, txs []rpcTransaction) ([][]rpcInternalTransfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var traces []rpcTraceResult
+	err := b.rpc.CallContext(ctx, &traces, "debug_traceBlockByHash", blockHash, callTracer)
+	if err != nil {
+		return nil, errors.Annotatef(err, "blockHash %v", blockHash)
+	}
+	if len(traces) != len(txs) {
+		return nil, errors.Errorf("blockHash %v, trace of %d transactions instead of %d", blockHash, len(traces), len(txs))
+	}
+	r := make([][]rpcInternalTransfer, len(traces))
+	for i := range traces {
+		if traces[i].Error != "" {
+			return nil, errors.Errorf("blockHash %v, txid %v, trace error %v", blockHash, txs[i].Hash, traces[i].Error)
+		}
+		r[i] = getInternalTransfersFromCallTrace(traces[i].Result)
+	}
+	return r, nil
+}
+
+func (b *EthereumRPC) getInternalTransfersForTx(txid string) ([]rpcInternalTransfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var trace rpcCallTrace
+	err := b.rpc.CallContext(ctx, &trace, "debug_traceTransaction", ethcommon.HexToHash(txid), callTracer)
+	if err != nil {
+		return nil, errors.Annotatef(err, "txid %v", txid)
+	}
+	return getInternalTransfersFromCallTrace(&trace), nil
+}
+
+// EthereumTypeGetInternalTransfersFromTx returns internal transfers of the transaction
+func (p *EthereumParser) EthereumTypeGetInternalTransfersFromTx(tx *bchain.Tx) ([]bchain.EthereumInternalTransfer, error) {
+	csd, ok := tx.CoinSpecificData.(completeTransaction)
+	if !ok || len(csd.InternalTransfers) == 0 {
+		return nil, nil
+	}
+	r := make([]bchain.EthereumInternalTransfer, len(csd.InternalTransfers))
+	for i := range csd.InternalTransfers {
+		t := &csd.InternalTransfers[i]
+		v, err := hexutil.DecodeBig(t.Value)
+		if err != nil {
+			return nil, errors.Annotatef(err, "Value %v", t.Value)
+		}
+		r[i] = bchain.EthereumInternalTransfer{
+			Type:  t.Type,
+			From:  t.From,
+			To:    t.To,
+			Value: *v,
+		}
+	}
+	return r, nil
+}
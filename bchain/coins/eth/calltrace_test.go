@@ -0,0 +1,148 @@
+// +build unittest
+
+package eth
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+var testTx1InternalTransfers = []rpcInternalTransfer{
+	{
+		Type:  bchain.EthereumInternalTransferCall,
+		From:  "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f",
+		To:    "0x9F4981531Fda132E83C44680787Dfa7Ee31E4F8D",
+		Value: "0x2386f26fc10000",
+	},
+	{
+		Type:  bchain.EthereumInternalTransferCreate,
+		From:  "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f",
+		To:    "0x479CC461fEcd078F766eCc58533D6F69580CF3AC",
+		Value: "0x5af3107a4000",
+	},
+	{
+		Type:  bchain.EthereumInternalTransferSelfDestruct,
+		From:  "0x479CC461fEcd078F766eCc58533D6F69580CF3AC",
+		To:    "0x20cD153de35D469BA46127A0C8F18626b59a256A",
+		Value: "0x5af3107a4000",
+	},
+}
+
+func Test_getInternalTransfersFromCallTrace(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/traceblock.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var traces []rpcTraceResult
+	if err = json.Unmarshal(data, &traces); err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 {
+		t.Fatalf("got %d traces, want 2", len(traces))
+	}
+	if got := getInternalTransfersFromCallTrace(traces[0].Result); !reflect.DeepEqual(got, testTx1InternalTransfers) {
+		t.Errorf("getInternalTransfersFromCallTrace() = %+v, want %+v", got, testTx1InternalTransfers)
+	}
+	if got := getInternalTransfersFromCallTrace(traces[1].Result); got != nil {
+		t.Errorf("getInternalTransfersFromCallTrace() = %+v, want nil", got)
+	}
+
+	tests := []struct {
+		name  string
+		trace string
+		want  []rpcInternalTransfer
+	}{
+		{
+			name:  "contract creation",
+			trace: `{"type":"CREATE","from":"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97","to":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","value":"0x0","calls":[{"type":"CALL","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f","value":"0x64"}]}`,
+			want: []rpcInternalTransfer{
+				{
+					Type:  bchain.EthereumInternalTransferCreate,
+					From:  "0x3E3a3D69dc66bA10737F531ed088954a9EC89d97",
+					To:    "0x479CC461fEcd078F766eCc58533D6F69580CF3AC",
+					Value: "0x0",
+				},
+				{
+					Type:  bchain.EthereumInternalTransferCall,
+					From:  "0x479CC461fEcd078F766eCc58533D6F69580CF3AC",
+					To:    "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f",
+					Value: "0x64",
+				},
+			},
+		},
+		{
+			name:  "failed transaction",
+			trace: `{"type":"CALL","from":"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97","to":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","value":"0x0","error":"out of gas","calls":[{"type":"CALL","from":"0x479cc461fecd078f766ecc58533d6f69580cf3ac","to":"0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f","value":"0x64"}]}`,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trace rpcCallTrace
+			if err := json.Unmarshal([]byte(tt.trace), &trace); err != nil {
+				t.Fatal(err)
+			}
+			if got := getInternalTransfersFromCallTrace(&trace); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getInternalTransfersFromCallTrace() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEthereumParser_InternalTransfers(t *testing.T) {
+	p := NewEthereumParser(1)
+	tx := testTx1
+	ct := tx.CoinSpecificData.(completeTransaction)
+	ct.InternalTransfers = testTx1InternalTransfers
+	tx.CoinSpecificData = ct
+
+	packed, err := p.PackTx(&tx, 4321000, 1534858022)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := hex.EncodeToString(packed); h != dbtestdata.EthTx1InternalPacked {
+		t.Errorf("EthereumParser.PackTx() = %v, want %v", h, dbtestdata.EthTx1InternalPacked)
+	}
+	got, _, err := p.UnpackTx(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &tx) {
+		t.Errorf("EthereumParser.UnpackTx() = %+v, want %+v", got, tx)
+	}
+
+	its, err := p.EthereumTypeGetInternalTransfersFromTx(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bchain.EthereumInternalTransfer{
+		{
+			Type:  bchain.EthereumInternalTransferCall,
+			From:  "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f",
+			To:    "0x9F4981531Fda132E83C44680787Dfa7Ee31E4F8D",
+			Value: *big.NewInt(10000000000000000),
+		},
+		{
+			Type:  bchain.EthereumInternalTransferCreate,
+			From:  "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f",
+			To:    "0x479CC461fEcd078F766eCc58533D6F69580CF3AC",
+			Value: *big.NewInt(100000000000000),
+		},
+		{
+			Type:  bchain.EthereumInternalTransferSelfDestruct,
+			From:  "0x479CC461fEcd078F766eCc58533D6F69580CF3AC",
+			To:    "0x20cD153de35D469BA46127A0C8F18626b59a256A",
+			Value: *big.NewInt(100000000000000),
+		},
+	}
+	if !reflect.DeepEqual(its, want) {
+		t.Errorf("EthereumParser.EthereumTypeGetInternalTransfersFromTx() = %+v, want %+v", its, want)
+	}
+}
@@ -0,0 +1,178 @@
+package eth
+
+import (
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"golang.org/x/crypto/sha3"
+)
+
+const ensResolverSignature = "0x0178b8bf"
+const ensAddrSignature = "0x3b3b57de"
+const ensNameSignature = "0x691f3431"
+const ensReverseSuffix = ".addr.reverse"
+
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// ErrEnsNotSupported is returned if the ENS registry is not configured for the chain
+var ErrEnsNotSupported = errors.New("ENS names are not supported")
+
+// ensNormalize converts the name to the form used by the namehash, it lowercases the name and removes the emoji presentation selectors
+// the name is rejected if it contains characters not allowed in ENS names, the unicode composition is not converted, NFC form is expected
+func ensNormalize(name string) (string, error) {
+	var sb strings.Builder
+	sb.Grow(len(name))
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r == '\ufe0f':
+			continue
+		case r < 0x80:
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+				return "", errors.Errorf("Invalid character %q in name %v", r, name)
+			}
+		case r == '\u200d':
+			// zero width joiner of the emoji sequences
+		case !unicode.In(r, unicode.Letter, unicode.Mark, unicode.Number, unicode.Symbol):
+			return "", errors.Errorf("Invalid character %q in name %v", r, name)
+		}
+		sb.WriteRune(r)
+	}
+	n := sb.String()
+	for _, l := range strings.Split(n, ".") {
+		if len(l) == 0 {
+			return "", errors.Errorf("Empty label in name %v", name)
+		}
+	}
+	return n, nil
+}
+
+// ensNamehash computes the namehash of the name as defined by EIP-137
+func ensNamehash(name string) []byte {
+	node := make([]byte, 32)
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		sha := sha3.NewLegacyKeccak256()
+		sha.Write([]byte(labels[i]))
+		label := sha.Sum(nil)
+		sha = sha3.NewLegacyKeccak256()
+		sha.Write(node)
+		sha.Write(label)
+		node = sha.Sum(nil)
+	}
+	return node
+}
+
+// IsEnsName checks if the string looks like an ENS name, i.e. dot separated labels with alphabetic top level label
+func IsEnsName(s string) bool {
+	if len(s) < 3 || has0xPrefix(s) && len(s) == 42 {
+		return false
+	}
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if len(l) == 0 || strings.ContainsAny(l, " \t\r\n/?#") {
+			return false
+		}
+	}
+	for _, c := range labels[len(labels)-1] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *EthereumRPC) ensResolver(node []byte) (string, error) {
+	data, err := b.ethCall(ensResolverSignature+hex.EncodeToString(node), b.ChainConfig.EnsRegistry)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < 66 {
+		return "", nil
+	}
+	resolver, err := addressFromPaddedHex(data[:66])
+	if err != nil {
+		return "", err
+	}
+	if resolver == zeroAddress {
+		return "", nil
+	}
+	return resolver, nil
+}
+
+// EthereumTypeResolveName returns the address the ENS name resolves to, empty string if the name is not resolved
+func (b *EthereumRPC) EthereumTypeResolveName(name string) (string, error) {
+	if b.ChainConfig.EnsRegistry == "" {
+		return "", ErrEnsNotSupported
+	}
+	if !IsEnsName(name) {
+		return "", errors.Errorf("Invalid name %v", name)
+	}
+	normalized, err := ensNormalize(name)
+	if err != nil {
+		return "", err
+	}
+	node := ensNamehash(normalized)
+	resolver, err := b.ensResolver(node)
+	if err != nil || resolver == "" {
+		return "", err
+	}
+	data, err := b.ethCall(ensAddrSignature+hex.EncodeToString(node), resolver)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < 66 {
+		return "", nil
+	}
+	address, err := addressFromPaddedHex(data[:66])
+	if err != nil {
+		return "", err
+	}
+	if address == zeroAddress {
+		return "", nil
+	}
+	return address, nil
+}
+
+// EthereumTypeLookupAddress returns the ENS name of the address using the reverse resolution,
+// the name is returned only if it is normalized and resolves back to the same address, otherwise empty string
+func (b *EthereumRPC) EthereumTypeLookupAddress(addrDesc bchain.AddressDescriptor) (string, error) {
+	if b.ChainConfig.EnsRegistry == "" {
+		return "", ErrEnsNotSupported
+	}
+	if len(addrDesc) != EthereumTypeAddressDescriptorLen {
+		return "", bchain.ErrAddressMissing
+	}
+	node := ensNamehash(hex.EncodeToString(addrDesc) + ensReverseSuffix)
+	resolver, err := b.ensResolver(node)
+	if err != nil || resolver == "" {
+		return "", err
+	}
+	data, err := b.ethCall(ensNameSignature+hex.EncodeToString(node), resolver)
+	if err != nil {
+		return "", err
+	}
+	name := parseErc20StringProperty(addrDesc, data)
+	if name == "" || !IsEnsName(name) {
+		return "", nil
+	}
+	if normalized, err := ensNormalize(name); err != nil || normalized != name {
+		return "", nil
+	}
+	address, err := b.EthereumTypeResolveName(name)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(address, EIP55Address(addrDesc)) {
+		return "", nil
+	}
+	return name, nil
+}
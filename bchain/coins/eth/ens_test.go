@@ -0,0 +1,175 @@
+// +build unittest
+
+package eth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_ensNamehash(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "",
+			want: "0000000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			name: "eth",
+			want: "93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae",
+		},
+		{
+			name: "foo.eth",
+			want: "de9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(ensNamehash(tt.name)); got != tt.want {
+				t.Errorf("ensNamehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsEnsName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{s: "vitalik.eth", want: true},
+		{s: "sub.name.xyz", want: true},
+		{s: "Vitalik.ETH", want: true},
+		{s: "eth", want: false},
+		{s: "name..eth", want: false},
+		{s: ".eth", want: false},
+		{s: "name.eth2", want: false},
+		{s: "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045", want: false},
+		{s: "4321000", want: false},
+		{s: "some name.eth", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := IsEnsName(tt.s); got != tt.want {
+				t.Errorf("IsEnsName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ensNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "vitalik.eth", want: "vitalik.eth"},
+		{name: "Vitalik.ETH", want: "vitalik.eth"},
+		{name: "sub_domain-1.eth", want: "sub_domain-1.eth"},
+		{name: "ÖBB.eth", want: "öbb.eth"},
+		{name: "\u2764\ufe0f.eth", want: "\u2764.eth"},
+		{name: "bad$name.eth", wantErr: true},
+		{name: "zero\u200bwidth.eth", wantErr: true},
+		{name: "name..eth", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ensNormalize(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ensNormalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ensNormalize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ensPad returns the address as the 32 bytes result of eth_call
+func ensPad(address string) string {
+	return "0x" + strings.Repeat("0", 24) + strings.ToLower(address[2:])
+}
+
+// ensString returns the abi encoded string as the result of eth_call
+func ensString(s string) string {
+	data := hex.EncodeToString([]byte(s))
+	if l := len(data) % 64; l != 0 {
+		data += strings.Repeat("0", 64-l)
+	}
+	return fmt.Sprintf("0x%064x%064x%s", 32, len(s), data)
+}
+
+func TestEthereumRPC_EnsResolution(t *testing.T) {
+	const registry = "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e"
+	const resolver = "0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41"
+	const address = "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	f := newFixtureBackend(t, false, 0)
+	b, closeFn := newFixtureEthereumRPC(t, f, false)
+	defer closeFn()
+	addrDesc, err := b.Parser.GetAddrDescFromAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the registry is not configured for the chain
+	if _, err := b.EthereumTypeResolveName("vitalik.eth"); err != ErrEnsNotSupported {
+		t.Errorf("EthereumTypeResolveName() error = %v, want %v", err, ErrEnsNotSupported)
+	}
+	if _, err := b.EthereumTypeLookupAddress(addrDesc); err != ErrEnsNotSupported {
+		t.Errorf("EthereumTypeLookupAddress() error = %v, want %v", err, ErrEnsNotSupported)
+	}
+
+	b.ChainConfig.EnsRegistry = registry
+	node := hex.EncodeToString(ensNamehash("vitalik.eth"))
+	reverse := hex.EncodeToString(ensNamehash(hex.EncodeToString(addrDesc) + ensReverseSuffix))
+	f.ethCalls = map[string]string{
+		strings.ToLower(registry) + ensResolverSignature + node:    ensPad(resolver),
+		strings.ToLower(resolver) + ensAddrSignature + node:        ensPad(address),
+		strings.ToLower(registry) + ensResolverSignature + reverse: ensPad(resolver),
+		strings.ToLower(resolver) + ensNameSignature + reverse:     ensString("vitalik.eth"),
+	}
+	resolveTests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "vitalik.eth", want: address},
+		{name: "Vitalik.ETH", want: address},
+		{name: "unknown.eth", want: ""},
+		{name: "bad$name.eth", wantErr: true},
+	}
+	for _, tt := range resolveTests {
+		got, err := b.EthereumTypeResolveName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("EthereumTypeResolveName(%v) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("EthereumTypeResolveName(%v) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	lookupTests := []struct {
+		name    string
+		primary string
+		want    string
+	}{
+		{name: "resolves back", primary: "vitalik.eth", want: "vitalik.eth"},
+		{name: "not normalized", primary: "Vitalik.eth", want: ""},
+		{name: "does not resolve back", primary: "unknown.eth", want: ""},
+	}
+	for _, tt := range lookupTests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.ethCalls[strings.ToLower(resolver)+ensNameSignature+reverse] = ensString(tt.primary)
+			got, err := b.EthereumTypeLookupAddress(addrDesc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("EthereumTypeLookupAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -37,6 +37,11 @@ const erc20NameSignature = "0x06fdde03"
 const erc20SymbolSignature = "0x95d89b41"
 const erc20DecimalsSignature = "0x313ce567"
 const erc20BalanceOf = "0x70a08231"
+const erc1155TransferSingleEventSignature = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+const erc1155TransferBatchEventSignature = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+const erc165SupportsInterfaceSignature = "0x01ffc9a7"
+const erc721InterfaceID = "80ac58cd"
+const erc1155InterfaceID = "d9b67a26"
 
 var cachedContracts = make(map[string]*bchain.Erc20Contract)
 var cachedContractsMux sync.Mutex
@@ -56,14 +61,102 @@ func addressFromPaddedHex(s string) (string, error) {
 	return a.String(), nil
 }
 
-func erc20GetTransfersFromLog(logs []*rpcLog) ([]bchain.Erc20Transfer, error) {
-	var r []bchain.Erc20Transfer
+func tokenIdFromHex(s string) (big.Int, error) {
+	var t big.Int
+	if has0xPrefix(s) {
+		s = s[2:]
+	}
+	if _, ok := t.SetString(s, 16); !ok {
+		return t, errors.New("Data is not a number")
+	}
+	return t, nil
+}
+
+// parseUint256Words splits the data of a log to 32 byte words
+func parseUint256Words(data string) ([]big.Int, error) {
+	if has0xPrefix(data) {
+		data = data[2:]
+	}
+	if len(data)%64 != 0 {
+		return nil, errors.New("Data is not an array of words")
+	}
+	r := make([]big.Int, len(data)/64)
+	for i := range r {
+		if _, ok := r[i].SetString(data[i*64:(i+1)*64], 16); !ok {
+			return nil, errors.New("Data is not a number")
+		}
+	}
+	return r, nil
+}
+
+// parseUint256Array parses ABI encoded dynamic array of uint256 at the byte offset in the words
+func parseUint256Array(words []big.Int, offset *big.Int) ([]big.Int, error) {
+	if !offset.IsInt64() || offset.Int64()%32 != 0 {
+		return nil, errors.New("Invalid array offset")
+	}
+	i := offset.Int64() / 32
+	if i >= int64(len(words)) || !words[i].IsInt64() {
+		return nil, errors.New("Invalid array offset")
+	}
+	n := words[i].Int64()
+	if n > int64(len(words))-i-1 {
+		return nil, errors.New("Invalid array length")
+	}
+	return words[i+1 : i+1+n], nil
+}
+
+func erc1155GetTransfersFromLog(l *rpcLog, from, to string) ([]bchain.TokenTransfer, error) {
+	words, err := parseUint256Words(l.Data)
+	if err != nil {
+		return nil, err
+	}
+	var ids, values []big.Int
+	if l.Topics[0] == erc1155TransferSingleEventSignature {
+		if len(words) != 2 {
+			return nil, errors.New("Invalid TransferSingle data")
+		}
+		ids, values = words[:1], words[1:]
+	} else {
+		if len(words) < 2 {
+			return nil, errors.New("Invalid TransferBatch data")
+		}
+		if ids, err = parseUint256Array(words, &words[0]); err != nil {
+			return nil, err
+		}
+		if values, err = parseUint256Array(words, &words[1]); err != nil {
+			return nil, err
+		}
+		if len(ids) != len(values) {
+			return nil, errors.New("Invalid TransferBatch data")
+		}
+	}
+	r := make([]bchain.TokenTransfer, len(ids))
+	for i := range ids {
+		r[i] = bchain.TokenTransfer{
+			Standard: bchain.TokenStandardERC1155,
+			Contract: EIP55AddressFromAddress(l.Address),
+			From:     EIP55AddressFromAddress(from),
+			To:       EIP55AddressFromAddress(to),
+			TokenId:  ids[i],
+			Value:    values[i],
+		}
+	}
+	return r, nil
+}
+
+// getTokenTransfersFromLog parses ERC20, ERC721 and ERC1155 token transfers from the logs
+// ERC20 and ERC721 share the Transfer event, ERC721 has the tokenId indexed as the fourth topic
+// ERC1155 transfers are TransferSingle and TransferBatch events, the batch is returned as separate transfers
+func getTokenTransfersFromLog(logs []*rpcLog) ([]bchain.TokenTransfer, error) {
+	var r []bchain.TokenTransfer
 	for _, l := range logs {
-		if len(l.Topics) == 3 && l.Topics[0] == erc20TransferEventSignature {
-			var t big.Int
-			_, ok := t.SetString(l.Data, 0)
-			if !ok {
-				return nil, errors.New("Data is not a number")
+		if len(l.Topics) == 0 {
+			continue
+		}
+		switch l.Topics[0] {
+		case erc20TransferEventSignature:
+			if len(l.Topics) != 3 && len(l.Topics) != 4 {
+				continue
 			}
 			from, err := addressFromPaddedHex(l.Topics[1])
 			if err != nil {
@@ -73,19 +166,46 @@ func erc20GetTransfersFromLog(logs []*rpcLog) ([]bchain.Erc20Transfer, error) {
 			if err != nil {
 				return nil, err
 			}
-			r = append(r, bchain.Erc20Transfer{
+			t := bchain.TokenTransfer{
 				Contract: EIP55AddressFromAddress(l.Address),
 				From:     EIP55AddressFromAddress(from),
 				To:       EIP55AddressFromAddress(to),
-				Tokens:   t,
-			})
+			}
+			if len(l.Topics) == 3 {
+				if _, ok := t.Value.SetString(l.Data, 0); !ok {
+					return nil, errors.New("Data is not a number")
+				}
+			} else {
+				t.Standard = bchain.TokenStandardERC721
+				if t.TokenId, err = tokenIdFromHex(l.Topics[3]); err != nil {
+					return nil, err
+				}
+			}
+			r = append(r, t)
+		case erc1155TransferSingleEventSignature, erc1155TransferBatchEventSignature:
+			if len(l.Topics) != 4 {
+				continue
+			}
+			from, err := addressFromPaddedHex(l.Topics[2])
+			if err != nil {
+				return nil, err
+			}
+			to, err := addressFromPaddedHex(l.Topics[3])
+			if err != nil {
+				return nil, err
+			}
+			t, err := erc1155GetTransfersFromLog(l, from, to)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, t...)
 		}
 	}
 	return r, nil
 }
 
-func erc20GetTransfersFromTx(tx *rpcTransaction) ([]bchain.Erc20Transfer, error) {
-	var r []bchain.Erc20Transfer
+func erc20GetTransfersFromTx(tx *rpcTransaction) ([]bchain.TokenTransfer, error) {
+	var r []bchain.TokenTransfer
 	if len(tx.Payload) == 128+len(erc20TransferMethodSignature) && strings.HasPrefix(tx.Payload, erc20TransferMethodSignature) {
 		to, err := addressFromPaddedHex(tx.Payload[len(erc20TransferMethodSignature) : 64+len(erc20TransferMethodSignature)])
 		if err != nil {
@@ -96,11 +216,11 @@ func erc20GetTransfersFromTx(tx *rpcTransaction) ([]bchain.Erc20Transfer, error)
 		if !ok {
 			return nil, errors.New("Data is not a number")
 		}
-		r = append(r, bchain.Erc20Transfer{
+		r = append(r, bchain.TokenTransfer{
 			Contract: EIP55AddressFromAddress(tx.To),
 			From:     EIP55AddressFromAddress(tx.From),
 			To:       EIP55AddressFromAddress(to),
-			Tokens:   t,
+			Value:    t,
 		})
 	}
 	return r, nil
@@ -183,49 +303,108 @@ func (b *EthereumRPC) EthereumTypeGetErc20ContractInfo(contractDesc bchain.Addre
 	contract, found := cachedContracts[cds]
 	cachedContractsMux.Unlock()
 	if !found {
-		address := EIP55Address(contractDesc)
-		data, err := b.ethCall(erc20NameSignature, address)
-		if err != nil {
-			// ignore the error from the eth_call - since geth v1.9.15 they changed the behavior
-			// and returning error "execution reverted" for some non contract addresses
-			// https://github.com/ethereum/go-ethereum/issues/21249#issuecomment-648647672
-			glog.Warning(errors.Annotatef(err, "erc20NameSignature %v", address))
-			return nil, nil
+		var cacheable bool
+		contract, cacheable = b.fetchErc20ContractInfo(contractDesc)
+		if cacheable {
+			cachedContractsMux.Lock()
+			cachedContracts[cds] = contract
+			cachedContractsMux.Unlock()
+		}
+	}
+	return contract, nil
+}
+
+// EthereumTypeRefreshErc20ContractInfo returns information about ERC20 contract fetched from the backend, bypassing the cache
+// nil is returned if the address is not a token contract, error if the information could not be fetched
+func (b *EthereumRPC) EthereumTypeRefreshErc20ContractInfo(contractDesc bchain.AddressDescriptor) (*bchain.Erc20Contract, error) {
+	contract, cacheable := b.fetchErc20ContractInfo(contractDesc)
+	if !cacheable {
+		return nil, errors.Errorf("Cannot fetch contract info of %v", EIP55Address(contractDesc))
+	}
+	cachedContractsMux.Lock()
+	cachedContracts[string(contractDesc)] = contract
+	cachedContractsMux.Unlock()
+	return contract, nil
+}
+
+// fetchErc20ContractInfo gets information about the contract using eth_call
+// the returned bool is false if the information could not be fetched and must not be cached
+func (b *EthereumRPC) fetchErc20ContractInfo(contractDesc bchain.AddressDescriptor) (*bchain.Erc20Contract, bool) {
+	var contract *bchain.Erc20Contract
+	address := EIP55Address(contractDesc)
+	data, err := b.ethCall(erc20NameSignature, address)
+	if err != nil {
+		// ignore the error from the eth_call - since geth v1.9.15 they changed the behavior
+		// and returning error "execution reverted" for some non contract addresses
+		// https://github.com/ethereum/go-ethereum/issues/21249#issuecomment-648647672
+		// the contract may also be a NFT without the optional name method
+		glog.Warning(errors.Annotatef(err, "erc20NameSignature %v", address))
+		standard := b.getNftStandard(contractDesc, address)
+		if standard == bchain.TokenStandardERC20 {
+			return nil, false
 			// return nil, errors.Annotatef(err, "erc20NameSignature %v", address)
 		}
-		name := parseErc20StringProperty(contractDesc, data)
-		if name != "" {
-			data, err = b.ethCall(erc20SymbolSignature, address)
-			if err != nil {
-				glog.Warning(errors.Annotatef(err, "erc20SymbolSignature %v", address))
-				return nil, nil
-				// return nil, errors.Annotatef(err, "erc20SymbolSignature %v", address)
-			}
-			symbol := parseErc20StringProperty(contractDesc, data)
+		contract = &bchain.Erc20Contract{
+			Contract: address,
+			Standard: standard,
+		}
+	} else if name := parseErc20StringProperty(contractDesc, data); name != "" {
+		data, err = b.ethCall(erc20SymbolSignature, address)
+		if err != nil {
+			glog.Warning(errors.Annotatef(err, "erc20SymbolSignature %v", address))
+			return nil, false
+			// return nil, errors.Annotatef(err, "erc20SymbolSignature %v", address)
+		}
+		symbol := parseErc20StringProperty(contractDesc, data)
+		contract = &bchain.Erc20Contract{
+			Contract: address,
+			Name:     name,
+			Symbol:   symbol,
+			Standard: b.getNftStandard(contractDesc, address),
+		}
+		// NFTs are not divisible
+		if contract.Standard == bchain.TokenStandardERC20 {
 			data, err = b.ethCall(erc20DecimalsSignature, address)
 			if err != nil {
 				glog.Warning(errors.Annotatef(err, "erc20DecimalsSignature %v", address))
 				// return nil, errors.Annotatef(err, "erc20DecimalsSignature %v", address)
 			}
-			contract = &bchain.Erc20Contract{
-				Contract: address,
-				Name:     name,
-				Symbol:   symbol,
-			}
 			d := parseErc20NumericProperty(contractDesc, data)
 			if d != nil {
 				contract.Decimals = int(uint8(d.Uint64()))
 			} else {
 				contract.Decimals = EtherAmountDecimalPoint
 			}
-		} else {
-			contract = nil
 		}
-		cachedContractsMux.Lock()
-		cachedContracts[cds] = contract
-		cachedContractsMux.Unlock()
+	} else if data != "0x" {
+		if standard := b.getNftStandard(contractDesc, address); standard != bchain.TokenStandardERC20 {
+			contract = &bchain.Erc20Contract{
+				Contract: address,
+				Standard: standard,
+			}
+		}
 	}
-	return contract, nil
+	return contract, true
+}
+
+func (b *EthereumRPC) supportsInterface(contractDesc bchain.AddressDescriptor, address string, interfaceID string) bool {
+	data, err := b.ethCall(erc165SupportsInterfaceSignature+interfaceID+"00000000000000000000000000000000000000000000000000000000", address)
+	if err != nil {
+		return false
+	}
+	r := parseErc20NumericProperty(contractDesc, data)
+	return r != nil && r.Cmp(big.NewInt(1)) == 0
+}
+
+// getNftStandard detects the standard of the contract using ERC165 supportsInterface, ERC20 is returned if it is not a NFT contract
+func (b *EthereumRPC) getNftStandard(contractDesc bchain.AddressDescriptor, address string) bchain.TokenStandard {
+	if b.supportsInterface(contractDesc, address, erc721InterfaceID) {
+		return bchain.TokenStandardERC721
+	}
+	if b.supportsInterface(contractDesc, address, erc1155InterfaceID) {
+		return bchain.TokenStandardERC1155
+	}
+	return bchain.TokenStandardERC20
 }
 
 // EthereumTypeGetErc20ContractBalance returns balance of ERC20 contract for given address
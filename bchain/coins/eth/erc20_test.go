@@ -12,11 +12,11 @@ import (
 	"github.com/trezor/blockbook/tests/dbtestdata"
 )
 
-func TestErc20_erc20GetTransfersFromLog(t *testing.T) {
+func TestErc20_getTokenTransfersFromLog(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    []*rpcLog
-		want    []bchain.Erc20Transfer
+		want    []bchain.TokenTransfer
 		wantErr bool
 	}{
 		{
@@ -32,12 +32,12 @@ func TestErc20_erc20GetTransfersFromLog(t *testing.T) {
 					Data: "0x0000000000000000000000000000000000000000000000000000000000000123",
 				},
 			},
-			want: []bchain.Erc20Transfer{
+			want: []bchain.TokenTransfer{
 				{
 					Contract: "0x76a45e8976499ab9ae223cc584019341d5a84e96",
 					From:     "0x2aacf811ac1a60081ea39f7783c0d26c500871a8",
 					To:       "0xe9a5216ff992cfa01594d43501a56e12769eb9d2",
-					Tokens:   *big.NewInt(0x123),
+					Value:    *big.NewInt(0x123),
 				},
 			},
 		},
@@ -82,32 +82,123 @@ func TestErc20_erc20GetTransfersFromLog(t *testing.T) {
 					Data: "0x0000000000000000000000004bda106325c335df99eab7fe363cac8a0ba2a24d000000000000000000000000c778417e063141139fce010982780140aa0cd5ab0000000000000000000000000d0f936ee4c93e25944694d6c121de94d9760f1100000000000000000000000000000000000000000000000000031855667df7a80000000000000000000000000000000000000000000000006a8313d60b1f800000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
 				},
 			},
-			want: []bchain.Erc20Transfer{
+			want: []bchain.TokenTransfer{
 				{
 					Contract: "0x0d0f936ee4c93e25944694d6c121de94d9760f11",
 					From:     "0x6f44cceb49b4a5812d54b6f494fc2febf25511ed",
 					To:       "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
-					Tokens:   *big.NewInt(0x6a8313d60b1f606b),
+					Value:    *big.NewInt(0x6a8313d60b1f606b),
 				},
 				{
 					Contract: "0xc778417e063141139fce010982780140aa0cd5ab",
 					From:     "0x4bda106325c335df99eab7fe363cac8a0ba2a24d",
 					To:       "0x6f44cceb49b4a5812d54b6f494fc2febf25511ed",
-					Tokens:   *big.NewInt(0x308fd0e798ac0),
+					Value:    *big.NewInt(0x308fd0e798ac0),
 				},
 			},
 		},
+		{
+			name: "ERC721",
+			args: []*rpcLog{
+				{
+					Address: "0x5d4aa6ff9de7963ead5a17b454dc1093ca9e98e7",
+					Topics: []string{
+						"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+						"0x0000000000000000000000000000000000000000000000000000000000000000",
+						"0x000000000000000000000000837e3f699d85a4b0b99894567e9233dfb1dcb081",
+						"0x0000000000000000000000000000000000000000000000000000000000000cae",
+					},
+					Data: "0x",
+				},
+			},
+			want: []bchain.TokenTransfer{
+				{
+					Standard: bchain.TokenStandardERC721,
+					Contract: "0x5d4aa6ff9de7963ead5a17b454dc1093ca9e98e7",
+					From:     "0x0000000000000000000000000000000000000000",
+					To:       "0x837e3f699d85a4b0b99894567e9233dfb1dcb081",
+					TokenId:  *big.NewInt(0xcae),
+				},
+			},
+		},
+		{
+			name: "ERC1155",
+			args: []*rpcLog{
+				{ // TransferSingle
+					Address: "0x6fad73936527d2a82aea5384d252462941b44042",
+					Topics: []string{
+						"0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62",
+						"0x0000000000000000000000009248a6048a58db9f0212dc7cd85ee8741128be72",
+						"0x0000000000000000000000000000000000000000000000000000000000000000",
+						"0x0000000000000000000000009248a6048a58db9f0212dc7cd85ee8741128be72",
+					},
+					Data: "0x00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000096",
+				},
+				{ // TransferBatch
+					Address: "0x6fad73936527d2a82aea5384d252462941b44042",
+					Topics: []string{
+						"0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb",
+						"0x0000000000000000000000009248a6048a58db9f0212dc7cd85ee8741128be72",
+						"0x0000000000000000000000009248a6048a58db9f0212dc7cd85ee8741128be72",
+						"0x000000000000000000000000837e3f699d85a4b0b99894567e9233dfb1dcb081",
+					},
+					Data: "0x000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000a00000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000a0000000000000000000000000000000000000000000000000000000000000014",
+				},
+			},
+			want: []bchain.TokenTransfer{
+				{
+					Standard: bchain.TokenStandardERC1155,
+					Contract: "0x6fad73936527d2a82aea5384d252462941b44042",
+					From:     "0x0000000000000000000000000000000000000000",
+					To:       "0x9248a6048a58db9f0212dc7cd85ee8741128be72",
+					TokenId:  *big.NewInt(1),
+					Value:    *big.NewInt(0x96),
+				},
+				{
+					Standard: bchain.TokenStandardERC1155,
+					Contract: "0x6fad73936527d2a82aea5384d252462941b44042",
+					From:     "0x9248a6048a58db9f0212dc7cd85ee8741128be72",
+					To:       "0x837e3f699d85a4b0b99894567e9233dfb1dcb081",
+					TokenId:  *big.NewInt(1),
+					Value:    *big.NewInt(10),
+				},
+				{
+					Standard: bchain.TokenStandardERC1155,
+					Contract: "0x6fad73936527d2a82aea5384d252462941b44042",
+					From:     "0x9248a6048a58db9f0212dc7cd85ee8741128be72",
+					To:       "0x837e3f699d85a4b0b99894567e9233dfb1dcb081",
+					TokenId:  *big.NewInt(2),
+					Value:    *big.NewInt(20),
+				},
+			},
+		},
+		{
+			name: "ERC1155 invalid batch",
+			args: []*rpcLog{
+				{
+					Address: "0x6fad73936527d2a82aea5384d252462941b44042",
+					Topics: []string{
+						"0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb",
+						"0x0000000000000000000000009248a6048a58db9f0212dc7cd85ee8741128be72",
+						"0x0000000000000000000000009248a6048a58db9f0212dc7cd85ee8741128be72",
+						"0x000000000000000000000000837e3f699d85a4b0b99894567e9233dfb1dcb081",
+					},
+					Data: "0x000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000a00000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000005",
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := erc20GetTransfersFromLog(tt.args)
+			got, err := getTokenTransfersFromLog(tt.args)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("erc20GetTransfersFromLog error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("getTokenTransfersFromLog error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			// the addresses could have different case
 			if strings.ToLower(fmt.Sprint(got)) != strings.ToLower(fmt.Sprint(tt.want)) {
-				t.Errorf("erc20GetTransfersFromLog = %+v, want %+v", got, tt.want)
+				t.Errorf("getTokenTransfersFromLog = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
@@ -168,22 +259,22 @@ func TestErc20_erc20GetTransfersFromTx(t *testing.T) {
 	tests := []struct {
 		name string
 		args *rpcTransaction
-		want []bchain.Erc20Transfer
+		want []bchain.TokenTransfer
 	}{
 		{
 			name: "0",
 			args: (b.Txs[0].CoinSpecificData.(completeTransaction)).Tx,
-			want: []bchain.Erc20Transfer{},
+			want: []bchain.TokenTransfer{},
 		},
 		{
 			name: "1",
 			args: (b.Txs[1].CoinSpecificData.(completeTransaction)).Tx,
-			want: []bchain.Erc20Transfer{
+			want: []bchain.TokenTransfer{
 				{
 					Contract: "0x4af4114f73d1c1c903ac9e0361b379d1291808a2",
 					From:     "0x20cd153de35d469ba46127a0c8f18626b59a256a",
 					To:       "0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f",
-					Tokens:   *bn,
+					Value:    *bn,
 				},
 			},
 		},
@@ -21,11 +21,13 @@ const EtherAmountDecimalPoint = 18
 // EthereumParser handle
 type EthereumParser struct {
 	*bchain.BaseParser
+	// ProcessEventLogs enables indexing of all event logs by contract and topic
+	ProcessEventLogs bool
 }
 
 // NewEthereumParser returns new EthereumParser instance
 func NewEthereumParser(b int) *EthereumParser {
-	return &EthereumParser{&bchain.BaseParser{
+	return &EthereumParser{BaseParser: &bchain.BaseParser{
 		BlockAddressesToKeep: b,
 		AmountDecimalPoint:   EtherAmountDecimalPoint,
 	}}
@@ -53,6 +55,10 @@ type rpcTransaction struct {
 	BlockHash        string `json:"blockHash,omitempty"`
 	From             string `json:"from"`
 	TransactionIndex string `json:"transactionIndex"`
+	// EIP-2718 transaction type and EIP-1559 fee parameters, not present in legacy transactions
+	Type                 string `json:"type,omitempty"`
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
 	// Signature values - ignored
 	// V string `json:"v"`
 	// R string `json:"r"`
@@ -71,14 +77,27 @@ type rpcLogWithTxHash struct {
 }
 
 type rpcReceipt struct {
-	GasUsed string    `json:"gasUsed"`
-	Status  string    `json:"status"`
-	Logs    []*rpcLog `json:"logs"`
+	GasUsed           string    `json:"gasUsed"`
+	Status            string    `json:"status"`
+	Logs              []*rpcLog `json:"logs"`
+	EffectiveGasPrice string    `json:"effectiveGasPrice,omitempty"`
+	ContractAddress   string    `json:"contractAddress,omitempty"`
+}
+
+// createdContract returns the address of the contract created by the transaction, empty if no contract was created
+func (r *rpcReceipt) createdContract() string {
+	if r == nil || len(r.ContractAddress) <= 2 || r.Status == "0x0" {
+		return ""
+	}
+	return r.ContractAddress
 }
 
 type completeTransaction struct {
-	Tx      *rpcTransaction `json:"tx"`
-	Receipt *rpcReceipt     `json:"receipt,omitempty"`
+	Tx                *rpcTransaction       `json:"tx"`
+	Receipt           *rpcReceipt           `json:"receipt,omitempty"`
+	InternalTransfers []rpcInternalTransfer `json:"internalTransfers,omitempty"`
+	// keccak256 hash of the code of the created contract, set only during the sync
+	ContractCodeHash string `json:"contractCodeHash,omitempty"`
 }
 
 type rpcBlockTransactions struct {
@@ -113,6 +132,12 @@ func (p *EthereumParser) ethTxToTx(tx *rpcTransaction, receipt *rpcReceipt, bloc
 			tx.To = EIP55AddressFromAddress(tx.To)
 		}
 		ta = []string{tx.To}
+	} else if contract := receipt.createdContract(); contract != "" {
+		// contract creation, the created contract is used as the output address
+		if fixEIP55 {
+			receipt.ContractAddress = EIP55AddressFromAddress(contract)
+		}
+		ta = []string{receipt.ContractAddress}
 	}
 	if fixEIP55 && receipt != nil && receipt.Logs != nil {
 		for _, l := range receipt.Logs {
@@ -239,6 +264,18 @@ func hexDecode(s string) ([]byte, error) {
 	return b, nil
 }
 
+// DecodeTopic decodes hex encoded topic of the event log
+func DecodeTopic(s string) ([]byte, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, errors.Errorf("Invalid topic length %d", len(b))
+	}
+	return b, nil
+}
+
 func hexDecodeBig(s string) ([]byte, error) {
 	b, err := hexutil.DecodeBig(s)
 	if err != nil {
@@ -306,6 +343,22 @@ func (p *EthereumParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) (
 	if pt.Tx.Value, err = hexDecodeBig(r.Tx.Value); err != nil {
 		return nil, errors.Annotatef(err, "Value %v", r.Tx.Value)
 	}
+	if r.Tx.Type != "" {
+		if n, err = hexutil.DecodeUint64(r.Tx.Type); err != nil {
+			return nil, errors.Annotatef(err, "Type %v", r.Tx.Type)
+		}
+		pt.Tx.Type = uint32(n)
+	}
+	if r.Tx.MaxFeePerGas != "" {
+		if pt.Tx.MaxFeePerGas, err = hexDecodeBig(r.Tx.MaxFeePerGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxFeePerGas %v", r.Tx.MaxFeePerGas)
+		}
+	}
+	if r.Tx.MaxPriorityFeePerGas != "" {
+		if pt.Tx.MaxPriorityFeePerGas, err = hexDecodeBig(r.Tx.MaxPriorityFeePerGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxPriorityFeePerGas %v", r.Tx.MaxPriorityFeePerGas)
+		}
+	}
 	if r.Receipt != nil {
 		pt.Receipt = &ProtoCompleteTransaction_ReceiptType{}
 		if pt.Receipt.GasUsed, err = hexDecodeBig(r.Receipt.GasUsed); err != nil {
@@ -320,6 +373,14 @@ func (p *EthereumParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) (
 			// there is a potential for conflict with value 0x55 but this is not used by any chain at this moment
 			pt.Receipt.Status = []byte{'U'}
 		}
+		if r.Receipt.EffectiveGasPrice != "" {
+			if pt.Receipt.EffectiveGasPrice, err = hexDecodeBig(r.Receipt.EffectiveGasPrice); err != nil {
+				return nil, errors.Annotatef(err, "EffectiveGasPrice %v", r.Receipt.EffectiveGasPrice)
+			}
+		}
+		if pt.Receipt.ContractAddress, err = hexDecode(r.Receipt.ContractAddress); err != nil {
+			return nil, errors.Annotatef(err, "ContractAddress %v", r.Receipt.ContractAddress)
+		}
 		ptLogs := make([]*ProtoCompleteTransaction_ReceiptType_LogType, len(r.Receipt.Logs))
 		for i, l := range r.Receipt.Logs {
 			a, err := hexutil.Decode(l.Address)
@@ -346,6 +407,23 @@ func (p *EthereumParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) (
 		}
 		pt.Receipt.Log = ptLogs
 	}
+	if len(r.InternalTransfers) > 0 {
+		pt.InternalTransfers = make([]*ProtoCompleteTransaction_InternalTransferType, len(r.InternalTransfers))
+		for i := range r.InternalTransfers {
+			t := &r.InternalTransfers[i]
+			it := &ProtoCompleteTransaction_InternalTransferType{Type: uint32(t.Type)}
+			if it.From, err = hexDecode(t.From); err != nil {
+				return nil, errors.Annotatef(err, "InternalTransfer From %v", t.From)
+			}
+			if it.To, err = hexDecode(t.To); err != nil {
+				return nil, errors.Annotatef(err, "InternalTransfer To %v", t.To)
+			}
+			if it.Value, err = hexDecodeBig(t.Value); err != nil {
+				return nil, errors.Annotatef(err, "InternalTransfer Value %v", t.Value)
+			}
+			pt.InternalTransfers[i] = it
+		}
+	}
 	return proto.Marshal(pt)
 }
 
@@ -371,6 +449,14 @@ func (p *EthereumParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
 		TransactionIndex: hexutil.EncodeUint64(uint64(pt.Tx.TransactionIndex)),
 		Value:            hexEncodeBig(pt.Tx.Value),
 	}
+	// legacy transactions and transactions stored by older versions do not have the type and EIP-1559 fields
+	if pt.Tx.Type != 0 {
+		rt.Type = hexutil.EncodeUint64(uint64(pt.Tx.Type))
+	}
+	if len(pt.Tx.MaxFeePerGas) > 0 || pt.Tx.Type >= 2 {
+		rt.MaxFeePerGas = hexEncodeBig(pt.Tx.MaxFeePerGas)
+		rt.MaxPriorityFeePerGas = hexEncodeBig(pt.Tx.MaxPriorityFeePerGas)
+	}
 	var rr *rpcReceipt
 	if pt.Receipt != nil {
 		logs := make([]*rpcLog, len(pt.Receipt.Log))
@@ -395,11 +481,30 @@ func (p *EthereumParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
 			Status:  status,
 			Logs:    logs,
 		}
+		if len(pt.Receipt.EffectiveGasPrice) > 0 {
+			rr.EffectiveGasPrice = hexEncodeBig(pt.Receipt.EffectiveGasPrice)
+		}
+		if len(pt.Receipt.ContractAddress) > 0 {
+			rr.ContractAddress = EIP55Address(pt.Receipt.ContractAddress)
+		}
 	}
 	tx, err := p.ethTxToTx(&rt, rr, int64(pt.BlockTime), 0, false)
 	if err != nil {
 		return nil, 0, err
 	}
+	if len(pt.InternalTransfers) > 0 {
+		ct := tx.CoinSpecificData.(completeTransaction)
+		ct.InternalTransfers = make([]rpcInternalTransfer, len(pt.InternalTransfers))
+		for i, t := range pt.InternalTransfers {
+			ct.InternalTransfers[i] = rpcInternalTransfer{
+				Type:  bchain.EthereumInternalTransferType(t.Type),
+				From:  EIP55Address(t.From),
+				To:    EIP55Address(t.To),
+				Value: hexEncodeBig(t.Value),
+			}
+		}
+		tx.CoinSpecificData = ct
+	}
 	return tx, pt.BlockNumber, nil
 }
 
@@ -454,14 +559,14 @@ func GetHeightFromTx(tx *bchain.Tx) (uint32, error) {
 	return uint32(n), nil
 }
 
-// EthereumTypeGetErc20FromTx returns Erc20 data from bchain.Tx
-func (p *EthereumParser) EthereumTypeGetErc20FromTx(tx *bchain.Tx) ([]bchain.Erc20Transfer, error) {
-	var r []bchain.Erc20Transfer
+// EthereumTypeGetTokenTransfersFromTx returns token transfers from bchain.Tx
+func (p *EthereumParser) EthereumTypeGetTokenTransfersFromTx(tx *bchain.Tx) ([]bchain.TokenTransfer, error) {
+	var r []bchain.TokenTransfer
 	var err error
 	csd, ok := tx.CoinSpecificData.(completeTransaction)
 	if ok {
 		if csd.Receipt != nil {
-			r, err = erc20GetTransfersFromLog(csd.Receipt.Logs)
+			r, err = getTokenTransfersFromLog(csd.Receipt.Logs)
 		} else {
 			r, err = erc20GetTransfersFromTx(csd.Tx)
 		}
@@ -483,14 +588,76 @@ const (
 	TxStatusOK
 )
 
+// EthereumTypeGetEventLogsFromTx returns the event logs of the transaction if the indexing of event logs is enabled
+func (p *EthereumParser) EthereumTypeGetEventLogsFromTx(tx *bchain.Tx) ([]bchain.EthereumEventLog, error) {
+	if !p.ProcessEventLogs {
+		return nil, nil
+	}
+	csd, ok := tx.CoinSpecificData.(completeTransaction)
+	if !ok || csd.Receipt == nil || len(csd.Receipt.Logs) == 0 {
+		return nil, nil
+	}
+	r := make([]bchain.EthereumEventLog, len(csd.Receipt.Logs))
+	for i, l := range csd.Receipt.Logs {
+		r[i] = bchain.EthereumEventLog{
+			Contract: EIP55AddressFromAddress(l.Address),
+			Topics:   l.Topics,
+			Data:     l.Data,
+		}
+	}
+	return r, nil
+}
+
+// EthereumTypeGetContractCreationFromTx returns the contract created by the transaction, nil if the transaction did not create a contract
+func (p *EthereumParser) EthereumTypeGetContractCreationFromTx(tx *bchain.Tx) (*bchain.EthereumContractCreation, error) {
+	csd, ok := tx.CoinSpecificData.(completeTransaction)
+	if !ok || csd.Tx == nil || len(csd.Tx.To) > 2 {
+		return nil, nil
+	}
+	contract := csd.Receipt.createdContract()
+	if contract == "" {
+		return nil, nil
+	}
+	return &bchain.EthereumContractCreation{
+		Contract: contract,
+		Creator:  csd.Tx.From,
+		CodeHash: csd.ContractCodeHash,
+	}, nil
+}
+
+// EthereumTypeGetNonceFromTx returns the nonce of the transaction
+func (p *EthereumParser) EthereumTypeGetNonceFromTx(tx *bchain.Tx) (uint64, error) {
+	csd, ok := tx.CoinSpecificData.(completeTransaction)
+	if !ok || csd.Tx == nil {
+		return 0, errors.New("Missing CoinSpecificData")
+	}
+	n, err := hexutil.DecodeUint64(csd.Tx.AccountNonce)
+	if err != nil {
+		return 0, errors.Annotatef(err, "txid %v", tx.Txid)
+	}
+	return n, nil
+}
+
 // EthereumTxData contains ethereum specific transaction data
 type EthereumTxData struct {
-	Status   TxStatus `json:"status"` // 1 OK, 0 Fail, -1 pending, -2 unknown
-	Nonce    uint64   `json:"nonce"`
-	GasLimit *big.Int `json:"gaslimit"`
-	GasUsed  *big.Int `json:"gasused"`
-	GasPrice *big.Int `json:"gasprice"`
-	Data     string   `json:"data"`
+	Status               TxStatus `json:"status"` // 1 OK, 0 Fail, -1 pending, -2 unknown
+	Nonce                uint64   `json:"nonce"`
+	GasLimit             *big.Int `json:"gaslimit"`
+	GasUsed              *big.Int `json:"gasused"`
+	GasPrice             *big.Int `json:"gasprice"`
+	Data                 string   `json:"data"`
+	Type                 uint64   `json:"type"`
+	MaxFeePerGas         *big.Int `json:"maxfeepergas,omitempty"`
+	MaxPriorityFeePerGas *big.Int `json:"maxpriorityfeepergas,omitempty"`
+	EffectiveGasPrice    *big.Int `json:"effectivegasprice,omitempty"`
+}
+
+// FeeGasPrice returns the price of gas paid by the transaction, the effective gas price if known
+func (etd *EthereumTxData) FeeGasPrice() *big.Int {
+	if etd.EffectiveGasPrice != nil {
+		return etd.EffectiveGasPrice
+	}
+	return etd.GasPrice
 }
 
 // GetEthereumTxData returns EthereumTxData from bchain.Tx
@@ -508,6 +675,15 @@ func GetEthereumTxDataFromSpecificData(coinSpecificData interface{}) *EthereumTx
 			etd.GasLimit, _ = hexutil.DecodeBig(csd.Tx.GasLimit)
 			etd.GasPrice, _ = hexutil.DecodeBig(csd.Tx.GasPrice)
 			etd.Data = csd.Tx.Payload
+			if csd.Tx.Type != "" {
+				etd.Type, _ = hexutil.DecodeUint64(csd.Tx.Type)
+			}
+			if csd.Tx.MaxFeePerGas != "" {
+				etd.MaxFeePerGas, _ = hexutil.DecodeBig(csd.Tx.MaxFeePerGas)
+			}
+			if csd.Tx.MaxPriorityFeePerGas != "" {
+				etd.MaxPriorityFeePerGas, _ = hexutil.DecodeBig(csd.Tx.MaxPriorityFeePerGas)
+			}
 		}
 		if csd.Receipt != nil {
 			switch csd.Receipt.Status {
@@ -519,6 +695,9 @@ func GetEthereumTxDataFromSpecificData(coinSpecificData interface{}) *EthereumTx
 				etd.Status = TxStatusFailure
 			}
 			etd.GasUsed, _ = hexutil.DecodeBig(csd.Receipt.GasUsed)
+			if csd.Receipt.EffectiveGasPrice != "" {
+				etd.EffectiveGasPrice, _ = hexutil.DecodeBig(csd.Receipt.EffectiveGasPrice)
+			}
 		}
 	}
 	return &etd
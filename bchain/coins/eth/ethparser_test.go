@@ -400,3 +400,112 @@ func TestEthereumParser_GetEthereumTxData(t *testing.T) {
 		})
 	}
 }
+
+func TestEthereumParser_Eip1559(t *testing.T) {
+	p := NewEthereumParser(1)
+	tx := testTx1
+	ct := tx.CoinSpecificData.(completeTransaction)
+	rt := *ct.Tx
+	rt.Type = "0x2"
+	rt.MaxFeePerGas = "0x6fc23ac00"
+	rt.MaxPriorityFeePerGas = "0x77359400"
+	ct.Tx = &rt
+	rr := *ct.Receipt
+	rr.EffectiveGasPrice = "0x430e23400"
+	ct.Receipt = &rr
+	tx.CoinSpecificData = ct
+
+	packed, err := p.PackTx(&tx, 4321000, 1534858022)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := p.UnpackTx(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &tx) {
+		t.Errorf("EthereumParser.UnpackTx() = %+v, want %+v", got, tx)
+	}
+
+	etd := GetEthereumTxData(got)
+	if etd.Type != 2 {
+		t.Errorf("GetEthereumTxData().Type = %v, want 2", etd.Type)
+	}
+	if etd.MaxFeePerGas == nil || etd.MaxFeePerGas.Cmp(big.NewInt(30000000000)) != 0 {
+		t.Errorf("GetEthereumTxData().MaxFeePerGas = %v, want 30000000000", etd.MaxFeePerGas)
+	}
+	if etd.MaxPriorityFeePerGas == nil || etd.MaxPriorityFeePerGas.Cmp(big.NewInt(2000000000)) != 0 {
+		t.Errorf("GetEthereumTxData().MaxPriorityFeePerGas = %v, want 2000000000", etd.MaxPriorityFeePerGas)
+	}
+	if etd.FeeGasPrice().Cmp(big.NewInt(18000000000)) != 0 {
+		t.Errorf("GetEthereumTxData().FeeGasPrice() = %v, want 18000000000", etd.FeeGasPrice())
+	}
+
+	// transactions packed without the EIP-1559 fields are decoded as legacy transactions
+	b, err := hex.DecodeString(dbtestdata.EthTx1Packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _, err := p.UnpackTx(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etd = GetEthereumTxData(old)
+	if etd.Type != 0 || etd.MaxFeePerGas != nil || etd.MaxPriorityFeePerGas != nil || etd.EffectiveGasPrice != nil {
+		t.Errorf("GetEthereumTxData() of legacy transaction = %+v", etd)
+	}
+}
+
+func TestEthereumParser_ContractCreation(t *testing.T) {
+	p := NewEthereumParser(1)
+	ct := testTx1.CoinSpecificData.(completeTransaction)
+	rt := *ct.Tx
+	rt.To = ""
+	rr := *ct.Receipt
+	rr.ContractAddress = "0x4af4114f73d1c1c903ac9e0361b379d1291808a2"
+	tx, err := p.ethTxToTx(&rt, &rr, 1534858022, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := "0x4af4114F73d1c1C903aC9E0361b379D1291808A2"
+	if !reflect.DeepEqual(tx.Vout[0].ScriptPubKey.Addresses, []string{contract}) {
+		t.Errorf("ethTxToTx() output addresses = %v, want %v", tx.Vout[0].ScriptPubKey.Addresses, contract)
+	}
+
+	packed, err := p.PackTx(tx, 4321000, 1534858022)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := p.UnpackTx(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Vout, tx.Vout) {
+		t.Errorf("EthereumParser.UnpackTx() Vout = %+v, want %+v", got.Vout, tx.Vout)
+	}
+	cc, err := p.EthereumTypeGetContractCreationFromTx(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &bchain.EthereumContractCreation{Contract: contract, Creator: rt.From}
+	if !reflect.DeepEqual(cc, want) {
+		t.Errorf("EthereumTypeGetContractCreationFromTx() = %+v, want %+v", cc, want)
+	}
+
+	// failed transaction does not create a contract
+	rr.Status = "0x0"
+	tx, err = p.ethTxToTx(&rt, &rr, 1534858022, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Vout[0].ScriptPubKey.Addresses) != 0 {
+		t.Errorf("ethTxToTx() output addresses of failed creation = %v", tx.Vout[0].ScriptPubKey.Addresses)
+	}
+	if cc, _ = p.EthereumTypeGetContractCreationFromTx(tx); cc != nil {
+		t.Errorf("EthereumTypeGetContractCreationFromTx() of failed creation = %+v", cc)
+	}
+	// regular transaction
+	if cc, _ = p.EthereumTypeGetContractCreationFromTx(&testTx1); cc != nil {
+		t.Errorf("EthereumTypeGetContractCreationFromTx() of regular transaction = %+v", cc)
+	}
+}
@@ -1,12 +1,14 @@
 package eth
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
 	"fmt"
 	"math/big"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ethereum "github.com/ethereum/go-ethereum"
@@ -19,6 +21,7 @@ import (
 	"github.com/juju/errors"
 	"github.com/trezor/blockbook/bchain"
 	"github.com/trezor/blockbook/common"
+	"golang.org/x/crypto/sha3"
 )
 
 // EthereumNet type specifies the type of ethereum network
@@ -42,6 +45,9 @@ type Configuration struct {
 	BlockAddressesToKeep        int    `json:"block_addresses_to_keep"`
 	MempoolTxTimeoutHours       int    `json:"mempoolTxTimeoutHours"`
 	QueryBackendOnMempoolResync bool   `json:"queryBackendOnMempoolResync"`
+	ProcessInternalTransactions bool   `json:"processInternalTransactions"`
+	ProcessEventLogs            bool   `json:"processEventLogs"`
+	EnsRegistry                 string `json:"ensRegistry,omitempty"`
 }
 
 // EthereumRPC is an interface to JSON-RPC eth service.
@@ -61,6 +67,8 @@ type EthereumRPC struct {
 	chanNewTx            chan ethcommon.Hash
 	newTxSubscription    *rpc.ClientSubscription
 	ChainConfig          *Configuration
+	// set if the backend does not support eth_getBlockReceipts
+	noBlockReceipts int32
 }
 
 // NewEthereumRPC returns new EthRPC instance.
@@ -90,6 +98,7 @@ func NewEthereumRPC(config json.RawMessage, pushHandler func(bchain.Notification
 
 	// always create parser
 	s.Parser = NewEthereumParser(c.BlockAddressesToKeep)
+	s.Parser.ProcessEventLogs = c.ProcessEventLogs
 	s.timeout = time.Duration(c.RPCTimeout) * time.Second
 
 	// new blocks notifications handling
@@ -491,29 +500,157 @@ func (b *EthereumRPC) getBlockRaw(hash string, height uint32, fullTxs bool) (jso
 	return raw, nil
 }
 
-func (b *EthereumRPC) getERC20EventsForBlock(blockNumber string) (map[string][]*rpcLog, error) {
+// rpcMethodNotFound is the json-rpc error code of an unsupported method
+const rpcMethodNotFound = -32601
+
+// eventLogsFilter returns the eth_getLogs filter of the token transfer events of the block or all events if the event logs are indexed
+func (b *EthereumRPC) eventLogsFilter(hash string, height uint32) map[string]interface{} {
+	filter := make(map[string]interface{})
+	if hash != "" {
+		filter["blockHash"] = ethcommon.HexToHash(hash)
+	} else {
+		n := fmt.Sprintf("%#x", height)
+		filter["fromBlock"] = n
+		filter["toBlock"] = n
+	}
+	if !b.ChainConfig.ProcessEventLogs {
+		filter["topics"] = [][]string{{erc20TransferEventSignature, erc1155TransferSingleEventSignature, erc1155TransferBatchEventSignature}}
+	}
+	return filter
+}
+
+// getBlockWithReceipts returns the block with transactions and the receipts of the transactions, fetched in one batch request
+// if the backend does not support eth_getBlockReceipts, the receipts are nil and the event logs of the block are returned instead,
+// the unsupported method is remembered and the logs are then fetched by eth_getLogs in the batch with the block
+func (b *EthereumRPC) getBlockWithReceipts(hash string, height uint32) (json.RawMessage, []*rpcReceipt, []rpcLogWithTxHash, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
+	var blockID interface{}
+	method := "eth_getBlockByNumber"
+	if hash != "" {
+		method = "eth_getBlockByHash"
+		blockID = ethcommon.HexToHash(hash)
+	} else {
+		blockID = fmt.Sprintf("%#x", height)
+	}
+	var raw json.RawMessage
+	var receipts []*rpcReceipt
 	var logs []rpcLogWithTxHash
-	err := b.rpc.CallContext(ctx, &logs, "eth_getLogs", map[string]interface{}{
-		"fromBlock": blockNumber,
-		"toBlock":   blockNumber,
-		"topics":    []string{erc20TransferEventSignature},
-	})
-	if err != nil {
-		return nil, errors.Annotatef(err, "blockNumber %v", blockNumber)
+	noBlockReceipts := atomic.LoadInt32(&b.noBlockReceipts) != 0
+	batch := []rpc.BatchElem{
+		{Method: method, Args: []interface{}{blockID, true}, Result: &raw},
+	}
+	if noBlockReceipts {
+		batch = append(batch, rpc.BatchElem{Method: "eth_getLogs", Args: []interface{}{b.eventLogsFilter(hash, height)}, Result: &logs})
+	} else {
+		batch = append(batch, rpc.BatchElem{Method: "eth_getBlockReceipts", Args: []interface{}{blockID}, Result: &receipts})
 	}
-	r := make(map[string][]*rpcLog)
+	if err := b.rpc.BatchCallContext(ctx, batch); err != nil {
+		return nil, nil, nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
+	}
+	if batch[0].Error != nil {
+		return nil, nil, nil, errors.Annotatef(batch[0].Error, "hash %v, height %v", hash, height)
+	} else if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil, nil, bchain.ErrBlockNotFound
+	}
+	if noBlockReceipts {
+		if batch[1].Error != nil {
+			return nil, nil, nil, errors.Annotatef(batch[1].Error, "eth_getLogs hash %v, height %v", hash, height)
+		}
+		return raw, nil, logs, nil
+	}
+	if batch[1].Error != nil {
+		if e, ok := batch[1].Error.(rpc.Error); ok && e.ErrorCode() == rpcMethodNotFound {
+			glog.Info("eth_getBlockReceipts is not supported by the backend, using eth_getLogs")
+			atomic.StoreInt32(&b.noBlockReceipts, 1)
+		} else {
+			glog.V(1).Info("eth_getBlockReceipts hash ", hash, ", height ", height, ": ", batch[1].Error)
+		}
+		if err := b.rpc.CallContext(ctx, &logs, "eth_getLogs", b.eventLogsFilter(hash, height)); err != nil {
+			return nil, nil, nil, errors.Annotatef(err, "eth_getLogs hash %v, height %v", hash, height)
+		}
+		return raw, nil, logs, nil
+	}
+	return raw, receipts, nil, nil
+}
+
+// getReceiptsFromLogs composes the receipts of the transactions from the event logs of the block
+// only the receipts of the contract creations are fetched from the backend, as they contain the address of the created contract,
+// the status and the used gas of the other transactions are not known
+func (b *EthereumRPC) getReceiptsFromLogs(txs []rpcTransaction, logs []rpcLogWithTxHash) ([]*rpcReceipt, error) {
+	txLogs := make(map[string][]*rpcLog)
 	for i := range logs {
 		l := &logs[i]
-		r[l.Hash] = append(r[l.Hash], &l.rpcLog)
+		txLogs[l.Hash] = append(txLogs[l.Hash], &l.rpcLog)
+	}
+	receipts := make([]*rpcReceipt, len(txs))
+	var creations []rpcTransaction
+	var creationIndexes []int
+	for i := range txs {
+		if len(txs[i].To) <= 2 {
+			creations = append(creations, txs[i])
+			creationIndexes = append(creationIndexes, i)
+		} else {
+			receipts[i] = &rpcReceipt{Logs: txLogs[txs[i].Hash]}
+		}
 	}
-	return r, nil
+	cr, err := b.getTransactionReceipts(creations)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range cr {
+		receipts[creationIndexes[i]] = r
+	}
+	return receipts, nil
+}
+
+// getTransactionReceipts returns the receipts of the transactions, fetched in one batch request
+func (b *EthereumRPC) getTransactionReceipts(txs []rpcTransaction) ([]*rpcReceipt, error) {
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	receipts := make([]*rpcReceipt, len(txs))
+	batch := make([]rpc.BatchElem, len(txs))
+	for i := range txs {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{ethcommon.HexToHash(txs[i].Hash)},
+			Result: &receipts[i],
+		}
+	}
+	if err := b.rpc.BatchCallContext(ctx, batch); err != nil {
+		return nil, err
+	}
+	for i := range batch {
+		if batch[i].Error != nil {
+			return nil, errors.Annotatef(batch[i].Error, "txid %v", txs[i].Hash)
+		}
+		if receipts[i] == nil {
+			return nil, errors.Errorf("Missing receipt of txid %v", txs[i].Hash)
+		}
+	}
+	return receipts, nil
+}
+
+// tokenTransferLogs returns only the token transfer events from the logs
+func tokenTransferLogs(logs []*rpcLog) []*rpcLog {
+	r := make([]*rpcLog, 0, len(logs))
+	for _, l := range logs {
+		if len(l.Topics) > 0 {
+			switch l.Topics[0] {
+			case erc20TransferEventSignature, erc1155TransferSingleEventSignature, erc1155TransferBatchEventSignature:
+				r = append(r, l)
+			}
+		}
+	}
+	return r
 }
 
 // GetBlock returns block with given hash or height, hash has precedence if both passed
 func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
-	raw, err := b.getBlockRaw(hash, height, true)
+	raw, receipts, logs, err := b.getBlockWithReceipts(hash, height)
 	if err != nil {
 		return nil, err
 	}
@@ -529,18 +666,55 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
 	}
-	// get ERC20 events
-	logs, err := b.getERC20EventsForBlock(head.Number)
-	if err != nil {
-		return nil, err
+	if receipts == nil {
+		receipts, err = b.getReceiptsFromLogs(body.Transactions, logs)
+		if err != nil {
+			return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
+		}
+	}
+	if len(receipts) != len(body.Transactions) {
+		return nil, errors.Errorf("hash %v, height %v: %v receipts for %v transactions", hash, height, len(receipts), len(body.Transactions))
+	}
+	// get internal transfers from the call traces of the transactions, requires debug API of the backend
+	var internalTransfers [][]rpcInternalTransfer
+	if b.ChainConfig.ProcessInternalTransactions && len(body.Transactions) > 0 {
+		internalTransfers, err = b.getInternalTransfersForBlock(head.Hash, body.Transactions)
+		if err != nil {
+			return nil, err
+		}
 	}
 	btxs := make([]bchain.Tx, len(body.Transactions))
 	for i := range body.Transactions {
 		tx := &body.Transactions[i]
-		btx, err := b.Parser.ethTxToTx(tx, &rpcReceipt{Logs: logs[tx.Hash]}, bbh.Time, uint32(bbh.Confirmations), true)
+		receipt := receipts[i]
+		if receipt == nil {
+			return nil, errors.Errorf("hash %v, height %v: missing receipt of txid %v", hash, height, tx.Hash)
+		}
+		// store only ERC20, ERC721 and ERC1155 transfer events, all events if the event logs are indexed
+		if !b.ChainConfig.ProcessEventLogs {
+			receipt.Logs = tokenTransferLogs(receipt.Logs)
+		}
+		var codeHash string
+		if contract := receipt.createdContract(); contract != "" && len(tx.To) <= 2 {
+			codeHash, err = b.getContractCodeHash(contract, bbh.Height)
+			if err != nil {
+				return nil, errors.Annotatef(err, "hash %v, height %v, txid %v", hash, height, tx.Hash)
+			}
+		}
+		btx, err := b.Parser.ethTxToTx(tx, receipt, bbh.Time, uint32(bbh.Confirmations), true)
 		if err != nil {
 			return nil, errors.Annotatef(err, "hash %v, height %v, txid %v", hash, height, tx.Hash)
 		}
+		if codeHash != "" {
+			ct := btx.CoinSpecificData.(completeTransaction)
+			ct.ContractCodeHash = codeHash
+			btx.CoinSpecificData = ct
+		}
+		if internalTransfers != nil && len(internalTransfers[i]) > 0 {
+			ct := btx.CoinSpecificData.(completeTransaction)
+			ct.InternalTransfers = internalTransfers[i]
+			btx.CoinSpecificData = ct
+		}
 		btxs[i] = *btx
 		if b.mempoolInitialized {
 			b.Mempool.RemoveTransactionFromMempool(tx.Hash)
@@ -553,6 +727,33 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 	return &bbk, nil
 }
 
+// getCode returns the code of the address at the block, "latest" for the current code, empty if the address is not a contract
+func (b *EthereumRPC) getCode(address string, block string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var code string
+	if err := b.rpc.CallContext(ctx, &code, "eth_getCode", address, block); err != nil {
+		return nil, errors.Annotatef(err, "address %v", address)
+	}
+	c, err := hexDecode(code)
+	if err != nil {
+		return nil, errors.Annotatef(err, "address %v", address)
+	}
+	return c, nil
+}
+
+// getContractCodeHash returns the keccak256 hash of the code of the contract at the block with the height,
+// the code is not read at the latest block, the contract can be destroyed by a later block
+func (b *EthereumRPC) getContractCodeHash(contract string, height uint32) (string, error) {
+	c, err := b.getCode(contract, hexutil.EncodeUint64(uint64(height)))
+	if err != nil {
+		return "", err
+	}
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write(c)
+	return hexutil.Encode(sha.Sum(nil)), nil
+}
+
 // GetBlockInfo returns extended header (more info than in bchain.BlockHeader) with a list of txids
 func (b *EthereumRPC) GetBlockInfo(hash string) (*bchain.BlockInfo, error) {
 	raw, err := b.getBlockRaw(hash, 0, false)
@@ -640,6 +841,17 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
+		if b.ChainConfig.ProcessInternalTransactions {
+			// the trace is not essential, on error return the tx without the internal transfers
+			it, err := b.getInternalTransfersForTx(txid)
+			if err != nil {
+				glog.Error("getInternalTransfersForTx ", txid, ": ", err)
+			} else if len(it) > 0 {
+				ct := btx.CoinSpecificData.(completeTransaction)
+				ct.InternalTransfers = it
+				btx.CoinSpecificData = ct
+			}
+		}
 		// remove tx from mempool if it is there
 		if b.mempoolInitialized {
 			b.Mempool.RemoveTransactionFromMempool(txid)
@@ -680,16 +892,53 @@ func (b *EthereumRPC) GetMempoolTransactions() ([]string, error) {
 	return body.Transactions, nil
 }
 
+type rpcTxPoolContent struct {
+	Pending map[string]map[string]*rpcTransaction `json:"pending"`
+	Queued  map[string]map[string]*rpcTransaction `json:"queued"`
+}
+
+// EthereumTypeGetTxPoolContent returns the pending and queued transactions from the transaction pool of the backend
+func (b *EthereumRPC) EthereumTypeGetTxPoolContent() ([]bchain.Tx, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var content rpcTxPoolContent
+	if err := b.rpc.CallContext(ctx, &content, "txpool_content"); err != nil {
+		return nil, err
+	}
+	var txs []bchain.Tx
+	for _, pool := range []map[string]map[string]*rpcTransaction{content.Pending, content.Queued} {
+		for _, senderTxs := range pool {
+			for _, tx := range senderTxs {
+				btx, err := b.Parser.ethTxToTx(tx, nil, 0, 0, true)
+				if err != nil {
+					return nil, errors.Annotatef(err, "txid %v", tx.Hash)
+				}
+				txs = append(txs, *btx)
+			}
+		}
+	}
+	return txs, nil
+}
+
 // EstimateFee returns fee estimation
 func (b *EthereumRPC) EstimateFee(blocks int) (big.Int, error) {
 	return b.EstimateSmartFee(blocks, true)
 }
 
 // EstimateSmartFee returns fee estimation
+// on chains supporting EIP-1559 it is the base fee plus the priority fee of the tier for the number of blocks,
+// otherwise the gas price suggested by the backend
 func (b *EthereumRPC) EstimateSmartFee(blocks int, conservative bool) (big.Int, error) {
+	var r big.Int
+	fees, err := b.EthereumTypeGetEip1559Fees()
+	if err != nil {
+		glog.V(1).Info("EthereumTypeGetEip1559Fees ", err)
+	} else if fees != nil {
+		r.Add(&fees.BaseFeePerGas, &fees.TierForBlocks(blocks).MaxPriorityFeePerGas)
+		return r, nil
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	var r big.Int
 	gp, err := b.client.SuggestGasPrice(ctx)
 	if err == nil && b != nil {
 		r = *gp
@@ -774,6 +1023,69 @@ func (b *EthereumRPC) EthereumTypeGetNonce(addrDesc bchain.AddressDescriptor) (u
 	return b.client.NonceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
 }
 
+const knownContractsCacheSize = 100000
+
+// contracts found by EthereumTypeIsContract, only the contracts are cached as a code can be deployed later to any address
+// the least recently used contracts are evicted from the cache
+var knownContracts = newContractsCache(knownContractsCacheSize)
+
+// contractsCache is a set of the address descriptors of the contracts limited to size items
+type contractsCache struct {
+	lock  sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+func newContractsCache(size int) *contractsCache {
+	return &contractsCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *contractsCache) contains(addrDesc bchain.AddressDescriptor) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, found := c.items[string(addrDesc)]
+	if found {
+		c.order.MoveToFront(e)
+	}
+	return found
+}
+
+func (c *contractsCache) add(addrDesc bchain.AddressDescriptor) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, found := c.items[string(addrDesc)]; found {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[string(addrDesc)] = c.order.PushFront(string(addrDesc))
+	if c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(string))
+	}
+}
+
+// EthereumTypeIsContract returns true if the address has a code
+func (b *EthereumRPC) EthereumTypeIsContract(addrDesc bchain.AddressDescriptor) (bool, error) {
+	if knownContracts.contains(addrDesc) {
+		return true, nil
+	}
+	code, err := b.getCode(hexutil.Encode(addrDesc), "latest")
+	if err != nil {
+		return false, err
+	}
+	if len(code) == 0 {
+		return false, nil
+	}
+	knownContracts.add(addrDesc)
+	return true, nil
+}
+
 // GetChainParser returns ethereum BlockChainParser
 func (b *EthereumRPC) GetChainParser() bchain.BlockChainParser {
 	return b.Parser
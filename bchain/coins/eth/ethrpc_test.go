@@ -0,0 +1,445 @@
+// +build unittest
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/trezor/blockbook/bchain"
+	"golang.org/x/crypto/sha3"
+)
+
+type fixtureRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type fixtureError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type fixtureResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *fixtureError   `json:"error,omitempty"`
+}
+
+// fixtureBackend serves the responses recorded in testdata/getblock.json with a latency of each http request
+// eth_getLogs is served from the logs of the recorded receipts
+type fixtureBackend struct {
+	results         map[string]json.RawMessage
+	receipts        map[string]json.RawMessage
+	logs            []rpcLogWithTxHash
+	// ethCalls are the results of eth_call by the lowercase address of the contract and the call data
+	ethCalls map[string]string
+	noBlockReceipts bool
+	latency         time.Duration
+	requests        int32
+}
+
+func newFixtureBackend(t testing.TB, noBlockReceipts bool, latency time.Duration) *fixtureBackend {
+	data, err := ioutil.ReadFile("testdata/getblock.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixtureBackend{
+		receipts:        make(map[string]json.RawMessage),
+		noBlockReceipts: noBlockReceipts,
+		latency:         latency,
+	}
+	if err := json.Unmarshal(data, &f.results); err != nil {
+		t.Fatal(err)
+	}
+	var receipts []json.RawMessage
+	if err := json.Unmarshal(f.results["eth_getBlockReceipts"], &receipts); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range receipts {
+		var h struct {
+			Hash string    `json:"transactionHash"`
+			Logs []*rpcLog `json:"logs"`
+		}
+		if err := json.Unmarshal(r, &h); err != nil {
+			t.Fatal(err)
+		}
+		f.receipts[h.Hash] = r
+		for _, l := range h.Logs {
+			f.logs = append(f.logs, rpcLogWithTxHash{rpcLog: *l, Hash: h.Hash})
+		}
+	}
+	return f
+}
+
+// getLogs returns the logs matching the first topic of the filter, the block in the filter is ignored
+func (f *fixtureBackend) getLogs(params []json.RawMessage) json.RawMessage {
+	var filter struct {
+		Topics [][]string `json:"topics"`
+	}
+	if len(params) > 0 {
+		json.Unmarshal(params[0], &filter)
+	}
+	logs := make([]rpcLogWithTxHash, 0, len(f.logs))
+	for _, l := range f.logs {
+		match := len(filter.Topics) == 0
+		if !match && len(l.Topics) > 0 {
+			for _, topic := range filter.Topics[0] {
+				if topic == l.Topics[0] {
+					match = true
+					break
+				}
+			}
+		}
+		if match {
+			logs = append(logs, l)
+		}
+	}
+	r, _ := json.Marshal(logs)
+	return r
+}
+
+func (f *fixtureBackend) response(req *fixtureRequest) fixtureResponse {
+	r := fixtureResponse{Version: "2.0", ID: req.ID}
+	switch {
+	case req.Method == "eth_getBlockReceipts" && f.noBlockReceipts:
+		r.Error = &fixtureError{Code: -32601, Message: "the method eth_getBlockReceipts does not exist/is not available"}
+	case req.Method == "eth_getTransactionReceipt":
+		var txid string
+		if len(req.Params) > 0 {
+			json.Unmarshal(req.Params[0], &txid)
+		}
+		r.Result = f.receipts[txid]
+	case req.Method == "eth_getLogs":
+		r.Result = f.getLogs(req.Params)
+	case req.Method == "eth_call" && f.ethCalls != nil:
+		var call struct {
+			To   string `json:"to"`
+			Data string `json:"data"`
+		}
+		if len(req.Params) > 0 {
+			json.Unmarshal(req.Params[0], &call)
+		}
+		result, found := f.ethCalls[strings.ToLower(call.To)+call.Data]
+		if !found {
+			result = "0x"
+		}
+		r.Result, _ = json.Marshal(result)
+	default:
+		result, found := f.results[req.Method]
+		if !found {
+			r.Error = &fixtureError{Code: -32601, Message: "the method " + req.Method + " is not recorded"}
+		}
+		r.Result = result
+	}
+	return r
+}
+
+func (f *fixtureBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&f.requests, 1)
+	time.Sleep(f.latency)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []fixtureRequest
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resps := make([]fixtureResponse, len(reqs))
+		for i := range reqs {
+			resps[i] = f.response(&reqs[i])
+		}
+		json.NewEncoder(w).Encode(resps)
+		return
+	}
+	var req fixtureRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(f.response(&req))
+}
+
+func newFixtureEthereumRPC(t testing.TB, f *fixtureBackend, processEventLogs bool) (*EthereumRPC, func()) {
+	ts := httptest.NewServer(f)
+	rc, err := rpc.DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &EthereumRPC{
+		BaseChain:   &bchain.BaseChain{},
+		client:      ethclient.NewClient(rc),
+		rpc:         rc,
+		Parser:      NewEthereumParser(1),
+		ChainConfig: &Configuration{ProcessEventLogs: processEventLogs},
+		timeout:     10 * time.Second,
+		// the best header is set to avoid a request for it
+		bestHeader:     &ethtypes.Header{Number: big.NewInt(4321009)},
+		bestHeaderTime: time.Now(),
+	}
+	return b, func() {
+		rc.Close()
+		ts.Close()
+	}
+}
+
+const fixtureBlockHash = "0xeccd6b0031015a19cb7d4e10f28590ba65a6a54ad1baa322b50fe5ad16903895"
+
+func TestEthereumRPC_GetBlock(t *testing.T) {
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write(hexutil.MustDecode("0x6080604052"))
+	codeHash := hexutil.Encode(sha.Sum(nil))
+	tests := []struct {
+		name             string
+		noBlockReceipts  bool
+		processEventLogs bool
+		wantRequests     []int32
+		wantLogs         int
+	}{
+		{
+			name: "eth_getBlockReceipts",
+			// the block with receipts in one batch, the code of the created contract in the second request
+			wantRequests: []int32{2, 2},
+			wantLogs:     1,
+		},
+		{
+			name:            "eth_getLogs",
+			noBlockReceipts: true,
+			// the unsupported eth_getBlockReceipts is remembered after the first block,
+			// then the block with logs in one batch, the receipt and the code of the created contract
+			wantRequests: []int32{4, 3},
+			wantLogs:     1,
+		},
+		{
+			name:             "all event logs",
+			processEventLogs: true,
+			wantRequests:     []int32{2, 2},
+			wantLogs:         2,
+		},
+		{
+			name:             "all event logs by eth_getLogs",
+			noBlockReceipts:  true,
+			processEventLogs: true,
+			wantRequests:     []int32{4, 3},
+			wantLogs:         2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixtureBackend(t, tt.noBlockReceipts, 0)
+			b, closeFn := newFixtureEthereumRPC(t, f, tt.processEventLogs)
+			defer closeFn()
+			for _, wantRequests := range tt.wantRequests {
+				atomic.StoreInt32(&f.requests, 0)
+				block, err := b.GetBlock(fixtureBlockHash, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := atomic.LoadInt32(&f.requests); got != wantRequests {
+					t.Errorf("GetBlock() used %d requests, want %d", got, wantRequests)
+				}
+				if block.Height != 4321000 || block.Confirmations != 10 || len(block.Txs) != 3 {
+					t.Fatalf("GetBlock() = height %d, confirmations %d, %d txs", block.Height, block.Confirmations, len(block.Txs))
+				}
+				for i := range block.Txs {
+					csd := block.Txs[i].CoinSpecificData.(completeTransaction)
+					// without eth_getBlockReceipts, only the receipt of the contract creation is fetched
+					wantStatus := "0x1"
+					if tt.noBlockReceipts && i != 2 {
+						wantStatus = ""
+					}
+					if csd.Receipt == nil || csd.Receipt.Status != wantStatus {
+						t.Errorf("tx %d: receipt %+v, want status %q", i, csd.Receipt, wantStatus)
+					}
+				}
+				if logs := block.Txs[1].CoinSpecificData.(completeTransaction).Receipt.Logs; len(logs) != tt.wantLogs {
+					t.Errorf("tx 1: %d logs, want %d", len(logs), tt.wantLogs)
+				}
+				creation := block.Txs[2]
+				if a := creation.Vout[0].ScriptPubKey.Addresses; len(a) != 1 || a[0] != EIP55AddressFromAddress("0x7a3c07e1b2f6d5b0e6b9c2a1d3e5f7a9b1c3d5e7") {
+					t.Errorf("contract creation: output addresses %v", a)
+				}
+				if h := creation.CoinSpecificData.(completeTransaction).ContractCodeHash; h != codeHash {
+					t.Errorf("contract creation: code hash %v, want %v", h, codeHash)
+				}
+			}
+		})
+	}
+}
+
+func TestEthereumRPC_GetTransactionTraceError(t *testing.T) {
+	f := newFixtureBackend(t, false, 0)
+	var body struct {
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+	if err := json.Unmarshal(f.results["eth_getBlockByHash"], &body); err != nil {
+		t.Fatal(err)
+	}
+	// debug_traceTransaction is not recorded, the backend returns an error for it
+	f.results["eth_getTransactionByHash"] = body.Transactions[1]
+	b, closeFn := newFixtureEthereumRPC(t, f, false)
+	defer closeFn()
+	b.ChainConfig.ProcessInternalTransactions = true
+	txid := "0xcd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b"
+	tx, err := b.GetTransaction(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Txid != txid || tx.Confirmations != 10 {
+		t.Errorf("GetTransaction() = txid %v, confirmations %d", tx.Txid, tx.Confirmations)
+	}
+	csd := tx.CoinSpecificData.(completeTransaction)
+	if csd.Receipt == nil || len(csd.InternalTransfers) != 0 {
+		t.Errorf("GetTransaction() = receipt %+v, internal transfers %+v", csd.Receipt, csd.InternalTransfers)
+	}
+}
+
+func TestEthereumRPC_EthereumTypeIsContract(t *testing.T) {
+	f := newFixtureBackend(t, false, 0)
+	b, closeFn := newFixtureEthereumRPC(t, f, false)
+	defer closeFn()
+	addrDesc, err := b.Parser.GetAddrDescFromAddress("0x7a3c07e1b2f6d5b0e6b9c2a1d3e5f7a9b1c3d5e7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		isContract, err := b.EthereumTypeIsContract(addrDesc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isContract {
+			t.Errorf("EthereumTypeIsContract() = false, want true")
+		}
+	}
+	// the second call is served from the cache
+	if got := atomic.LoadInt32(&f.requests); got != 1 {
+		t.Errorf("EthereumTypeIsContract() used %d requests, want 1", got)
+	}
+	// an address without a code is not a contract and is not cached
+	f.results["eth_getCode"] = json.RawMessage(`"0x"`)
+	addrDesc, err = b.Parser.GetAddrDescFromAddress("0x3e3a3d69dc66ba10737f531ed088954a9ec89d97")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isContract, err := b.EthereumTypeIsContract(addrDesc); err != nil || isContract {
+		t.Errorf("EthereumTypeIsContract() = %v, %v, want false", isContract, err)
+	}
+	if knownContracts.contains(addrDesc) {
+		t.Errorf("EthereumTypeIsContract() cached an address without a code")
+	}
+}
+
+func Test_contractsCache(t *testing.T) {
+	c := newContractsCache(2)
+	a1 := bchain.AddressDescriptor{1}
+	a2 := bchain.AddressDescriptor{2}
+	a3 := bchain.AddressDescriptor{3}
+	c.add(a1)
+	c.add(a2)
+	// a1 is used, a2 is the least recently used contract
+	if !c.contains(a1) {
+		t.Fatal("contains(a1) = false, want true")
+	}
+	c.add(a3)
+	if c.contains(a2) {
+		t.Error("contains(a2) = true, want evicted")
+	}
+	if !c.contains(a1) || !c.contains(a3) {
+		t.Error("contains() = false, want true for a1 and a3")
+	}
+	if len(c.items) != 2 || c.order.Len() != 2 {
+		t.Errorf("cache size = %v, %v, want 2", len(c.items), c.order.Len())
+	}
+}
+
+// getBlockSequential gets the block data the way it was done before batching by separate requests,
+// the block, the token transfer events of the block and the receipt and the code of each created contract
+func getBlockSequential(b *EthereumRPC, hash string) error {
+	ctx := context.Background()
+	var raw json.RawMessage
+	if err := b.rpc.CallContext(ctx, &raw, "eth_getBlockByHash", ethcommon.HexToHash(hash), true); err != nil {
+		return err
+	}
+	var body rpcBlockTransactions
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return err
+	}
+	var logs []rpcLogWithTxHash
+	if err := b.rpc.CallContext(ctx, &logs, "eth_getLogs", b.eventLogsFilter(hash, 0)); err != nil {
+		return err
+	}
+	for i := range body.Transactions {
+		tx := &body.Transactions[i]
+		if len(tx.To) > 2 {
+			continue
+		}
+		var receipt rpcReceipt
+		if err := b.rpc.CallContext(ctx, &receipt, "eth_getTransactionReceipt", ethcommon.HexToHash(tx.Hash)); err != nil {
+			return err
+		}
+		if contract := receipt.createdContract(); contract != "" {
+			var code string
+			if err := b.rpc.CallContext(ctx, &code, "eth_getCode", contract, "latest"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BenchmarkEthereumRPC_GetBlock compares the batched GetBlock with the sequential requests on the fixture backend with 2ms latency
+func BenchmarkEthereumRPC_GetBlock(b *testing.B) {
+	benchmarks := []struct {
+		name            string
+		noBlockReceipts bool
+		sequential      bool
+	}{
+		{name: "eth_getBlockReceipts"},
+		{name: "eth_getLogs", noBlockReceipts: true},
+		{name: "sequential", sequential: true},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			f := newFixtureBackend(b, bm.noBlockReceipts, 2*time.Millisecond)
+			e, closeFn := newFixtureEthereumRPC(b, f, false)
+			defer closeFn()
+			// measure the steady state, when the unsupported eth_getBlockReceipts is already known
+			if bm.noBlockReceipts {
+				e.noBlockReceipts = 1
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var err error
+				if bm.sequential {
+					err = getBlockSequential(e, fixtureBlockHash)
+				} else {
+					_, err = e.GetBlock(fixtureBlockHash, 0)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt32(&f.requests))/float64(b.N), "requests/op")
+		})
+	}
+}
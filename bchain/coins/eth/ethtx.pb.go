@@ -28,10 +28,11 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type ProtoCompleteTransaction struct {
-	BlockNumber uint32                                `protobuf:"varint,1,opt,name=BlockNumber" json:"BlockNumber,omitempty"`
-	BlockTime   uint64                                `protobuf:"varint,2,opt,name=BlockTime" json:"BlockTime,omitempty"`
-	Tx          *ProtoCompleteTransaction_TxType      `protobuf:"bytes,3,opt,name=Tx" json:"Tx,omitempty"`
-	Receipt     *ProtoCompleteTransaction_ReceiptType `protobuf:"bytes,4,opt,name=Receipt" json:"Receipt,omitempty"`
+	BlockNumber       uint32                                           `protobuf:"varint,1,opt,name=BlockNumber" json:"BlockNumber,omitempty"`
+	BlockTime         uint64                                           `protobuf:"varint,2,opt,name=BlockTime" json:"BlockTime,omitempty"`
+	Tx                *ProtoCompleteTransaction_TxType                 `protobuf:"bytes,3,opt,name=Tx" json:"Tx,omitempty"`
+	Receipt           *ProtoCompleteTransaction_ReceiptType            `protobuf:"bytes,4,opt,name=Receipt" json:"Receipt,omitempty"`
+	InternalTransfers []*ProtoCompleteTransaction_InternalTransferType `protobuf:"bytes,5,rep,name=InternalTransfers" json:"InternalTransfers,omitempty"`
 }
 
 func (m *ProtoCompleteTransaction) Reset()                    { *m = ProtoCompleteTransaction{} }
@@ -67,16 +68,26 @@ func (m *ProtoCompleteTransaction) GetReceipt() *ProtoCompleteTransaction_Receip
 	return nil
 }
 
+func (m *ProtoCompleteTransaction) GetInternalTransfers() []*ProtoCompleteTransaction_InternalTransferType {
+	if m != nil {
+		return m.InternalTransfers
+	}
+	return nil
+}
+
 type ProtoCompleteTransaction_TxType struct {
-	AccountNonce     uint64 `protobuf:"varint,1,opt,name=AccountNonce" json:"AccountNonce,omitempty"`
-	GasPrice         []byte `protobuf:"bytes,2,opt,name=GasPrice,proto3" json:"GasPrice,omitempty"`
-	GasLimit         uint64 `protobuf:"varint,3,opt,name=GasLimit" json:"GasLimit,omitempty"`
-	Value            []byte `protobuf:"bytes,4,opt,name=Value,proto3" json:"Value,omitempty"`
-	Payload          []byte `protobuf:"bytes,5,opt,name=Payload,proto3" json:"Payload,omitempty"`
-	Hash             []byte `protobuf:"bytes,6,opt,name=Hash,proto3" json:"Hash,omitempty"`
-	To               []byte `protobuf:"bytes,7,opt,name=To,proto3" json:"To,omitempty"`
-	From             []byte `protobuf:"bytes,8,opt,name=From,proto3" json:"From,omitempty"`
-	TransactionIndex uint32 `protobuf:"varint,9,opt,name=TransactionIndex" json:"TransactionIndex,omitempty"`
+	AccountNonce         uint64 `protobuf:"varint,1,opt,name=AccountNonce" json:"AccountNonce,omitempty"`
+	GasPrice             []byte `protobuf:"bytes,2,opt,name=GasPrice,proto3" json:"GasPrice,omitempty"`
+	GasLimit             uint64 `protobuf:"varint,3,opt,name=GasLimit" json:"GasLimit,omitempty"`
+	Value                []byte `protobuf:"bytes,4,opt,name=Value,proto3" json:"Value,omitempty"`
+	Payload              []byte `protobuf:"bytes,5,opt,name=Payload,proto3" json:"Payload,omitempty"`
+	Hash                 []byte `protobuf:"bytes,6,opt,name=Hash,proto3" json:"Hash,omitempty"`
+	To                   []byte `protobuf:"bytes,7,opt,name=To,proto3" json:"To,omitempty"`
+	From                 []byte `protobuf:"bytes,8,opt,name=From,proto3" json:"From,omitempty"`
+	TransactionIndex     uint32 `protobuf:"varint,9,opt,name=TransactionIndex" json:"TransactionIndex,omitempty"`
+	Type                 uint32 `protobuf:"varint,10,opt,name=Type" json:"Type,omitempty"`
+	MaxFeePerGas         []byte `protobuf:"bytes,11,opt,name=MaxFeePerGas,proto3" json:"MaxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas []byte `protobuf:"bytes,12,opt,name=MaxPriorityFeePerGas,proto3" json:"MaxPriorityFeePerGas,omitempty"`
 }
 
 func (m *ProtoCompleteTransaction_TxType) Reset()         { *m = ProtoCompleteTransaction_TxType{} }
@@ -149,10 +160,33 @@ func (m *ProtoCompleteTransaction_TxType) GetTransactionIndex() uint32 {
 	return 0
 }
 
+func (m *ProtoCompleteTransaction_TxType) GetType() uint32 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *ProtoCompleteTransaction_TxType) GetMaxFeePerGas() []byte {
+	if m != nil {
+		return m.MaxFeePerGas
+	}
+	return nil
+}
+
+func (m *ProtoCompleteTransaction_TxType) GetMaxPriorityFeePerGas() []byte {
+	if m != nil {
+		return m.MaxPriorityFeePerGas
+	}
+	return nil
+}
+
 type ProtoCompleteTransaction_ReceiptType struct {
-	GasUsed []byte                                          `protobuf:"bytes,1,opt,name=GasUsed,proto3" json:"GasUsed,omitempty"`
-	Status  []byte                                          `protobuf:"bytes,2,opt,name=Status,proto3" json:"Status,omitempty"`
-	Log     []*ProtoCompleteTransaction_ReceiptType_LogType `protobuf:"bytes,3,rep,name=Log" json:"Log,omitempty"`
+	GasUsed           []byte                                          `protobuf:"bytes,1,opt,name=GasUsed,proto3" json:"GasUsed,omitempty"`
+	Status            []byte                                          `protobuf:"bytes,2,opt,name=Status,proto3" json:"Status,omitempty"`
+	Log               []*ProtoCompleteTransaction_ReceiptType_LogType `protobuf:"bytes,3,rep,name=Log" json:"Log,omitempty"`
+	EffectiveGasPrice []byte                                          `protobuf:"bytes,4,opt,name=EffectiveGasPrice,proto3" json:"EffectiveGasPrice,omitempty"`
+	ContractAddress   []byte                                          `protobuf:"bytes,5,opt,name=ContractAddress,proto3" json:"ContractAddress,omitempty"`
 }
 
 func (m *ProtoCompleteTransaction_ReceiptType) Reset()         { *m = ProtoCompleteTransaction_ReceiptType{} }
@@ -183,6 +217,20 @@ func (m *ProtoCompleteTransaction_ReceiptType) GetLog() []*ProtoCompleteTransact
 	return nil
 }
 
+func (m *ProtoCompleteTransaction_ReceiptType) GetEffectiveGasPrice() []byte {
+	if m != nil {
+		return m.EffectiveGasPrice
+	}
+	return nil
+}
+
+func (m *ProtoCompleteTransaction_ReceiptType) GetContractAddress() []byte {
+	if m != nil {
+		return m.ContractAddress
+	}
+	return nil
+}
+
 type ProtoCompleteTransaction_ReceiptType_LogType struct {
 	Address []byte   `protobuf:"bytes,1,opt,name=Address,proto3" json:"Address,omitempty"`
 	Data    []byte   `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
@@ -221,41 +269,96 @@ func (m *ProtoCompleteTransaction_ReceiptType_LogType) GetTopics() [][]byte {
 	return nil
 }
 
+type ProtoCompleteTransaction_InternalTransferType struct {
+	Type  uint32 `protobuf:"varint,1,opt,name=Type" json:"Type,omitempty"`
+	From  []byte `protobuf:"bytes,2,opt,name=From,proto3" json:"From,omitempty"`
+	To    []byte `protobuf:"bytes,3,opt,name=To,proto3" json:"To,omitempty"`
+	Value []byte `protobuf:"bytes,4,opt,name=Value,proto3" json:"Value,omitempty"`
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) Reset() {
+	*m = ProtoCompleteTransaction_InternalTransferType{}
+}
+func (m *ProtoCompleteTransaction_InternalTransferType) String() string {
+	return proto.CompactTextString(m)
+}
+func (*ProtoCompleteTransaction_InternalTransferType) ProtoMessage() {}
+func (*ProtoCompleteTransaction_InternalTransferType) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{0, 2}
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetType() uint32 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetFrom() []byte {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetTo() []byte {
+	if m != nil {
+		return m.To
+	}
+	return nil
+}
+
+func (m *ProtoCompleteTransaction_InternalTransferType) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*ProtoCompleteTransaction)(nil), "eth.ProtoCompleteTransaction")
 	proto.RegisterType((*ProtoCompleteTransaction_TxType)(nil), "eth.ProtoCompleteTransaction.TxType")
 	proto.RegisterType((*ProtoCompleteTransaction_ReceiptType)(nil), "eth.ProtoCompleteTransaction.ReceiptType")
 	proto.RegisterType((*ProtoCompleteTransaction_ReceiptType_LogType)(nil), "eth.ProtoCompleteTransaction.ReceiptType.LogType")
+	proto.RegisterType((*ProtoCompleteTransaction_InternalTransferType)(nil), "eth.ProtoCompleteTransaction.InternalTransferType")
 }
 
 func init() { proto.RegisterFile("bchain/coins/eth/ethtx.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 409 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0xdf, 0x8a, 0xd4, 0x30,
-	0x18, 0xc5, 0xe9, 0x9f, 0x99, 0xd9, 0xfd, 0xa6, 0x8a, 0x04, 0x91, 0x30, 0xec, 0x45, 0x59, 0xbc,
-	0x18, 0xbd, 0xe8, 0xe2, 0xea, 0x0b, 0xac, 0x23, 0xae, 0xc2, 0xb0, 0x0e, 0x31, 0x7a, 0x9f, 0x49,
-	0xc3, 0x36, 0x38, 0x6d, 0x4a, 0x93, 0x42, 0xf7, 0x8d, 0x7c, 0x21, 0xdf, 0xc5, 0x4b, 0xc9, 0xd7,
-	0x74, 0x1d, 0x11, 0x65, 0x2f, 0x0a, 0xf9, 0x9d, 0x7e, 0xa7, 0x39, 0x27, 0x29, 0x9c, 0xed, 0x65,
-	0x25, 0x74, 0x73, 0x21, 0x8d, 0x6e, 0xec, 0x85, 0x72, 0x95, 0x7f, 0xdc, 0x50, 0xb4, 0x9d, 0x71,
-	0x86, 0x24, 0xca, 0x55, 0xe7, 0xdf, 0x67, 0x40, 0x77, 0x1e, 0x37, 0xa6, 0x6e, 0x0f, 0xca, 0x29,
-	0xde, 0x89, 0xc6, 0x0a, 0xe9, 0xb4, 0x69, 0x48, 0x0e, 0xcb, 0xb7, 0x07, 0x23, 0xbf, 0xdd, 0xf4,
-	0xf5, 0x5e, 0x75, 0x34, 0xca, 0xa3, 0xf5, 0x23, 0x76, 0x2c, 0x91, 0x33, 0x38, 0x45, 0xe4, 0xba,
-	0x56, 0x34, 0xce, 0xa3, 0x75, 0xca, 0x7e, 0x0b, 0xe4, 0x0d, 0xc4, 0x7c, 0xa0, 0x49, 0x1e, 0xad,
-	0x97, 0x97, 0xcf, 0x0b, 0xe5, 0xaa, 0xe2, 0x5f, 0x5b, 0x15, 0x7c, 0xe0, 0x77, 0xad, 0x62, 0x31,
-	0x1f, 0xc8, 0x06, 0x16, 0x4c, 0x49, 0xa5, 0x5b, 0x47, 0x53, 0xb4, 0xbe, 0xf8, 0xbf, 0x35, 0x0c,
-	0xa3, 0x7f, 0x72, 0xae, 0x7e, 0x46, 0x30, 0x1f, 0xbf, 0x49, 0xce, 0x21, 0xbb, 0x92, 0xd2, 0xf4,
-	0x8d, 0xbb, 0x31, 0x8d, 0x54, 0x58, 0x23, 0x65, 0x7f, 0x68, 0x64, 0x05, 0x27, 0xd7, 0xc2, 0xee,
-	0x3a, 0x2d, 0xc7, 0x1a, 0x19, 0xbb, 0xe7, 0xf0, 0x6e, 0xab, 0x6b, 0xed, 0xb0, 0x4b, 0xca, 0xee,
-	0x99, 0x3c, 0x85, 0xd9, 0x57, 0x71, 0xe8, 0x15, 0x26, 0xcd, 0xd8, 0x08, 0x84, 0xc2, 0x62, 0x27,
-	0xee, 0x0e, 0x46, 0x94, 0x74, 0x86, 0xfa, 0x84, 0x84, 0x40, 0xfa, 0x41, 0xd8, 0x8a, 0xce, 0x51,
-	0xc6, 0x35, 0x79, 0x0c, 0x31, 0x37, 0x74, 0x81, 0x4a, 0xcc, 0x8d, 0x9f, 0x79, 0xdf, 0x99, 0x9a,
-	0x9e, 0x8c, 0x33, 0x7e, 0x4d, 0x5e, 0xc2, 0x93, 0xa3, 0xca, 0x1f, 0x9b, 0x52, 0x0d, 0xf4, 0x14,
-	0xaf, 0xe3, 0x2f, 0x7d, 0xf5, 0x23, 0x82, 0xe5, 0xd1, 0x99, 0xf8, 0x34, 0xd7, 0xc2, 0x7e, 0xb1,
-	0xaa, 0xc4, 0xea, 0x19, 0x9b, 0x90, 0x3c, 0x83, 0xf9, 0x67, 0x27, 0x5c, 0x6f, 0x43, 0xe7, 0x40,
-	0x64, 0x03, 0xc9, 0xd6, 0xdc, 0xd2, 0x24, 0x4f, 0xd6, 0xcb, 0xcb, 0x57, 0x0f, 0x3e, 0xfd, 0x62,
-	0x6b, 0x6e, 0xf1, 0x16, 0xbc, 0x7b, 0xf5, 0x09, 0x16, 0x81, 0x7d, 0x82, 0xab, 0xb2, 0xec, 0x94,
-	0xb5, 0x53, 0x82, 0x80, 0xbe, 0xeb, 0x3b, 0xe1, 0x44, 0xd8, 0x1f, 0xd7, 0x3e, 0x15, 0x37, 0xad,
-	0x96, 0x16, 0x03, 0x64, 0x2c, 0xd0, 0x7e, 0x8e, 0xbf, 0xed, 0xeb, 0x5f, 0x01, 0x00, 0x00, 0xff,
-	0xff, 0xc2, 0x69, 0x8d, 0xdf, 0xd6, 0x02, 0x00, 0x00,
+	// 536 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0xdf, 0x6e, 0xd3, 0x3e,
+	0x14, 0x56, 0x93, 0xac, 0xed, 0x4e, 0xf3, 0xfb, 0xc1, 0xac, 0x0a, 0x59, 0xd5, 0x2e, 0xaa, 0x89,
+	0x8b, 0x82, 0x50, 0x27, 0x0a, 0x2f, 0x30, 0x0a, 0x2b, 0x93, 0xba, 0x51, 0x99, 0xc0, 0x35, 0xae,
+	0x73, 0xba, 0x5a, 0xb4, 0x71, 0x65, 0xbb, 0x28, 0x7d, 0x28, 0xee, 0x78, 0x24, 0x1e, 0x04, 0xd9,
+	0x49, 0xba, 0x6e, 0x2d, 0x13, 0x17, 0x51, 0xfc, 0x7d, 0xe7, 0x8f, 0x73, 0xbe, 0xef, 0x28, 0x70,
+	0x3a, 0x15, 0x73, 0x2e, 0xb3, 0x73, 0xa1, 0x64, 0x66, 0xce, 0xd1, 0xce, 0xdd, 0x63, 0xf3, 0xfe,
+	0x4a, 0x2b, 0xab, 0x48, 0x88, 0x76, 0x7e, 0xf6, 0xab, 0x09, 0x74, 0xe2, 0xe0, 0x50, 0x2d, 0x57,
+	0x0b, 0xb4, 0x98, 0x68, 0x9e, 0x19, 0x2e, 0xac, 0x54, 0x19, 0xe9, 0x42, 0xeb, 0xdd, 0x42, 0x89,
+	0xef, 0x37, 0xeb, 0xe5, 0x14, 0x35, 0xad, 0x75, 0x6b, 0xbd, 0xff, 0xd8, 0x2e, 0x45, 0x4e, 0xe1,
+	0xd8, 0xc3, 0x44, 0x2e, 0x91, 0x06, 0xdd, 0x5a, 0x2f, 0x62, 0x77, 0x04, 0x79, 0x0b, 0x41, 0x92,
+	0xd3, 0xb0, 0x5b, 0xeb, 0xb5, 0x06, 0xcf, 0xfb, 0x68, 0xe7, 0xfd, 0xbf, 0x5d, 0xd5, 0x4f, 0xf2,
+	0x64, 0xb3, 0x42, 0x16, 0x24, 0x39, 0x19, 0x42, 0x83, 0xa1, 0x40, 0xb9, 0xb2, 0x34, 0xf2, 0xa5,
+	0x2f, 0x1e, 0x2f, 0x2d, 0x93, 0x7d, 0x7d, 0x55, 0x49, 0xbe, 0xc1, 0xc9, 0x55, 0x66, 0x51, 0x67,
+	0x7c, 0xe1, 0x73, 0x67, 0xa8, 0x0d, 0x3d, 0xea, 0x86, 0xbd, 0xd6, 0x60, 0xf0, 0x78, 0xbb, 0x87,
+	0x65, 0xbe, 0xef, 0x7e, 0xb3, 0xce, 0xef, 0x00, 0xea, 0xc5, 0x57, 0x93, 0x33, 0x88, 0x2f, 0x84,
+	0x50, 0xeb, 0xcc, 0xde, 0xa8, 0x4c, 0xa0, 0x17, 0x2a, 0x62, 0xf7, 0x38, 0xd2, 0x81, 0xe6, 0x88,
+	0x9b, 0x89, 0x96, 0xa2, 0x10, 0x2a, 0x66, 0x5b, 0x5c, 0xc6, 0xc6, 0x72, 0x29, 0xad, 0x57, 0x2b,
+	0x62, 0x5b, 0x4c, 0xda, 0x70, 0xf4, 0x95, 0x2f, 0xd6, 0xe8, 0xb5, 0x88, 0x59, 0x01, 0x08, 0x85,
+	0xc6, 0x84, 0x6f, 0x16, 0x8a, 0xa7, 0xf4, 0xc8, 0xf3, 0x15, 0x24, 0x04, 0xa2, 0x8f, 0xdc, 0xcc,
+	0x69, 0xdd, 0xd3, 0xfe, 0x4c, 0xfe, 0x87, 0x20, 0x51, 0xb4, 0xe1, 0x99, 0x20, 0x51, 0x2e, 0xe7,
+	0x52, 0xab, 0x25, 0x6d, 0x16, 0x39, 0xee, 0x4c, 0x5e, 0xc2, 0xd3, 0x1d, 0x15, 0xae, 0xb2, 0x14,
+	0x73, 0x7a, 0xec, 0x0d, 0xdf, 0xe3, 0x5d, 0xbd, 0x9b, 0x9b, 0x82, 0x8f, 0x47, 0x95, 0x06, 0xd7,
+	0x3c, 0xbf, 0x44, 0x9c, 0xa0, 0x1e, 0x71, 0x43, 0x5b, 0xbe, 0xf7, 0x3d, 0x8e, 0x0c, 0xa0, 0x7d,
+	0xcd, 0xf3, 0x89, 0x96, 0x4a, 0x4b, 0xbb, 0xb9, 0xcb, 0x8d, 0x7d, 0xee, 0xc1, 0x58, 0xe7, 0x67,
+	0x00, 0xad, 0x1d, 0x87, 0xdd, 0xe4, 0x23, 0x6e, 0xbe, 0x18, 0x4c, 0xbd, 0xcc, 0x31, 0xab, 0x20,
+	0x79, 0x06, 0xf5, 0xcf, 0x96, 0xdb, 0xb5, 0x29, 0xf5, 0x2d, 0x11, 0x19, 0x42, 0x38, 0x56, 0xb7,
+	0x34, 0xf4, 0xe6, 0xbf, 0xfe, 0xe7, 0x5d, 0xea, 0x8f, 0xd5, 0xad, 0x7b, 0x33, 0x57, 0x4d, 0x5e,
+	0xc1, 0xc9, 0x87, 0xd9, 0x0c, 0x85, 0x95, 0x3f, 0x70, 0xeb, 0x63, 0x61, 0xc9, 0x7e, 0x80, 0xf4,
+	0xe0, 0xc9, 0x50, 0x65, 0x56, 0x73, 0x61, 0x2f, 0xd2, 0x54, 0xa3, 0x31, 0xa5, 0x4d, 0x0f, 0xe9,
+	0xce, 0x27, 0x68, 0x94, 0xf7, 0xb8, 0xc9, 0xaa, 0xe4, 0x72, 0xb2, 0x12, 0x3a, 0xbd, 0xdf, 0x73,
+	0xcb, 0xcb, 0xb9, 0xfc, 0xd9, 0x4d, 0x9b, 0xa8, 0x95, 0x14, 0xc6, 0x0f, 0x16, 0xb3, 0x12, 0x75,
+	0x52, 0x68, 0x1f, 0xda, 0xe0, 0xad, 0x67, 0xb5, 0x1d, 0xcf, 0xaa, 0x3d, 0x08, 0x76, 0xf6, 0xa0,
+	0xd8, 0x95, 0x70, 0xbb, 0x2b, 0x07, 0xf7, 0x6f, 0x5a, 0xf7, 0xbf, 0x90, 0x37, 0x7f, 0x06, 0x00,
+	0xc3, 0x8d, 0xa3, 0xda, 0x62, 0x04, 0x00, 0x00,
 }
@@ -0,0 +1,91 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// the number of recent blocks and the percentiles of the priority fees of their transactions used for the fee tiers
+const feeHistoryBlocks = 20
+
+var feeHistoryPercentiles = []float64{10, 50, 90}
+
+// rpcFeeHistory is the result of eth_feeHistory
+type rpcFeeHistory struct {
+	OldestBlock   string     `json:"oldestBlock"`
+	BaseFeePerGas []string   `json:"baseFeePerGas"`
+	GasUsedRatio  []float64  `json:"gasUsedRatio"`
+	Reward        [][]string `json:"reward"`
+}
+
+func medianBig(values []*big.Int) big.Int {
+	var r big.Int
+	if len(values) == 0 {
+		return r
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	m := len(values) / 2
+	if len(values)%2 == 1 {
+		return *r.Set(values[m])
+	}
+	r.Add(values[m-1], values[m])
+	return *r.Rsh(&r, 1)
+}
+
+// getEip1559FeesFromFeeHistory computes the fee tiers from the fee history
+// the base fee is the base fee of the next block, the priority fee of each tier is the median of the percentile over the blocks
+// the max fee per gas covers the increase of the base fee in several full blocks
+func getEip1559FeesFromFeeHistory(h *rpcFeeHistory) (*bchain.Eip1559Fees, error) {
+	if len(h.BaseFeePerGas) == 0 {
+		return nil, errors.New("Missing baseFeePerGas")
+	}
+	baseFee, err := hexutil.DecodeBig(h.BaseFeePerGas[len(h.BaseFeePerGas)-1])
+	if err != nil {
+		return nil, errors.Annotatef(err, "baseFeePerGas %v", h.BaseFeePerGas)
+	}
+	// the chain does not support EIP-1559 (yet)
+	if baseFee.Sign() == 0 {
+		return nil, nil
+	}
+	r := &bchain.Eip1559Fees{BaseFeePerGas: *baseFee}
+	tiers := []*bchain.Eip1559Fee{&r.Low, &r.Medium, &r.High}
+	for i, t := range tiers {
+		var rewards []*big.Int
+		for b, reward := range h.Reward {
+			// empty blocks report zero rewards, which would lower the estimate
+			if b < len(h.GasUsedRatio) && h.GasUsedRatio[b] == 0 {
+				continue
+			}
+			if i >= len(reward) {
+				return nil, errors.Errorf("Missing reward percentile %v", feeHistoryPercentiles[i])
+			}
+			v, err := hexutil.DecodeBig(reward[i])
+			if err != nil {
+				return nil, errors.Annotatef(err, "reward %v", reward)
+			}
+			rewards = append(rewards, v)
+		}
+		t.MaxPriorityFeePerGas = medianBig(rewards)
+		t.MaxFeePerGas.Lsh(baseFee, 1)
+		t.MaxFeePerGas.Add(&t.MaxFeePerGas, &t.MaxPriorityFeePerGas)
+	}
+	return r, nil
+}
+
+// EthereumTypeGetEip1559Fees returns the base fee and the fee tiers for EIP-1559 transactions
+// nil is returned if the chain does not support EIP-1559
+func (b *EthereumRPC) EthereumTypeGetEip1559Fees() (*bchain.Eip1559Fees, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var h rpcFeeHistory
+	err := b.rpc.CallContext(ctx, &h, "eth_feeHistory", hexutil.EncodeUint64(feeHistoryBlocks), "latest", feeHistoryPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	return getEip1559FeesFromFeeHistory(&h)
+}
@@ -0,0 +1,78 @@
+// +build unittest
+
+package eth
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func Test_getEip1559FeesFromFeeHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     string
+		wantNil     bool
+		wantBaseFee int64
+		wantTiers   [3][2]int64
+		wantErr     bool
+	}{
+		{
+			name:        "fee history",
+			history:     `{"oldestBlock":"0xd0e1e0","baseFeePerGas":["0x3b9aca00","0x3b9aca00","0x0","0x4a817c800"],"gasUsedRatio":[0.5,0,0.9],"reward":[["0x3b9aca00","0x77359400","0xb2d05e00"],["0x0","0x0","0x0"],["0x5f5e100","0x3b9aca00","0x12a05f200"]]}`,
+			wantBaseFee: 20000000000,
+			// the empty second block is ignored, medians of two values are their averages
+			wantTiers: [3][2]int64{
+				{40550000000, 550000000},
+				{41500000000, 1500000000},
+				{44000000000, 4000000000},
+			},
+		},
+		{
+			name:    "chain without EIP-1559",
+			history: `{"oldestBlock":"0xd0e1e0","baseFeePerGas":["0x0","0x0"],"gasUsedRatio":[0.5],"reward":[["0x1","0x2","0x3"]]}`,
+			wantNil: true,
+		},
+		{
+			name:    "missing base fee",
+			history: `{"oldestBlock":"0xd0e1e0","baseFeePerGas":[],"gasUsedRatio":[],"reward":[]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h rpcFeeHistory
+			if err := json.Unmarshal([]byte(tt.history), &h); err != nil {
+				t.Fatal(err)
+			}
+			got, err := getEip1559FeesFromFeeHistory(&h)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getEip1559FeesFromFeeHistory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("getEip1559FeesFromFeeHistory() = %+v, want nil", got)
+				}
+				return
+			}
+			if got.BaseFeePerGas.Cmp(big.NewInt(tt.wantBaseFee)) != 0 {
+				t.Errorf("BaseFeePerGas = %v, want %v", got.BaseFeePerGas.String(), tt.wantBaseFee)
+			}
+			for i, tier := range [][2]big.Int{
+				{got.Low.MaxFeePerGas, got.Low.MaxPriorityFeePerGas},
+				{got.Medium.MaxFeePerGas, got.Medium.MaxPriorityFeePerGas},
+				{got.High.MaxFeePerGas, got.High.MaxPriorityFeePerGas},
+			} {
+				if tier[0].Cmp(big.NewInt(tt.wantTiers[i][0])) != 0 || tier[1].Cmp(big.NewInt(tt.wantTiers[i][1])) != 0 {
+					t.Errorf("tier %d = %v %v, want %v", i, tier[0].String(), tier[1].String(), tt.wantTiers[i])
+				}
+			}
+			if got.TierForBlocks(1) != &got.High || got.TierForBlocks(4) != &got.Medium || got.TierForBlocks(10) != &got.Low {
+				t.Error("TierForBlocks() returned wrong tier")
+			}
+		})
+	}
+}
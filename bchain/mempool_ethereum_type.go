@@ -1,6 +1,7 @@
 package bchain
 
 import (
+	"sort"
 	"time"
 
 	"github.com/golang/glog"
@@ -8,12 +9,23 @@ import (
 
 const mempoolTimeoutRunPeriod = 10 * time.Minute
 
+type senderNonce struct {
+	sender string
+	nonce  uint64
+}
+
 // MempoolEthereumType is mempool handle of EthereumType chains
 type MempoolEthereumType struct {
 	BaseMempool
 	mempoolTimeoutTime   time.Duration
 	queryBackendOnResync bool
 	nextTimeoutRun       time.Time
+	// the transactions are tracked also by the sender and nonce to detect replacements and nonce gaps
+	txNonces     map[string]senderNonce
+	senderNonces map[string]map[uint64]string
+	// txpool_content is used for the resync until the backend fails to provide it for the first time
+	txPoolChecked     bool
+	txPoolUnavailable bool
 }
 
 // NewMempoolEthereumType creates new mempool handler.
@@ -28,6 +40,8 @@ func NewMempoolEthereumType(chain BlockChain, mempoolTxTimeoutHours int, queryBa
 		mempoolTimeoutTime:   mempoolTimeoutTime,
 		queryBackendOnResync: queryBackendOnResync,
 		nextTimeoutRun:       time.Now().Add(mempoolTimeoutTime),
+		txNonces:             make(map[string]senderNonce),
+		senderNonces:         make(map[string]map[uint64]string),
 	}
 }
 
@@ -45,14 +59,7 @@ func appendAddress(io []addrIndex, i int32, a string, parser BlockChainParser) (
 	return io, addrDesc
 }
 
-func (m *MempoolEthereumType) createTxEntry(txid string, txTime uint32) (txEntry, bool) {
-	tx, err := m.chain.GetTransactionForMempool(txid)
-	if err != nil {
-		if err != ErrTxNotFound {
-			glog.Warning("cannot get transaction ", txid, ": ", err)
-		}
-		return txEntry{}, false
-	}
+func (m *MempoolEthereumType) createTxEntry(tx *Tx, txTime uint32) (*MempoolTx, txEntry) {
 	mtx := m.txToMempoolTx(tx)
 	parser := m.chain.GetChainParser()
 	addrIndexes := make([]addrIndex, 0, len(mtx.Vout)+len(mtx.Vin))
@@ -60,7 +67,7 @@ func (m *MempoolEthereumType) createTxEntry(txid string, txTime uint32) (txEntry
 		addrDesc, err := parser.GetAddrDescFromVout(&output)
 		if err != nil {
 			if err != ErrAddressMissing {
-				glog.Error("error in output addrDesc in ", txid, " ", output.N, ": ", err)
+				glog.Error("error in output addrDesc in ", tx.Txid, " ", output.N, ": ", err)
 			}
 			continue
 		}
@@ -74,19 +81,65 @@ func (m *MempoolEthereumType) createTxEntry(txid string, txTime uint32) (txEntry
 			addrIndexes, input.AddrDesc = appendAddress(addrIndexes, ^int32(i), a, parser)
 		}
 	}
-	t, err := parser.EthereumTypeGetErc20FromTx(tx)
+	t, err := parser.EthereumTypeGetTokenTransfersFromTx(tx)
 	if err != nil {
-		glog.Error("GetErc20FromTx for tx ", txid, ", ", err)
+		glog.Error("GetTokenTransfersFromTx for tx ", tx.Txid, ", ", err)
 	} else {
-		mtx.Erc20 = t
+		mtx.TokenTransfers = t
 		for i := range t {
 			addrIndexes, _ = appendAddress(addrIndexes, ^int32(i+1), t[i].From, parser)
 			addrIndexes, _ = appendAddress(addrIndexes, int32(i+1), t[i].To, parser)
 		}
 	}
+	return mtx, txEntry{addrIndexes: addrIndexes, time: txTime}
+}
+
+// getSenderNonce returns the sender and the nonce of the transaction, false if they cannot be determined
+func (m *MempoolEthereumType) getSenderNonce(tx *Tx, mtx *MempoolTx) (senderNonce, bool) {
+	if len(mtx.Vin) == 0 || len(mtx.Vin[0].AddrDesc) == 0 {
+		return senderNonce{}, false
+	}
+	nonce, err := m.chain.GetChainParser().EthereumTypeGetNonceFromTx(tx)
+	if err != nil {
+		glog.V(1).Info("EthereumTypeGetNonceFromTx for tx ", tx.Txid, ", ", err)
+		return senderNonce{}, false
+	}
+	return senderNonce{sender: string(mtx.Vin[0].AddrDesc), nonce: nonce}, true
+}
+
+// addTransaction adds the transaction to mempool, a mempool transaction with the same sender and nonce is replaced
+func (m *MempoolEthereumType) addTransaction(tx *Tx, txTime uint32) {
+	mtx, entry := m.createTxEntry(tx, txTime)
+	sn, hasNonce := m.getSenderNonce(tx, mtx)
+	m.mux.Lock()
+	if _, exists := m.txEntries[tx.Txid]; exists {
+		m.mux.Unlock()
+		return
+	}
+	if hasNonce {
+		nonces, found := m.senderNonces[sn.sender]
+		if !found {
+			nonces = make(map[uint64]string)
+			m.senderNonces[sn.sender] = nonces
+		}
+		if replaced, found := nonces[sn.nonce]; found {
+			if replacedEntry, found := m.txEntries[replaced]; found {
+				m.removeEntry(replaced, replacedEntry)
+			}
+			mtx.Replaces = replaced
+			glog.Info("Mempool: tx ", tx.Txid, " replaces tx ", replaced)
+		}
+		nonces[sn.nonce] = tx.Txid
+		m.txNonces[tx.Txid] = sn
+	}
+	m.txEntries[tx.Txid] = entry
+	for _, si := range entry.addrIndexes {
+		m.addrDescToTx[si.addrDesc] = append(m.addrDescToTx[si.addrDesc], Outpoint{tx.Txid, si.n})
+	}
+	m.mux.Unlock()
 	if m.OnNewTxAddr != nil {
 		sent := make(map[string]struct{})
-		for _, si := range addrIndexes {
+		for _, si := range entry.addrIndexes {
 			if _, found := sent[si.addrDesc]; !found {
 				m.OnNewTxAddr(tx, AddressDescriptor(si.addrDesc))
 				sent[si.addrDesc] = struct{}{}
@@ -96,20 +149,86 @@ func (m *MempoolEthereumType) createTxEntry(txid string, txTime uint32) (txEntry
 	if m.OnNewTx != nil {
 		m.OnNewTx(mtx)
 	}
-	return txEntry{addrIndexes: addrIndexes, time: txTime}, true
+}
+
+// removeEntry removes entry from mempool structs including the nonce index. The caller is responsible for locking!
+func (m *MempoolEthereumType) removeEntry(txid string, entry txEntry) {
+	m.removeEntryFromMempool(txid, entry)
+	if sn, found := m.txNonces[txid]; found {
+		delete(m.txNonces, txid)
+		nonces := m.senderNonces[sn.sender]
+		if nonces[sn.nonce] == txid {
+			delete(nonces, sn.nonce)
+			if len(nonces) == 0 {
+				delete(m.senderNonces, sn.sender)
+			}
+		}
+	}
+}
+
+// resyncBackend loads the transactions from the backend, using txpool_content if the backend supports it
+func (m *MempoolEthereumType) resyncBackend() error {
+	if !m.txPoolUnavailable {
+		txs, err := m.chain.EthereumTypeGetTxPoolContent()
+		if err == nil {
+			m.txPoolChecked = true
+			m.resyncTxPool(txs)
+			return nil
+		}
+		if m.txPoolChecked {
+			return err
+		}
+		glog.Warning("Mempool: txpool_content is not available, using the pending block for resync: ", err)
+		m.txPoolUnavailable = true
+	}
+	txs, err := m.chain.GetMempoolTransactions()
+	if err != nil {
+		return err
+	}
+	for _, txid := range txs {
+		m.AddTransactionToMempool(txid)
+	}
+	return nil
+}
+
+// resyncTxPool adds the new transactions from the transaction pool of the backend
+// and removes the transactions which are no longer in the pool
+func (m *MempoolEthereumType) resyncTxPool(txs []Tx) {
+	now := uint32(time.Now().Unix())
+	inPool := make(map[string]struct{}, len(txs))
+	for i := range txs {
+		tx := &txs[i]
+		inPool[tx.Txid] = struct{}{}
+		m.mux.Lock()
+		_, exists := m.txEntries[tx.Txid]
+		m.mux.Unlock()
+		if !exists {
+			m.addTransaction(tx, now)
+		}
+	}
+	// keep the transactions added by notifications during the resync
+	m.mux.Lock()
+	removed := 0
+	for txid, entry := range m.txEntries {
+		if _, found := inPool[txid]; !found && entry.time < now {
+			m.removeEntry(txid, entry)
+			removed++
+		}
+	}
+	m.mux.Unlock()
+	if removed > 0 {
+		glog.Info("Mempool: removed ", removed, " transactions not present in txpool")
+	}
 }
 
 // Resync ethereum type removes timed out transactions and returns number of transactions in mempool.
-// Transactions are added/removed by AddTransactionToMempool/RemoveTransactionFromMempool methods
+// Transactions are added/removed by AddTransactionToMempool/RemoveTransactionFromMempool methods,
+// if queryBackendOnResync is set, the mempool is synchronized with the transaction pool of the backend
 func (m *MempoolEthereumType) Resync() (int, error) {
 	if m.queryBackendOnResync {
-		txs, err := m.chain.GetMempoolTransactions()
-		if err != nil {
+		if err := m.resyncBackend(); err != nil {
 			return 0, err
 		}
-		for _, txid := range txs {
-			m.AddTransactionToMempool(txid)
-		}
 	}
 	m.mux.Lock()
 	entries := len(m.txEntries)
@@ -118,7 +237,7 @@ func (m *MempoolEthereumType) Resync() (int, error) {
 		threshold := now.Add(-m.mempoolTimeoutTime)
 		for txid, entry := range m.txEntries {
 			if time.Unix(int64(entry.time), 0).Before(threshold) {
-				m.removeEntryFromMempool(txid, entry)
+				m.removeEntry(txid, entry)
 			}
 		}
 		removed := entries - len(m.txEntries)
@@ -140,16 +259,14 @@ func (m *MempoolEthereumType) AddTransactionToMempool(txid string) {
 		glog.Info("AddTransactionToMempool ", txid, ", existed ", exists)
 	}
 	if !exists {
-		entry, ok := m.createTxEntry(txid, uint32(time.Now().Unix()))
-		if !ok {
+		tx, err := m.chain.GetTransactionForMempool(txid)
+		if err != nil {
+			if err != ErrTxNotFound {
+				glog.Warning("cannot get transaction ", txid, ": ", err)
+			}
 			return
 		}
-		m.mux.Lock()
-		m.txEntries[txid] = entry
-		for _, si := range entry.addrIndexes {
-			m.addrDescToTx[si.addrDesc] = append(m.addrDescToTx[si.addrDesc], Outpoint{txid, si.n})
-		}
-		m.mux.Unlock()
+		m.addTransaction(tx, uint32(time.Now().Unix()))
 	}
 }
 
@@ -161,7 +278,37 @@ func (m *MempoolEthereumType) RemoveTransactionFromMempool(txid string) {
 		glog.Info("RemoveTransactionFromMempool ", txid, ", existed ", exists)
 	}
 	if exists {
-		m.removeEntryFromMempool(txid, entry)
+		m.removeEntry(txid, entry)
 	}
 	m.mux.Unlock()
 }
+
+// EthereumTypeGetPendingNonce returns the nonce following the mempool transactions of the address which continue
+// the sequence of nonces from the confirmed nonce and the txids of the mempool transactions queued after a nonce gap
+func (m *MempoolEthereumType) EthereumTypeGetPendingNonce(addrDesc AddressDescriptor, confirmedNonce uint64) (uint64, []string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	nonces := m.senderNonces[string(addrDesc)]
+	pendingNonce := confirmedNonce
+	for {
+		if _, found := nonces[pendingNonce]; !found {
+			break
+		}
+		pendingNonce++
+	}
+	queuedNonces := make([]uint64, 0)
+	for n := range nonces {
+		if n > pendingNonce {
+			queuedNonces = append(queuedNonces, n)
+		}
+	}
+	if len(queuedNonces) == 0 {
+		return pendingNonce, nil
+	}
+	sort.Slice(queuedNonces, func(i, j int) bool { return queuedNonces[i] < queuedNonces[j] })
+	queued := make([]string, len(queuedNonces))
+	for i, n := range queuedNonces {
+		queued[i] = nonces[n]
+	}
+	return pendingNonce, queued
+}
@@ -0,0 +1,143 @@
+// +build unittest
+
+package bchain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testMempoolParser struct {
+	BlockChainParser
+}
+
+func (p *testMempoolParser) GetAddrDescFromAddress(address string) (AddressDescriptor, error) {
+	return AddressDescriptor(address), nil
+}
+
+func (p *testMempoolParser) GetAddrDescFromVout(output *Vout) (AddressDescriptor, error) {
+	if len(output.ScriptPubKey.Addresses) != 1 {
+		return nil, ErrAddressMissing
+	}
+	return AddressDescriptor(output.ScriptPubKey.Addresses[0]), nil
+}
+
+func (p *testMempoolParser) EthereumTypeGetTokenTransfersFromTx(tx *Tx) ([]TokenTransfer, error) {
+	return nil, nil
+}
+
+func (p *testMempoolParser) EthereumTypeGetNonceFromTx(tx *Tx) (uint64, error) {
+	return tx.CoinSpecificData.(uint64), nil
+}
+
+type testMempoolChain struct {
+	BlockChain
+	parser *testMempoolParser
+	txs    map[string]*Tx
+	txPool []Tx
+}
+
+func (c *testMempoolChain) GetChainParser() BlockChainParser {
+	return c.parser
+}
+
+func (c *testMempoolChain) GetTransactionForMempool(txid string) (*Tx, error) {
+	tx, found := c.txs[txid]
+	if !found {
+		return nil, ErrTxNotFound
+	}
+	return tx, nil
+}
+
+func (c *testMempoolChain) EthereumTypeGetTxPoolContent() ([]Tx, error) {
+	if c.txPool == nil {
+		return nil, errors.New("the method txpool_content does not exist")
+	}
+	return c.txPool, nil
+}
+
+func (c *testMempoolChain) GetMempoolTransactions() ([]string, error) {
+	return nil, nil
+}
+
+func testMempoolTx(txid, from, to string, nonce uint64) *Tx {
+	return &Tx{
+		Txid: txid,
+		Vin:  []Vin{{Addresses: []string{from}}},
+		Vout: []Vout{{ScriptPubKey: ScriptPubKey{Addresses: []string{to}}}},
+		// the test parser reads the nonce from the coin specific data
+		CoinSpecificData: nonce,
+	}
+}
+
+func TestMempoolEthereumType_Nonces(t *testing.T) {
+	chain := &testMempoolChain{
+		parser: &testMempoolParser{},
+		txs: map[string]*Tx{
+			"tx0":  testMempoolTx("tx0", "sender", "recipient1", 5),
+			"tx1":  testMempoolTx("tx1", "sender", "recipient1", 6),
+			"tx1r": testMempoolTx("tx1r", "sender", "recipient2", 6),
+			"tx3":  testMempoolTx("tx3", "sender", "recipient1", 8),
+		},
+	}
+	m := NewMempoolEthereumType(chain, 1, true)
+	var newTxs []*MempoolTx
+	m.OnNewTx = func(tx *MempoolTx) { newTxs = append(newTxs, tx) }
+
+	for _, txid := range []string{"tx0", "tx1", "tx3"} {
+		m.AddTransactionToMempool(txid)
+	}
+	n, queued := m.EthereumTypeGetPendingNonce(AddressDescriptor("sender"), 5)
+	if n != 7 || !reflect.DeepEqual(queued, []string{"tx3"}) {
+		t.Errorf("EthereumTypeGetPendingNonce() = %v, %v, want 7, [tx3]", n, queued)
+	}
+	n, queued = m.EthereumTypeGetPendingNonce(AddressDescriptor("recipient1"), 3)
+	if n != 3 || queued != nil {
+		t.Errorf("EthereumTypeGetPendingNonce() = %v, %v, want 3, nil", n, queued)
+	}
+
+	// replacement of the transaction with nonce 6
+	m.AddTransactionToMempool("tx1r")
+	if got := newTxs[len(newTxs)-1]; got.Txid != "tx1r" || got.Replaces != "tx1" {
+		t.Errorf("OnNewTx got %v replacing %v, want tx1r replacing tx1", got.Txid, got.Replaces)
+	}
+	if m.GetTransactionTime("tx1") != 0 {
+		t.Error("replaced tx1 still in mempool")
+	}
+	if o, _ := m.GetAddrDescTransactions(AddressDescriptor("recipient2")); len(o) != 1 || o[0].Txid != "tx1r" {
+		t.Errorf("GetAddrDescTransactions(recipient2) = %v", o)
+	}
+
+	// confirmation of the transaction with nonce 5 removes it from the nonce index
+	m.RemoveTransactionFromMempool("tx0")
+	n, queued = m.EthereumTypeGetPendingNonce(AddressDescriptor("sender"), 6)
+	if n != 7 || !reflect.DeepEqual(queued, []string{"tx3"}) {
+		t.Errorf("EthereumTypeGetPendingNonce() = %v, %v, want 7, [tx3]", n, queued)
+	}
+
+	// without txpool_content the resync falls back to the pending block and does not remove any transactions
+	if _, err := m.Resync(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.txPoolUnavailable || len(m.GetAllEntries()) != 2 {
+		t.Errorf("Resync() without txpool: txPoolUnavailable %v, entries %v", m.txPoolUnavailable, m.GetAllEntries())
+	}
+
+	// txpool resync removes transactions missing in the pool and adds the new ones
+	m.txPoolUnavailable = false
+	m.mux.Lock()
+	for txid, e := range m.txEntries {
+		e.time--
+		m.txEntries[txid] = e
+	}
+	m.mux.Unlock()
+	chain.txPool = []Tx{*chain.txs["tx1r"], *testMempoolTx("tx2", "sender", "recipient1", 7)}
+	if count, err := m.Resync(); err != nil || count != 2 {
+		t.Fatalf("Resync() = %v, %v, want 2", count, err)
+	}
+	n, queued = m.EthereumTypeGetPendingNonce(AddressDescriptor("sender"), 6)
+	if n != 8 || queued != nil {
+		t.Errorf("EthereumTypeGetPendingNonce() = %v, %v, want 8, nil", n, queued)
+	}
+}
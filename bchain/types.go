@@ -109,8 +109,10 @@ type MempoolTx struct {
 	Vin              []MempoolVin    `json:"vin"`
 	Vout             []Vout          `json:"vout"`
 	Blocktime        int64           `json:"blocktime,omitempty"`
-	Erc20            []Erc20Transfer `json:"-"`
+	TokenTransfers   []TokenTransfer `json:"-"`
 	CoinSpecificData interface{}     `json:"-"`
+	// Replaces is the txid of the mempool transaction replaced by this transaction (EthereumType only)
+	Replaces string `json:"-"`
 }
 
 // Block is block header and list of transactions
@@ -159,6 +161,13 @@ type MempoolEntry struct {
 	Depends         []string          `json:"depends"`
 }
 
+// MempoolAcceptResult is the result of the test if a transaction would be accepted to the mempool
+type MempoolAcceptResult struct {
+	Txid         string `json:"txid"`
+	Allowed      bool   `json:"allowed"`
+	RejectReason string `json:"reject-reason"`
+}
+
 // ChainInfo is used to get information about blockchain
 type ChainInfo struct {
 	Chain           string      `json:"chain"`
@@ -202,20 +211,93 @@ func AddressDescriptorFromString(s string) (AddressDescriptor, error) {
 
 // EthereumType specific
 
-// Erc20Contract contains info about ERC20 contract
+// TokenStandard is the standard implemented by a token contract
+type TokenStandard int
+
+// TokenStandard enumeration
+const (
+	TokenStandardERC20 = TokenStandard(iota)
+	TokenStandardERC721
+	TokenStandardERC1155
+)
+
+// Erc20Contract contains info about a token contract
 type Erc20Contract struct {
-	Contract string `json:"contract"`
-	Name     string `json:"name"`
-	Symbol   string `json:"symbol"`
-	Decimals int    `json:"decimals"`
+	Contract string        `json:"contract"`
+	Name     string        `json:"name"`
+	Symbol   string        `json:"symbol"`
+	Decimals int           `json:"decimals"`
+	Standard TokenStandard `json:"-"`
+	Scam     bool          `json:"scam,omitempty"`
 }
 
-// Erc20Transfer contains a single ERC20 token transfer
-type Erc20Transfer struct {
+// TokenTransfer contains a single token transfer
+// Value is the transferred amount of ERC20 and ERC1155 tokens, TokenId identifies the ERC721 and ERC1155 token
+type TokenTransfer struct {
+	Standard TokenStandard
 	Contract string
 	From     string
 	To       string
-	Tokens   big.Int
+	TokenId  big.Int
+	Value    big.Int
+}
+
+// EthereumInternalTransferType is the type of an internal transfer of ethereum transaction
+type EthereumInternalTransferType int
+
+// EthereumInternalTransferType enumeration
+const (
+	EthereumInternalTransferCall = EthereumInternalTransferType(iota)
+	EthereumInternalTransferCreate
+	EthereumInternalTransferSelfDestruct
+)
+
+// EthereumInternalTransfer contains a single value transfer done by a contract during the execution of a transaction
+type EthereumInternalTransfer struct {
+	Type  EthereumInternalTransferType
+	From  string
+	To    string
+	Value big.Int
+}
+
+// EthereumEventLog is a log emitted by a contract during the execution of a transaction
+type EthereumEventLog struct {
+	Contract string
+	Topics   []string
+	Data     string
+}
+
+// EthereumContractCreation describes the creation of a contract by a transaction
+// CodeHash is the keccak256 hash of the code of the contract, empty if not known
+type EthereumContractCreation struct {
+	Contract string
+	Creator  string
+	CodeHash string
+}
+
+// Eip1559Fee is the fee of EIP-1559 transaction per unit of gas
+type Eip1559Fee struct {
+	MaxFeePerGas         big.Int
+	MaxPriorityFeePerGas big.Int
+}
+
+// Eip1559Fees contains the base fee of the next block and the fee tiers estimated from the recent blocks
+type Eip1559Fees struct {
+	BaseFeePerGas big.Int
+	Low           Eip1559Fee
+	Medium        Eip1559Fee
+	High          Eip1559Fee
+}
+
+// TierForBlocks returns the fee tier expected to confirm the transaction within the number of blocks
+func (f *Eip1559Fees) TierForBlocks(blocks int) *Eip1559Fee {
+	if blocks <= 2 {
+		return &f.High
+	}
+	if blocks <= 5 {
+		return &f.Medium
+	}
+	return &f.Low
 }
 
 // MempoolTxidEntry contains mempool txid with first seen time
@@ -236,6 +318,25 @@ type OnNewTxAddrFunc func(tx *Tx, desc AddressDescriptor)
 // OnNewTxFunc is used to send notification about a new transaction/address
 type OnNewTxFunc func(tx *MempoolTx)
 
+// OnMempoolResyncFunc is used to send notification that the mempool was resynchronized
+type OnMempoolResyncFunc func()
+
+// ReorgBlock contains hash and height of a block disconnected from the index in a reorg
+type ReorgBlock struct {
+	Hash   string `json:"hash"`
+	Height uint32 `json:"height"`
+}
+
+// ReorgTx contains a transaction from a disconnected block together with the addresses it affected
+type ReorgTx struct {
+	Txid      string
+	Height    uint32
+	AddrDescs []AddressDescriptor
+}
+
+// OnReorgFunc is used to send notification about blocks disconnected in a reorg and their transactions
+type OnReorgFunc func(blocks []ReorgBlock, txs []ReorgTx)
+
 // AddrDescForOutpointFunc returns address descriptor and value for given outpoint or nil if outpoint not found
 type AddrDescForOutpointFunc func(outpoint Outpoint) (AddressDescriptor, *big.Int)
 
@@ -270,15 +371,22 @@ type BlockChain interface {
 	EstimateSmartFee(blocks int, conservative bool) (big.Int, error)
 	EstimateFee(blocks int) (big.Int, error)
 	SendRawTransaction(tx string) (string, error)
+	TestMempoolAccept(tx string) (*MempoolAcceptResult, error)
 	GetMempoolEntry(txid string) (*MempoolEntry, error)
 	// parser
 	GetChainParser() BlockChainParser
 	// EthereumType specific
 	EthereumTypeGetBalance(addrDesc AddressDescriptor) (*big.Int, error)
 	EthereumTypeGetNonce(addrDesc AddressDescriptor) (uint64, error)
+	EthereumTypeIsContract(addrDesc AddressDescriptor) (bool, error)
 	EthereumTypeEstimateGas(params map[string]interface{}) (uint64, error)
+	EthereumTypeGetEip1559Fees() (*Eip1559Fees, error)
 	EthereumTypeGetErc20ContractInfo(contractDesc AddressDescriptor) (*Erc20Contract, error)
+	EthereumTypeRefreshErc20ContractInfo(contractDesc AddressDescriptor) (*Erc20Contract, error)
 	EthereumTypeGetErc20ContractBalance(addrDesc, contractDesc AddressDescriptor) (*big.Int, error)
+	EthereumTypeResolveName(name string) (string, error)
+	EthereumTypeLookupAddress(addrDesc AddressDescriptor) (string, error)
+	EthereumTypeGetTxPoolContent() ([]Tx, error)
 }
 
 // BlockChainParser defines common interface to parsing and conversions of block chain data
@@ -321,7 +429,11 @@ type BlockChainParser interface {
 	DeriveAddressDescriptors(xpub string, change uint32, indexes []uint32) ([]AddressDescriptor, error)
 	DeriveAddressDescriptorsFromTo(xpub string, change uint32, fromIndex uint32, toIndex uint32) ([]AddressDescriptor, error)
 	// EthereumType specific
-	EthereumTypeGetErc20FromTx(tx *Tx) ([]Erc20Transfer, error)
+	EthereumTypeGetTokenTransfersFromTx(tx *Tx) ([]TokenTransfer, error)
+	EthereumTypeGetInternalTransfersFromTx(tx *Tx) ([]EthereumInternalTransfer, error)
+	EthereumTypeGetEventLogsFromTx(tx *Tx) ([]EthereumEventLog, error)
+	EthereumTypeGetContractCreationFromTx(tx *Tx) (*EthereumContractCreation, error)
+	EthereumTypeGetNonceFromTx(tx *Tx) (uint64, error)
 }
 
 // Mempool defines common interface to mempool
@@ -331,4 +443,6 @@ type Mempool interface {
 	GetAddrDescTransactions(addrDesc AddressDescriptor) ([]Outpoint, error)
 	GetAllEntries() MempoolTxidEntries
 	GetTransactionTime(txid string) uint32
+	// EthereumType specific
+	EthereumTypeGetPendingNonce(addrDesc AddressDescriptor, confirmedNonce uint64) (uint64, []string)
 }
@@ -37,6 +37,16 @@ const debounceResyncMempoolMs = 1009
 // store internal state about once every minute
 const storeInternalStatePeriodMs = 59699
 
+// check the contracts to refresh about once every ten minutes, refresh at most refreshContractsBatch contracts at once
+const refreshContractsPeriodMs = 600317
+const refreshContractsBatch = 1000
+
+// prune the expired cached names of the addresses about once an hour
+const pruneAddressNamesPeriodMs = 3600251
+
+// check the transactions in the broadcast queue and rebroadcast them about once a minute
+const rebroadcastPeriodMs = 60131
+
 // exit codes from the main function
 const exitCodeOK = 0
 const exitCodeFatal = 255
@@ -75,10 +85,26 @@ var (
 
 	enableSubNewTx = flag.Bool("enablesubnewtx", false, "enable support for subscribing to all new transactions")
 
+	eventLogRetentionMinutes = flag.Int("eventlogretention", 0, "retention of the websocket event log in minutes, enables resuming of websocket subscriptions (default 0, disabled)")
+	eventLogMemSize          = flag.Int("eventlogmemsize", 10000, "number of the most recent websocket events kept in memory")
+
+	apiKeys   = flag.String("apikeys", "", "path to json file with API keys and rate limits of the public server (default no authentication and limits)")
+	apiKeysDB = flag.Bool("apikeysdb", false, "store API keys of the public server in the database, managed by the admin/apikey/ endpoint of the internal server")
+
 	computeColumnStats  = flag.Bool("computedbstats", false, "compute column stats and exit")
 	computeFeeStatsFlag = flag.Bool("computefeestats", false, "compute fee stats for blocks in blockheight-blockuntil range and exit")
 	dbStatsPeriodHours  = flag.Int("dbstatsperiod", 24, "period of db stats collection in hours, 0 disables stats collection")
 
+	fiatRatesExport   = flag.String("fiatratesexport", "", "export the stored fiat rates to the file (json if the file has .json extension, otherwise csv) and exit")
+	fiatRatesImport   = flag.String("fiatratesimport", "", "import the fiat rates from the csv file and exit")
+	fiatRatesBackfill = flag.Bool("fiatratesbackfill", false, "download the fiat rates of the days without stored rates and exit")
+	fiatRatesFrom     = flag.String("fiatratesfrom", "", "start date (YYYYMMDD) of the fiat rates export and backfill (default the first stored rates)")
+	fiatRatesTo       = flag.String("fiatratesto", "", "end date (YYYYMMDD) of the fiat rates export and backfill (default the last stored rates, yesterday for backfill)")
+
+	broadcastExpirationHours = flag.Int("broadcastexpiration", 0, "expiration of the transactions in the broadcast queue in hours, the sent transactions are rebroadcast until they confirm, conflict or expire, 0 (default) disables the queue")
+
+	contractsRefreshHours = flag.Int("contractsrefresh", 168, "period of refresh of the stored metadata of ethereum contracts in hours, 0 disables the refresh")
+
 	// resync index at least each resyncIndexPeriodMs (could be more often if invoked by message from ZeroMQ)
 	resyncIndexPeriodMs = flag.Int("resyncindexperiod", 935093, "resync index period in milliseconds")
 
@@ -101,9 +127,13 @@ var (
 	syncWorker                    *db.SyncWorker
 	internalState                 *common.InternalState
 	callbacksOnNewBlock           []bchain.OnNewBlockFunc
+	callbacksOnReorg              []bchain.OnReorgFunc
 	callbacksOnNewTxAddr          []bchain.OnNewTxAddrFunc
 	callbacksOnNewTx              []bchain.OnNewTxFunc
+	callbacksOnMempoolResync      []bchain.OnMempoolResyncFunc
 	callbacksOnNewFiatRatesTicker []fiat.OnNewFiatRatesTicker
+	callbacksOnBroadcastState     []db.OnBroadcastStateChange
+	broadcastQueue                *db.BroadcastQueue
 	chanOsSignal                  chan os.Signal
 	inShutdown                    int32
 )
@@ -236,6 +266,14 @@ func mainWithExitCode() int {
 		return exitCodeOK
 	}
 
+	if *fiatRatesExport != "" || *fiatRatesImport != "" || *fiatRatesBackfill {
+		if err = maintainFiatRates(index, *blockchain); err != nil {
+			glog.Error("fiatRates: ", err)
+			return exitCodeFatal
+		}
+		return exitCodeOK
+	}
+
 	syncWorker, err = db.NewSyncWorker(index, chain, *syncWorkers, *syncChunk, *blockFrom, *dryRun, chanOsSignal, metrics, internalState)
 	if err != nil {
 		glog.Errorf("NewSyncWorker %v", err)
@@ -289,7 +327,7 @@ func mainWithExitCode() int {
 	if *synchronize {
 		internalState.SyncMode = true
 		internalState.InitialSync = true
-		if err := syncWorker.ResyncIndex(nil, true); err != nil {
+		if err := syncWorker.ResyncIndex(nil, nil, true); err != nil {
 			if err != db.ErrOperationInterrupted {
 				glog.Error("resyncIndex ", err)
 				return exitCodeFatal
@@ -317,13 +355,25 @@ func mainWithExitCode() int {
 		internalState.InitialSync = false
 	}
 	go storeInternalStateLoop()
+	if *contractsRefreshHours > 0 && chain.GetChainParser().GetChainType() == bchain.ChainEthereumType {
+		go refreshContractsLoop()
+	}
+	if chain.GetChainParser().GetChainType() == bchain.ChainEthereumType && ensEnabled(*blockchain) {
+		go pruneAddressNamesLoop()
+	}
+	if broadcastQueue != nil {
+		go rebroadcastLoop()
+	}
 
 	if publicServer != nil {
 		// start full public interface
 		callbacksOnNewBlock = append(callbacksOnNewBlock, publicServer.OnNewBlock)
+		callbacksOnReorg = append(callbacksOnReorg, publicServer.OnReorg)
 		callbacksOnNewTxAddr = append(callbacksOnNewTxAddr, publicServer.OnNewTxAddr)
 		callbacksOnNewTx = append(callbacksOnNewTx, publicServer.OnNewTx)
+		callbacksOnMempoolResync = append(callbacksOnMempoolResync, publicServer.OnMempoolResync)
 		callbacksOnNewFiatRatesTicker = append(callbacksOnNewFiatRatesTicker, publicServer.OnNewFiatRatesTicker)
+		callbacksOnBroadcastState = append(callbacksOnBroadcastState, publicServer.OnBroadcastStateChange)
 		publicServer.ConnectFullPublicInterface()
 	}
 
@@ -406,8 +456,35 @@ func startInternalServer() (*server.InternalServer, error) {
 }
 
 func startPublicServer() (*server.PublicServer, error) {
+	var eventLog *db.EventLog
+	if *eventLogRetentionMinutes > 0 {
+		var err error
+		eventLog, err = db.NewEventLog(index, time.Duration(*eventLogRetentionMinutes)*time.Minute, *eventLogMemSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var apiAccess *server.APIAccess
+	if *apiKeys != "" || *apiKeysDB {
+		var err error
+		var d *db.RocksDB
+		if *apiKeysDB {
+			d = index
+		}
+		apiAccess, err = server.NewAPIAccess(*apiKeys, d, metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *broadcastExpirationHours > 0 {
+		var err error
+		broadcastQueue, err = db.NewBroadcastQueue(index, chain, time.Duration(*broadcastExpirationHours)*time.Hour, onBroadcastStateChange)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// start public server in limited functionality, extend it after sync is finished by calling ConnectFullPublicInterface
-	publicServer, err := server.NewPublicServer(*publicBinding, *certFiles, index, chain, mempool, txCache, *explorerURL, metrics, internalState, *debugMode, *enableSubNewTx)
+	publicServer, err := server.NewPublicServer(*publicBinding, *certFiles, index, chain, mempool, txCache, *explorerURL, metrics, internalState, *debugMode, *enableSubNewTx, eventLog, apiAccess, broadcastQueue)
 	if err != nil {
 		return nil, err
 	}
@@ -536,11 +613,11 @@ func syncIndexLoop() {
 	glog.Info("syncIndexLoop starting")
 	// resync index about every 15 minutes if there are no chanSyncIndex requests, with debounce 1 second
 	tickAndDebounce(time.Duration(*resyncIndexPeriodMs)*time.Millisecond, debounceResyncIndexMs*time.Millisecond, chanSyncIndex, func() {
-		if err := syncWorker.ResyncIndex(onNewBlockHash, false); err != nil {
+		if err := syncWorker.ResyncIndex(onNewBlockHash, onReorg, false); err != nil {
 			glog.Error("syncIndexLoop ", errors.ErrorStack(err), ", will retry...")
 			// retry once in case of random network error, after a slight delay
 			time.Sleep(time.Millisecond * 2500)
-			if err := syncWorker.ResyncIndex(onNewBlockHash, false); err != nil {
+			if err := syncWorker.ResyncIndex(onNewBlockHash, onReorg, false); err != nil {
 				glog.Error("syncIndexLoop ", errors.ErrorStack(err))
 			}
 		}
@@ -559,6 +636,17 @@ func onNewBlockHash(hash string, height uint32) {
 	}
 }
 
+func onReorg(blocks []bchain.ReorgBlock, txs []bchain.ReorgTx) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error("onReorg recovered from panic: ", r)
+		}
+	}()
+	for _, c := range callbacksOnReorg {
+		c(blocks, txs)
+	}
+}
+
 func onNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -570,6 +658,17 @@ func onNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
 	}
 }
 
+func onBroadcastStateChange(tx *db.BroadcastTx) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error("onBroadcastStateChange recovered from panic: ", r)
+		}
+	}()
+	for _, c := range callbacksOnBroadcastState {
+		c(tx)
+	}
+}
+
 func syncMempoolLoop() {
 	defer close(chanSyncMempoolDone)
 	glog.Info("syncMempoolLoop starting")
@@ -580,12 +679,72 @@ func syncMempoolLoop() {
 			glog.Error("syncMempoolLoop ", errors.ErrorStack(err))
 		} else {
 			internalState.FinishedMempoolSync(count)
-
+			onMempoolResync()
 		}
 	})
 	glog.Info("syncMempoolLoop stopped")
 }
 
+func refreshContractsLoop() {
+	maxAge := time.Duration(*contractsRefreshHours) * time.Hour
+	glog.Info("refreshContractsLoop starting with refresh period ", maxAge)
+	for {
+		count, err := index.RefreshContracts(chain, maxAge, refreshContractsBatch)
+		if err != nil {
+			glog.Error("refreshContractsLoop ", err)
+		} else if count > 0 {
+			glog.Info("refreshContractsLoop refreshed ", count, " contracts")
+		}
+		// continue without waiting if there are more contracts to refresh
+		if err != nil || count < refreshContractsBatch {
+			time.Sleep(refreshContractsPeriodMs * time.Millisecond)
+		}
+	}
+}
+
+// ensEnabled checks if the ENS registry is configured, the address names are cached only if it is
+func ensEnabled(configfile string) bool {
+	data, err := ioutil.ReadFile(configfile)
+	if err != nil {
+		glog.Error("Error reading file ", configfile, ", ", err)
+		return false
+	}
+	var config struct {
+		EnsRegistry string `json:"ensRegistry"`
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		glog.Error("Error parsing config file ", configfile, ", ", err)
+		return false
+	}
+	return config.EnsRegistry != ""
+}
+
+func pruneAddressNamesLoop() {
+	glog.Info("pruneAddressNamesLoop starting")
+	for {
+		time.Sleep(pruneAddressNamesPeriodMs * time.Millisecond)
+		count, err := index.PruneAddressNames(time.Now().Add(-db.AddressNameTTL).Unix())
+		if err != nil {
+			glog.Error("pruneAddressNamesLoop ", err)
+		} else if count > 0 {
+			glog.Info("pruneAddressNamesLoop pruned ", count, " address names")
+		}
+	}
+}
+
+func rebroadcastLoop() {
+	glog.Info("rebroadcastLoop starting")
+	for {
+		time.Sleep(rebroadcastPeriodMs * time.Millisecond)
+		pending, err := broadcastQueue.Rebroadcast(time.Now())
+		if err != nil {
+			glog.Error("rebroadcastLoop ", err)
+		} else if pending > 0 {
+			glog.Info("rebroadcastLoop ", pending, " pending transactions")
+		}
+	}
+}
+
 func storeInternalStateLoop() {
 	stopCompute := make(chan os.Signal)
 	defer func() {
@@ -652,6 +811,17 @@ func onNewTx(tx *bchain.MempoolTx) {
 	}
 }
 
+func onMempoolResync() {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error("onMempoolResync recovered from panic: ", r)
+		}
+	}()
+	for _, c := range callbacksOnMempoolResync {
+		c()
+	}
+}
+
 func pushSynchronizationHandler(nt bchain.NotificationType) {
 	glog.V(1).Info("MQ: notification ", nt)
 	if atomic.LoadInt32(&inShutdown) != 0 {
@@ -717,28 +887,103 @@ func computeFeeStats(stopCompute chan os.Signal, blockFrom, blockTo int, db *db.
 	return err
 }
 
-func initFiatRatesDownloader(db *db.RocksDB, configfile string) {
+type fiatRatesConfig struct {
+	FiatRates       string `json:"fiat_rates"`
+	FiatRatesParams string `json:"fiat_rates_params"`
+}
+
+func loadFiatRatesConfig(configfile string) (*fiatRatesConfig, error) {
 	data, err := ioutil.ReadFile(configfile)
 	if err != nil {
-		glog.Errorf("Error reading file %v, %v", configfile, err)
-		return
+		return nil, errors.Errorf("Error reading file %v, %v", configfile, err)
+	}
+	var config fiatRatesConfig
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, errors.Errorf("Error parsing config file %v, %v", configfile, err)
 	}
+	return &config, nil
+}
 
-	var config struct {
-		FiatRates       string `json:"fiat_rates"`
-		FiatRatesParams string `json:"fiat_rates_params"`
+// maintainFiatRates exports, imports or backfills the stored fiat rates as requested by the command line flags
+func maintainFiatRates(d *db.RocksDB, configfile string) error {
+	var from, to *time.Time
+	var err error
+	if *fiatRatesFrom != "" {
+		if from, err = db.FiatRatesConvertDate(*fiatRatesFrom); err != nil {
+			return err
+		}
 	}
+	if *fiatRatesTo != "" {
+		if to, err = db.FiatRatesConvertDate(*fiatRatesTo); err != nil {
+			return err
+		}
+	}
+	if *fiatRatesImport != "" {
+		f, err := os.Open(*fiatRatesImport)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := fiat.ImportTickers(d, f)
+		if err != nil {
+			return err
+		}
+		glog.Infof("Imported %d fiat rates tickers from %v", n, *fiatRatesImport)
+	}
+	if *fiatRatesBackfill {
+		config, err := loadFiatRatesConfig(configfile)
+		if err != nil {
+			return err
+		}
+		if config.FiatRates == "" || config.FiatRatesParams == "" {
+			return errors.Errorf("FiatRates config (%v) is empty", configfile)
+		}
+		fiatRates, err := fiat.NewFiatRatesDownloader(d, config.FiatRates, config.FiatRatesParams, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+		n, err := fiatRates.BackfillGaps(from, to)
+		if err != nil {
+			return err
+		}
+		glog.Infof("Backfilled %d fiat rates tickers", n)
+	}
+	if *fiatRatesExport != "" {
+		format := fiat.ExportFormatCSV
+		if strings.HasSuffix(strings.ToLower(*fiatRatesExport), ".json") {
+			format = fiat.ExportFormatJSON
+		}
+		f, err := os.Create(*fiatRatesExport)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if to != nil {
+			// the end date is inclusive
+			t := to.Add(24 * time.Hour)
+			to = &t
+		}
+		n, err := fiat.ExportTickers(d, f, format, from, to)
+		if err != nil {
+			return err
+		}
+		glog.Infof("Exported %d fiat rates tickers to %v", n, *fiatRatesExport)
+	}
+	return nil
+}
 
-	err = json.Unmarshal(data, &config)
+func initFiatRatesDownloader(db *db.RocksDB, configfile string) {
+	config, err := loadFiatRatesConfig(configfile)
 	if err != nil {
-		glog.Errorf("Error parsing config file %v, %v", configfile, err)
+		glog.Error(err)
 		return
 	}
 
 	if config.FiatRates == "" || config.FiatRatesParams == "" {
 		glog.Infof("FiatRates config (%v) is empty, so the functionality is disabled.", configfile)
 	} else {
-		fiatRates, err := fiat.NewFiatRatesDownloader(db, config.FiatRates, config.FiatRatesParams, nil, onNewFiatRatesTicker)
+		fiatRates, err := fiat.NewFiatRatesDownloader(db, config.FiatRates, config.FiatRatesParams, nil, onNewFiatRatesTicker, metrics)
 		if err != nil {
 			glog.Errorf("NewFiatRatesDownloader Init error: %v", err)
 			return
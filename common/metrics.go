@@ -8,31 +8,34 @@ import (
 
 // Metrics holds prometheus collectors for various metrics collected by Blockbook
 type Metrics struct {
-	SocketIORequests         *prometheus.CounterVec
-	SocketIOSubscribes       *prometheus.CounterVec
-	SocketIOClients          prometheus.Gauge
-	SocketIOReqDuration      *prometheus.HistogramVec
-	WebsocketRequests        *prometheus.CounterVec
-	WebsocketSubscribes      *prometheus.GaugeVec
-	WebsocketClients         prometheus.Gauge
-	WebsocketReqDuration     *prometheus.HistogramVec
-	IndexResyncDuration      prometheus.Histogram
-	MempoolResyncDuration    prometheus.Histogram
-	TxCacheEfficiency        *prometheus.CounterVec
-	RPCLatency               *prometheus.HistogramVec
-	IndexResyncErrors        *prometheus.CounterVec
-	IndexDBSize              prometheus.Gauge
-	ExplorerViews            *prometheus.CounterVec
-	MempoolSize              prometheus.Gauge
-	DbColumnRows             *prometheus.GaugeVec
-	DbColumnSize             *prometheus.GaugeVec
-	BlockbookAppInfo         *prometheus.GaugeVec
-	BackendBestHeight        prometheus.Gauge
-	BlockbookBestHeight      prometheus.Gauge
-	ExplorerPendingRequests  *prometheus.GaugeVec
-	WebsocketPendingRequests *prometheus.GaugeVec
-	SocketIOPendingRequests  *prometheus.GaugeVec
-	XPubCacheSize            prometheus.Gauge
+	SocketIORequests          *prometheus.CounterVec
+	SocketIOSubscribes        *prometheus.CounterVec
+	SocketIOClients           prometheus.Gauge
+	SocketIOReqDuration       *prometheus.HistogramVec
+	WebsocketRequests         *prometheus.CounterVec
+	WebsocketSubscribes       *prometheus.GaugeVec
+	WebsocketClients          prometheus.Gauge
+	WebsocketReqDuration      *prometheus.HistogramVec
+	IndexResyncDuration       prometheus.Histogram
+	MempoolResyncDuration     prometheus.Histogram
+	TxCacheEfficiency         *prometheus.CounterVec
+	RPCLatency                *prometheus.HistogramVec
+	IndexResyncErrors         *prometheus.CounterVec
+	IndexDBSize               prometheus.Gauge
+	ExplorerViews             *prometheus.CounterVec
+	MempoolSize               prometheus.Gauge
+	DbColumnRows              *prometheus.GaugeVec
+	DbColumnSize              *prometheus.GaugeVec
+	BlockbookAppInfo          *prometheus.GaugeVec
+	BackendBestHeight         prometheus.Gauge
+	BlockbookBestHeight       prometheus.Gauge
+	ExplorerPendingRequests   *prometheus.GaugeVec
+	WebsocketPendingRequests  *prometheus.GaugeVec
+	SocketIOPendingRequests   *prometheus.GaugeVec
+	XPubCacheSize             prometheus.Gauge
+	APIRejections             *prometheus.CounterVec
+	FiatRatesProviderRequests *prometheus.CounterVec
+	FiatRatesProviderUp       *prometheus.GaugeVec
 }
 
 // Labels represents a collection of label name -> value mappings.
@@ -238,6 +241,30 @@ func GetMetrics(coin string) (*Metrics, error) {
 			ConstLabels: Labels{"coin": coin},
 		},
 	)
+	metrics.APIRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_api_rejections",
+			Help:        "Number of rejected public API requests by API key and reason",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"key", "reason"},
+	)
+	metrics.FiatRatesProviderRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_fiat_rates_provider_requests",
+			Help:        "Number of fiat rates provider requests by provider and status (ok, error, outlier)",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"provider", "status"},
+	)
+	metrics.FiatRatesProviderUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_fiat_rates_provider_up",
+			Help:        "Result of the last request of the fiat rates provider (1 success, 0 error)",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"provider"},
+	)
 
 	v := reflect.ValueOf(metrics)
 	for i := 0; i < v.NumField(); i++ {
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/juju/errors"
+)
+
+// APILimits are the limits of a client of the public server, zero value means unlimited
+type APILimits struct {
+	// REST requests per second and the maximum burst of requests
+	RESTRate  float64 `json:"restRate"`
+	RESTBurst int     `json:"restBurst"`
+	// websocket requests per second and the maximum burst of requests
+	WebsocketRate  float64 `json:"websocketRate"`
+	WebsocketBurst int     `json:"websocketBurst"`
+	// maximum number of subscribed items (addresses, accounts, transactions and other subscriptions) in all websocket connections
+	MaxSubscriptions int `json:"maxSubscriptions"`
+}
+
+// APIKey is an API key of the public server with its limits, stored as json in the apiKeys column
+type APIKey struct {
+	Key      string    `json:"key"`
+	Name     string    `json:"name"`
+	Disabled bool      `json:"disabled"`
+	Limits   APILimits `json:"limits"`
+}
+
+var errAPIKeysDisabled = errors.New("API keys are not stored in the database")
+
+// EnableAPIKeys creates the apiKeys column if it does not exist yet, it must be called before the API keys are stored
+func (d *RocksDB) EnableAPIKeys() error {
+	return d.createOptionalColumn(cfAPIKeys)
+}
+
+// StoreAPIKey stores the API key to the apiKeys column, an existing key is replaced
+func (d *RocksDB) StoreAPIKey(k *APIKey) error {
+	if d.cfh[cfAPIKeys] == nil {
+		return errAPIKeysDisabled
+	}
+	if k.Key == "" {
+		return errors.New("Missing key")
+	}
+	buf, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfAPIKeys], []byte(k.Key), buf)
+}
+
+// GetAPIKeys returns all API keys from the apiKeys column, nil if the column is not enabled
+func (d *RocksDB) GetAPIKeys() ([]APIKey, error) {
+	if d.cfh[cfAPIKeys] == nil {
+		return nil, nil
+	}
+	var keys []APIKey
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAPIKeys])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		var k APIKey
+		if err := json.Unmarshal(it.Value().Data(), &k); err != nil {
+			return nil, errors.Annotatef(err, "API key %v", string(it.Key().Data()))
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey removes the API key from the apiKeys column
+func (d *RocksDB) DeleteAPIKey(key string) error {
+	if d.cfh[cfAPIKeys] == nil {
+		return errAPIKeysDisabled
+	}
+	return d.db.DeleteCF(d.wo, d.cfh[cfAPIKeys], []byte(key))
+}
@@ -0,0 +1,55 @@
+// +build unittest
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	keys, err := d.GetAPIKeys()
+	if err != nil || keys != nil {
+		t.Fatalf("GetAPIKeys() of disabled column = %v, %v, want nil", keys, err)
+	}
+	if err = d.StoreAPIKey(&APIKey{Key: "key1", Name: "exchange"}); err != errAPIKeysDisabled {
+		t.Fatalf("StoreAPIKey() of disabled column = %v, want %v", err, errAPIKeysDisabled)
+	}
+
+	if err = d.EnableAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	k1 := APIKey{Key: "key1", Name: "exchange", Limits: APILimits{RESTRate: 10, RESTBurst: 20}}
+	k2 := APIKey{Key: "key2", Name: "wallet", Disabled: true}
+	for _, k := range []*APIKey{&k2, &k1} {
+		if err = d.StoreAPIKey(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = d.StoreAPIKey(&APIKey{Name: "nokey"}); err == nil {
+		t.Fatal("StoreAPIKey() without key succeeded")
+	}
+	keys, err = d.GetAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []APIKey{k1, k2}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetAPIKeys() = %+v, want %+v", keys, want)
+	}
+
+	if err = d.DeleteAPIKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = d.GetAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []APIKey{k2}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetAPIKeys() after delete = %+v, want %+v", keys, want)
+	}
+}
@@ -0,0 +1,317 @@
+package db
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// BroadcastState is the state of a transaction in the broadcast queue
+type BroadcastState string
+
+const (
+	// BroadcastPending is a transaction that is rebroadcast until it is confirmed
+	BroadcastPending = BroadcastState("pending")
+	// BroadcastConfirmed is a transaction included in a block
+	BroadcastConfirmed = BroadcastState("confirmed")
+	// BroadcastConflicted is a transaction that cannot be confirmed, its inputs were spent by another transaction
+	BroadcastConflicted = BroadcastState("conflicted")
+	// BroadcastExpired is a transaction that was not confirmed within the expiration period
+	BroadcastExpired = BroadcastState("expired")
+)
+
+// BroadcastTx is a transaction sent by blockbook, stored in the broadcasts column
+// the times are unix timestamps, BlockHeight is set only for the confirmed transactions
+type BroadcastTx struct {
+	Txid        string         `json:"txid"`
+	Hex         string         `json:"hex"`
+	State       BroadcastState `json:"state"`
+	FirstSent   int64          `json:"firstSent"`
+	LastSent    int64          `json:"lastSent"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"lastError,omitempty"`
+	BlockHeight uint32         `json:"blockHeight,omitempty"`
+	Updated     int64          `json:"updated"`
+}
+
+// OnBroadcastStateChange is called when the state of a transaction in the broadcast queue changes
+type OnBroadcastStateChange func(tx *BroadcastTx)
+
+// StoreBroadcastTx stores the transaction to the broadcasts column
+func (d *RocksDB) StoreBroadcastTx(tx *BroadcastTx) error {
+	key, err := d.chainParser.PackTxid(tx.Txid)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfBroadcasts], key, buf)
+}
+
+// GetBroadcastTx returns the transaction from the broadcasts column or nil if it is not found
+func (d *RocksDB) GetBroadcastTx(txid string) (*BroadcastTx, error) {
+	key, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfBroadcasts], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	var tx BroadcastTx
+	if err = json.Unmarshal(buf, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// GetBroadcastTxs returns all transactions from the broadcasts column
+func (d *RocksDB) GetBroadcastTxs() ([]*BroadcastTx, error) {
+	var txs []*BroadcastTx
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBroadcasts])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		var tx BroadcastTx
+		if err := json.Unmarshal(it.Value().Data(), &tx); err != nil {
+			glog.Error("GetBroadcastTxs: invalid tx ", hex.EncodeToString(it.Key().Data()), ", ", err)
+			continue
+		}
+		txs = append(txs, &tx)
+	}
+	return txs, nil
+}
+
+// DeleteBroadcastTx removes the transaction from the broadcasts column
+func (d *RocksDB) DeleteBroadcastTx(txid string) error {
+	key, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return err
+	}
+	return d.db.DeleteCF(d.wo, d.cfh[cfBroadcasts], key)
+}
+
+// BroadcastQueue sends the transactions to the backend and rebroadcasts them until they are confirmed, conflicted or expired,
+// the transactions in the final states are kept for the expiration period so that their state can be queried
+type BroadcastQueue struct {
+	db            *RocksDB
+	chain         bchain.BlockChain
+	expiration    time.Duration
+	onStateChange OnBroadcastStateChange
+	// serializes the updates of the broadcasts column
+	lock sync.Mutex
+}
+
+// NewBroadcastQueue creates BroadcastQueue stored in the broadcasts column, onStateChange is optional
+func NewBroadcastQueue(d *RocksDB, chain bchain.BlockChain, expiration time.Duration, onStateChange OnBroadcastStateChange) (*BroadcastQueue, error) {
+	if expiration <= 0 {
+		return nil, errors.New("Invalid broadcast expiration")
+	}
+	if err := d.createOptionalColumn(cfBroadcasts); err != nil {
+		return nil, err
+	}
+	return &BroadcastQueue{
+		db:            d,
+		chain:         chain,
+		expiration:    expiration,
+		onStateChange: onStateChange,
+	}, nil
+}
+
+func (q *BroadcastQueue) setState(tx *BroadcastTx, state BroadcastState, now time.Time) {
+	changed := tx.State != state
+	tx.State = state
+	tx.Updated = now.Unix()
+	if err := q.db.StoreBroadcastTx(tx); err != nil {
+		glog.Error("BroadcastQueue: StoreBroadcastTx error ", err, " for ", tx.Txid)
+	}
+	if changed && q.onStateChange != nil {
+		q.onStateChange(tx)
+	}
+}
+
+// Send sends the transaction to the backend and adds it to the queue, the transactions rejected by the backend are not added
+func (q *BroadcastQueue) Send(txHex string) (string, error) {
+	txid, err := q.chain.SendRawTransaction(txHex)
+	if err != nil {
+		return "", err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	now := time.Now()
+	tx, err := q.db.GetBroadcastTx(txid)
+	if err != nil {
+		glog.Error("BroadcastQueue: GetBroadcastTx error ", err, " for ", txid)
+	}
+	// the transaction sent again after it left the queue starts a new expiration period
+	if tx == nil || tx.State != BroadcastPending {
+		tx = &BroadcastTx{Txid: txid, Hex: txHex, FirstSent: now.Unix()}
+	}
+	tx.LastSent = now.Unix()
+	tx.Attempts++
+	tx.LastError = ""
+	q.setState(tx, BroadcastPending, now)
+	return txid, nil
+}
+
+// confirmation returns the height of the block containing the transaction and if the backend knows the transaction
+func (q *BroadcastQueue) confirmation(tx *BroadcastTx) (uint32, bool, error) {
+	if q.db.chainParser.GetChainType() == bchain.ChainBitcoinType {
+		ta, err := q.db.GetTxAddresses(tx.Txid)
+		if err != nil {
+			return 0, false, err
+		}
+		if ta != nil {
+			return ta.Height, true, nil
+		}
+	}
+	btx, err := q.chain.GetTransaction(tx.Txid)
+	if err != nil {
+		if err == bchain.ErrTxNotFound {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	// in Bitcoin type coins the confirmed transaction is waiting for the index to be synchronized
+	if btx.Confirmations > 0 && q.db.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return btx.BlockHeight, true, nil
+	}
+	return 0, true, nil
+}
+
+// conflicted returns true if the transaction cannot be confirmed because its inputs were spent by another transaction
+func (q *BroadcastQueue) conflicted(tx *BroadcastTx, sendErr error) bool {
+	if q.db.chainParser.GetChainType() == bchain.ChainBitcoinType {
+		b, err := hex.DecodeString(tx.Hex)
+		if err != nil {
+			return false
+		}
+		btx, err := q.db.chainParser.ParseTx(b)
+		if err != nil {
+			return false
+		}
+		for i := range btx.Vin {
+			vin := &btx.Vin[i]
+			if vin.Txid == "" {
+				continue
+			}
+			ta, err := q.db.GetTxAddresses(vin.Txid)
+			if err != nil {
+				glog.Error("BroadcastQueue: GetTxAddresses error ", err, " for ", vin.Txid)
+				return false
+			}
+			if ta != nil && int(vin.Vout) < len(ta.Outputs) && ta.Outputs[vin.Vout].Spent {
+				return true
+			}
+		}
+		return false
+	}
+	// in Ethereum type coins the nonce of the transaction was used by another transaction
+	return sendErr != nil && strings.Contains(strings.ToLower(sendErr.Error()), "nonce too low")
+}
+
+// Rebroadcast checks the state of the queued transactions and sends again the pending transactions unknown to the backend,
+// the transactions in the final states older than the expiration period are removed; it returns the number of pending transactions
+// the backend is queried without holding the lock, the transactions changed by Send in the meantime are not updated
+func (q *BroadcastQueue) Rebroadcast(now time.Time) (int, error) {
+	txs, err := q.pendingBroadcastTxs(now)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, tx := range txs {
+		lastSent := tx.LastSent
+		state, update := q.checkBroadcastTx(tx, now)
+		if state == BroadcastPending {
+			pending++
+		}
+		if update {
+			q.updateBroadcastTx(tx, lastSent, state, now)
+		}
+	}
+	return pending, nil
+}
+
+// pendingBroadcastTxs removes the expired transactions in the final states and returns the pending transactions
+func (q *BroadcastQueue) pendingBroadcastTxs(now time.Time) ([]*BroadcastTx, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	txs, err := q.db.GetBroadcastTxs()
+	if err != nil {
+		return nil, err
+	}
+	var pending []*BroadcastTx
+	for _, tx := range txs {
+		if tx.State == BroadcastPending {
+			pending = append(pending, tx)
+		} else if now.Sub(time.Unix(tx.Updated, 0)) > q.expiration {
+			if err = q.db.DeleteBroadcastTx(tx.Txid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return pending, nil
+}
+
+// checkBroadcastTx finds out the new state of the pending transaction and rebroadcasts it if necessary,
+// it returns the state and if the transaction must be updated
+func (q *BroadcastQueue) checkBroadcastTx(tx *BroadcastTx, now time.Time) (BroadcastState, bool) {
+	height, known, err := q.confirmation(tx)
+	if err != nil {
+		glog.Error("BroadcastQueue: confirmation error ", err, " for ", tx.Txid)
+		return BroadcastPending, false
+	}
+	if height > 0 {
+		tx.BlockHeight = height
+		return BroadcastConfirmed, true
+	}
+	// the transaction expires even if it is stuck in the mempool of the backend
+	if now.Sub(time.Unix(tx.FirstSent, 0)) > q.expiration {
+		return BroadcastExpired, true
+	}
+	if known {
+		return BroadcastPending, false
+	}
+	if q.conflicted(tx, nil) {
+		return BroadcastConflicted, true
+	}
+	tx.LastSent = now.Unix()
+	tx.Attempts++
+	if _, err = q.chain.SendRawTransaction(tx.Hex); err != nil {
+		glog.Info("BroadcastQueue: rebroadcast of ", tx.Txid, " failed: ", err)
+		if q.conflicted(tx, err) {
+			return BroadcastConflicted, true
+		}
+		tx.LastError = err.Error()
+	} else {
+		tx.LastError = ""
+	}
+	return BroadcastPending, true
+}
+
+// updateBroadcastTx stores the new state of the transaction, unless it was sent again by Send after lastSent
+func (q *BroadcastQueue) updateBroadcastTx(tx *BroadcastTx, lastSent int64, state BroadcastState, now time.Time) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	stored, err := q.db.GetBroadcastTx(tx.Txid)
+	if err != nil {
+		glog.Error("BroadcastQueue: GetBroadcastTx error ", err, " for ", tx.Txid)
+		return
+	}
+	if stored == nil || stored.State != BroadcastPending || stored.LastSent != lastSent {
+		return
+	}
+	q.setState(tx, state, now)
+}
@@ -0,0 +1,181 @@
+// +build unittest
+
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+// spends the unspent output B2T3:0
+const broadcastTestHex = "0200000001071b23c43f89bc9dbf22b5a7abc2134730ba56d7487bef5db7d9bdea8ae4e2050000000000fdffffff01401f0000000000001976a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac00000000"
+const broadcastTestTxid = "0d5187819d6071344f23f266be934adac8097ac3a22b2bcc40098f29bfa07149"
+
+// spends the outputs B2T3:0 and the already spent B1T2:1
+const broadcastConflictHex = "0200000002071b23c43f89bc9dbf22b5a7abc2134730ba56d7487bef5db7d9bdea8ae4e2050000000000fdffffff75acb49486d6bb2240fdbef2a421f5fb8e4c43bff58a1c6b533d3809f59efdef0100000000fdffffff0164000000000000001976a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac00000000"
+
+type broadcastTestChain struct {
+	bchain.BlockChain
+	txids   map[string]string
+	mempool map[string]struct{}
+	failing map[string]struct{}
+	sent    []string
+}
+
+func (c *broadcastTestChain) SendRawTransaction(tx string) (string, error) {
+	txid, found := c.txids[tx]
+	if !found {
+		return "", errors.New("TX decode failed")
+	}
+	c.sent = append(c.sent, txid)
+	return txid, nil
+}
+
+func (c *broadcastTestChain) GetTransaction(txid string) (*bchain.Tx, error) {
+	if _, found := c.failing[txid]; found {
+		return nil, errors.New("backend error")
+	}
+	if _, found := c.mempool[txid]; found {
+		return &bchain.Tx{Txid: txid}, nil
+	}
+	return nil, bchain.ErrTxNotFound
+}
+
+func TestBroadcastQueue(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := &broadcastTestChain{
+		txids:   map[string]string{broadcastTestHex: broadcastTestTxid},
+		mempool: make(map[string]struct{}),
+	}
+	if _, err := NewBroadcastQueue(d, chain, 0, nil); err == nil {
+		t.Fatal("NewBroadcastQueue: expected error for zero expiration")
+	}
+	var changes []string
+	q, err := NewBroadcastQueue(d, chain, time.Hour, func(tx *BroadcastTx) {
+		changes = append(changes, tx.Txid[:8]+" "+string(tx.State))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = q.Send("00"); err == nil || err.Error() != "TX decode failed" {
+		t.Fatalf("Send: expected rejection, got %v", err)
+	}
+	txid, err := q.Send(broadcastTestHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != broadcastTestTxid {
+		t.Fatalf("Send() = %v, want %v", txid, broadcastTestTxid)
+	}
+	tx, err := d.GetBroadcastTx(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx == nil || tx.State != BroadcastPending || tx.Attempts != 1 || tx.Hex != broadcastTestHex {
+		t.Fatalf("GetBroadcastTx() = %+v", tx)
+	}
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour).Unix()
+	for _, tx := range []*BroadcastTx{
+		// confirmed in block 1
+		{Txid: dbtestdata.TxidB1T1, Hex: "00", State: BroadcastPending, FirstSent: old},
+		{Txid: "1111111111111111111111111111111111111111111111111111111111111111", Hex: broadcastConflictHex, State: BroadcastPending, FirstSent: now.Unix()},
+		{Txid: "2222222222222222222222222222222222222222222222222222222222222222", Hex: "00", State: BroadcastPending, FirstSent: old},
+		// in the backend mempool, expires even while it is there
+		{Txid: "3333333333333333333333333333333333333333333333333333333333333333", Hex: "00", State: BroadcastPending, FirstSent: old},
+		// in the backend mempool, the failing backend does not stop the other transactions
+		{Txid: "4444444444444444444444444444444444444444444444444444444444444444", Hex: "00", State: BroadcastPending, FirstSent: now.Unix()},
+		{Txid: "5555555555555555555555555555555555555555555555555555555555555555", Hex: "00", State: BroadcastPending, FirstSent: now.Unix()},
+	} {
+		if err = d.StoreBroadcastTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chain.mempool["3333333333333333333333333333333333333333333333333333333333333333"] = struct{}{}
+	chain.mempool["4444444444444444444444444444444444444444444444444444444444444444"] = struct{}{}
+	chain.failing = map[string]struct{}{"5555555555555555555555555555555555555555555555555555555555555555": {}}
+	changes = nil
+	chain.sent = nil
+	pending, err := q.Rebroadcast(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != 3 {
+		t.Errorf("Rebroadcast() = %v, want 3", pending)
+	}
+	sort.Strings(changes)
+	wantChanges := []string{"00b2c060 confirmed", "11111111 conflicted", "22222222 expired", "33333333 expired"}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("state changes = %v, want %v", changes, wantChanges)
+	}
+	if !reflect.DeepEqual(chain.sent, []string{broadcastTestTxid}) {
+		t.Errorf("rebroadcast txs = %v, want [%v]", chain.sent, broadcastTestTxid)
+	}
+	if tx, err = d.GetBroadcastTx(dbtestdata.TxidB1T1); err != nil || tx.BlockHeight != 225493 {
+		t.Errorf("GetBroadcastTx() = %+v, %v, want block height 225493", tx, err)
+	}
+	if tx, err = d.GetBroadcastTx(broadcastTestTxid); err != nil || tx.Attempts != 2 || tx.State != BroadcastPending {
+		t.Errorf("GetBroadcastTx() = %+v, %v, want 2 attempts", tx, err)
+	}
+
+	// the transactions in the final states are removed after the expiration, the pending one expires
+	changes = nil
+	if pending, err = q.Rebroadcast(now.Add(3 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if pending != 1 {
+		t.Errorf("Rebroadcast() = %v, want 1", pending)
+	}
+	sort.Strings(changes)
+	if want := []string{"0d518781 expired", "44444444 expired"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("state changes = %v, want %v", changes, want)
+	}
+	txs, err := d.GetBroadcastTxs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tx := range txs {
+		got = append(got, tx.Txid[:8]+" "+string(tx.State))
+	}
+	sort.Strings(got)
+	if want := []string{"0d518781 expired", "44444444 expired", "55555555 pending"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBroadcastTxs() = %v, want %v", got, want)
+	}
+
+	// sending again restarts the expired transaction
+	changes = nil
+	if _, err = q.Send(broadcastTestHex); err != nil {
+		t.Fatal(err)
+	}
+	if tx, err = d.GetBroadcastTx(broadcastTestTxid); err != nil || tx.Attempts != 1 || tx.State != BroadcastPending {
+		t.Errorf("GetBroadcastTx() = %+v, %v, want pending with 1 attempt", tx, err)
+	}
+	if !reflect.DeepEqual(changes, []string{"0d518781 pending"}) {
+		t.Errorf("state changes = %v, want [0d518781 pending]", changes)
+	}
+
+	// the result of a check overtaken by Send is not stored
+	q.updateBroadcastTx(&BroadcastTx{Txid: broadcastTestTxid, Hex: broadcastTestHex}, tx.LastSent-1, BroadcastExpired, now)
+	if tx, err = d.GetBroadcastTx(broadcastTestTxid); err != nil || tx.State != BroadcastPending {
+		t.Errorf("GetBroadcastTx() = %+v, %v, want pending", tx, err)
+	}
+}
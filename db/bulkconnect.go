@@ -15,8 +15,9 @@ import (
 // 2) rocksdb seems to handle better fewer larger batches than continuous stream of smaller batches
 
 type bulkAddresses struct {
-	bi        BlockInfo
-	addresses addressesMap
+	bi           BlockInfo
+	addresses    addressesMap
+	contractLogs addressesMap
 }
 
 // BulkConnect is used to connect blocks in bulk, faster but if interrupted inconsistent way
@@ -28,6 +29,7 @@ type BulkConnect struct {
 	txAddressesMap     map[string]*TxAddresses
 	balances           map[string]*AddrBalance
 	addressContracts   map[string]*AddrContracts
+	contractHolders    map[string]int
 	height             uint32
 }
 
@@ -49,6 +51,7 @@ func (d *RocksDB) InitBulkConnect() (*BulkConnect, error) {
 		txAddressesMap:   make(map[string]*TxAddresses),
 		balances:         make(map[string]*AddrBalance),
 		addressContracts: make(map[string]*AddrContracts),
+		contractHolders:  make(map[string]int),
 	}
 	if err := d.SetInconsistentState(true); err != nil {
 		return nil, err
@@ -160,12 +163,21 @@ func (b *BulkConnect) storeBulkAddresses(wb *gorocksdb.WriteBatch) error {
 		if err := b.d.storeAddresses(wb, ba.bi.Height, ba.addresses); err != nil {
 			return err
 		}
+		if len(ba.contractLogs) > 0 {
+			b.d.storeContractLogs(wb, ba.bi.Height, ba.contractLogs, false)
+		}
 		if err := b.d.writeHeight(wb, ba.bi.Height, &ba.bi, opInsert); err != nil {
 			return err
 		}
 	}
 	b.bulkAddressesCount = 0
 	b.bulkAddresses = b.bulkAddresses[:0]
+	if len(b.contractHolders) > 0 {
+		if err := b.d.storeContractHolders(wb, b.contractHolders); err != nil {
+			return err
+		}
+		b.contractHolders = make(map[string]int)
+	}
 	return nil
 }
 
@@ -276,7 +288,16 @@ func (b *BulkConnect) parallelStoreAddressContracts(c chan error, all bool) {
 
 func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTxs bool) error {
 	addresses := make(addressesMap)
-	blockTxs, err := b.d.processAddressesEthereumType(block, addresses, b.addressContracts)
+	newContracts := make(map[string]struct{})
+	blockTxs, err := b.d.processAddressesEthereumType(block, addresses, b.addressContracts, newContracts, b.contractHolders)
+	if err != nil {
+		return err
+	}
+	contractLogs := make(addressesMap)
+	if err := b.d.processEventLogsEthereumType(block, contractLogs); err != nil {
+		return err
+	}
+	creations, err := b.d.processContractCreationsEthereumType(block)
 	if err != nil {
 		return err
 	}
@@ -297,9 +318,14 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 		},
 		addresses: addresses,
 	})
+	// the event logs are cached with the addresses, except for the blocks which must be disconnectable
+	if !storeBlockTxs {
+		b.bulkAddresses[len(b.bulkAddresses)-1].contractLogs = contractLogs
+		b.bulkAddressesCount += len(contractLogs)
+	}
 	b.bulkAddressesCount += len(addresses)
 	// open WriteBatch only if going to write
-	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
+	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs || len(newContracts) > 0 || len(creations) > 0 {
 		start := time.Now()
 		wb := gorocksdb.NewWriteBatch()
 		defer wb.Destroy()
@@ -314,6 +340,11 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 				return err
 			}
 		}
+		if storeBlockTxs {
+			b.d.storeContractLogs(wb, block.Height, contractLogs, true)
+		}
+		b.d.storeNewContracts(wb, newContracts)
+		b.d.storeContractCreations(wb, creations)
 		if err := b.d.db.Write(b.d.wo, wb); err != nil {
 			return err
 		}
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// prune the event log at most once per this period
+const eventLogPrunePeriod = time.Minute
+
+// EventType is type of the event stored in the EventLog
+type EventType byte
+
+const (
+	// EventNewBlock is a new block connected to the index
+	EventNewBlock = EventType(iota)
+	// EventAddressTx is a new transaction affecting an address
+	EventAddressTx
+	// EventAddressReorgTx is a transaction affecting an address from a block disconnected in a reorg
+	EventAddressReorgTx
+)
+
+// Event is a notification about a change in the index, stored in the EventLog so that it can be replayed
+// Height and Hash are set for EventNewBlock, AddrDesc, Txid and Height (of the disconnected block) for address events
+type Event struct {
+	Seq      uint64
+	Time     int64
+	Type     EventType
+	Height   uint32
+	Hash     string
+	AddrDesc bchain.AddressDescriptor
+	Txid     string
+}
+
+// EventLog is a bounded log of events, the most recent events are kept in memory, all events within the retention period in RocksDB
+type EventLog struct {
+	db        *RocksDB
+	retention time.Duration
+	memSize   int
+	lock      sync.Mutex
+	mem       []Event
+	firstSeq  uint64
+	lastSeq   uint64
+	lastPrune time.Time
+}
+
+// NewEventLog creates EventLog stored in the events column, loading the sequence numbers of the stored events
+func NewEventLog(d *RocksDB, retention time.Duration, memSize int) (*EventLog, error) {
+	if retention <= 0 {
+		return nil, errors.New("Invalid event log retention")
+	}
+	if memSize < 0 {
+		memSize = 0
+	}
+	if err := d.createOptionalColumn(cfEvents); err != nil {
+		return nil, err
+	}
+	l := &EventLog{
+		db:        d,
+		retention: retention,
+		memSize:   memSize,
+		mem:       make([]Event, 0, memSize),
+	}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfEvents])
+	defer it.Close()
+	it.SeekToLast()
+	if it.Valid() {
+		l.lastSeq = unpackEventSeq(it.Key().Data())
+		it.SeekToFirst()
+		l.firstSeq = unpackEventSeq(it.Key().Data())
+	} else {
+		l.firstSeq = 1
+	}
+	if err := l.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	glog.Infof("eventlog: retention %v, events %d-%d", retention, l.firstSeq, l.lastSeq)
+	return l, nil
+}
+
+func packEventSeq(seq uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, seq)
+	return buf
+}
+
+func unpackEventSeq(buf []byte) uint64 {
+	return binary.BigEndian.Uint64(buf)
+}
+
+func (d *RocksDB) packEvent(e *Event) ([]byte, error) {
+	var id []byte
+	var err error
+	if e.Type == EventNewBlock {
+		id, err = d.chainParser.PackBlockHash(e.Hash)
+	} else {
+		id, err = d.chainParser.PackTxid(e.Txid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, 1+3*vlq.MaxLen64+len(e.AddrDesc)+len(id))
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf = append(buf, byte(e.Type))
+	l := packVarint(int(e.Time), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(e.Height), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(len(e.AddrDesc)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = append(buf, e.AddrDesc...)
+	buf = append(buf, id...)
+	return buf, nil
+}
+
+func (d *RocksDB) unpackEvent(seq uint64, buf []byte) (*Event, error) {
+	if len(buf) < 4 {
+		return nil, errors.New("Inconsistent data in events")
+	}
+	e := Event{Seq: seq, Type: EventType(buf[0])}
+	i := 1
+	t, l := unpackVarint(buf[i:])
+	e.Time = int64(t)
+	i += l
+	h, l := unpackVaruint(buf[i:])
+	e.Height = uint32(h)
+	i += l
+	al, l := unpackVaruint(buf[i:])
+	i += l
+	if len(buf) < i+int(al) {
+		return nil, errors.New("Inconsistent data in events")
+	}
+	if al > 0 {
+		e.AddrDesc = append(bchain.AddressDescriptor(nil), buf[i:i+int(al)]...)
+	}
+	i += int(al)
+	var err error
+	if e.Type == EventNewBlock {
+		e.Hash, err = d.chainParser.UnpackBlockHash(buf[i:])
+	} else {
+		e.Txid, err = d.chainParser.UnpackTxid(buf[i:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Append stores the events in the log, assigning them sequence numbers
+func (l *EventLog) Append(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	seq := l.lastSeq
+	for i := range events {
+		e := &events[i]
+		seq++
+		e.Seq = seq
+		e.Time = now.Unix()
+		buf, err := l.db.packEvent(e)
+		if err != nil {
+			return err
+		}
+		wb.PutCF(l.db.cfh[cfEvents], packEventSeq(seq), buf)
+	}
+	if err := l.db.db.Write(l.db.wo, wb); err != nil {
+		return err
+	}
+	l.lastSeq = seq
+	if l.memSize > 0 {
+		l.mem = append(l.mem, events...)
+		if len(l.mem) > l.memSize {
+			l.mem = append(l.mem[:0], l.mem[len(l.mem)-l.memSize:]...)
+		}
+	}
+	if l.lastPrune.Add(eventLogPrunePeriod).Before(now) {
+		if err := l.prune(now); err != nil {
+			glog.Error("eventlog: prune error ", err)
+		}
+	}
+	return nil
+}
+
+// eventTime returns the time of the stored event
+func (l *EventLog) eventTime(seq uint64) (int64, error) {
+	val, err := l.db.db.GetCF(l.db.ro, l.db.cfh[cfEvents], packEventSeq(seq))
+	if err != nil {
+		return 0, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) < 2 {
+		return 0, errors.New("Inconsistent data in events")
+	}
+	t, _ := unpackVarint(buf[1:])
+	return int64(t), nil
+}
+
+// prune removes events older than the retention period, the last event is always kept to preserve the sequence
+// it must be called with the lock held or during initialization
+func (l *EventLog) prune(now time.Time) error {
+	l.lastPrune = now
+	cutoff := now.Add(-l.retention).Unix()
+	for len(l.mem) > 0 && l.mem[0].Time < cutoff && l.mem[0].Seq < l.lastSeq {
+		l.mem = l.mem[1:]
+	}
+	// the stored events have consecutive sequence numbers and ascending times,
+	// find the first event within the retention period by binary search instead of iterating over the column
+	first, last := l.firstSeq, l.lastSeq
+	for first < last {
+		mid := first + (last-first)/2
+		t, err := l.eventTime(mid)
+		if err != nil {
+			return err
+		}
+		if t < cutoff {
+			first = mid + 1
+		} else {
+			last = mid
+		}
+	}
+	if first <= l.firstSeq {
+		return nil
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for seq := l.firstSeq; seq < first; seq++ {
+		wb.DeleteCF(l.db.cfh[cfEvents], packEventSeq(seq))
+	}
+	if err := l.db.db.Write(l.db.wo, wb); err != nil {
+		return err
+	}
+	glog.V(1).Info("eventlog: pruned events ", l.firstSeq, "-", first-1)
+	l.firstSeq = first
+	return nil
+}
+
+// LastSeq returns the sequence number of the last event in the log
+func (l *EventLog) LastSeq() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.lastSeq
+}
+
+// GetEventsAfter returns events with sequence number greater than seq, for which filter returns true
+// the returned bool is false if the log does not contain all events after seq, either because they were pruned or seq is unknown
+func (l *EventLog) GetEventsAfter(seq uint64, filter func(e *Event) bool) ([]Event, bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if seq > l.lastSeq {
+		return nil, false, nil
+	}
+	complete := true
+	if seq+1 < l.firstSeq {
+		complete = false
+		seq = l.firstSeq - 1
+	}
+	var events []Event
+	if len(l.mem) > 0 && l.mem[0].Seq <= seq+1 {
+		for i := range l.mem {
+			if l.mem[i].Seq > seq && filter(&l.mem[i]) {
+				events = append(events, l.mem[i])
+			}
+		}
+		return events, complete, nil
+	}
+	it := l.db.db.NewIteratorCF(l.db.ro, l.db.cfh[cfEvents])
+	defer it.Close()
+	for it.Seek(packEventSeq(seq + 1)); it.Valid(); it.Next() {
+		e, err := l.db.unpackEvent(unpackEventSeq(it.Key().Data()), it.Value().Data())
+		if err != nil {
+			return nil, false, err
+		}
+		if filter(e) {
+			events = append(events, *e)
+		}
+	}
+	return events, complete, nil
+}
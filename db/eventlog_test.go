@@ -0,0 +1,207 @@
+// +build unittest
+
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func TestEventLog(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if d.cfh[cfEvents] != nil {
+		t.Fatal("events column created before the event log is enabled")
+	}
+	if _, err := NewEventLog(d, 0, 10); err == nil {
+		t.Fatal("NewEventLog: expected error for zero retention")
+	}
+
+	addr1, err := d.chainParser.GetAddrDescFromAddress(dbtestdata.Addr1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr2, err := d.chainParser.GetAddrDescFromAddress(dbtestdata.Addr2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)
+
+	l, err := NewEventLog(d, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.LastSeq(); got != 0 {
+		t.Fatalf("LastSeq() = %v, want 0", got)
+	}
+	events := []Event{
+		{Type: EventNewBlock, Height: block1.Height, Hash: block1.Hash},
+		{Type: EventAddressTx, AddrDesc: addr1, Txid: dbtestdata.TxidB1T1},
+		{Type: EventAddressTx, AddrDesc: addr2, Txid: dbtestdata.TxidB1T1},
+		{Type: EventAddressReorgTx, AddrDesc: addr1, Txid: dbtestdata.TxidB2T1, Height: 225494},
+	}
+	if err := l.Append(events); err != nil {
+		t.Fatal(err)
+	}
+	for i := range events {
+		if events[i].Seq != uint64(i+1) {
+			t.Fatalf("Append: event %d has Seq %v, want %v", i, events[i].Seq, i+1)
+		}
+	}
+	if got := l.LastSeq(); got != 4 {
+		t.Fatalf("LastSeq() = %v, want 4", got)
+	}
+
+	addr1Filter := func(e *Event) bool {
+		return string(e.AddrDesc) == string(addr1)
+	}
+	all := func(e *Event) bool { return true }
+	tests := []struct {
+		name         string
+		seq          uint64
+		filter       func(e *Event) bool
+		want         []Event
+		wantComplete bool
+	}{
+		{
+			name:         "all from start",
+			seq:          0,
+			filter:       all,
+			want:         events,
+			wantComplete: true,
+		},
+		{
+			name:         "address filter",
+			seq:          1,
+			filter:       addr1Filter,
+			want:         []Event{events[1], events[3]},
+			wantComplete: true,
+		},
+		{
+			name:         "from memory",
+			seq:          2,
+			filter:       all,
+			want:         events[2:],
+			wantComplete: true,
+		},
+		{
+			name:         "up to date",
+			seq:          4,
+			filter:       all,
+			want:         nil,
+			wantComplete: true,
+		},
+		{
+			name:         "unknown sequence",
+			seq:          5,
+			filter:       all,
+			want:         nil,
+			wantComplete: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, complete, err := l.GetEventsAfter(tt.seq, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetEventsAfter() = %+v, want %+v", got, tt.want)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("GetEventsAfter() complete = %v, want %v", complete, tt.wantComplete)
+			}
+		})
+	}
+
+	// reopened log continues the sequence, old events are pruned except the last one
+	l, err = NewEventLog(d, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.LastSeq(); got != 4 {
+		t.Fatalf("LastSeq() = %v, want 4", got)
+	}
+	if err := l.prune(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got, complete, err := l.GetEventsAfter(1, all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete || !reflect.DeepEqual(got, events[3:]) {
+		t.Errorf("GetEventsAfter() after prune = %+v, %v, want %+v, false", got, complete, events[3:])
+	}
+	e := Event{Type: EventAddressTx, AddrDesc: addr2, Txid: dbtestdata.TxidB2T1}
+	if err := l.Append([]Event{e}); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.LastSeq(); got != 5 {
+		t.Fatalf("LastSeq() = %v, want 5", got)
+	}
+}
+
+func TestEventLogPrune(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	l, err := NewEventLog(d, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ages := []time.Duration{4 * time.Hour, 3 * time.Hour, 2 * time.Hour, 30 * time.Minute, 10 * time.Minute}
+	var events []Event
+	for i, age := range ages {
+		e := Event{Seq: uint64(i + 1), Time: now.Add(-age).Unix(), Type: EventNewBlock, Height: uint32(i), Hash: dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser).Hash}
+		buf, err := d.packEvent(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.db.PutCF(d.wo, d.cfh[cfEvents], packEventSeq(e.Seq), buf); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	l.lastSeq = uint64(len(ages))
+
+	if err := l.prune(now); err != nil {
+		t.Fatal(err)
+	}
+	if l.firstSeq != 4 {
+		t.Errorf("firstSeq = %v, want 4", l.firstSeq)
+	}
+	for seq := uint64(1); seq <= l.lastSeq; seq++ {
+		val, err := d.db.GetCF(d.ro, d.cfh[cfEvents], packEventSeq(seq))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored := len(val.Data()) > 0; stored != (seq >= 4) {
+			t.Errorf("event %d stored %v, want %v", seq, stored, seq >= 4)
+		}
+		val.Free()
+	}
+	got, complete, err := l.GetEventsAfter(0, func(e *Event) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete || !reflect.DeepEqual(got, events[3:]) {
+		t.Errorf("GetEventsAfter() = %+v, %v, want %+v, false", got, complete, events[3:])
+	}
+
+	// the last event is kept even if it is older than the retention
+	if err := l.prune(now.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if l.firstSeq != 5 {
+		t.Errorf("firstSeq = %v, want 5", l.firstSeq)
+	}
+}
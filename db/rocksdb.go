@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -22,7 +23,7 @@ import (
 	"github.com/trezor/blockbook/common"
 )
 
-const dbVersion = 5
+const dbVersion = 6
 
 const packedHeightBytes = 4
 const maxAddrDescLen = 1024
@@ -98,6 +99,10 @@ type RocksDB struct {
 	cache        *gorocksdb.Cache
 	maxOpenFiles int
 	cbs          connectBlockStats
+	// serializes the read-modify-write updates of the contracts column
+	contractsMux sync.Mutex
+	// linear interpolation of the fiat rates between the surrounding tickers
+	fiatRatesInterpolation bool
 }
 
 const (
@@ -107,20 +112,32 @@ const (
 	cfBlockTxs
 	cfTransactions
 	cfFiatRates
+	cfEvents
+	cfBroadcasts
+	cfAPIKeys
 	// BitcoinType
 	cfAddressBalance
 	cfTxAddresses
 	// EthereumType
-	cfAddressContracts = cfAddressBalance
+	cfAddressContracts  = cfAddressBalance
+	cfContractLogs      = cfTxAddresses
+	cfContracts         = cfTxAddresses + 1
+	cfContractCreations = cfTxAddresses + 2
+	cfAddressNames      = cfTxAddresses + 3
+	cfFiatTokenRates    = cfTxAddresses + 4
+	cfContractHolders   = cfTxAddresses + 5
 )
 
 // common columns
 var cfNames []string
-var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions", "fiatRates"}
+var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions", "fiatRates", "events", "broadcasts", "apiKeys"}
+
+// optional columns are created only when the feature using them is enabled
+var cfOptional = map[int]bool{cfEvents: true, cfBroadcasts: true, cfAPIKeys: true}
 
 // type specific columns
 var cfNamesBitcoinType = []string{"addressBalance", "txAddresses"}
-var cfNamesEthereumType = []string{"addressContracts"}
+var cfNamesEthereumType = []string{"addressContracts", "contractLogs", "contracts", "contractCreations", "addressNames", "fiatTokenRates", "contractHolders"}
 
 func openDB(path string, c *gorocksdb.Cache, openFiles int) (*gorocksdb.DB, []*gorocksdb.ColumnFamilyHandle, error) {
 	// opts with bloom filter
@@ -135,13 +152,49 @@ func openDB(path string, c *gorocksdb.Cache, openFiles int) (*gorocksdb.DB, []*g
 	for i := 0; i < count; i++ {
 		cfOptions = append(cfOptions, opts)
 	}
-	db, cfh, err := gorocksdb.OpenDbColumnFamilies(opts, path, cfNames, cfOptions)
+	// the handles of the optional columns which do not exist are left nil, a new db does not have any column
+	existing := make(map[string]bool)
+	if names, err := gorocksdb.ListColumnFamilies(opts, path); err == nil {
+		for _, n := range names {
+			existing[n] = true
+		}
+	}
+	var names []string
+	var options []*gorocksdb.Options
+	var indexes []int
+	for i, n := range cfNames {
+		if cfOptional[i] && !existing[n] {
+			continue
+		}
+		names = append(names, n)
+		options = append(options, cfOptions[i])
+		indexes = append(indexes, i)
+	}
+	db, h, err := gorocksdb.OpenDbColumnFamilies(opts, path, names, options)
 	if err != nil {
 		return nil, nil, err
 	}
+	cfh := make([]*gorocksdb.ColumnFamilyHandle, len(cfNames))
+	for j, i := range indexes {
+		cfh[i] = h[j]
+	}
 	return db, cfh, nil
 }
 
+// createOptionalColumn creates the optional column if it does not exist yet, it must be called before the column is used
+func (d *RocksDB) createOptionalColumn(cf int) error {
+	if d.cfh[cf] != nil {
+		return nil
+	}
+	h, err := d.db.CreateColumnFamily(createAndSetDBOptions(10, d.cache, d.maxOpenFiles), cfNames[cf])
+	if err != nil {
+		return errors.Annotatef(err, "CreateColumnFamily %v", cfNames[cf])
+	}
+	glog.Info("rocksdb: created column ", cfNames[cf])
+	d.cfh[cf] = h
+	return nil
+}
+
 // NewRocksDB opens an internal handle to RocksDB environment.  Close
 // needs to be called to release it.
 func NewRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser, metrics *common.Metrics) (d *RocksDB, err error) {
@@ -164,12 +217,14 @@ func NewRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockCha
 	}
 	wo := gorocksdb.NewDefaultWriteOptions()
 	ro := gorocksdb.NewDefaultReadOptions()
-	return &RocksDB{path, db, wo, ro, cfh, parser, nil, metrics, c, maxOpenFiles, connectBlockStats{}}, nil
+	return &RocksDB{path, db, wo, ro, cfh, parser, nil, metrics, c, maxOpenFiles, connectBlockStats{}, sync.Mutex{}, false}, nil
 }
 
 func (d *RocksDB) closeDB() error {
 	for _, h := range d.cfh {
-		h.Destroy()
+		if h != nil {
+			h.Destroy()
+		}
 	}
 	d.db.Close()
 	d.db = nil
@@ -274,6 +329,244 @@ func (d *RocksDB) FiatRatesFindLastTicker() (*CurrencyRatesTicker, error) {
 	return ticker, nil
 }
 
+// SetFiatRatesInterpolation sets the linear interpolation of the fiat rates in FiatRatesGetTicker
+func (d *RocksDB) SetFiatRatesInterpolation(interpolation bool) {
+	d.fiatRatesInterpolation = interpolation
+}
+
+// FiatRatesGetTicker returns the fiat rates valid at the specified time.
+// Without the interpolation, it is the first ticker at or after the time (as FiatRatesFindTicker).
+// With the interpolation, the rates are linearly interpolated between the last ticker before and the first ticker after the time,
+// the currencies missing in one of the tickers are taken from the ticker after the time.
+func (d *RocksDB) FiatRatesGetTicker(tickerTime *time.Time) (*CurrencyRatesTicker, error) {
+	next, err := d.FiatRatesFindTicker(tickerTime)
+	if err != nil || next == nil || !d.fiatRatesInterpolation || !next.Timestamp.After(*tickerTime) {
+		return next, err
+	}
+	prev, err := d.fiatRatesFindPreviousTicker(tickerTime)
+	if err != nil || prev == nil {
+		return next, err
+	}
+	return interpolateTickers(prev, next, tickerTime.UTC()), nil
+}
+
+func interpolateTickers(prev, next *CurrencyRatesTicker, t time.Time) *CurrencyRatesTicker {
+	span := next.Timestamp.Sub(*prev.Timestamp)
+	f := float64(t.Sub(*prev.Timestamp)) / float64(span)
+	rates := make(map[string]float64, len(next.Rates))
+	for currency, nr := range next.Rates {
+		if pr, found := prev.Rates[currency]; found {
+			rates[currency] = pr + (nr-pr)*f
+		} else {
+			rates[currency] = nr
+		}
+	}
+	return &CurrencyRatesTicker{Timestamp: &t, Rates: rates}
+}
+
+// fiatRatesFindPreviousTicker returns the last ticker before the specified time
+func (d *RocksDB) fiatRatesFindPreviousTicker(tickerTime *time.Time) (*CurrencyRatesTicker, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatRates])
+	defer it.Close()
+	key := []byte(tickerTime.UTC().Format(FiatRatesTimeFormat))
+	it.SeekForPrev(key)
+	if it.Valid() && bytes.Equal(it.Key().Data(), key) {
+		it.Prev()
+	}
+	if err := it.Err(); err != nil {
+		glog.Error("fiatRatesFindPreviousTicker Iterator error: ", err)
+		return nil, err
+	}
+	if !it.Valid() {
+		return nil, nil
+	}
+	timeObj, err := time.Parse(FiatRatesTimeFormat, string(it.Key().Data()))
+	if err != nil {
+		glog.Error("fiatRatesFindPreviousTicker time parse error: ", err)
+		return nil, err
+	}
+	timeObj = timeObj.UTC()
+	ticker := &CurrencyRatesTicker{Timestamp: &timeObj}
+	if err = json.Unmarshal(it.Value().Data(), &ticker.Rates); err != nil {
+		glog.Error("fiatRatesFindPreviousTicker error unpacking rates: ", err)
+		return nil, err
+	}
+	return ticker, nil
+}
+
+// FiatRatesCompact reduces the tickers before the specified time to daily granularity,
+// only the first ticker of each day (UTC) is kept. It returns the number of removed tickers.
+func (d *RocksDB) FiatRatesCompact(before time.Time) (int, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatRates])
+	defer it.Close()
+	beforeKey := []byte(truncateToDay(before).Format(FiatRatesTimeFormat))
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	removed := 0
+	var lastDay []byte
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, beforeKey) >= 0 {
+			break
+		}
+		// the key starts with YYYYMMDD
+		if len(key) < 8 {
+			continue
+		}
+		if lastDay != nil && bytes.Equal(key[:8], lastDay) {
+			wb.DeleteCF(d.cfh[cfFiatRates], key)
+			removed++
+		} else {
+			lastDay = append([]byte(nil), key[:8]...)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return 0, err
+	}
+	if removed > 0 {
+		if err := d.db.Write(d.wo, wb); err != nil {
+			return 0, err
+		}
+	}
+	return removed, nil
+}
+
+// FiatRatesIterate calls fn for each stored ticker with the timestamp in the range [from, to), nil bounds are not limited
+// the iteration stops on the first error returned by fn
+func (d *RocksDB) FiatRatesIterate(from, to *time.Time, fn func(ticker *CurrencyRatesTicker) error) error {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatRates])
+	defer it.Close()
+	var toKey []byte
+	if to != nil {
+		toKey = []byte(to.UTC().Format(FiatRatesTimeFormat))
+	}
+	if from != nil {
+		it.Seek([]byte(from.UTC().Format(FiatRatesTimeFormat)))
+	} else {
+		it.SeekToFirst()
+	}
+	for ; it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if toKey != nil && bytes.Compare(key, toKey) >= 0 {
+			break
+		}
+		timeObj, err := time.Parse(FiatRatesTimeFormat, string(key))
+		if err != nil {
+			glog.Error("FiatRatesIterate time parse error: ", err)
+			return err
+		}
+		timeObj = timeObj.UTC()
+		ticker := &CurrencyRatesTicker{Timestamp: &timeObj}
+		if err = json.Unmarshal(it.Value().Data(), &ticker.Rates); err != nil {
+			glog.Error("FiatRatesIterate error unpacking rates: ", err)
+			return err
+		}
+		if err = fn(ticker); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// FiatRatesFindGaps returns the days in the range [from, to] (truncated to days in UTC) without any stored ticker
+func (d *RocksDB) FiatRatesFindGaps(from, to time.Time) ([]time.Time, error) {
+	from = truncateToDay(from)
+	to = truncateToDay(to).Add(24 * time.Hour)
+	var gaps []time.Time
+	day := from
+	err := d.FiatRatesIterate(&from, &to, func(ticker *CurrencyRatesTicker) error {
+		tickerDay := truncateToDay(*ticker.Timestamp)
+		for ; day.Before(tickerDay); day = day.Add(24 * time.Hour) {
+			gaps = append(gaps, day)
+		}
+		day = tickerDay.Add(24 * time.Hour)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for ; day.Before(to); day = day.Add(24 * time.Hour) {
+		gaps = append(gaps, day)
+	}
+	return gaps, nil
+}
+
+// FiatRatesCurrencyCoverage describes the availability of the rates of one currency
+type FiatRatesCurrencyCoverage struct {
+	Currency    string    `json:"currency"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+	Days        int       `json:"days"`
+	MissingDays int       `json:"missingDays"`
+}
+
+// FiatRatesCoverage describes the availability of the stored fiat rates
+type FiatRatesCoverage struct {
+	Tickers     int                         `json:"tickers"`
+	First       *time.Time                  `json:"first,omitempty"`
+	Last        *time.Time                  `json:"last,omitempty"`
+	MissingDays int                         `json:"missingDays"`
+	Currencies  []FiatRatesCurrencyCoverage `json:"currencies"`
+}
+
+// FiatRatesGetCoverage computes the coverage of the stored tickers, in total and per currency,
+// a day is covered if there is at least one ticker with the timestamp in the day (UTC)
+func (d *RocksDB) FiatRatesGetCoverage() (*FiatRatesCoverage, error) {
+	type currencyDays struct {
+		coverage *FiatRatesCurrencyCoverage
+		lastDay  time.Time
+	}
+	c := &FiatRatesCoverage{}
+	currencies := make(map[string]*currencyDays)
+	days := 0
+	var lastDay time.Time
+	err := d.FiatRatesIterate(nil, nil, func(ticker *CurrencyRatesTicker) error {
+		ts := *ticker.Timestamp
+		day := truncateToDay(ts)
+		c.Tickers++
+		if c.First == nil {
+			c.First = &ts
+		}
+		c.Last = &ts
+		if day != lastDay {
+			days++
+			lastDay = day
+		}
+		for currency := range ticker.Rates {
+			cd, found := currencies[currency]
+			if !found {
+				cd = &currencyDays{coverage: &FiatRatesCurrencyCoverage{Currency: currency, First: ts}}
+				currencies[currency] = cd
+			}
+			cd.coverage.Last = ts
+			if day != cd.lastDay {
+				cd.coverage.Days++
+				cd.lastDay = day
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.First != nil {
+		c.MissingDays = int(truncateToDay(*c.Last).Sub(truncateToDay(*c.First))/(24*time.Hour)) + 1 - days
+	}
+	c.Currencies = make([]FiatRatesCurrencyCoverage, 0, len(currencies))
+	for _, cd := range currencies {
+		cc := cd.coverage
+		cc.MissingDays = int(truncateToDay(cc.Last).Sub(truncateToDay(cc.First))/(24*time.Hour)) + 1 - cc.Days
+		c.Currencies = append(c.Currencies, *cc)
+	}
+	sort.Slice(c.Currencies, func(i, j int) bool { return c.Currencies[i].Currency < c.Currencies[j].Currency })
+	return c, nil
+}
+
 // Close releases the RocksDB environment opened in NewRocksDB.
 func (d *RocksDB) Close() error {
 	if d.db != nil {
@@ -327,6 +620,9 @@ func (d *RocksDB) GetMemoryStats() string {
 	cs := make([]columnStats, len(cfNames))
 	for i := 0; i < len(cfNames); i++ {
 		cs[i].name = cfNames[i]
+		if d.cfh[i] == nil {
+			continue
+		}
 		cs[i].indexAndFilter = d.db.GetPropertyCF("rocksdb.estimate-table-readers-mem", d.cfh[i])
 		cs[i].memtable = d.db.GetPropertyCF("rocksdb.cur-size-all-mem-tables", d.cfh[i])
 		indexAndFilter += atoUint64(cs[i].indexAndFilter)
@@ -372,12 +668,17 @@ func (d *RocksDB) GetTransactions(address string, lower uint32, higher uint32, f
 // GetAddrDescTransactions finds all input/output transactions for address descriptor
 // Transaction are passed to callback function in the order from newest block to the oldest
 func (d *RocksDB) GetAddrDescTransactions(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn GetTransactionsCallback) (err error) {
+	return d.getIndexedTransactions(cfAddresses, addrDesc, lower, higher, fn)
+}
+
+// getIndexedTransactions iterates over the column with keys in the format of the addresses column
+func (d *RocksDB) getIndexedTransactions(cf int, addrDesc []byte, lower uint32, higher uint32, fn GetTransactionsCallback) (err error) {
 	txidUnpackedLen := d.chainParser.PackedTxidLen()
 	addrDescLen := len(addrDesc)
 	startKey := packAddressKey(addrDesc, higher)
 	stopKey := packAddressKey(addrDesc, lower)
 	indexes := make([]int32, 0, 16)
-	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cf])
 	defer it.Close()
 	for it.Seek(startKey); it.Valid(); it.Next() {
 		key := it.Key().Data()
@@ -467,16 +768,32 @@ func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
 		}
 	} else if chainType == bchain.ChainEthereumType {
 		addressContracts := make(map[string]*AddrContracts)
-		blockTxs, err := d.processAddressesEthereumType(block, addresses, addressContracts)
+		newContracts := make(map[string]struct{})
+		contractHolders := make(map[string]int)
+		blockTxs, err := d.processAddressesEthereumType(block, addresses, addressContracts, newContracts, contractHolders)
 		if err != nil {
 			return err
 		}
 		if err := d.storeAddressContracts(wb, addressContracts); err != nil {
 			return err
 		}
+		if err := d.storeContractHolders(wb, contractHolders); err != nil {
+			return err
+		}
+		d.storeNewContracts(wb, newContracts)
+		creations, err := d.processContractCreationsEthereumType(block)
+		if err != nil {
+			return err
+		}
+		d.storeContractCreations(wb, creations)
 		if err := d.storeAndCleanupBlockTxsEthereumType(wb, block, blockTxs); err != nil {
 			return err
 		}
+		contractLogs := make(addressesMap)
+		if err := d.processEventLogsEthereumType(block, contractLogs); err != nil {
+			return err
+		}
+		d.storeContractLogs(wb, block.Height, contractLogs, true)
 	} else {
 		return errors.New("Unknown chain type")
 	}
@@ -969,6 +1286,41 @@ func (d *RocksDB) getBlockTxs(height uint32) ([]blockTxs, error) {
 	return bt, nil
 }
 
+// GetBlockTxids returns the txids of the block at the height from the block txs column
+// the column keeps only the last blocks needed for the disconnection, nil is returned for the older blocks
+func (d *RocksDB) GetBlockTxids(height uint32) ([]string, error) {
+	var btxIDs [][]byte
+	if d.chainParser.GetChainType() == bchain.ChainEthereumType {
+		bt, err := d.getBlockTxsEthereumType(height)
+		if err != nil || bt == nil {
+			return nil, err
+		}
+		btxIDs = make([][]byte, len(bt))
+		for i := range bt {
+			btxIDs[i] = bt[i].btxID
+		}
+	} else {
+		bt, err := d.getBlockTxs(height)
+		// bitcoin type block contains at least the coinbase transaction, no data means the block is not stored
+		if err != nil || len(bt) == 0 {
+			return nil, err
+		}
+		btxIDs = make([][]byte, len(bt))
+		for i := range bt {
+			btxIDs[i] = bt[i].btxID
+		}
+	}
+	txids := make([]string, len(btxIDs))
+	for i, btxID := range btxIDs {
+		txid, err := d.chainParser.UnpackTxid(btxID)
+		if err != nil {
+			return nil, err
+		}
+		txids[i] = txid
+	}
+	return txids, nil
+}
+
 // GetAddrDescBalance returns AddrBalance for given addrDesc
 func (d *RocksDB) GetAddrDescBalance(addrDesc bchain.AddressDescriptor, detail AddressBalanceDetail) (*AddrBalance, error) {
 	val, err := d.db.GetCF(d.ro, d.cfh[cfAddressBalance], addrDesc)
@@ -1560,6 +1912,52 @@ func (d *RocksDB) DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) e
 	return nil
 }
 
+// addReorgTxAddrDesc adds the address descriptor to the ReorgTx, skipping empty and duplicate descriptors
+func addReorgTxAddrDesc(rt *bchain.ReorgTx, addrDesc bchain.AddressDescriptor) {
+	if len(addrDesc) == 0 {
+		return
+	}
+	for _, ad := range rt.AddrDescs {
+		if bytes.Equal(ad, addrDesc) {
+			return
+		}
+	}
+	rt.AddrDescs = append(rt.AddrDescs, addrDesc)
+}
+
+// GetReorgTxsBitcoinType returns transactions of blocks in range lower-higher together with the addresses they affect
+// it must be called before the blocks are disconnected
+func (d *RocksDB) GetReorgTxsBitcoinType(lower uint32, higher uint32) ([]bchain.ReorgTx, error) {
+	var rts []bchain.ReorgTx
+	for height := lower; height <= higher; height++ {
+		blockTxs, err := d.getBlockTxs(height)
+		if err != nil {
+			return nil, err
+		}
+		for i := range blockTxs {
+			txid, err := d.chainParser.UnpackTxid(blockTxs[i].btxID)
+			if err != nil {
+				return nil, err
+			}
+			rt := bchain.ReorgTx{Txid: txid, Height: height}
+			txa, err := d.getTxAddresses(blockTxs[i].btxID)
+			if err != nil {
+				return nil, err
+			}
+			if txa != nil {
+				for j := range txa.Inputs {
+					addReorgTxAddrDesc(&rt, txa.Inputs[j].AddrDesc)
+				}
+				for j := range txa.Outputs {
+					addReorgTxAddrDesc(&rt, txa.Outputs[j].AddrDesc)
+				}
+			}
+			rts = append(rts, rt)
+		}
+	}
+	return rts, nil
+}
+
 func (d *RocksDB) storeBalancesDisconnect(wb *gorocksdb.WriteBatch, balances map[string]*AddrBalance) {
 	for _, b := range balances {
 		if b != nil {
@@ -1797,6 +2195,9 @@ func (d *RocksDB) storeState(is *common.InternalState) error {
 func (d *RocksDB) computeColumnSize(col int, stopCompute chan os.Signal) (int64, int64, int64, error) {
 	var rows, keysSum, valuesSum int64
 	var seekKey []byte
+	if d.cfh[col] == nil {
+		return 0, 0, 0, nil
+	}
 	// do not use cache
 	ro := gorocksdb.NewDefaultReadOptions()
 	ro.SetFillCache(false)
@@ -3,8 +3,11 @@ package db
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"time"
 
 	vlq "github.com/bsm/go-vlq"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/golang/glog"
 	"github.com/juju/errors"
 	"github.com/tecbot/gorocksdb"
@@ -102,7 +105,7 @@ func isZeroAddress(addrDesc bchain.AddressDescriptor) bool {
 	return true
 }
 
-func (d *RocksDB) addToAddressesAndContractsEthereumType(addrDesc bchain.AddressDescriptor, btxID []byte, index int32, contract bchain.AddressDescriptor, addresses addressesMap, addressContracts map[string]*AddrContracts, addTxCount bool) error {
+func (d *RocksDB) addToAddressesAndContractsEthereumType(addrDesc bchain.AddressDescriptor, btxID []byte, index int32, contract bchain.AddressDescriptor, addresses addressesMap, addressContracts map[string]*AddrContracts, contractHolders map[string]int, addTxCount bool) error {
 	var err error
 	strAddrDesc := string(addrDesc)
 	ac, e := addressContracts[strAddrDesc]
@@ -131,6 +134,7 @@ func (d *RocksDB) addToAddressesAndContractsEthereumType(addrDesc bchain.Address
 			if !found {
 				i = len(ac.Contracts)
 				ac.Contracts = append(ac.Contracts, AddrContract{Contract: contract})
+				contractHolders[string(contract)]++
 			}
 			// index 0 is for ETH transfers, contract indexes start with 1
 			if index < 0 {
@@ -160,8 +164,12 @@ type ethBlockTx struct {
 	contracts []ethBlockTxContract
 }
 
-func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses addressesMap, addressContracts map[string]*AddrContracts) ([]ethBlockTx, error) {
+// processAddressesEthereumType indexes the addresses of the transactions in the block
+// the contracts seen for the first time are added to newContracts to be stored in the contracts column,
+// the changes of the numbers of the holders of the contracts are added to contractHolders
+func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses addressesMap, addressContracts map[string]*AddrContracts, newContracts map[string]struct{}, contractHolders map[string]int) ([]ethBlockTx, error) {
 	blockTxs := make([]ethBlockTx, len(block.Txs))
+	checkedContracts := make(map[string]struct{})
 	for txi, tx := range block.Txs {
 		btxID, err := d.chainParser.PackTxid(tx.Txid)
 		if err != nil {
@@ -180,7 +188,7 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 				}
 				continue
 			}
-			if err = d.addToAddressesAndContractsEthereumType(to, btxID, 0, nil, addresses, addressContracts, true); err != nil {
+			if err = d.addToAddressesAndContractsEthereumType(to, btxID, 0, nil, addresses, addressContracts, contractHolders, true); err != nil {
 				return nil, err
 			}
 			blockTx.to = to
@@ -194,19 +202,19 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 				}
 				continue
 			}
-			if err = d.addToAddressesAndContractsEthereumType(from, btxID, ^int32(0), nil, addresses, addressContracts, !bytes.Equal(from, to)); err != nil {
+			if err = d.addToAddressesAndContractsEthereumType(from, btxID, ^int32(0), nil, addresses, addressContracts, contractHolders, !bytes.Equal(from, to)); err != nil {
 				return nil, err
 			}
 			blockTx.from = from
 		}
-		// store erc20 transfers
-		erc20, err := d.chainParser.EthereumTypeGetErc20FromTx(&tx)
+		// store token transfers
+		tokenTransfers, err := d.chainParser.EthereumTypeGetTokenTransfersFromTx(&tx)
 		if err != nil {
-			glog.Warningf("rocksdb: GetErc20FromTx %v - height %d, tx %v", err, block.Height, tx.Txid)
+			glog.Warningf("rocksdb: GetTokenTransfersFromTx %v - height %d, tx %v", err, block.Height, tx.Txid)
 		}
-		blockTx.contracts = make([]ethBlockTxContract, len(erc20)*2)
+		blockTx.contracts = make([]ethBlockTxContract, len(tokenTransfers)*2)
 		j := 0
-		for i, t := range erc20 {
+		for i, t := range tokenTransfers {
 			var contract, from, to bchain.AddressDescriptor
 			contract, err = d.chainParser.GetAddrDescFromAddress(t.Contract)
 			if err == nil {
@@ -216,10 +224,20 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 				}
 			}
 			if err != nil {
-				glog.Warningf("rocksdb: GetErc20FromTx %v - height %d, tx %v, transfer %v", err, block.Height, tx.Txid, t)
+				glog.Warningf("rocksdb: GetTokenTransfersFromTx %v - height %d, tx %v, transfer %v", err, block.Height, tx.Txid, t)
 				continue
 			}
-			if err = d.addToAddressesAndContractsEthereumType(to, btxID, int32(i), contract, addresses, addressContracts, true); err != nil {
+			if _, found := checkedContracts[string(contract)]; !found {
+				checkedContracts[string(contract)] = struct{}{}
+				stored, err := d.isContractStored(contract)
+				if err != nil {
+					return nil, err
+				}
+				if !stored {
+					newContracts[string(contract)] = struct{}{}
+				}
+			}
+			if err = d.addToAddressesAndContractsEthereumType(to, btxID, int32(i), contract, addresses, addressContracts, contractHolders, true); err != nil {
 				return nil, err
 			}
 			eq := bytes.Equal(from, to)
@@ -227,7 +245,7 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 			j++
 			bc.addr = from
 			bc.contract = contract
-			if err = d.addToAddressesAndContractsEthereumType(from, btxID, ^int32(i), contract, addresses, addressContracts, !eq); err != nil {
+			if err = d.addToAddressesAndContractsEthereumType(from, btxID, ^int32(i), contract, addresses, addressContracts, contractHolders, !eq); err != nil {
 				return nil, err
 			}
 			// add to address to blockTx.contracts only if it is different from from address
@@ -239,10 +257,138 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 			}
 		}
 		blockTx.contracts = blockTx.contracts[:j]
+		// store internal transfers as ETH transfers of the addresses
+		internal, err := d.chainParser.EthereumTypeGetInternalTransfersFromTx(&tx)
+		if err != nil {
+			glog.Warningf("rocksdb: GetInternalTransfersFromTx %v - height %d, tx %v", err, block.Height, tx.Txid)
+		}
+		if len(internal) > 0 {
+			// the addresses already counted as a non contract transaction
+			counted := map[string]struct{}{string(blockTx.from): {}, string(blockTx.to): {}}
+			addInternal := func(addrDesc bchain.AddressDescriptor, index int32) error {
+				_, found := counted[string(addrDesc)]
+				if err := d.addToAddressesAndContractsEthereumType(addrDesc, btxID, index, nil, addresses, addressContracts, contractHolders, !found); err != nil {
+					return err
+				}
+				if !found {
+					counted[string(addrDesc)] = struct{}{}
+					// the address is stored with empty contract to blockTx.contracts to be disconnected as ETH transfer
+					blockTx.contracts = append(blockTx.contracts, ethBlockTxContract{addr: addrDesc})
+				}
+				return nil
+			}
+			for _, t := range internal {
+				var from, to bchain.AddressDescriptor
+				from, err = d.chainParser.GetAddrDescFromAddress(t.From)
+				if err == nil {
+					to, err = d.chainParser.GetAddrDescFromAddress(t.To)
+				}
+				if err != nil {
+					glog.Warningf("rocksdb: GetInternalTransfersFromTx %v - height %d, tx %v, transfer %v", err, block.Height, tx.Txid, t)
+					continue
+				}
+				if err = addInternal(to, 0); err != nil {
+					return nil, err
+				}
+				if err = addInternal(from, ^int32(0)); err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
 	return blockTxs, nil
 }
 
+// length of the topic in the key of the contractLogs column, logs without topics are indexed under zero topic
+const eventLogTopicLen = 32
+
+// packContractLogKey packs contract address descriptor and the first topic of the event log
+func packContractLogKey(contract bchain.AddressDescriptor, topic0 []byte) []byte {
+	key := make([]byte, eth.EthereumTypeAddressDescriptorLen+eventLogTopicLen)
+	copy(key, contract)
+	copy(key[eth.EthereumTypeAddressDescriptorLen:], topic0)
+	return key
+}
+
+func (d *RocksDB) processEventLogsEthereumType(block *bchain.Block, contractLogs addressesMap) error {
+	for txi := range block.Txs {
+		tx := &block.Txs[txi]
+		logs, err := d.chainParser.EthereumTypeGetEventLogsFromTx(tx)
+		if err != nil {
+			glog.Warningf("rocksdb: GetEventLogsFromTx %v - height %d, tx %v", err, block.Height, tx.Txid)
+			continue
+		}
+		if len(logs) == 0 {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			return err
+		}
+		for i := range logs {
+			l := &logs[i]
+			contract, err := d.chainParser.GetAddrDescFromAddress(l.Contract)
+			var topic0 []byte
+			if err == nil && len(l.Topics) > 0 {
+				topic0, err = eth.DecodeTopic(l.Topics[0])
+			}
+			if err != nil {
+				glog.Warningf("rocksdb: GetEventLogsFromTx %v - height %d, tx %v, log %v", err, block.Height, tx.Txid, i)
+				continue
+			}
+			addToAddressesMap(contractLogs, string(packContractLogKey(contract, topic0)), btxID, int32(i))
+		}
+	}
+	return nil
+}
+
+// storeContractLogs stores the index of the event logs of the block
+// if storeBlockKeys is set, the list of the stored keys is stored under the height of the block to be able to disconnect the block
+func (d *RocksDB) storeContractLogs(wb *gorocksdb.WriteBatch, height uint32, contractLogs addressesMap, storeBlockKeys bool) {
+	keys := make([]byte, 0, len(contractLogs)*(eth.EthereumTypeAddressDescriptorLen+eventLogTopicLen))
+	for k, txi := range contractLogs {
+		wb.PutCF(d.cfh[cfContractLogs], packAddressKey([]byte(k), height), d.packTxIndexes(txi))
+		keys = append(keys, k...)
+	}
+	if storeBlockKeys {
+		if len(keys) > 0 {
+			wb.PutCF(d.cfh[cfContractLogs], packUint(height), keys)
+		}
+		// the keys are kept for the same number of blocks as blockTxs
+		keep := uint32(d.chainParser.KeepBlockAddresses())
+		if height > keep {
+			wb.DeleteCF(d.cfh[cfContractLogs], packUint(height-keep))
+		}
+	}
+}
+
+func (d *RocksDB) disconnectContractLogs(wb *gorocksdb.WriteBatch, height uint32) error {
+	key := packUint(height)
+	val, err := d.db.GetCF(d.ro, d.cfh[cfContractLogs], key)
+	if err != nil {
+		return err
+	}
+	defer val.Free()
+	buf := val.Data()
+	kl := eth.EthereumTypeAddressDescriptorLen + eventLogTopicLen
+	if len(buf)%kl != 0 {
+		glog.Error("rocksdb: Inconsistent data in contractLogs ", hex.EncodeToString(buf))
+		return errors.New("Inconsistent data in contractLogs")
+	}
+	for i := 0; i < len(buf); i += kl {
+		wb.DeleteCF(d.cfh[cfContractLogs], packAddressKey(buf[i:i+kl], height))
+	}
+	wb.DeleteCF(d.cfh[cfContractLogs], key)
+	return nil
+}
+
+// GetContractLogs finds the transactions with event logs of the contract with the first topic
+// the indexes passed to the callback function are the indexes of the logs in the transaction
+// transactions are passed to callback function in the order from newest block to the oldest
+func (d *RocksDB) GetContractLogs(contract bchain.AddressDescriptor, topic0 []byte, lower uint32, higher uint32, fn GetTransactionsCallback) error {
+	return d.getIndexedTransactions(cfContractLogs, packContractLogKey(contract, topic0), lower, higher, fn)
+}
+
 func (d *RocksDB) storeAndCleanupBlockTxsEthereumType(wb *gorocksdb.WriteBatch, block *bchain.Block, blockTxs []ethBlockTx) error {
 	pl := d.chainParser.PackedTxidLen()
 	buf := make([]byte, 0, (pl+2*eth.EthereumTypeAddressDescriptorLen)*len(blockTxs))
@@ -340,7 +486,7 @@ func (d *RocksDB) getBlockTxsEthereumType(height uint32) ([]ethBlockTx, error) {
 	return bt, nil
 }
 
-func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, height uint32, blockTxs []ethBlockTx, contracts map[string]*AddrContracts) error {
+func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, height uint32, blockTxs []ethBlockTx, contracts map[string]*AddrContracts, contractHolders map[string]int) error {
 	glog.Info("Disconnecting block ", height, " containing ", len(blockTxs), " transactions")
 	addresses := make(map[string]map[string]struct{})
 	disconnectAddress := func(btxID []byte, addrDesc, contract bchain.AddressDescriptor) error {
@@ -388,6 +534,7 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, heigh
 						c.Contracts[i].Txs--
 						if c.Contracts[i].Txs == 0 {
 							c.Contracts = append(c.Contracts[:i], c.Contracts[i+1:]...)
+							contractHolders[string(contract)]--
 						}
 					} else {
 						glog.Warning("AddressContracts ", addrDesc, ", contract ", i, " Txs would be negative, tx ", hex.EncodeToString(btxID))
@@ -418,12 +565,42 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *gorocksdb.WriteBatch, heigh
 			}
 		}
 		wb.DeleteCF(d.cfh[cfTransactions], blockTx.btxID)
+		if err := d.disconnectContractCreation(wb, blockTx); err != nil {
+			return err
+		}
 	}
 	for a := range addresses {
 		key := packAddressKey([]byte(a), height)
 		wb.DeleteCF(d.cfh[cfAddresses], key)
 	}
-	return nil
+	return d.disconnectContractLogs(wb, height)
+}
+
+// GetReorgTxsEthereumType returns transactions of blocks in range lower-higher together with the addresses they affect
+// it must be called before the blocks are disconnected
+func (d *RocksDB) GetReorgTxsEthereumType(lower uint32, higher uint32) ([]bchain.ReorgTx, error) {
+	var rts []bchain.ReorgTx
+	for height := lower; height <= higher; height++ {
+		blockTxs, err := d.getBlockTxsEthereumType(height)
+		if err != nil {
+			return nil, err
+		}
+		for i := range blockTxs {
+			blockTx := &blockTxs[i]
+			txid, err := d.chainParser.UnpackTxid(blockTx.btxID)
+			if err != nil {
+				return nil, err
+			}
+			rt := bchain.ReorgTx{Txid: txid, Height: height}
+			addReorgTxAddrDesc(&rt, blockTx.from)
+			addReorgTxAddrDesc(&rt, blockTx.to)
+			for _, c := range blockTx.contracts {
+				addReorgTxAddrDesc(&rt, c.addr)
+			}
+			rts = append(rts, rt)
+		}
+	}
+	return rts, nil
 }
 
 // DisconnectBlockRangeEthereumType removes all data belonging to blocks in range lower-higher
@@ -444,8 +621,9 @@ func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32)
 	wb := gorocksdb.NewWriteBatch()
 	defer wb.Destroy()
 	contracts := make(map[string]*AddrContracts)
+	contractHolders := make(map[string]int)
 	for height := higher; height >= lower; height-- {
-		if err := d.disconnectBlockTxsEthereumType(wb, height, blocks[height-lower], contracts); err != nil {
+		if err := d.disconnectBlockTxsEthereumType(wb, height, blocks[height-lower], contracts, contractHolders); err != nil {
 			return err
 		}
 		key := packUint(height)
@@ -453,6 +631,9 @@ func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32)
 		wb.DeleteCF(d.cfh[cfHeight], key)
 	}
 	d.storeAddressContracts(wb, contracts)
+	if err := d.storeContractHolders(wb, contractHolders); err != nil {
+		return err
+	}
 	err := d.db.Write(d.wo, wb)
 	if err == nil {
 		d.is.RemoveLastBlockTimes(int(higher-lower) + 1)
@@ -460,3 +641,574 @@ func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32)
 	}
 	return err
 }
+
+// ContractOverride contains the metadata of a contract set by the administrator
+// the set values take precedence over the metadata fetched from the backend
+type ContractOverride struct {
+	Name     string `json:"name,omitempty"`
+	Symbol   string `json:"symbol,omitempty"`
+	Decimals *int   `json:"decimals,omitempty"`
+	Scam     bool   `json:"scam,omitempty"`
+}
+
+// ContractInfo contains the metadata of a contract stored in the contracts column
+type ContractInfo struct {
+	// Contract contains the metadata fetched from the backend, nil if the contract is not a token or the metadata were not fetched yet
+	Contract *bchain.Erc20Contract `json:"contract,omitempty"`
+	// LastUpdate is the unix time of the last fetch of the metadata from the backend, zero if the metadata were not fetched yet
+	LastUpdate int64             `json:"lastUpdate"`
+	Override   *ContractOverride `json:"override,omitempty"`
+}
+
+// Erc20Contract returns the metadata of the contract with applied override, nil if the contract is not a token
+func (ci *ContractInfo) Erc20Contract(contract bchain.AddressDescriptor) *bchain.Erc20Contract {
+	if ci.Contract == nil && ci.Override == nil {
+		return nil
+	}
+	c := bchain.Erc20Contract{Contract: eth.EIP55Address(contract)}
+	if ci.Contract != nil {
+		c = *ci.Contract
+	}
+	if o := ci.Override; o != nil {
+		if o.Name != "" {
+			c.Name = o.Name
+		}
+		if o.Symbol != "" {
+			c.Symbol = o.Symbol
+		}
+		if o.Decimals != nil {
+			c.Decimals = *o.Decimals
+		}
+		c.Scam = o.Scam
+	}
+	return &c
+}
+
+const (
+	contractInfoFetched = 1 << iota
+	contractInfoOverride
+	contractInfoOverrideDecimals
+	contractInfoScam
+)
+
+func packString(s string, buf []byte, varBuf []byte) []byte {
+	l := packVaruint(uint(len(s)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	return append(buf, s...)
+}
+
+func unpackString(buf []byte) (string, int) {
+	sl, l := unpackVaruint(buf)
+	if len(buf) < l+int(sl) {
+		return "", -1
+	}
+	return string(buf[l : l+int(sl)]), l + int(sl)
+}
+
+func packContractInfo(ci *ContractInfo) []byte {
+	buf := make([]byte, 1, 64)
+	varBuf := make([]byte, vlq.MaxLen64)
+	l := packVarint(int(ci.LastUpdate), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	if c := ci.Contract; c != nil {
+		buf[0] |= contractInfoFetched
+		buf = append(buf, byte(c.Standard))
+		l = packVaruint(uint(c.Decimals), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		buf = packString(c.Name, buf, varBuf)
+		buf = packString(c.Symbol, buf, varBuf)
+	}
+	if o := ci.Override; o != nil {
+		buf[0] |= contractInfoOverride
+		if o.Scam {
+			buf[0] |= contractInfoScam
+		}
+		buf = packString(o.Name, buf, varBuf)
+		buf = packString(o.Symbol, buf, varBuf)
+		if o.Decimals != nil {
+			buf[0] |= contractInfoOverrideDecimals
+			l = packVaruint(uint(*o.Decimals), varBuf)
+			buf = append(buf, varBuf[:l]...)
+		}
+	}
+	return buf
+}
+
+func unpackContractInfo(contract bchain.AddressDescriptor, buf []byte) (*ContractInfo, error) {
+	if len(buf) < 2 {
+		return nil, errors.New("Inconsistent data in contracts")
+	}
+	flags := buf[0]
+	lu, i := unpackVarint(buf[1:])
+	i++
+	ci := ContractInfo{LastUpdate: int64(lu)}
+	if flags&contractInfoFetched != 0 {
+		if len(buf) < i+2 {
+			return nil, errors.New("Inconsistent data in contracts")
+		}
+		c := bchain.Erc20Contract{
+			Contract: eth.EIP55Address(contract),
+			Standard: bchain.TokenStandard(buf[i]),
+		}
+		i++
+		dec, l := unpackVaruint(buf[i:])
+		c.Decimals = int(dec)
+		i += l
+		if c.Name, l = unpackString(buf[i:]); l < 0 {
+			return nil, errors.New("Inconsistent data in contracts")
+		}
+		i += l
+		if c.Symbol, l = unpackString(buf[i:]); l < 0 {
+			return nil, errors.New("Inconsistent data in contracts")
+		}
+		i += l
+		ci.Contract = &c
+	}
+	if flags&contractInfoOverride != 0 {
+		o := ContractOverride{Scam: flags&contractInfoScam != 0}
+		var l int
+		if o.Name, l = unpackString(buf[i:]); l < 0 {
+			return nil, errors.New("Inconsistent data in contracts")
+		}
+		i += l
+		if o.Symbol, l = unpackString(buf[i:]); l < 0 {
+			return nil, errors.New("Inconsistent data in contracts")
+		}
+		i += l
+		if flags&contractInfoOverrideDecimals != 0 {
+			if len(buf) <= i {
+				return nil, errors.New("Inconsistent data in contracts")
+			}
+			dec, _ := unpackVaruint(buf[i:])
+			decimals := int(dec)
+			o.Decimals = &decimals
+		}
+		ci.Override = &o
+	}
+	return &ci, nil
+}
+
+func (d *RocksDB) isContractStored(contract bchain.AddressDescriptor) (bool, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfContracts], contract)
+	if err != nil {
+		return false, err
+	}
+	defer val.Free()
+	return val.Size() > 0, nil
+}
+
+// storeNewContracts stores the contracts seen for the first time, their metadata are fetched later by RefreshContracts
+func (d *RocksDB) storeNewContracts(wb *gorocksdb.WriteBatch, newContracts map[string]struct{}) {
+	if len(newContracts) == 0 {
+		return
+	}
+	buf := packContractInfo(&ContractInfo{})
+	for contract := range newContracts {
+		wb.PutCF(d.cfh[cfContracts], bchain.AddressDescriptor(contract), buf)
+	}
+}
+
+// GetContractInfo returns the stored metadata of the contract, nil if the contract is not stored
+func (d *RocksDB) GetContractInfo(contract bchain.AddressDescriptor) (*ContractInfo, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfContracts], contract)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return unpackContractInfo(contract, buf)
+}
+
+// updateContractInfo updates the stored metadata of the contract using the function update
+func (d *RocksDB) updateContractInfo(contract bchain.AddressDescriptor, update func(ci *ContractInfo)) error {
+	d.contractsMux.Lock()
+	defer d.contractsMux.Unlock()
+	ci, err := d.GetContractInfo(contract)
+	if err != nil {
+		return err
+	}
+	if ci == nil {
+		ci = &ContractInfo{}
+	}
+	update(ci)
+	return d.db.PutCF(d.wo, d.cfh[cfContracts], contract, packContractInfo(ci))
+}
+
+// StoreContractMetadata stores the metadata of the contract fetched from the backend, keeping the override
+func (d *RocksDB) StoreContractMetadata(contract bchain.AddressDescriptor, c *bchain.Erc20Contract) error {
+	return d.updateContractInfo(contract, func(ci *ContractInfo) {
+		ci.Contract = c
+		ci.LastUpdate = time.Now().Unix()
+	})
+}
+
+// SetContractOverride sets the override of the metadata of the contract, nil override removes the existing override
+func (d *RocksDB) SetContractOverride(contract bchain.AddressDescriptor, o *ContractOverride) error {
+	return d.updateContractInfo(contract, func(ci *ContractInfo) {
+		ci.Override = o
+	})
+}
+
+// RefreshContracts fetches from the backend the metadata of the contracts, which were not fetched yet or are older than maxAge
+// at most maxCount contracts are refreshed in one call, the contracts without metadata take precedence
+// the number of the refreshed contracts is returned, the contracts which could not be fetched from the backend are skipped
+func (d *RocksDB) RefreshContracts(chain bchain.BlockChain, maxAge time.Duration, maxCount int) (int, error) {
+	var fresh, stale []bchain.AddressDescriptor
+	limit := time.Now().Add(-maxAge).Unix()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfContracts])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid() && len(fresh) < maxCount; it.Next() {
+		contract := append(bchain.AddressDescriptor(nil), it.Key().Data()...)
+		ci, err := unpackContractInfo(contract, it.Value().Data())
+		if err != nil {
+			return 0, err
+		}
+		if ci.LastUpdate == 0 {
+			fresh = append(fresh, contract)
+		} else if ci.LastUpdate < limit && len(stale) < maxCount {
+			stale = append(stale, contract)
+		}
+	}
+	contracts := append(fresh, stale...)
+	if len(contracts) > maxCount {
+		contracts = contracts[:maxCount]
+	}
+	count := 0
+	for _, contract := range contracts {
+		c, err := chain.EthereumTypeRefreshErc20ContractInfo(contract)
+		if err != nil {
+			// keep the stored metadata and the time of the last update, the contract is refreshed in the next round
+			glog.Warning("rocksdb: RefreshContracts ", err)
+			continue
+		}
+		if err = d.StoreContractMetadata(contract, c); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// ContractCreation contains the information about the creation of a contract
+type ContractCreation struct {
+	Creator  bchain.AddressDescriptor
+	Txid     string
+	Height   uint32
+	CodeHash []byte
+}
+
+func (d *RocksDB) packContractCreation(cc *ContractCreation) ([]byte, error) {
+	btxID, err := d.chainParser.PackTxid(cc.Txid)
+	if err != nil {
+		return nil, err
+	}
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := make([]byte, 0, len(cc.Creator)+len(btxID)+vlq.MaxLen32+len(cc.CodeHash))
+	buf = append(buf, cc.Creator...)
+	buf = append(buf, btxID...)
+	l := packVaruint(uint(cc.Height), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = append(buf, cc.CodeHash...)
+	return buf, nil
+}
+
+func (d *RocksDB) unpackContractCreation(buf []byte) (*ContractCreation, error) {
+	txidLen := d.chainParser.PackedTxidLen()
+	if len(buf) < eth.EthereumTypeAddressDescriptorLen+txidLen+1 {
+		return nil, errors.New("Inconsistent data in contractCreations")
+	}
+	txid, err := d.chainParser.UnpackTxid(buf[eth.EthereumTypeAddressDescriptorLen : eth.EthereumTypeAddressDescriptorLen+txidLen])
+	if err != nil {
+		return nil, err
+	}
+	i := eth.EthereumTypeAddressDescriptorLen + txidLen
+	height, l := unpackVaruint(buf[i:])
+	i += l
+	cc := ContractCreation{
+		Creator: append(bchain.AddressDescriptor(nil), buf[:eth.EthereumTypeAddressDescriptorLen]...),
+		Txid:    txid,
+		Height:  uint32(height),
+	}
+	if len(buf) > i {
+		cc.CodeHash = append([]byte(nil), buf[i:]...)
+	}
+	return &cc, nil
+}
+
+// processContractCreationsEthereumType returns the packed information about the contracts created in the block, mapped by the contract address descriptor
+func (d *RocksDB) processContractCreationsEthereumType(block *bchain.Block) (map[string][]byte, error) {
+	creations := make(map[string][]byte)
+	for txi := range block.Txs {
+		tx := &block.Txs[txi]
+		c, err := d.chainParser.EthereumTypeGetContractCreationFromTx(tx)
+		if err != nil {
+			glog.Warningf("rocksdb: GetContractCreationFromTx %v - height %d, tx %v", err, block.Height, tx.Txid)
+			continue
+		}
+		if c == nil {
+			continue
+		}
+		contract, err := d.chainParser.GetAddrDescFromAddress(c.Contract)
+		var creator bchain.AddressDescriptor
+		if err == nil {
+			creator, err = d.chainParser.GetAddrDescFromAddress(c.Creator)
+		}
+		cc := ContractCreation{Creator: creator, Txid: tx.Txid, Height: block.Height}
+		if err == nil && c.CodeHash != "" {
+			cc.CodeHash, err = hexutil.Decode(c.CodeHash)
+		}
+		if err != nil {
+			glog.Warningf("rocksdb: GetContractCreationFromTx %v - height %d, tx %v, contract %v", err, block.Height, tx.Txid, c.Contract)
+			continue
+		}
+		buf, err := d.packContractCreation(&cc)
+		if err != nil {
+			return nil, err
+		}
+		creations[string(contract)] = buf
+	}
+	return creations, nil
+}
+
+func (d *RocksDB) storeContractCreations(wb *gorocksdb.WriteBatch, creations map[string][]byte) {
+	for contract, buf := range creations {
+		wb.PutCF(d.cfh[cfContractCreations], bchain.AddressDescriptor(contract), buf)
+	}
+}
+
+// disconnectContractCreation removes the information about the contract created by the disconnected transaction
+func (d *RocksDB) disconnectContractCreation(wb *gorocksdb.WriteBatch, blockTx *ethBlockTx) error {
+	if len(blockTx.to) == 0 {
+		return nil
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfContractCreations], blockTx.to)
+	if err != nil {
+		return err
+	}
+	defer val.Free()
+	buf := val.Data()
+	l := eth.EthereumTypeAddressDescriptorLen + d.chainParser.PackedTxidLen()
+	if len(buf) >= l && bytes.Equal(buf[eth.EthereumTypeAddressDescriptorLen:l], blockTx.btxID) {
+		wb.DeleteCF(d.cfh[cfContractCreations], blockTx.to)
+	}
+	return nil
+}
+
+// GetContractCreation returns the information about the creation of the contract, nil if the creation is not known
+func (d *RocksDB) GetContractCreation(contract bchain.AddressDescriptor) (*ContractCreation, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfContractCreations], contract)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return d.unpackContractCreation(buf)
+}
+
+// AddressNameTTL is the time after which the cached name of an address is looked up again, older names are pruned
+const AddressNameTTL = 24 * time.Hour
+
+// AddressName is the name of an address obtained by the reverse resolution, empty if the address has no name
+type AddressName struct {
+	Name       string
+	LastUpdate int64
+}
+
+func packAddressName(an *AddressName) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	l := packVarint(int(an.LastUpdate), varBuf)
+	buf := append(make([]byte, 0, l+len(an.Name)+4), varBuf[:l]...)
+	return packString(an.Name, buf, varBuf)
+}
+
+func unpackAddressName(buf []byte) (*AddressName, error) {
+	lastUpdate, l := unpackVarint(buf)
+	name, ll := unpackString(buf[l:])
+	if ll < 0 {
+		return nil, errors.New("Invalid address name")
+	}
+	return &AddressName{Name: name, LastUpdate: int64(lastUpdate)}, nil
+}
+
+// GetAddressName returns the cached name of the address, nil if the name is not cached
+func (d *RocksDB) GetAddressName(addrDesc bchain.AddressDescriptor) (*AddressName, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfAddressNames], addrDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return unpackAddressName(buf)
+}
+
+// StoreAddressName caches the name of the address, empty name is stored for the addresses without a name
+func (d *RocksDB) StoreAddressName(addrDesc bchain.AddressDescriptor, an *AddressName) error {
+	return d.db.PutCF(d.wo, d.cfh[cfAddressNames], addrDesc, packAddressName(an))
+}
+
+// PruneAddressNames removes the cached names of the addresses last updated before the given unix time
+// the cache grows with each looked up address, the pruning keeps it limited to the recently looked up addresses
+func (d *RocksDB) PruneAddressNames(before int64) (int, error) {
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddressNames])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		an, err := unpackAddressName(it.Value().Data())
+		if err != nil || an.LastUpdate < before {
+			wb.DeleteCF(d.cfh[cfAddressNames], append([]byte(nil), it.Key().Data()...))
+		}
+	}
+	count := wb.Count()
+	if count == 0 {
+		return 0, nil
+	}
+	return count, d.db.Write(d.wo, wb)
+}
+
+// storeContractHolders applies the changes of the numbers of the holders of the contracts to the stored values
+func (d *RocksDB) storeContractHolders(wb *gorocksdb.WriteBatch, contractHolders map[string]int) error {
+	varBuf := make([]byte, vlq.MaxLen64)
+	for contract, delta := range contractHolders {
+		if delta == 0 {
+			continue
+		}
+		holders, err := d.GetContractHolders(bchain.AddressDescriptor(contract))
+		if err != nil {
+			return err
+		}
+		holders += delta
+		if holders <= 0 {
+			wb.DeleteCF(d.cfh[cfContractHolders], bchain.AddressDescriptor(contract))
+		} else {
+			l := packVaruint(uint(holders), varBuf)
+			wb.PutCF(d.cfh[cfContractHolders], bchain.AddressDescriptor(contract), varBuf[:l])
+		}
+	}
+	return nil
+}
+
+// GetContractHolders returns the number of the addresses holding the contract in their list of contracts,
+// i.e. the addresses which transferred the token, the balances of the tokens are not indexed
+func (d *RocksDB) GetContractHolders(contract bchain.AddressDescriptor) (int, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfContractHolders], contract)
+	if err != nil {
+		return 0, err
+	}
+	defer val.Free()
+	if val.Size() == 0 {
+		return 0, nil
+	}
+	holders, _ := unpackVaruint(val.Data())
+	return int(holders), nil
+}
+
+// GetContractsByHolders returns the contracts with at least minHolders holders, see GetContractHolders
+func (d *RocksDB) GetContractsByHolders(minHolders int) ([]bchain.AddressDescriptor, error) {
+	if err := d.fiatTokenRatesSupported(); err != nil {
+		return nil, err
+	}
+	var contracts []bchain.AddressDescriptor
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfContractHolders])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if holders, _ := unpackVaruint(it.Value().Data()); int(holders) >= minHolders {
+			contracts = append(contracts, append(bchain.AddressDescriptor(nil), it.Key().Data()...))
+		}
+	}
+	return contracts, it.Err()
+}
+
+var errFiatTokenRatesNotSupported = errors.New("Token fiat rates are supported only for Ethereum type coins")
+
+func (d *RocksDB) fiatTokenRatesSupported() error {
+	if d.chainParser.GetChainType() != bchain.ChainEthereumType {
+		return errFiatTokenRatesNotSupported
+	}
+	return nil
+}
+
+func packFiatTokenRatesKey(contract bchain.AddressDescriptor, t *time.Time) []byte {
+	key := make([]byte, 0, len(contract)+len(FiatRatesTimeFormat))
+	key = append(key, contract...)
+	return append(key, []byte(t.UTC().Format(FiatRatesTimeFormat))...)
+}
+
+func unpackFiatTokenRatesTicker(contract bchain.AddressDescriptor, key, val []byte) (*CurrencyRatesTicker, error) {
+	if len(key) != len(contract)+len(FiatRatesTimeFormat) || !bytes.HasPrefix(key, contract) {
+		return nil, nil
+	}
+	t, err := time.Parse(FiatRatesTimeFormat, string(key[len(contract):]))
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	ticker := &CurrencyRatesTicker{Timestamp: &t}
+	if err = json.Unmarshal(val, &ticker.Rates); err != nil {
+		return nil, err
+	}
+	return ticker, nil
+}
+
+// FiatRatesStoreTokenTicker stores the fiat rates of the token at the time of the ticker
+func (d *RocksDB) FiatRatesStoreTokenTicker(contract bchain.AddressDescriptor, ticker *CurrencyRatesTicker) error {
+	if err := d.fiatTokenRatesSupported(); err != nil {
+		return err
+	}
+	if len(ticker.Rates) == 0 {
+		return errors.New("Error storing token ticker: empty rates")
+	} else if ticker.Timestamp == nil {
+		return errors.New("Error storing token ticker: empty timestamp")
+	}
+	rates, err := json.Marshal(ticker.Rates)
+	if err != nil {
+		return err
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfFiatTokenRates], packFiatTokenRatesKey(contract, ticker.Timestamp), rates)
+}
+
+// FiatRatesFindTokenTicker returns the first ticker of the token at or after the specified time, nil if there is none
+func (d *RocksDB) FiatRatesFindTokenTicker(contract bchain.AddressDescriptor, tickerTime *time.Time) (*CurrencyRatesTicker, error) {
+	if err := d.fiatTokenRatesSupported(); err != nil {
+		return nil, err
+	}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatTokenRates])
+	defer it.Close()
+	it.Seek(packFiatTokenRatesKey(contract, tickerTime))
+	if err := it.Err(); err != nil {
+		glog.Error("FiatRatesFindTokenTicker Iterator error: ", err)
+		return nil, err
+	}
+	if !it.Valid() {
+		return nil, nil
+	}
+	return unpackFiatTokenRatesTicker(contract, it.Key().Data(), it.Value().Data())
+}
+
+// FiatRatesFindLastTokenTicker returns the last stored ticker of the token, nil if there is none
+func (d *RocksDB) FiatRatesFindLastTokenTicker(contract bchain.AddressDescriptor) (*CurrencyRatesTicker, error) {
+	if err := d.fiatTokenRatesSupported(); err != nil {
+		return nil, err
+	}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFiatTokenRates])
+	defer it.Close()
+	// the time formatted to digits sorts before the 0xff byte
+	it.SeekForPrev(append(append([]byte{}, contract...), 0xff))
+	if err := it.Err(); err != nil {
+		glog.Error("FiatRatesFindLastTokenTicker Iterator error: ", err)
+		return nil, err
+	}
+	if !it.Valid() {
+		return nil, nil
+	}
+	return unpackFiatTokenRatesTicker(contract, it.Key().Data(), it.Value().Data())
+}
@@ -3,11 +3,14 @@
 package db
 
 import (
+	"bytes"
 	"encoding/hex"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
 	"github.com/trezor/blockbook/bchain/coins/eth"
 	"github.com/trezor/blockbook/tests/dbtestdata"
 )
@@ -302,3 +305,633 @@ func TestRocksDB_Index_EthereumType(t *testing.T) {
 	}
 
 }
+
+func TestRocksDB_Index_EthereumType_InternalTransfers(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	block1 := dbtestdata.GetTestEthereumTypeBlock1InternalTransfers(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkColumn(d, cfAddresses, []keyPair{
+		{addressKeyHex(dbtestdata.EthAddr3e, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T1, []int32{^0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr55, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T2, []int32{1}) + txIndexesHex(dbtestdata.EthTxidB1T1, []int32{0, ^0, ^0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr20, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T2, []int32{^0, ^1}) + txIndexesHex(dbtestdata.EthTxidB1T1, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddr9f, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T1, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddrContract4a, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T2, []int32{0}), nil},
+		{addressKeyHex(dbtestdata.EthAddrContract47, 4321000, d), txIndexesHex(dbtestdata.EthTxidB1T1, []int32{0, ^0}), nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+	if err := checkColumn(d, cfAddressContracts, []keyPair{
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser), "0201" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser), "0202" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + "01", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "0101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser), "0101", nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+	zeroAddress := "0000000000000000000000000000000000000000"
+	if err := checkColumn(d, cfBlockTxs, []keyPair{
+		{
+			"0041eee8",
+			dbtestdata.EthTxidB1T1 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) +
+				"03" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser) + zeroAddress +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser) + zeroAddress +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser) + zeroAddress +
+				dbtestdata.EthTxidB1T2 +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
+				"02" +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) +
+				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser),
+			nil,
+		},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+	verifyGetTransactions(t, d, "0x"+dbtestdata.EthAddr20, 0, 10000000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB1T2, ^0},
+		{"0x" + dbtestdata.EthTxidB1T2, ^1},
+		{"0x" + dbtestdata.EthTxidB1T1, 0},
+	}, nil)
+
+	// the disconnected block must remove also the addresses of the internal transfers
+	if err := d.DisconnectBlockRangeEthereumType(4321000, 4321000); err != nil {
+		t.Fatal(err)
+	}
+	for _, cf := range []int{cfAddresses, cfAddressContracts, cfBlockTxs} {
+		if err := checkColumn(d, cf, []keyPair{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func verifyGetContractLogs(t *testing.T, d *RocksDB, contract, topic0 string, low, high uint32, want []txidIndex) {
+	contractDesc, err := d.chainParser.GetAddrDescFromAddress(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := eth.DecodeTopic(topic0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]txidIndex, 0)
+	if err := d.GetContractLogs(contractDesc, topic, low, high, func(txid string, height uint32, indexes []int32) error {
+		for _, index := range indexes {
+			got = append(got, txidIndex{txid, index})
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetContractLogs() = %v, want %v", got, want)
+	}
+}
+
+func TestRocksDB_Index_EthereumType_EventLogs(t *testing.T) {
+	parser := ethereumTestnetParser()
+	parser.ProcessEventLogs = true
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: parser,
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	transferTopic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	contract47Topic := "0x0d0b9391970d9a25552f37d436d2aae2925e2bfe1b2a923754bada030c498cb3"
+
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract4a, transferTopic, 0, 10000000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB2T2, 1},
+		{"0x" + dbtestdata.EthTxidB2T2, 3},
+		{"0x" + dbtestdata.EthTxidB1T2, 0},
+	})
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract4a, transferTopic, 4321000, 4321000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB1T2, 0},
+	})
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract47, contract47Topic, 0, 10000000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB2T2, 2},
+		{"0x" + dbtestdata.EthTxidB2T2, 5},
+	})
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract47, transferTopic, 0, 10000000, []txidIndex{})
+
+	// the disconnected block must remove also the indexed event logs
+	if err := d.DisconnectBlockRangeEthereumType(4321001, 4321001); err != nil {
+		t.Fatal(err)
+	}
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract4a, transferTopic, 0, 10000000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB1T2, 0},
+	})
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract0d, transferTopic, 0, 10000000, []txidIndex{})
+	// only the logs of the 1st block remain, the keys of the 1st block were removed as only one block is kept for rollback
+	if err := checkColumn(d, cfContractLogs, []keyPair{
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + transferTopic[2:] + "ffbe1117", txIndexesHex(dbtestdata.EthTxidB1T2, []int32{0}), nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testContractsChain implements only the methods of bchain.BlockChain used by RefreshContracts
+type testContractsChain struct {
+	bchain.BlockChain
+	refreshed []string
+	failing   string
+}
+
+func (c *testContractsChain) EthereumTypeRefreshErc20ContractInfo(contractDesc bchain.AddressDescriptor) (*bchain.Erc20Contract, error) {
+	address := eth.EIP55Address(contractDesc)
+	c.refreshed = append(c.refreshed, address)
+	if address == c.failing {
+		return nil, errors.New("backend not available")
+	}
+	if address == eth.EIP55AddressFromAddress(dbtestdata.EthAddrContract0d) {
+		return nil, nil
+	}
+	return &bchain.Erc20Contract{Contract: address, Name: "Contract " + address[:6], Symbol: "C" + address[2:4], Decimals: 18}, nil
+}
+
+func TestRocksDB_BulkConnect_EthereumType_EventLogs(t *testing.T) {
+	parser := ethereumTestnetParser()
+	parser.ProcessEventLogs = true
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: parser,
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	transferTopic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d.chainParser), false); err != nil {
+		t.Fatal(err)
+	}
+	// the event logs are cached until the bulk addresses are stored
+	if err := checkColumn(d, cfContractLogs, []keyPair{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock2(d.chainParser), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract4a, transferTopic, 0, 10000000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB2T2, 1},
+		{"0x" + dbtestdata.EthTxidB2T2, 3},
+		{"0x" + dbtestdata.EthTxidB1T2, 0},
+	})
+	// the block stored with the block txs can be disconnected including its event logs
+	if err := d.DisconnectBlockRangeEthereumType(4321001, 4321001); err != nil {
+		t.Fatal(err)
+	}
+	verifyGetContractLogs(t, d, "0x"+dbtestdata.EthAddrContract4a, transferTopic, 0, 10000000, []txidIndex{
+		{"0x" + dbtestdata.EthTxidB1T2, 0},
+	})
+}
+
+func TestRocksDB_Index_EthereumType_Contracts(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	placeholder := hex.EncodeToString(packContractInfo(&ContractInfo{}))
+	if err := checkColumn(d, cfContracts, []keyPair{
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), placeholder, nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	contract4a := addressToAddrDesc("0x"+dbtestdata.EthAddrContract4a, d.chainParser)
+	contract0d := addressToAddrDesc("0x"+dbtestdata.EthAddrContract0d, d.chainParser)
+	chain := &testContractsChain{}
+	count, err := d.RefreshContracts(chain, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("RefreshContracts() = %v, want 1", count)
+	}
+	ci, err := d.GetContractInfo(contract4a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &bchain.Erc20Contract{Contract: "0x4af4114F73d1c1C903aC9E0361b379D1291808A2", Name: "Contract 0x4af4", Symbol: "C4a", Decimals: 18}
+	if ci == nil || ci.LastUpdate == 0 || !reflect.DeepEqual(ci.Erc20Contract(contract4a), want) {
+		t.Errorf("GetContractInfo() = %+v, want %+v", ci, want)
+	}
+
+	// the already stored contract is not stored again, the new contract gets a placeholder
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	ci, err = d.GetContractInfo(contract4a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci == nil || ci.LastUpdate == 0 {
+		t.Errorf("GetContractInfo() = %+v, the metadata were lost", ci)
+	}
+	ci, err = d.GetContractInfo(contract0d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ci, &ContractInfo{}) {
+		t.Errorf("GetContractInfo() = %+v, want placeholder", ci)
+	}
+
+	// only the contract without metadata is refreshed, the backend does not know it
+	chain.refreshed = nil
+	if _, err = d.RefreshContracts(chain, time.Hour, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(chain.refreshed, []string{"0x0d0F936Ee4c93e25944694D6C121de94D9760F11"}) {
+		t.Errorf("RefreshContracts() refreshed %v", chain.refreshed)
+	}
+	ci, err = d.GetContractInfo(contract0d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci == nil || ci.LastUpdate == 0 || ci.Erc20Contract(contract0d) != nil {
+		t.Errorf("GetContractInfo() = %+v, want refreshed contract without metadata", ci)
+	}
+
+	// the contract which cannot be fetched keeps its metadata and the time of the last update
+	if err = d.updateContractInfo(contract4a, func(c *ContractInfo) { c.LastUpdate = 1 }); err != nil {
+		t.Fatal(err)
+	}
+	chain.failing = "0x4af4114F73d1c1C903aC9E0361b379D1291808A2"
+	count, err = d.RefreshContracts(chain, time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("RefreshContracts() = %v, want 0", count)
+	}
+	ci, err = d.GetContractInfo(contract4a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &bchain.Erc20Contract{Contract: "0x4af4114F73d1c1C903aC9E0361b379D1291808A2", Name: "Contract 0x4af4", Symbol: "C4a", Decimals: 18}
+	if ci == nil || ci.LastUpdate != 1 || !reflect.DeepEqual(ci.Erc20Contract(contract4a), want) {
+		t.Errorf("GetContractInfo() = %+v, want the kept metadata", ci)
+	}
+	chain.failing = ""
+
+	// override takes precedence and survives the refresh
+	decimals := 6
+	if err = d.SetContractOverride(contract4a, &ContractOverride{Symbol: "FAKE", Decimals: &decimals, Scam: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.RefreshContracts(chain, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	ci, err = d.GetContractInfo(contract4a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &bchain.Erc20Contract{Contract: "0x4af4114F73d1c1C903aC9E0361b379D1291808A2", Name: "Contract 0x4af4", Symbol: "FAKE", Decimals: 6, Scam: true}
+	if ci == nil || !reflect.DeepEqual(ci.Erc20Contract(contract4a), want) {
+		t.Errorf("GetContractInfo() = %+v, want %+v", ci.Erc20Contract(contract4a), want)
+	}
+	if err = d.SetContractOverride(contract4a, nil); err != nil {
+		t.Fatal(err)
+	}
+	ci, err = d.GetContractInfo(contract4a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci == nil || ci.Override != nil || ci.Erc20Contract(contract4a).Symbol != "C4a" {
+		t.Errorf("GetContractInfo() = %+v, want removed override", ci)
+	}
+}
+
+func Test_packUnpackContractInfo(t *testing.T) {
+	contract := addressToAddrDesc("0x"+dbtestdata.EthAddrContract4a, ethereumTestnetParser())
+	decimals := 0
+	tests := []struct {
+		name string
+		ci   ContractInfo
+	}{
+		{
+			name: "placeholder",
+			ci:   ContractInfo{},
+		},
+		{
+			name: "fetched",
+			ci: ContractInfo{
+				Contract: &bchain.Erc20Contract{
+					Contract: "0x4af4114F73d1c1C903aC9E0361b379D1291808A2",
+					Name:     "Contract name",
+					Symbol:   "SYM",
+					Decimals: 18,
+				},
+				LastUpdate: 1634558400,
+			},
+		},
+		{
+			name: "nft with override",
+			ci: ContractInfo{
+				Contract: &bchain.Erc20Contract{
+					Contract: "0x4af4114F73d1c1C903aC9E0361b379D1291808A2",
+					Standard: bchain.TokenStandardERC721,
+				},
+				LastUpdate: 1634558400,
+				Override:   &ContractOverride{Name: "Overridden", Decimals: &decimals, Scam: true},
+			},
+		},
+		{
+			name: "override only",
+			ci: ContractInfo{
+				Override: &ContractOverride{Symbol: "X"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := packContractInfo(&tt.ci)
+			got, err := unpackContractInfo(contract, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.ci) {
+				t.Errorf("unpackContractInfo() = %+v, want %+v", *got, tt.ci)
+			}
+		})
+	}
+	if _, err := unpackContractInfo(contract, []byte{contractInfoFetched, 0, 0, 0, 5, 'a'}); err == nil {
+		t.Error("unpackContractInfo() expected error for truncated data")
+	}
+}
+
+func Test_packUnpackAddressName(t *testing.T) {
+	for _, an := range []AddressName{
+		{Name: "", LastUpdate: 1634558400},
+		{Name: "vitalik.eth", LastUpdate: 1634558400},
+	} {
+		got, err := unpackAddressName(packAddressName(&an))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, an) {
+			t.Errorf("unpackAddressName() = %+v, want %+v", *got, an)
+		}
+	}
+	if _, err := unpackAddressName([]byte{0, 5, 'a'}); err == nil {
+		t.Error("unpackAddressName() expected error for truncated data")
+	}
+}
+
+func TestRocksDB_PruneAddressNames(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	addr3e := addressToAddrDesc("0x"+dbtestdata.EthAddr3e, d.chainParser)
+	addr55 := addressToAddrDesc("0x"+dbtestdata.EthAddr55, d.chainParser)
+	if err := d.StoreAddressName(addr3e, &AddressName{Name: "old.eth", LastUpdate: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StoreAddressName(addr55, &AddressName{Name: "", LastUpdate: 2000}); err != nil {
+		t.Fatal(err)
+	}
+	count, err := d.PruneAddressNames(1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("PruneAddressNames() = %v, want 1", count)
+	}
+	if an, err := d.GetAddressName(addr3e); err != nil || an != nil {
+		t.Errorf("GetAddressName() = %+v, %v, want pruned name", an, err)
+	}
+	if an, err := d.GetAddressName(addr55); err != nil || an == nil || an.LastUpdate != 2000 {
+		t.Errorf("GetAddressName() = %+v, %v, want kept name", an, err)
+	}
+}
+
+type testContractCreationParser struct {
+	*eth.EthereumParser
+	creations map[string]*bchain.EthereumContractCreation
+}
+
+func (p *testContractCreationParser) EthereumTypeGetContractCreationFromTx(tx *bchain.Tx) (*bchain.EthereumContractCreation, error) {
+	return p.creations[tx.Txid], nil
+}
+
+func TestRocksDB_Index_EthereumType_ContractCreations(t *testing.T) {
+	codeHash := "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"
+	d := setupRocksDB(t, &testContractCreationParser{
+		// keep both blocks to be able to disconnect them
+		EthereumParser: eth.NewEthereumParser(2),
+		creations: map[string]*bchain.EthereumContractCreation{
+			"0x" + dbtestdata.EthTxidB1T2: {
+				Contract: "0x" + dbtestdata.EthAddrContract4a,
+				Creator:  "0x" + dbtestdata.EthAddr20,
+				CodeHash: codeHash,
+			},
+		},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkColumn(d, cfContractCreations, []keyPair{
+		{
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser),
+			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser) + dbtestdata.EthTxidB1T2 + varuintToHex(4321000) + codeHash[2:],
+			nil,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	contract := addressToAddrDesc("0x"+dbtestdata.EthAddrContract4a, d.chainParser)
+	cc, err := d.GetContractCreation(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc == nil || cc.Txid != "0x"+dbtestdata.EthTxidB1T2 || cc.Height != 4321000 || hex.EncodeToString(cc.CodeHash) != codeHash[2:] ||
+		!bytes.Equal(cc.Creator, addressToAddrDesc("0x"+dbtestdata.EthAddr20, d.chainParser)) {
+		t.Errorf("GetContractCreation() = %+v", cc)
+	}
+
+	// the creation is removed only with the block containing the creation transaction
+	if err := d.DisconnectBlockRangeEthereumType(4321001, 4321001); err != nil {
+		t.Fatal(err)
+	}
+	if cc, err = d.GetContractCreation(contract); err != nil || cc == nil {
+		t.Errorf("GetContractCreation() = %+v, %v, want creation", cc, err)
+	}
+	if err := d.DisconnectBlockRangeEthereumType(4321000, 4321000); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkColumn(d, cfContractCreations, []keyPair{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyContractHolders compares the stored numbers of the holders with the holders counted from the addressContracts column
+func verifyContractHolders(t *testing.T, d *RocksDB) {
+	want := make(map[string]int)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddressContracts])
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		ac, err := d.GetAddrDescContracts(append(bchain.AddressDescriptor(nil), it.Key().Data()...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range ac.Contracts {
+			want[string(c.Contract)]++
+		}
+	}
+	it.Close()
+	got := make(map[string]int)
+	it = d.db.NewIteratorCF(d.ro, d.cfh[cfContractHolders])
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		holders, err := d.GetContractHolders(it.Key().Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[string(it.Key().Data())] = holders
+	}
+	it.Close()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("contract holders = %v, want %v", got, want)
+	}
+}
+
+func TestRocksDB_ContractHolders(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyContractHolders(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyContractHolders(t, d)
+	contract := addressToAddrDesc("0x"+dbtestdata.EthAddrContract0d, d.chainParser)
+	if holders, err := d.GetContractHolders(contract); err != nil || holders == 0 {
+		t.Errorf("GetContractHolders() = %v, %v, want holders", holders, err)
+	}
+	if err := d.DisconnectBlockRangeEthereumType(4321001, 4321001); err != nil {
+		t.Fatal(err)
+	}
+	verifyContractHolders(t, d)
+	if holders, err := d.GetContractHolders(contract); err != nil || holders != 0 {
+		t.Errorf("GetContractHolders() = %v, %v, want 0", holders, err)
+	}
+
+	// the holders are counted in the bulk connect, too
+	d2 := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d2)
+	bc, err := d2.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d2.chainParser), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock2(d2.chainParser), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	verifyContractHolders(t, d2)
+}
+
+func TestRocksDB_FiatTokenRates(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	contract := bchain.AddressDescriptor(addressToAddrDesc(dbtestdata.EthAddrContract4a, d.chainParser))
+	contracts, err := d.GetContractsByHolders(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(contracts, []bchain.AddressDescriptor{contract}) {
+		t.Errorf("GetContractsByHolders(2) = %v, want [%v]", contracts, contract)
+	}
+	if contracts, err = d.GetContractsByHolders(3); err != nil || len(contracts) != 0 {
+		t.Errorf("GetContractsByHolders(3) = %v, %v, want none", contracts, err)
+	}
+
+	other := addressToAddrDesc("0x"+dbtestdata.EthAddr55, d.chainParser)
+	ts1 := time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC)
+	ts2 := time.Date(2021, 10, 18, 13, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		contract bchain.AddressDescriptor
+		ticker   CurrencyRatesTicker
+	}{
+		{contract, CurrencyRatesTicker{Timestamp: &ts1, Rates: map[string]float64{"usd": 1.01, "eur": 0.87}}},
+		{contract, CurrencyRatesTicker{Timestamp: &ts2, Rates: map[string]float64{"usd": 1.02, "eur": 0.88}}},
+		{other, CurrencyRatesTicker{Timestamp: &ts1, Rates: map[string]float64{"usd": 3000}}},
+	} {
+		if err = d.FiatRatesStoreTokenTicker(tt.contract, &tt.ticker); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = d.FiatRatesStoreTokenTicker(contract, &CurrencyRatesTicker{Timestamp: &ts1}); err == nil {
+		t.Error("FiatRatesStoreTokenTicker() expected error for empty rates")
+	}
+
+	between := ts1.Add(30 * time.Minute)
+	ticker, err := d.FiatRatesFindTokenTicker(contract, &between)
+	if err != nil || ticker == nil || !ticker.Timestamp.Equal(ts2) || ticker.Rates["usd"] != 1.02 {
+		t.Errorf("FiatRatesFindTokenTicker() = %+v, %v, want ticker at %v", ticker, err, ts2)
+	}
+	// the tickers of a different contract must not be returned
+	after := ts2.Add(time.Minute)
+	if ticker, err = d.FiatRatesFindTokenTicker(contract, &after); err != nil || ticker != nil {
+		t.Errorf("FiatRatesFindTokenTicker() after the last ticker = %+v, %v, want nil", ticker, err)
+	}
+	if ticker, err = d.FiatRatesFindLastTokenTicker(contract); err != nil || ticker == nil || !ticker.Timestamp.Equal(ts2) {
+		t.Errorf("FiatRatesFindLastTokenTicker() = %+v, %v, want ticker at %v", ticker, err, ts2)
+	}
+	if ticker, err = d.FiatRatesFindLastTokenTicker(other); err != nil || ticker == nil || ticker.Rates["usd"] != 3000 {
+		t.Errorf("FiatRatesFindLastTokenTicker(other) = %+v, %v", ticker, err)
+	}
+	unknown := addressToAddrDesc("0x"+dbtestdata.EthAddr3e, d.chainParser)
+	if ticker, err = d.FiatRatesFindLastTokenTicker(unknown); err != nil || ticker != nil {
+		t.Errorf("FiatRatesFindLastTokenTicker(unknown) = %+v, %v, want nil", ticker, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"os"
 	"reflect"
@@ -616,6 +617,22 @@ func TestRocksDB_Index_BitcoinType(t *testing.T) {
 		t.Fatalf("GetBlockHash: got hash '%v', expected ''", hash)
 	}
 
+	// GetBlockTxids
+	txids, err := d.GetBlockTxids(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(txids, []string{dbtestdata.TxidB2T1, dbtestdata.TxidB2T2, dbtestdata.TxidB2T3, dbtestdata.TxidB2T4}) {
+		t.Fatalf("GetBlockTxids: got %v", txids)
+	}
+	txids, err = d.GetBlockTxids(225495)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txids != nil {
+		t.Fatalf("GetBlockTxids: got %v, expected nil", txids)
+	}
+
 	// GetBlockHash
 	info, err := d.GetBlockInfo(225494)
 	if err != nil {
@@ -655,6 +672,52 @@ func TestRocksDB_Index_BitcoinType(t *testing.T) {
 	}
 	verifyAfterBitcoinTypeBlock2(t, d)
 
+	// get the transactions of the 2nd block with the affected addresses before it is disconnected
+	reorgTxs, err := d.GetReorgTxsBitcoinType(225494, 225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReorgTxs := []struct {
+		txid      string
+		addrDescs []string
+	}{
+		{dbtestdata.TxidB2T1, []string{
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser),
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser),
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser),
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr7, d.chainParser),
+			dbtestdata.TxidB2T1Output3OpReturn,
+		}},
+		{dbtestdata.TxidB2T2, []string{
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser),
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser),
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr8, d.chainParser),
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr9, d.chainParser),
+		}},
+		{dbtestdata.TxidB2T3, []string{
+			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser),
+		}},
+		{dbtestdata.TxidB2T4, []string{
+			dbtestdata.AddressToPubKeyHex(dbtestdata.AddrA, d.chainParser),
+		}},
+	}
+	if len(reorgTxs) != len(wantReorgTxs) {
+		t.Fatalf("GetReorgTxsBitcoinType got %d txs, want %d", len(reorgTxs), len(wantReorgTxs))
+	}
+	for i, w := range wantReorgTxs {
+		rt := reorgTxs[i]
+		if rt.Txid != w.txid || rt.Height != 225494 {
+			t.Errorf("GetReorgTxsBitcoinType[%d] got %v/%v, want %v/%v", i, rt.Txid, rt.Height, w.txid, 225494)
+		}
+		got := make([]string, len(rt.AddrDescs))
+		for j, ad := range rt.AddrDescs {
+			got[j] = hex.EncodeToString(ad)
+		}
+		if !reflect.DeepEqual(got, w.addrDescs) {
+			t.Errorf("GetReorgTxsBitcoinType[%d] got %v, want %v", i, got, w.addrDescs)
+		}
+	}
+
 	// disconnect the 2nd block, verify that the db contains only data from the 1st block with restored unspentTxs
 	// and that the cached tx is removed
 	err = d.DisconnectBlockRangeBitcoinType(225494, 225494)
@@ -1558,3 +1621,170 @@ func TestRocksTickers(t *testing.T) {
 		t.Errorf("Ticker found, but the timestamp is older than the last ticker entry.")
 	}
 }
+
+func TestRocksDB_FiatRatesGapsAndCoverage(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	for _, tt := range []struct {
+		ts    string
+		rates map[string]float64
+	}{
+		{"20190627000000", map[string]float64{"usd": 1, "eur": 2}},
+		{"20190628000000", map[string]float64{"usd": 3}},
+		{"20190628120000", map[string]float64{"usd": 4, "eur": 5}},
+		{"20190701000000", map[string]float64{"usd": 6, "eur": 7}},
+	} {
+		ts, _ := time.Parse(FiatRatesTimeFormat, tt.ts)
+		if err := d.FiatRatesStoreTicker(&CurrencyRatesTicker{Timestamp: &ts, Rates: tt.rates}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	from := time.Date(2019, 6, 26, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 7, 2, 23, 0, 0, 0, time.UTC)
+	gaps, err := d.FiatRatesFindGaps(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range gaps {
+		got = append(got, g.Format("20060102"))
+	}
+	want := []string{"20190626", "20190629", "20190630", "20190702"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FiatRatesFindGaps() = %v, want %v", got, want)
+	}
+
+	var tickers []string
+	iterFrom := time.Date(2019, 6, 28, 0, 0, 0, 0, time.UTC)
+	iterTo := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	if err = d.FiatRatesIterate(&iterFrom, &iterTo, func(ticker *CurrencyRatesTicker) error {
+		tickers = append(tickers, ticker.Timestamp.Format(FiatRatesTimeFormat))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20190628000000", "20190628120000"}; !reflect.DeepEqual(tickers, want) {
+		t.Errorf("FiatRatesIterate() = %v, want %v", tickers, want)
+	}
+
+	c, err := d.FiatRatesGetCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2019, 6, 27, 0, 0, 0, 0, time.UTC)
+	last := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	wantCoverage := &FiatRatesCoverage{
+		Tickers:     4,
+		First:       &first,
+		Last:        &last,
+		MissingDays: 2,
+		Currencies: []FiatRatesCurrencyCoverage{
+			{Currency: "eur", First: first, Last: last, Days: 3, MissingDays: 2},
+			{Currency: "usd", First: first, Last: last, Days: 3, MissingDays: 2},
+		},
+	}
+	if !reflect.DeepEqual(c, wantCoverage) {
+		t.Errorf("FiatRatesGetCoverage() = %+v, want %+v", c, wantCoverage)
+	}
+}
+
+func TestRocksDB_FiatRatesInterpolationAndCompaction(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	for _, tt := range []struct {
+		ts    string
+		rates map[string]float64
+	}{
+		{"20190627000000", map[string]float64{"usd": 100, "eur": 90}},
+		{"20190628000000", map[string]float64{"usd": 200, "eur": 180, "czk": 4000}},
+		{"20190628060000", map[string]float64{"usd": 210}},
+		{"20190628120000", map[string]float64{"usd": 220}},
+		{"20190629000000", map[string]float64{"usd": 300}},
+		{"20190629010000", map[string]float64{"usd": 310}},
+	} {
+		ts, _ := time.Parse(FiatRatesTimeFormat, tt.ts)
+		if err := d.FiatRatesStoreTicker(&CurrencyRatesTicker{Timestamp: &ts, Rates: tt.rates}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		ts          string
+		interpolate bool
+		wantTs      string
+		want        map[string]float64
+	}{
+		{
+			name:   "next ticker",
+			ts:     "20190627180000",
+			wantTs: "20190628000000",
+			want:   map[string]float64{"usd": 200, "eur": 180, "czk": 4000},
+		},
+		{
+			name:        "interpolated",
+			ts:          "20190627180000",
+			interpolate: true,
+			wantTs:      "20190627180000",
+			want:        map[string]float64{"usd": 175, "eur": 157.5, "czk": 4000},
+		},
+		{
+			name:        "exact match",
+			ts:          "20190628060000",
+			interpolate: true,
+			wantTs:      "20190628060000",
+			want:        map[string]float64{"usd": 210},
+		},
+		{
+			name:        "before the first ticker",
+			ts:          "20190626000000",
+			interpolate: true,
+			wantTs:      "20190627000000",
+			want:        map[string]float64{"usd": 100, "eur": 90},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d.SetFiatRatesInterpolation(tt.interpolate)
+			ts, _ := time.Parse(FiatRatesTimeFormat, tt.ts)
+			ticker, err := d.FiatRatesGetTicker(&ts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ticker.Timestamp.Format(FiatRatesTimeFormat); got != tt.wantTs {
+				t.Errorf("FiatRatesGetTicker() timestamp = %v, want %v", got, tt.wantTs)
+			}
+			for currency, want := range tt.want {
+				if got := ticker.Rates[currency]; math.Abs(got-want) > 1e-9 {
+					t.Errorf("FiatRatesGetTicker() %v = %v, want %v", currency, got, want)
+				}
+			}
+			if len(ticker.Rates) != len(tt.want) {
+				t.Errorf("FiatRatesGetTicker() = %v, want %v", ticker.Rates, tt.want)
+			}
+		})
+	}
+	d.SetFiatRatesInterpolation(false)
+
+	removed, err := d.FiatRatesCompact(time.Date(2019, 6, 29, 0, 30, 0, 0, time.UTC))
+	if err != nil || removed != 2 {
+		t.Fatalf("FiatRatesCompact() = %v, %v, want 2", removed, err)
+	}
+	var tickers []string
+	if err = d.FiatRatesIterate(nil, nil, func(ticker *CurrencyRatesTicker) error {
+		tickers = append(tickers, ticker.Timestamp.Format(FiatRatesTimeFormat))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20190627000000", "20190628000000", "20190629000000", "20190629010000"}; !reflect.DeepEqual(tickers, want) {
+		t.Errorf("tickers after FiatRatesCompact() = %v, want %v", tickers, want)
+	}
+}
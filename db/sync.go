@@ -76,11 +76,12 @@ func (w *SyncWorker) updateBackendInfo() {
 
 // ResyncIndex synchronizes index to the top of the blockchain
 // onNewBlock is called when new block is connected, but not in initial parallel sync
-func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+// onReorg is called when blocks were disconnected because of a fork, after the new branch is connected
+func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
 	start := time.Now()
 	w.is.StartedSync()
 
-	err := w.resyncIndex(onNewBlock, initialSync)
+	err := w.resyncIndex(onNewBlock, onReorg, initialSync)
 
 	// update backend info after each resync
 	w.updateBackendInfo()
@@ -114,7 +115,7 @@ func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 	return err
 }
 
-func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
 	remoteBestHash, err := w.chain.GetBestBlockHash()
 	if err != nil {
 		return err
@@ -137,7 +138,7 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 		if remoteHash != localBestHash {
 			// forked - the remote hash differs from the local hash at the same height
 			glog.Info("resync: local is forked at height ", localBestHeight, ", local hash ", localBestHash, ", remote hash ", remoteHash)
-			return w.handleFork(localBestHeight, localBestHash, onNewBlock, initialSync)
+			return w.handleFork(localBestHeight, localBestHash, onNewBlock, onReorg, initialSync)
 		}
 		glog.Info("resync: local at ", localBestHeight, " is behind")
 		w.startHeight = localBestHeight + 1
@@ -169,17 +170,17 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 			}
 			// after parallel load finish the sync using standard way,
 			// new blocks may have been created in the meantime
-			return w.resyncIndex(onNewBlock, initialSync)
+			return w.resyncIndex(onNewBlock, onReorg, initialSync)
 		}
 	}
 	err = w.connectBlocks(onNewBlock, initialSync)
 	if err == errFork {
-		return w.resyncIndex(onNewBlock, initialSync)
+		return w.resyncIndex(onNewBlock, onReorg, initialSync)
 	}
 	return err
 }
 
-func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
 	// find forked blocks, disconnect them and then synchronize again
 	var height uint32
 	hashes := []string{localBestHash}
@@ -201,10 +202,48 @@ func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, on
 		}
 		hashes = append(hashes, local)
 	}
-	if err := w.DisconnectBlocks(height+1, localBestHeight, hashes); err != nil {
+	blocks, reorgTxs, err := w.disconnectReorgBlocks(height+1, localBestHeight, hashes, onReorg != nil)
+	if err != nil {
 		return err
 	}
-	return w.resyncIndex(onNewBlock, initialSync)
+	err = w.resyncIndex(onNewBlock, onReorg, initialSync)
+	if onReorg != nil {
+		onReorg(blocks, reorgTxs)
+	}
+	return err
+}
+
+// disconnectReorgBlocks disconnects the blocks and, if collect is set, returns the disconnected blocks and their transactions
+func (w *SyncWorker) disconnectReorgBlocks(lower uint32, higher uint32, hashes []string, collect bool) ([]bchain.ReorgBlock, []bchain.ReorgTx, error) {
+	// collect the disconnected transactions before their data are removed from the index
+	var reorgTxs []bchain.ReorgTx
+	if collect {
+		var err error
+		if reorgTxs, err = w.getReorgTxs(lower, higher); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := w.DisconnectBlocks(lower, higher, hashes); err != nil {
+		return nil, nil, err
+	}
+	var blocks []bchain.ReorgBlock
+	if collect {
+		blocks = make([]bchain.ReorgBlock, len(hashes))
+		for i, hash := range hashes {
+			blocks[i] = bchain.ReorgBlock{Hash: hash, Height: higher - uint32(i)}
+		}
+	}
+	return blocks, reorgTxs, nil
+}
+
+func (w *SyncWorker) getReorgTxs(lower uint32, higher uint32) ([]bchain.ReorgTx, error) {
+	ct := w.chain.GetChainParser().GetChainType()
+	if ct == bchain.ChainBitcoinType {
+		return w.db.GetReorgTxsBitcoinType(lower, higher)
+	} else if ct == bchain.ChainEthereumType {
+		return w.db.GetReorgTxsEthereumType(lower, higher)
+	}
+	return nil, errors.New("Unknown chain type")
 }
 
 func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
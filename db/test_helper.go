@@ -14,6 +14,6 @@ func ConnectBlocks(w *SyncWorker, onNewBlock bchain.OnNewBlockFunc, initialSync
 	return w.connectBlocks(onNewBlock, initialSync)
 }
 
-func HandleFork(w *SyncWorker, localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
-	return w.handleFork(localBestHeight, localBestHash, onNewBlock, initialSync)
+func HandleFork(w *SyncWorker, localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
+	return w.handleFork(localBestHeight, localBestHash, onNewBlock, onReorg, initialSync)
 }
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -16,15 +19,18 @@ import (
 type Coingecko struct {
 	url                string
 	coin               string
+	platform           string
 	httpTimeoutSeconds time.Duration
 	timeFormat         string
 }
 
 // NewCoinGeckoDownloader creates a coingecko structure that implements the RatesDownloaderInterface
-func NewCoinGeckoDownloader(url string, coin string, timeFormat string) RatesDownloaderInterface {
+// the platform is the Coingecko id of the blockchain of the tokens, it is required only for the token rates
+func NewCoinGeckoDownloader(url string, coin string, platform string, timeFormat string) RatesDownloaderInterface {
 	return &Coingecko{
 		url:                url,
 		coin:               coin,
+		platform:           platform,
 		httpTimeoutSeconds: 15 * time.Second,
 		timeFormat:         timeFormat,
 	}
@@ -83,6 +89,98 @@ func (cg *Coingecko) makeRequest(timestamp *time.Time) ([]byte, error) {
 	return bodyBytes, nil
 }
 
+// getIntradayTickers gets the rates in the range [from, to] in the granularity provided by Coingecko (hourly for the ranges up to 90 days)
+// the rates of each currency are downloaded by a separate request, the tickers contain only the requested currencies
+func (cg *Coingecko) getIntradayTickers(from, to time.Time, currencies []string) ([]*db.CurrencyRatesTicker, error) {
+	tickers := make(map[int64]*db.CurrencyRatesTicker)
+	for _, currency := range currencies {
+		requestURL := cg.url + "/coins/" + cg.coin + "/market_chart/range?vs_currency=" + url.QueryEscape(currency) +
+			"&from=" + strconv.FormatInt(from.Unix(), 10) + "&to=" + strconv.FormatInt(to.Unix(), 10)
+		client := &http.Client{
+			Timeout: cg.httpTimeoutSeconds,
+		}
+		resp, err := client.Get(requestURL)
+		if err != nil {
+			return nil, err
+		}
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New("Invalid response status: " + string(resp.Status))
+		}
+		var data struct {
+			Prices [][2]float64 `json:"prices"`
+		}
+		if err = json.Unmarshal(bodyBytes, &data); err != nil {
+			glog.Errorf("Error parsing Coingecko market chart response: %v", err)
+			return nil, err
+		}
+		for _, p := range data.Prices {
+			// the points of all currencies have the same timestamps, merge them on the minute
+			t := time.Unix(int64(p[0])/1000, 0).UTC().Truncate(time.Minute)
+			ticker, found := tickers[t.Unix()]
+			if !found {
+				ticker = &db.CurrencyRatesTicker{Timestamp: &t, Rates: make(map[string]float64)}
+				tickers[t.Unix()] = ticker
+			}
+			ticker.Rates[currency] = p[1]
+		}
+	}
+	r := make([]*db.CurrencyRatesTicker, 0, len(tickers))
+	for _, ticker := range tickers {
+		r = append(r, ticker)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Timestamp.Before(*r[j].Timestamp) })
+	return r, nil
+}
+
+// getTokenRates gets the current rates of the tokens in the currency, the contracts are queried in batches
+// it returns the rates by the lowercase contract addresses, the tokens unknown to Coingecko are omitted
+func (cg *Coingecko) getTokenRates(contracts []string, currency string) (map[string]float64, error) {
+	if cg.platform == "" {
+		return nil, errors.New("Missing platform")
+	}
+	const batchSize = 100
+	rates := make(map[string]float64, len(contracts))
+	client := &http.Client{
+		Timeout: cg.httpTimeoutSeconds,
+	}
+	for i := 0; i < len(contracts); i += batchSize {
+		j := i + batchSize
+		if j > len(contracts) {
+			j = len(contracts)
+		}
+		requestURL := cg.url + "/simple/token_price/" + cg.platform + "?contract_addresses=" + url.QueryEscape(strings.Join(contracts[i:j], ",")) +
+			"&vs_currencies=" + url.QueryEscape(currency)
+		resp, err := client.Get(requestURL)
+		if err != nil {
+			return nil, err
+		}
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New("Invalid response status: " + string(resp.Status))
+		}
+		var data map[string]map[string]float64
+		if err = json.Unmarshal(bodyBytes, &data); err != nil {
+			glog.Errorf("Error parsing Coingecko token price response: %v", err)
+			return nil, err
+		}
+		for contract, r := range data {
+			if rate, found := r[currency]; found {
+				rates[strings.ToLower(contract)] = rate
+			}
+		}
+	}
+	return rates, nil
+}
+
 // GetData gets fiat rates from API at the specified date and returns a CurrencyRatesTicker
 // If timestamp is nil, it will download the current fiat rates.
 func (cg *Coingecko) getTicker(timestamp *time.Time) (*db.CurrencyRatesTicker, error) {
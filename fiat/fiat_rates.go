@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/trezor/blockbook/common"
 	"github.com/trezor/blockbook/db"
 )
 
@@ -20,6 +22,11 @@ type RatesDownloaderInterface interface {
 	marketDataExists(timestamp *time.Time) (bool, error)
 }
 
+// intradayRatesDownloader is implemented by the downloaders providing historical rates in finer than daily granularity
+type intradayRatesDownloader interface {
+	getIntradayTickers(from, to time.Time, currencies []string) ([]*db.CurrencyRatesTicker, error)
+}
+
 // RatesDownloader stores FiatRates API parameters
 type RatesDownloader struct {
 	periodSeconds       time.Duration
@@ -28,29 +35,66 @@ type RatesDownloader struct {
 	timeFormat          string
 	callbackOnNewTicker OnNewFiatRatesTicker
 	downloader          RatesDownloaderInterface
+	intradayDays        int      // the number of the recent days with the intraday historical rates
+	intradayCurrencies  []string // the currencies downloaded intraday, the other currencies are derived using the cross rates
+	compactAfterDays    int      // the tickers older than the number of days are reduced to daily, 0 disables compaction
+	lastCompaction      time.Time
+	tokens              []string      // the configured contracts of the tokens with downloaded rates
+	tokenMinHolders     int           // the rates are downloaded also for the tokens with at least this number of holders, 0 disables it
+	tokenPeriod         time.Duration // the period of the download of the token rates
+	tokenContracts      []string      // the configured tokens together with the tokens above the holders threshold
+	lastTokenContracts  time.Time
+	lastTokenSync       time.Time
 }
 
 // NewFiatRatesDownloader initiallizes the downloader for FiatRates API.
 // If the startTime is nil, the downloader will start from the beginning.
-func NewFiatRatesDownloader(db *db.RocksDB, apiType string, params string, startTime *time.Time, callback OnNewFiatRatesTicker) (*RatesDownloader, error) {
+// The apiType "multi" aggregates the rates from several providers listed in the params.
+func NewFiatRatesDownloader(db *db.RocksDB, apiType string, params string, startTime *time.Time, callback OnNewFiatRatesTicker, metrics *common.Metrics) (*RatesDownloader, error) {
 	var rd = &RatesDownloader{}
 	type fiatRatesParams struct {
-		URL           string `json:"url"`
-		Coin          string `json:"coin"`
-		PeriodSeconds int    `json:"periodSeconds"`
+		URL                string   `json:"url"`
+		Coin               string   `json:"coin"`
+		PeriodSeconds      int      `json:"periodSeconds"`
+		IntradayDays       int      `json:"intradayDays"`
+		IntradayCurrencies []string `json:"intradayCurrencies"`
+		CompactAfterDays   int      `json:"compactAfterDays"`
+		Interpolate        bool     `json:"interpolate"`
+		Platform           string   `json:"platform"`
+		Tokens             []string `json:"tokens"`
+		TokenMinHolders    int      `json:"tokenMinHolders"`
+		TokenPeriodSeconds int      `json:"tokenPeriodSeconds"`
 	}
 	rdParams := &fiatRatesParams{}
 	err := json.Unmarshal([]byte(params), &rdParams)
 	if err != nil {
 		return nil, err
 	}
-	if rdParams.URL == "" || rdParams.PeriodSeconds == 0 {
+	if (rdParams.URL == "" && apiType != "multi") || rdParams.PeriodSeconds == 0 {
 		return nil, errors.New("Missing parameters")
 	}
 	rd.timeFormat = "02-01-2006"                                           // Layout string for FiatRates date formatting (DD-MM-YYYY)
 	rd.periodSeconds = time.Duration(rdParams.PeriodSeconds) * time.Second // Time period for syncing the latest market data
 	rd.db = db
 	rd.callbackOnNewTicker = callback
+	rd.intradayDays = rdParams.IntradayDays
+	rd.intradayCurrencies = rdParams.IntradayCurrencies
+	if len(rd.intradayCurrencies) == 0 {
+		rd.intradayCurrencies = []string{"usd"}
+	}
+	rd.compactAfterDays = rdParams.CompactAfterDays
+	if rd.compactAfterDays > 0 && rd.compactAfterDays < rd.intradayDays {
+		return nil, errors.New("compactAfterDays must not be smaller than intradayDays")
+	}
+	db.SetFiatRatesInterpolation(rdParams.Interpolate)
+	for _, token := range rdParams.Tokens {
+		rd.tokens = append(rd.tokens, strings.ToLower(token))
+	}
+	rd.tokenMinHolders = rdParams.TokenMinHolders
+	rd.tokenPeriod = rd.periodSeconds
+	if rdParams.TokenPeriodSeconds > 0 {
+		rd.tokenPeriod = time.Duration(rdParams.TokenPeriodSeconds) * time.Second
+	}
 	if startTime == nil {
 		timeNow := time.Now().UTC()
 		rd.startTime = &timeNow
@@ -58,7 +102,12 @@ func NewFiatRatesDownloader(db *db.RocksDB, apiType string, params string, start
 		rd.startTime = startTime // If startTime is nil, time.Now() will be used
 	}
 	if apiType == "coingecko" {
-		rd.downloader = NewCoinGeckoDownloader(rdParams.URL, rdParams.Coin, rd.timeFormat)
+		rd.downloader = NewCoinGeckoDownloader(rdParams.URL, rdParams.Coin, rdParams.Platform, rd.timeFormat)
+	} else if apiType == "multi" {
+		rd.downloader, err = newMultiProviderFromParams(params, rd.timeFormat, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("NewFiatRatesDownloader: %v", err)
+		}
 	} else {
 		return nil, fmt.Errorf("NewFiatRatesDownloader: incorrect API type %q", apiType)
 	}
@@ -97,6 +146,11 @@ func (rd *RatesDownloader) Run() error {
 		glog.Errorf("RatesDownloader syncHistorical error: %v", err)
 		return err
 	}
+	if err := rd.syncIntraday(); err != nil {
+		// the intraday rates are not essential, continue with the daily rates
+		glog.Errorf("RatesDownloader syncIntraday error: %v", err)
+	}
+	rd.compact()
 	if err := rd.syncLatest(); err != nil {
 		glog.Errorf("RatesDownloader syncLatest error: %v", err)
 		return err
@@ -165,6 +219,9 @@ func (rd *RatesDownloader) syncLatest() error {
 		}
 		lastTickerRates = ticker.Rates
 		sameTickerCounter = 0
+		if time.Since(rd.lastCompaction) > 24*time.Hour {
+			rd.compact()
+		}
 
 		glog.Infof("syncLatest: storing ticker for %v", ticker.Timestamp)
 		err = rd.db.FiatRatesStoreTicker(ticker)
@@ -174,6 +231,12 @@ func (rd *RatesDownloader) syncLatest() error {
 		} else if rd.callbackOnNewTicker != nil {
 			rd.callbackOnNewTicker(ticker)
 		}
+		if err == nil && time.Since(rd.lastTokenSync) >= rd.tokenPeriod {
+			rd.lastTokenSync = time.Now()
+			if _, err = rd.syncTokens(ticker); err != nil {
+				glog.Errorf("syncLatest syncTokens error: %v", err)
+			}
+		}
 		<-timer.C
 		timer.Reset(rd.periodSeconds)
 	}
@@ -212,3 +275,80 @@ func (rd *RatesDownloader) syncHistorical(timestamp *time.Time) error {
 	}
 	return nil
 }
+
+// syncIntraday downloads the intraday historical rates of the last rd.intradayDays days,
+// the hours which already have a stored ticker are skipped
+func (rd *RatesDownloader) syncIntraday() error {
+	if rd.intradayDays <= 0 {
+		return nil
+	}
+	d, ok := rd.downloader.(intradayRatesDownloader)
+	if !ok {
+		glog.Infof("syncIntraday: the downloader does not support intraday rates")
+		return nil
+	}
+	to := *rd.startTime
+	from := to.Add(-time.Duration(rd.intradayDays) * 24 * time.Hour)
+	tickers, err := d.getIntradayTickers(from, to, rd.intradayCurrencies)
+	if err != nil {
+		return err
+	}
+	stored := 0
+	for _, ticker := range tickers {
+		hour := ticker.Timestamp.Truncate(time.Hour)
+		existing, err := rd.db.FiatRatesFindTicker(&hour)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Timestamp.Before(hour.Add(time.Hour)) {
+			continue
+		}
+		rd.addCrossRates(ticker, existing)
+		if err = rd.db.FiatRatesStoreTicker(ticker); err != nil {
+			glog.Errorf("syncIntraday error storing ticker for %v: %v", ticker.Timestamp, err)
+			continue
+		}
+		stored++
+	}
+	glog.Infof("syncIntraday: stored %d tickers of %d downloaded since %v", stored, len(tickers), from)
+	return nil
+}
+
+// addCrossRates adds to the intraday ticker the currencies it does not contain, derived from the reference ticker
+// using the ratio of the rates of the first intraday currency in both tickers
+// the reference ticker is the next stored ticker or, if there is none, the last stored ticker
+func (rd *RatesDownloader) addCrossRates(ticker, reference *db.CurrencyRatesTicker) {
+	if reference == nil {
+		var err error
+		if reference, err = rd.db.FiatRatesFindLastTicker(); err != nil || reference == nil {
+			return
+		}
+	}
+	base := rd.intradayCurrencies[0]
+	br, found := ticker.Rates[base]
+	rr, rfound := reference.Rates[base]
+	if !found || !rfound || rr == 0 {
+		return
+	}
+	ratio := br / rr
+	for currency, r := range reference.Rates {
+		if _, found := ticker.Rates[currency]; !found {
+			ticker.Rates[currency] = r * ratio
+		}
+	}
+}
+
+// compact reduces the tickers older than rd.compactAfterDays days to daily granularity
+func (rd *RatesDownloader) compact() {
+	rd.lastCompaction = time.Now()
+	if rd.compactAfterDays <= 0 {
+		return
+	}
+	before := rd.lastCompaction.Add(-time.Duration(rd.compactAfterDays) * 24 * time.Hour)
+	removed, err := rd.db.FiatRatesCompact(before)
+	if err != nil {
+		glog.Errorf("RatesDownloader compact error: %v", err)
+		return
+	}
+	glog.Infof("RatesDownloader compact: removed %d tickers before %v", removed, before)
+}
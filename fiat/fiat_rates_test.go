@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -136,7 +137,7 @@ func TestFiatRates(t *testing.T) {
 		return
 	}
 	testStartTime := time.Date(2019, 11, 22, 16, 0, 0, 0, time.UTC)
-	fiatRates, err := NewFiatRatesDownloader(d, config.FiatRates, config.FiatRatesParams, &testStartTime, nil)
+	fiatRates, err := NewFiatRatesDownloader(d, config.FiatRates, config.FiatRatesParams, &testStartTime, nil, nil)
 	if err != nil {
 		t.Errorf("FiatRates init error: %v\n", err)
 	}
@@ -174,3 +175,61 @@ func TestFiatRates(t *testing.T) {
 		}
 	}
 }
+
+func TestFiatRates_Intraday(t *testing.T) {
+	d, _, tmp := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d, tmp)
+
+	coingecko := newCoinGeckoMockServer(t)
+	defer coingecko.Close()
+
+	daily := time.Date(2019, 11, 22, 0, 0, 0, 0, time.UTC)
+	existing := time.Date(2019, 11, 21, 18, 30, 0, 0, time.UTC)
+	for _, ticker := range []*db.CurrencyRatesTicker{
+		{Timestamp: &daily, Rates: map[string]float64{"usd": 200, "eur": 180, "czk": 4000}},
+		{Timestamp: &existing, Rates: map[string]float64{"usd": 111, "eur": 100, "czk": 2220}},
+	} {
+		if err := d.FiatRatesStoreTicker(ticker); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testStartTime := time.Date(2019, 11, 22, 16, 0, 0, 0, time.UTC)
+	params := `{"url": "` + coingecko.URL + `", "coin": "bitcoin", "periodSeconds": 60, "intradayDays": 1, "intradayCurrencies": ["usd", "eur"], "interpolate": true}`
+	fiatRates, err := NewFiatRatesDownloader(d, "coingecko", params, &testStartTime, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fiatRates.syncIntraday(); err != nil {
+		t.Fatal(err)
+	}
+	var got []db.ResultTickerAsString
+	if err = d.FiatRatesIterate(nil, nil, func(ticker *db.CurrencyRatesTicker) error {
+		got = append(got, db.ResultTickerAsString{Timestamp: ticker.Timestamp.Unix(), Rates: ticker.Rates})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the hour 18:00 is already covered, the czk rate is derived from the next daily ticker using the usd cross rate
+	want := []db.ResultTickerAsString{
+		{Timestamp: 1574355600, Rates: map[string]float64{"usd": 100, "eur": 90, "czk": 2000}},
+		{Timestamp: existing.Unix(), Rates: map[string]float64{"usd": 111, "eur": 100, "czk": 2220}},
+		{Timestamp: 1574362800, Rates: map[string]float64{"usd": 120, "eur": 108, "czk": 2400}},
+		{Timestamp: daily.Unix(), Rates: map[string]float64{"usd": 200, "eur": 180, "czk": 4000}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tickers after syncIntraday() = %+v, want %+v", got, want)
+	}
+
+	// a transaction at 23:50 is valued by the rates interpolated between 19:00 and the daily ticker at midnight
+	tm := time.Date(2019, 11, 21, 23, 50, 0, 0, time.UTC)
+	ticker, err := d.FiatRatesGetTicker(&tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := ticker.Rates["usd"]; r < 195 || r >= 200 {
+		t.Errorf("interpolated usd rate %v", r)
+	}
+	d.SetFiatRatesInterpolation(false)
+}
@@ -0,0 +1,186 @@
+package fiat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/trezor/blockbook/db"
+)
+
+// JSONProviderParams are the parameters of a generic JSON rates provider
+type JSONProviderParams struct {
+	// URL returns the current rates
+	URL string `json:"url"`
+	// HistoryURL returns the rates at a date, the placeholder {date} is replaced by the date formatted using DateFormat
+	// if empty, the provider supplies only the current rates
+	HistoryURL string `json:"historyUrl"`
+	// DateFormat is the Go time layout of the date in HistoryURL, default DD-MM-YYYY
+	DateFormat string `json:"dateFormat"`
+	// RatesPath is the dot separated path to the object with the rates by currency, e.g. "data.rates"
+	RatesPath string `json:"ratesPath"`
+	// Rates maps currencies to the dot separated paths to the rates, it can be used instead of or together with RatesPath
+	Rates map[string]string `json:"rates"`
+}
+
+// JSONProvider is a generic rates provider returning rates in JSON, with the location of the rates set in config
+type JSONProvider struct {
+	params             JSONProviderParams
+	httpTimeoutSeconds time.Duration
+}
+
+// NewJSONProvider creates a generic JSON provider that implements the RatesDownloaderInterface
+func NewJSONProvider(params *JSONProviderParams) (RatesDownloaderInterface, error) {
+	if params.URL == "" {
+		return nil, errors.New("Missing url")
+	}
+	if params.RatesPath == "" && len(params.Rates) == 0 {
+		return nil, errors.New("Missing ratesPath or rates")
+	}
+	p := &JSONProvider{
+		params:             *params,
+		httpTimeoutSeconds: 15 * time.Second,
+	}
+	if p.params.DateFormat == "" {
+		p.params.DateFormat = "02-01-2006"
+	}
+	return p, nil
+}
+
+func (p *JSONProvider) makeRequest(timestamp *time.Time) (interface{}, error) {
+	requestURL := p.params.URL
+	if timestamp != nil {
+		requestURL = strings.Replace(p.params.HistoryURL, "{date}", timestamp.Format(p.params.DateFormat), -1)
+	}
+	client := &http.Client{
+		Timeout: p.httpTimeoutSeconds,
+	}
+	resp, err := client.Get(requestURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Invalid response status: " + string(resp.Status))
+	}
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err = json.Unmarshal(bodyBytes, &data); err != nil {
+		glog.Errorf("Error parsing JSON provider response: %v", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// jsonPathValue returns the value at the dot separated path, the array elements are addressed by their index
+func jsonPathValue(data interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return data, nil
+	}
+	for _, p := range strings.Split(path, ".") {
+		switch d := data.(type) {
+		case map[string]interface{}:
+			v, found := d[p]
+			if !found {
+				return nil, fmt.Errorf("Path %v: field %v not found", path, p)
+			}
+			data = v
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(d) {
+				return nil, fmt.Errorf("Path %v: invalid index %v", path, p)
+			}
+			data = d[i]
+		default:
+			return nil, fmt.Errorf("Path %v: %v is not an object or array", path, p)
+		}
+	}
+	return data, nil
+}
+
+// jsonRate converts the rate to float64, the rates can be numbers or numeric strings
+func jsonRate(v interface{}) (float64, bool) {
+	switch r := v.(type) {
+	case float64:
+		return r, true
+	case string:
+		f, err := strconv.ParseFloat(r, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (p *JSONProvider) parseRates(data interface{}) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	if p.params.RatesPath != "" {
+		v, err := jsonPathValue(data, p.params.RatesPath)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Path %v is not an object", p.params.RatesPath)
+		}
+		for currency, r := range m {
+			if f, ok := jsonRate(r); ok {
+				rates[strings.ToLower(currency)] = f
+			}
+		}
+	}
+	for currency, path := range p.params.Rates {
+		v, err := jsonPathValue(data, path)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := jsonRate(v)
+		if !ok {
+			return nil, fmt.Errorf("Path %v is not a number", path)
+		}
+		rates[strings.ToLower(currency)] = f
+	}
+	return rates, nil
+}
+
+func (p *JSONProvider) getTicker(timestamp *time.Time) (*db.CurrencyRatesTicker, error) {
+	if timestamp != nil && p.params.HistoryURL == "" {
+		return nil, errors.New("Historical rates not supported")
+	}
+	dataTimestamp := time.Now().UTC()
+	if timestamp != nil {
+		dataTimestamp = timestamp.UTC()
+	}
+	data, err := p.makeRequest(timestamp)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := p.parseRates(data)
+	if err != nil {
+		return nil, err
+	}
+	return &db.CurrencyRatesTicker{Timestamp: &dataTimestamp, Rates: rates}, nil
+}
+
+func (p *JSONProvider) marketDataExists(timestamp *time.Time) (bool, error) {
+	if timestamp != nil && p.params.HistoryURL == "" {
+		return false, nil
+	}
+	data, err := p.makeRequest(timestamp)
+	if err != nil {
+		return false, err
+	}
+	rates, err := p.parseRates(data)
+	if err != nil {
+		// the response without the rates means that there are no data for the date
+		return false, nil
+	}
+	return len(rates) != 0, nil
+}
@@ -0,0 +1,213 @@
+package fiat
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/trezor/blockbook/db"
+)
+
+// ExportFormatCSV and ExportFormatJSON are the supported formats of the export of the tickers
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+)
+
+var csvHeader = []string{"timestamp", "currency", "rate"}
+
+// ExportTickers writes the stored tickers in the range [from, to) to w and returns the number of exported tickers.
+// The csv format has one row per ticker and currency with the columns timestamp (YYYYMMDDhhmmss in UTC), currency and rate,
+// the json format is an array of objects {"ts": <unix timestamp>, "rates": {<currency>: <rate>}}.
+func ExportTickers(d *db.RocksDB, w io.Writer, format string, from, to *time.Time) (int, error) {
+	count := 0
+	switch format {
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return 0, err
+		}
+		err := d.FiatRatesIterate(from, to, func(ticker *db.CurrencyRatesTicker) error {
+			ts := ticker.Timestamp.Format(db.FiatRatesTimeFormat)
+			currencies := make([]string, 0, len(ticker.Rates))
+			for currency := range ticker.Rates {
+				currencies = append(currencies, currency)
+			}
+			sort.Strings(currencies)
+			for _, currency := range currencies {
+				rate := strconv.FormatFloat(ticker.Rates[currency], 'g', -1, 64)
+				if err := cw.Write([]string{ts, currency, rate}); err != nil {
+					return err
+				}
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		cw.Flush()
+		return count, cw.Error()
+	case ExportFormatJSON:
+		bw := bufio.NewWriter(w)
+		bw.WriteString("[")
+		err := d.FiatRatesIterate(from, to, func(ticker *db.CurrencyRatesTicker) error {
+			b, err := json.Marshal(&db.ResultTickerAsString{Timestamp: ticker.Timestamp.Unix(), Rates: ticker.Rates})
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				bw.WriteString(",")
+			}
+			bw.WriteString("\n")
+			bw.Write(b)
+			count++
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		bw.WriteString("\n]\n")
+		return count, bw.Flush()
+	}
+	return 0, fmt.Errorf("Unsupported export format %q", format)
+}
+
+// parseImportTimestamp parses the timestamp as unix timestamp (10 digits), in one of the formats YYYYMMDDhhmmss,
+// YYYYMMDDhhmm, YYYYMMDD or in RFC3339
+func parseImportTimestamp(s string) (time.Time, error) {
+	if len(s) == 10 {
+		if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(unix, 0).UTC(), nil
+		}
+	} else if t, err := db.FiatRatesConvertDate(s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid timestamp %q", s)
+}
+
+// ImportTickers reads the tickers from csv in the format of ExportTickers and stores them,
+// the rates are merged into the already stored tickers with the same timestamp. It returns the number of stored tickers.
+func ImportTickers(d *db.RocksDB, r io.Reader) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+	tickers := make(map[time.Time]map[string]float64)
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if line == 1 && strings.EqualFold(record[0], csvHeader[0]) {
+			continue
+		}
+		ts, err := parseImportTimestamp(record[0])
+		if err != nil {
+			return 0, fmt.Errorf("Line %d: %v", line, err)
+		}
+		rate, err := strconv.ParseFloat(record[2], 64)
+		if err != nil || rate <= 0 {
+			return 0, fmt.Errorf("Line %d: invalid rate %q", line, record[2])
+		}
+		currency := strings.ToLower(strings.TrimSpace(record[1]))
+		if currency == "" {
+			return 0, fmt.Errorf("Line %d: missing currency", line)
+		}
+		rates, found := tickers[ts]
+		if !found {
+			rates = make(map[string]float64)
+			tickers[ts] = rates
+		}
+		rates[currency] = rate
+	}
+	timestamps := make([]time.Time, 0, len(tickers))
+	for ts := range tickers {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+	for i := range timestamps {
+		ts := timestamps[i]
+		rates := tickers[ts]
+		stored, err := d.FiatRatesFindTicker(&ts)
+		if err != nil {
+			return i, err
+		}
+		if stored != nil && stored.Timestamp.Equal(ts) {
+			for currency, rate := range stored.Rates {
+				if _, found := rates[currency]; !found {
+					rates[currency] = rate
+				}
+			}
+		}
+		if err = d.FiatRatesStoreTicker(&db.CurrencyRatesTicker{Timestamp: &ts, Rates: rates}); err != nil {
+			return i, err
+		}
+	}
+	return len(timestamps), nil
+}
+
+// BackfillGaps downloads the historical tickers of the days in the range [from, to] without any stored ticker.
+// If from is nil, the range starts at the first stored ticker, if to is nil, it ends yesterday.
+// It returns the number of stored tickers, the days for which the download fails are skipped.
+func (rd *RatesDownloader) BackfillGaps(from, to *time.Time) (int, error) {
+	if from == nil {
+		first, err := rd.firstTickerTime()
+		if err != nil || first == nil {
+			return 0, err
+		}
+		from = first
+	}
+	if to == nil {
+		yesterday := rd.startTime.Add(-24 * time.Hour)
+		to = &yesterday
+	}
+	gaps, err := rd.db.FiatRatesFindGaps(*from, *to)
+	if err != nil {
+		return 0, err
+	}
+	glog.Infof("BackfillGaps: %d days missing between %v and %v", len(gaps), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	period := time.Duration(1) * time.Second
+	stored := 0
+	for i := range gaps {
+		if i > 0 {
+			time.Sleep(period)
+		}
+		timestamp := gaps[i]
+		ticker, err := rd.downloader.getTicker(&timestamp)
+		if err != nil {
+			glog.Errorf("BackfillGaps error downloading ticker for %v: %v", gaps[i], err)
+			continue
+		}
+		if err = rd.db.FiatRatesStoreTicker(ticker); err != nil {
+			glog.Errorf("BackfillGaps error storing ticker for %v: %v", gaps[i], err)
+			continue
+		}
+		stored++
+	}
+	return stored, nil
+}
+
+func (rd *RatesDownloader) firstTickerTime() (*time.Time, error) {
+	var first *time.Time
+	err := rd.db.FiatRatesIterate(nil, nil, func(ticker *db.CurrencyRatesTicker) error {
+		first = ticker.Timestamp
+		return io.EOF
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return first, nil
+}
@@ -0,0 +1,130 @@
+// +build unittest
+
+package fiat
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/db"
+)
+
+func TestFiatRates_ExportImport(t *testing.T) {
+	d, _, tmp := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d, tmp)
+
+	ts1 := time.Date(2019, 11, 20, 0, 0, 0, 0, time.UTC)
+	ts2 := time.Date(2019, 11, 21, 12, 30, 0, 0, time.UTC)
+	for _, ticker := range []*db.CurrencyRatesTicker{
+		{Timestamp: &ts1, Rates: map[string]float64{"usd": 8138.831605359057, "eur": 7346.92}},
+		{Timestamp: &ts2, Rates: map[string]float64{"usd": 8000}},
+	} {
+		if err := d.FiatRatesStoreTicker(ticker); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var csv bytes.Buffer
+	n, err := ExportTickers(d, &csv, ExportFormatCSV, nil, nil)
+	if err != nil || n != 2 {
+		t.Fatalf("ExportTickers() = %v, %v", n, err)
+	}
+	wantCSV := "timestamp,currency,rate\n" +
+		"20191120000000,eur,7346.92\n" +
+		"20191120000000,usd,8138.831605359057\n" +
+		"20191121123000,usd,8000\n"
+	if csv.String() != wantCSV {
+		t.Errorf("ExportTickers(csv) = %q, want %q", csv.String(), wantCSV)
+	}
+
+	var json bytes.Buffer
+	from := time.Date(2019, 11, 21, 0, 0, 0, 0, time.UTC)
+	if n, err = ExportTickers(d, &json, ExportFormatJSON, &from, nil); err != nil || n != 1 {
+		t.Fatalf("ExportTickers() = %v, %v", n, err)
+	}
+	if want := "[\n{\"ts\":1574339400,\"rates\":{\"usd\":8000}}\n]\n"; json.String() != want {
+		t.Errorf("ExportTickers(json) = %q, want %q", json.String(), want)
+	}
+
+	// import of the exported data into an empty db
+	d2, _, tmp2 := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d2, tmp2)
+	if n, err = ImportTickers(d2, strings.NewReader(wantCSV)); err != nil || n != 2 {
+		t.Fatalf("ImportTickers() = %v, %v", n, err)
+	}
+	var exported bytes.Buffer
+	if _, err = ExportTickers(d2, &exported, ExportFormatCSV, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if exported.String() != wantCSV {
+		t.Errorf("ExportTickers() after import = %q, want %q", exported.String(), wantCSV)
+	}
+
+	// vendor data with unix and RFC3339 timestamps, merged into the stored ticker
+	vendor := "1574208000,CZK,190000\n2019-11-22T00:00:00Z,usd,7600\n"
+	if n, err = ImportTickers(d2, strings.NewReader(vendor)); err != nil || n != 2 {
+		t.Fatalf("ImportTickers() = %v, %v", n, err)
+	}
+	ticker, err := d2.FiatRatesFindTicker(&ts1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]float64{"usd": 8138.831605359057, "eur": 7346.92, "czk": 190000}; !reflect.DeepEqual(ticker.Rates, want) {
+		t.Errorf("merged ticker rates %v, want %v", ticker.Rates, want)
+	}
+
+	for _, invalid := range []string{"2019-11-22,usd,7600\n", "20191122,usd,-1\n", "20191122,,1\n", "20191122,usd\n"} {
+		if _, err = ImportTickers(d2, strings.NewReader(invalid)); err == nil {
+			t.Errorf("ImportTickers(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestFiatRates_BackfillGaps(t *testing.T) {
+	d, _, tmp := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d, tmp)
+
+	coingecko := newCoinGeckoMockServer(t)
+	defer coingecko.Close()
+
+	ts := time.Date(2019, 11, 19, 0, 0, 0, 0, time.UTC)
+	if err := d.FiatRatesStoreTicker(&db.CurrencyRatesTicker{Timestamp: &ts, Rates: map[string]float64{"usd": 8000}}); err != nil {
+		t.Fatal(err)
+	}
+	testStartTime := time.Date(2019, 11, 22, 16, 0, 0, 0, time.UTC)
+	fiatRates, err := NewFiatRatesDownloader(d, "coingecko", `{"url": "`+coingecko.URL+`", "coin": "bitcoin", "periodSeconds": 60}`, &testStartTime, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := fiatRates.BackfillGaps(nil, nil)
+	if err != nil || n != 2 {
+		t.Fatalf("BackfillGaps() = %v, %v, want 2", n, err)
+	}
+	gaps, err := d.FiatRatesFindGaps(ts, testStartTime.Add(-24*time.Hour))
+	if err != nil || len(gaps) != 0 {
+		t.Errorf("FiatRatesFindGaps() after backfill = %v, %v", gaps, err)
+	}
+	ticker, err := d.FiatRatesFindTicker(&ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker.Rates["usd"] != 8000 {
+		t.Errorf("existing ticker overwritten: %v", ticker.Rates)
+	}
+	c, err := d.FiatRatesGetCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Tickers != 3 || c.MissingDays != 0 {
+		t.Errorf("FiatRatesGetCoverage() = %+v", c)
+	}
+}
@@ -0,0 +1,311 @@
+package fiat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/db"
+)
+
+// defaultMaxDeviation is the default maximal relative deviation of a provider rate from the median of all providers
+const defaultMaxDeviation = 0.1
+
+// minOutlierRates is the minimal number of rates of a currency for the rejection of outliers,
+// with two rates the median is their mean and both rates deviate from it equally
+const minOutlierRates = 3
+
+// ProviderParams are the parameters of one provider of the MultiProvider
+type ProviderParams struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// the url is used by all provider types
+	URL string `json:"url"`
+	// parameters of the coingecko provider
+	Coin     string `json:"coin"`
+	Platform string `json:"platform"`
+	// parameters of the generic json provider, the url is taken from the URL field
+	JSONProviderParams
+}
+
+// ProviderStatus contains the health statistics of a provider
+type ProviderStatus struct {
+	Requests    int
+	Errors      int
+	Outliers    int
+	LastError   error
+	LastSuccess time.Time
+}
+
+type namedProvider struct {
+	name       string
+	downloader RatesDownloaderInterface
+	status     ProviderStatus
+}
+
+// MultiProvider is a structure that implements RatesDownloaderInterface by aggregation of rates from several providers.
+// The rates are the median of the rates of the providers that responded, after rejection of the outliers.
+// The outliers are rejected only if at least minOutlierRates providers returned the rate of the currency.
+type MultiProvider struct {
+	providers    []*namedProvider
+	maxDeviation float64
+	metrics      *common.Metrics
+	mux          sync.Mutex
+}
+
+// NewMultiProvider creates a MultiProvider from the list of provider parameters
+func NewMultiProvider(providers []ProviderParams, maxDeviation float64, timeFormat string, metrics *common.Metrics) (*MultiProvider, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("Missing providers")
+	}
+	if maxDeviation <= 0 {
+		maxDeviation = defaultMaxDeviation
+	}
+	mp := &MultiProvider{
+		maxDeviation: maxDeviation,
+		metrics:      metrics,
+	}
+	if len(providers) < minOutlierRates {
+		glog.Warningf("Fiat rates multi provider has less than %d providers, the outlying rates are not rejected", minOutlierRates)
+	}
+	names := make(map[string]struct{})
+	for i := range providers {
+		p := &providers[i]
+		var d RatesDownloaderInterface
+		var err error
+		switch p.Type {
+		case "coingecko":
+			if p.URL == "" {
+				err = errors.New("Missing url")
+			} else {
+				d = NewCoinGeckoDownloader(p.URL, p.Coin, p.Platform, timeFormat)
+			}
+		case "json":
+			jp := p.JSONProviderParams
+			jp.URL = p.URL
+			d, err = NewJSONProvider(&jp)
+		default:
+			err = fmt.Errorf("incorrect API type %q", p.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Provider %d: %v", i, err)
+		}
+		name := p.Name
+		if name == "" {
+			name = p.Type
+		}
+		if _, found := names[name]; found {
+			return nil, fmt.Errorf("Provider %d: duplicate name %q", i, name)
+		}
+		names[name] = struct{}{}
+		mp.providers = append(mp.providers, &namedProvider{name: name, downloader: d})
+	}
+	return mp, nil
+}
+
+// newMultiProviderFromParams creates a MultiProvider from the fiat_rates_params
+func newMultiProviderFromParams(params string, timeFormat string, metrics *common.Metrics) (*MultiProvider, error) {
+	var p struct {
+		Providers    []ProviderParams `json:"providers"`
+		MaxDeviation float64          `json:"maxDeviation"`
+	}
+	if err := json.Unmarshal([]byte(params), &p); err != nil {
+		return nil, err
+	}
+	return NewMultiProvider(p.Providers, p.MaxDeviation, timeFormat, metrics)
+}
+
+// Status returns the health statistics of the providers by their names
+func (mp *MultiProvider) Status() map[string]ProviderStatus {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	r := make(map[string]ProviderStatus, len(mp.providers))
+	for _, p := range mp.providers {
+		r[p.name] = p.status
+	}
+	return r
+}
+
+func (mp *MultiProvider) updateStatus(p *namedProvider, err error, outlier bool) {
+	mp.mux.Lock()
+	defer mp.mux.Unlock()
+	p.status.Requests++
+	status := "ok"
+	if err != nil {
+		p.status.Errors++
+		p.status.LastError = err
+		status = "error"
+	} else {
+		p.status.LastSuccess = time.Now()
+		if outlier {
+			p.status.Outliers++
+			status = "outlier"
+		}
+	}
+	if mp.metrics != nil {
+		mp.metrics.FiatRatesProviderRequests.With(common.Labels{"provider": p.name, "status": status}).Inc()
+		up := float64(1)
+		if err != nil {
+			up = 0
+		}
+		mp.metrics.FiatRatesProviderUp.With(common.Labels{"provider": p.name}).Set(up)
+	}
+}
+
+func median(values []float64) float64 {
+	s := append([]float64(nil), values...)
+	sort.Float64s(s)
+	l := len(s)
+	if l%2 == 1 {
+		return s[l/2]
+	}
+	return (s[l/2-1] + s[l/2]) / 2
+}
+
+// aggregateRates returns for each currency the median of the rates, the rates deviating from the median
+// by more than maxDeviation are rejected and the median is computed again from the remaining rates
+// the rejection is skipped for the currencies with less than minOutlierRates rates
+// the returned slice contains for each of the tickers the flag if any of its rates was rejected
+func aggregateRates(tickers []*db.CurrencyRatesTicker, maxDeviation float64) (map[string]float64, []bool) {
+	values := make(map[string][]float64)
+	for _, t := range tickers {
+		for currency, r := range t.Rates {
+			if r > 0 && !math.IsInf(r, 0) && !math.IsNaN(r) {
+				values[currency] = append(values[currency], r)
+			}
+		}
+	}
+	outliers := make([]bool, len(tickers))
+	rates := make(map[string]float64, len(values))
+	for currency, v := range values {
+		m := median(v)
+		if len(v) < minOutlierRates {
+			rates[currency] = m
+			continue
+		}
+		var accepted []float64
+		for _, r := range v {
+			if math.Abs(r-m)/m <= maxDeviation {
+				accepted = append(accepted, r)
+			}
+		}
+		if len(accepted) < len(v) {
+			for i, t := range tickers {
+				if r, found := t.Rates[currency]; found && math.Abs(r-m)/m > maxDeviation {
+					outliers[i] = true
+				}
+			}
+		}
+		if len(accepted) > 0 {
+			m = median(accepted)
+		}
+		rates[currency] = m
+	}
+	return rates, outliers
+}
+
+// getTicker gets the tickers of all providers in parallel and returns the aggregated ticker
+func (mp *MultiProvider) getTicker(timestamp *time.Time) (*db.CurrencyRatesTicker, error) {
+	dataTimestamp := time.Now().UTC()
+	if timestamp != nil {
+		dataTimestamp = timestamp.UTC()
+	}
+	tickers := make([]*db.CurrencyRatesTicker, len(mp.providers))
+	errs := make([]error, len(mp.providers))
+	var wg sync.WaitGroup
+	for i := range mp.providers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var ts *time.Time
+			if timestamp != nil {
+				t := *timestamp
+				ts = &t
+			}
+			tickers[i], errs[i] = mp.providers[i].downloader.getTicker(ts)
+			if errs[i] == nil && len(tickers[i].Rates) == 0 {
+				errs[i] = errors.New("No rates")
+			}
+		}(i)
+	}
+	wg.Wait()
+	var responded []*db.CurrencyRatesTicker
+	var respondedProviders []*namedProvider
+	for i, p := range mp.providers {
+		if errs[i] != nil {
+			glog.Warningf("Fiat rates provider %v error: %v", p.name, errs[i])
+			mp.updateStatus(p, errs[i], false)
+			continue
+		}
+		responded = append(responded, tickers[i])
+		respondedProviders = append(respondedProviders, p)
+	}
+	if len(responded) == 0 {
+		return nil, errors.New("No fiat rates provider responded")
+	}
+	rates, outliers := aggregateRates(responded, mp.maxDeviation)
+	for i, p := range respondedProviders {
+		if outliers[i] {
+			glog.Warningf("Fiat rates provider %v returned outlying rates for %v", p.name, dataTimestamp)
+		}
+		mp.updateStatus(p, nil, outliers[i])
+	}
+	return &db.CurrencyRatesTicker{Timestamp: &dataTimestamp, Rates: rates}, nil
+}
+
+// marketDataExists returns true if any of the providers has the data for the timestamp
+func (mp *MultiProvider) marketDataExists(timestamp *time.Time) (bool, error) {
+	var lastErr error
+	answered := false
+	for _, p := range mp.providers {
+		exists, err := p.downloader.marketDataExists(timestamp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if exists {
+			return true, nil
+		}
+		answered = true
+	}
+	if answered {
+		return false, nil
+	}
+	return false, lastErr
+}
+
+// getIntradayTickers returns the intraday tickers of the first provider supporting them
+func (mp *MultiProvider) getIntradayTickers(from, to time.Time, currencies []string) ([]*db.CurrencyRatesTicker, error) {
+	err := errors.New("No provider supports intraday rates")
+	for _, p := range mp.providers {
+		if d, ok := p.downloader.(intradayRatesDownloader); ok {
+			var tickers []*db.CurrencyRatesTicker
+			if tickers, err = d.getIntradayTickers(from, to, currencies); err == nil {
+				return tickers, nil
+			}
+			glog.Warningf("Fiat rates provider %v intraday error: %v", p.name, err)
+		}
+	}
+	return nil, err
+}
+
+// getTokenRates returns the token rates of the first provider supporting them
+func (mp *MultiProvider) getTokenRates(contracts []string, currency string) (map[string]float64, error) {
+	err := errors.New("No provider supports token rates")
+	for _, p := range mp.providers {
+		if d, ok := p.downloader.(tokenRatesDownloader); ok {
+			var rates map[string]float64
+			if rates, err = d.getTokenRates(contracts, currency); err == nil {
+				return rates, nil
+			}
+			glog.Warningf("Fiat rates provider %v token rates error: %v", p.name, err)
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,213 @@
+//go:build unittest
+// +build unittest
+
+package fiat
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/db"
+)
+
+func newCoinGeckoMockServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		var mockData string
+		if r.URL.Path == "/coins/bitcoin/market_chart/range" {
+			// hourly points of 2019-11-21 17:00, 18:00 and 19:00 UTC, with a few seconds offset as returned by Coingecko
+			prices := map[string]string{
+				"usd": "[[1574355612000,100],[1574359212000,110],[1574362812000,120]]",
+				"eur": "[[1574355612000,90],[1574359212000,99],[1574362812000,108]]",
+			}
+			p, found := prices[r.URL.Query().Get("vs_currency")]
+			if !found {
+				p = "[]"
+			}
+			mockData = `{"prices":` + p + `}`
+		} else if r.URL.Path == "/coins/bitcoin/history" {
+			mockData, err = getFiatRatesMockData(r.URL.Query()["date"][0])
+		} else if r.URL.Path == "/coins/bitcoin" {
+			mockData, err = getFiatRatesMockData("current")
+		} else {
+			t.Errorf("Unknown URL path: %v", r.URL.Path)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, mockData)
+	}))
+}
+
+// newJSONMockServer serves the responses by the URL path
+func newJSONMockServer(responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, found := responses[r.URL.Path]
+		if !found {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, data)
+	}))
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFiatRates_MultiProvider(t *testing.T) {
+	d, _, tmp := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d, tmp)
+
+	coingecko := newCoinGeckoMockServer(t)
+	defer coingecko.Close()
+	exchange := newJSONMockServer(map[string]string{
+		"/ticker":             `{"data":{"rates":{"USD":"7213.0","EUR":6471.78}}}`,
+		"/history/2019-11-20": `{"data":{"rates":{"USD":8000,"EUR":7346.923290157612}}}`,
+		"/history/2019-11-21": `{"data":{"rates":{"USD":8000,"EUR":7346.923290157612}}}`,
+	})
+	defer exchange.Close()
+	outlier := newJSONMockServer(map[string]string{
+		"/price": `{"result":[{"price":"21427.77"}]}`,
+	})
+	defer outlier.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limit", http.StatusTooManyRequests)
+	}))
+	defer down.Close()
+
+	params := `{"periodSeconds": 60, "maxDeviation": 0.05, "providers": [
+		{"type": "coingecko", "url": "` + coingecko.URL + `", "coin": "bitcoin"},
+		{"type": "json", "name": "exchange", "url": "` + exchange.URL + `/ticker", "historyUrl": "` + exchange.URL + `/history/{date}", "dateFormat": "2006-01-02", "ratesPath": "data.rates"},
+		{"type": "json", "name": "outlier", "url": "` + outlier.URL + `/price", "rates": {"usd": "result.0.price"}},
+		{"type": "coingecko", "name": "down", "url": "` + down.URL + `", "coin": "bitcoin"}
+	]}`
+	testStartTime := time.Date(2019, 11, 22, 16, 0, 0, 0, time.UTC)
+	fiatRates, err := NewFiatRatesDownloader(d, "multi", params, &testStartTime, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := fiatRates.downloader.(*MultiProvider)
+
+	// current rates, the outlier usd rate is rejected, eur from two providers, other currencies only from coingecko
+	ticker, err := mp.getTicker(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := ticker.Rates["usd"]; !almostEqual(r, (7142.59+7213.0)/2) {
+		t.Errorf("usd rate %v, want %v", r, (7142.59+7213.0)/2)
+	}
+	if r := ticker.Rates["eur"]; !almostEqual(r, 6471.78) {
+		t.Errorf("eur rate %v, want 6471.78", r)
+	}
+	if len(ticker.Rates) != 55 {
+		t.Errorf("got %d rates, want 55", len(ticker.Rates))
+	}
+	status := mp.Status()
+	if s := status["outlier"]; s.Requests != 1 || s.Outliers != 1 || s.Errors != 0 {
+		t.Errorf("outlier status %+v", s)
+	}
+	if s := status["down"]; s.Requests != 1 || s.Errors != 1 || s.LastError == nil {
+		t.Errorf("down status %+v", s)
+	}
+	if s := status["coingecko"]; s.Requests != 1 || s.Outliers != 0 || s.Errors != 0 {
+		t.Errorf("coingecko status %+v", s)
+	}
+
+	// historical rates, the providers without history are skipped
+	timestamp := time.Date(2019, 11, 20, 0, 0, 0, 0, time.UTC)
+	if err = fiatRates.syncHistorical(&timestamp); err != nil {
+		t.Fatal(err)
+	}
+	tickerTime := time.Date(2019, 11, 20, 0, 0, 0, 0, time.UTC)
+	stored, err := d.FiatRatesFindTicker(&tickerTime)
+	if err != nil || stored == nil {
+		t.Fatalf("FiatRatesFindTicker() = %v, %v", stored, err)
+	}
+	if !stored.Timestamp.Equal(tickerTime) {
+		t.Errorf("stored ticker timestamp %v, want %v", stored.Timestamp, tickerTime)
+	}
+	if r := stored.Rates["usd"]; !almostEqual(r, (8138.831605359057+8000)/2) {
+		t.Errorf("usd rate %v, want %v", r, (8138.831605359057+8000)/2)
+	}
+	if r := stored.Rates["eur"]; !almostEqual(r, 7346.923290157612) {
+		t.Errorf("eur rate %v, want 7346.923290157612", r)
+	}
+	if s := mp.Status()["outlier"]; s.Errors != 2 {
+		t.Errorf("outlier status %+v, want 2 errors", s)
+	}
+
+	// all providers down
+	mp, err = NewMultiProvider([]ProviderParams{{Type: "coingecko", URL: down.URL, Coin: "bitcoin"}}, 0, fiatRates.timeFormat, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mp.getTicker(nil); err == nil {
+		t.Error("getTicker() expected error if all providers are down")
+	}
+}
+
+func Test_aggregateRates(t *testing.T) {
+	tests := []struct {
+		name         string
+		rates        []float64
+		want         float64
+		wantOutliers []bool
+	}{
+		{
+			name:         "single",
+			rates:        []float64{100},
+			want:         100,
+			wantOutliers: []bool{false},
+		},
+		{
+			name:         "odd",
+			rates:        []float64{101, 100, 99},
+			want:         100,
+			wantOutliers: []bool{false, false, false},
+		},
+		{
+			name:         "outlier",
+			rates:        []float64{100, 102, 1000, 0.01},
+			want:         101,
+			wantOutliers: []bool{false, false, true, true},
+		},
+		{
+			name:         "two not rejected",
+			rates:        []float64{100, 300},
+			want:         200,
+			wantOutliers: []bool{false, false},
+		},
+		{
+			name:         "all deviating",
+			rates:        []float64{100, 300, 900},
+			want:         300,
+			wantOutliers: []bool{true, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tickers := make([]*db.CurrencyRatesTicker, len(tt.rates))
+			for i, r := range tt.rates {
+				tickers[i] = &db.CurrencyRatesTicker{Rates: map[string]float64{"usd": r}}
+			}
+			got, outliers := aggregateRates(tickers, 0.1)
+			if !almostEqual(got["usd"], tt.want) {
+				t.Errorf("aggregateRates() = %v, want %v", got["usd"], tt.want)
+			}
+			for i := range outliers {
+				if outliers[i] != tt.wantOutliers[i] {
+					t.Errorf("aggregateRates() outliers = %v, want %v", outliers, tt.wantOutliers)
+					break
+				}
+			}
+		})
+	}
+}
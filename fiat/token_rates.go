@@ -0,0 +1,111 @@
+package fiat
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/db"
+)
+
+// tokenQuoteCurrency is the currency in which the token rates are downloaded,
+// the rates in the other currencies are derived from the ticker of the base coin
+const tokenQuoteCurrency = "usd"
+
+// tokenRatesDownloader is implemented by the downloaders providing the current rates of the tokens by their contract addresses
+type tokenRatesDownloader interface {
+	getTokenRates(contracts []string, currency string) (map[string]float64, error)
+}
+
+// contractToDescriptor converts the hex contract address to the Ethereum type address descriptor
+func contractToDescriptor(contract string) (bchain.AddressDescriptor, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.ToLower(contract), "0x"))
+}
+
+// updateTokenContracts sets the list of the tokens with downloaded rates, the configured tokens
+// together with the tokens with at least rd.tokenMinHolders holders
+func (rd *RatesDownloader) updateTokenContracts() error {
+	rd.lastTokenContracts = time.Now()
+	// the contracts are compared and queried in lowercase, as returned by the rates providers
+	contracts := make([]string, 0, len(rd.tokens))
+	configured := make(map[string]struct{}, len(rd.tokens))
+	for _, c := range rd.tokens {
+		c = strings.ToLower(c)
+		if _, found := configured[c]; !found {
+			configured[c] = struct{}{}
+			contracts = append(contracts, c)
+		}
+	}
+	if rd.tokenMinHolders > 0 {
+		descs, err := rd.db.GetContractsByHolders(rd.tokenMinHolders)
+		if err != nil {
+			return err
+		}
+		for _, d := range descs {
+			c := "0x" + hex.EncodeToString(d)
+			if _, found := configured[c]; !found {
+				contracts = append(contracts, c)
+			}
+		}
+	}
+	rd.tokenContracts = contracts
+	glog.Infof("RatesDownloader: downloading rates of %d tokens", len(contracts))
+	return nil
+}
+
+// tokenCrossRates returns the rates of the token in all currencies of the ticker of the base coin
+// derived from the rate of the token in tokenQuoteCurrency
+func tokenCrossRates(rate float64, ticker *db.CurrencyRatesTicker) map[string]float64 {
+	quote, found := ticker.Rates[tokenQuoteCurrency]
+	if !found || quote <= 0 {
+		return map[string]float64{tokenQuoteCurrency: rate}
+	}
+	rates := make(map[string]float64, len(ticker.Rates))
+	for currency, r := range ticker.Rates {
+		rates[currency] = rate * r / quote
+	}
+	rates[tokenQuoteCurrency] = rate
+	return rates
+}
+
+// syncTokens downloads the current rates of the tokens and stores them with the timestamp of the ticker of the base coin
+// the list of the tokens above the holders threshold is refreshed daily; it returns the number of stored token tickers
+func (rd *RatesDownloader) syncTokens(ticker *db.CurrencyRatesTicker) (int, error) {
+	if len(rd.tokens) == 0 && rd.tokenMinHolders <= 0 {
+		return 0, nil
+	}
+	d, ok := rd.downloader.(tokenRatesDownloader)
+	if !ok {
+		glog.Infof("syncTokens: the downloader does not support token rates")
+		return 0, nil
+	}
+	if rd.tokenContracts == nil || time.Since(rd.lastTokenContracts) > 24*time.Hour {
+		if err := rd.updateTokenContracts(); err != nil {
+			return 0, err
+		}
+	}
+	if len(rd.tokenContracts) == 0 {
+		return 0, nil
+	}
+	rates, err := d.getTokenRates(rd.tokenContracts, tokenQuoteCurrency)
+	if err != nil {
+		return 0, err
+	}
+	stored := 0
+	for contract, rate := range rates {
+		desc, err := contractToDescriptor(contract)
+		if err != nil {
+			glog.Errorf("syncTokens invalid contract %v: %v", contract, err)
+			continue
+		}
+		t := &db.CurrencyRatesTicker{Timestamp: ticker.Timestamp, Rates: tokenCrossRates(rate, ticker)}
+		if err = rd.db.FiatRatesStoreTokenTicker(desc, t); err != nil {
+			return stored, err
+		}
+		stored++
+	}
+	glog.Infof("syncTokens: stored rates of %d tokens for %v", stored, ticker.Timestamp)
+	return stored, nil
+}
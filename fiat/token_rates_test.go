@@ -0,0 +1,64 @@
+// +build unittest
+
+package fiat
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/bchain/coins/eth"
+	"github.com/trezor/blockbook/db"
+)
+
+func TestFiatRates_Tokens(t *testing.T) {
+	d, _, tmp := setupRocksDB(t, eth.NewEthereumParser(1))
+	defer closeAndDestroyRocksDB(t, d, tmp)
+
+	coingecko := newJSONMockServer(map[string]string{
+		"/simple/token_price/ethereum": `{"0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48":{"usd":1.001},"0x4fabb145d64652a948d72533023f6e7a623c7c53":{"usd":0.5}}`,
+	})
+	defer coingecko.Close()
+
+	params := `{"url": "` + coingecko.URL + `", "coin": "ethereum", "platform": "ethereum", "periodSeconds": 60,
+		"tokens": ["0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "0x4fabb145d64652a948d72533023f6e7a623c7c53"]}`
+	testStartTime := time.Date(2019, 11, 22, 16, 0, 0, 0, time.UTC)
+	fiatRates, err := NewFiatRatesDownloader(d, "coingecko", params, &testStartTime, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2019, 11, 22, 16, 0, 0, 0, time.UTC)
+	ticker := &db.CurrencyRatesTicker{Timestamp: &ts, Rates: map[string]float64{"usd": 200, "eur": 180}}
+	n, err := fiatRates.syncTokens(ticker)
+	if err != nil || n != 2 {
+		t.Fatalf("syncTokens() = %v, %v, want 2", n, err)
+	}
+	// the configured tokens are deduplicated regardless of the case of the addresses
+	wantContracts := []string{"0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "0x4fabb145d64652a948d72533023f6e7a623c7c53"}
+	if !reflect.DeepEqual(fiatRates.tokenContracts, wantContracts) {
+		t.Errorf("tokenContracts = %v, want %v", fiatRates.tokenContracts, wantContracts)
+	}
+	contract, _ := contractToDescriptor("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	got, err := d.FiatRatesFindLastTokenTicker(contract)
+	if err != nil || got == nil {
+		t.Fatalf("FiatRatesFindLastTokenTicker() = %v, %v", got, err)
+	}
+	if !got.Timestamp.Equal(ts) {
+		t.Errorf("token ticker timestamp %v, want %v", got.Timestamp, ts)
+	}
+	if !almostEqual(got.Rates["usd"], 1.001) || !almostEqual(got.Rates["eur"], 1.001*180/200) {
+		t.Errorf("token ticker rates %v", got.Rates)
+	}
+}
+
+func Test_tokenCrossRates(t *testing.T) {
+	ts := time.Date(2019, 11, 22, 16, 0, 0, 0, time.UTC)
+	got := tokenCrossRates(2, &db.CurrencyRatesTicker{Timestamp: &ts, Rates: map[string]float64{"eur": 90}})
+	if want := map[string]float64{"usd": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenCrossRates() = %v, want %v", got, want)
+	}
+	got = tokenCrossRates(2, &db.CurrencyRatesTicker{Timestamp: &ts, Rates: map[string]float64{"usd": 100, "eur": 90}})
+	if want := map[string]float64{"usd": 2, "eur": 1.8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenCrossRates() = %v, want %v", got, want)
+	}
+}
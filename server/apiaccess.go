@@ -0,0 +1,399 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/db"
+)
+
+// the idle clients without open websocket connections are removed from memory after this period
+const apiClientIdleTimeout = 10 * time.Minute
+const apiClientsPrunePeriod = time.Minute
+
+// the API keys stored in the database are reloaded with this period, the changes made by the internal server take effect after it
+const apiKeysReloadPeriod = time.Minute
+
+const anonymousAPIClient = "anonymous"
+
+// rejection reasons used as labels of the metric
+const (
+	apiRejectBlockedOrigin = "blockedOrigin"
+	apiRejectInvalidKey    = "invalidKey"
+	apiRejectMissingKey    = "missingKey"
+	apiRejectRateLimit     = "rateLimit"
+	apiRejectSubscriptions = "subscriptions"
+)
+
+// apiLimits are the limits of a client, zero value means unlimited
+type apiLimits = db.APILimits
+
+// apiKeyConfig is an API key from the config file or from the database
+type apiKeyConfig = db.APIKey
+
+type apiAccessConfig struct {
+	// if set, only the requests with a valid key or from an exempt origin are served
+	RequireKey bool           `json:"requireKey"`
+	Keys       []apiKeyConfig `json:"keys"`
+	// limits of the requests without key, applied to each IP address
+	IPLimits apiLimits `json:"ipLimits"`
+	// the requests from these origins without key are not limited, the origin can be specified as *.domain
+	ExemptOrigins []string `json:"exemptOrigins"`
+	// the requests from these origins are rejected
+	BlockedOrigins []string `json:"blockedOrigins"`
+}
+
+type apiAccessError struct {
+	text       string
+	httpStatus int
+}
+
+func (e *apiAccessError) Error() string {
+	return e.text
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes one token from the bucket refilled at rate tokens per second up to burst
+func (b *tokenBucket) take(rate float64, burst int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// apiClient is an API key or an IP address accessing the server without key
+type apiClient struct {
+	name string
+	// the API key of the client, empty for the clients without key
+	key           string
+	limits        *apiLimits
+	exempt        bool
+	rest          tokenBucket
+	websocket     tokenBucket
+	subscriptions int
+	connections   int
+	lastUsed      time.Time
+}
+
+// APIAccess handles the authentication by API keys and the rate limiting of the public server
+type APIAccess struct {
+	config     apiAccessConfig
+	keys       map[string]*apiKeyConfig
+	db         *db.RocksDB
+	dbKeys     map[string]*apiKeyConfig
+	metrics    *common.Metrics
+	lock       sync.Mutex
+	clients    map[string]*apiClient
+	exempt     apiClient
+	lastPrune  time.Time
+	lastReload time.Time
+}
+
+// NewAPIAccess loads the API keys and limits from the json config file and the API keys from the database
+// configFile is optional, without it there are no limits of the requests without key
+// d is optional, if set, the API keys are stored in the database and managed by the internal server
+func NewAPIAccess(configFile string, d *db.RocksDB, metrics *common.Metrics) (*APIAccess, error) {
+	var config apiAccessConfig
+	if configFile != "" {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, errors.Annotatef(err, "ReadFile %v", configFile)
+		}
+		if err = json.Unmarshal(data, &config); err != nil {
+			return nil, errors.Annotatef(err, "Unmarshal %v", configFile)
+		}
+	}
+	if d != nil {
+		if err := d.EnableAPIKeys(); err != nil {
+			return nil, err
+		}
+	}
+	return newAPIAccess(&config, d, metrics)
+}
+
+func newAPIAccess(config *apiAccessConfig, d *db.RocksDB, metrics *common.Metrics) (*APIAccess, error) {
+	a := &APIAccess{
+		config:  *config,
+		keys:    make(map[string]*apiKeyConfig, len(config.Keys)),
+		db:      d,
+		metrics: metrics,
+		clients: make(map[string]*apiClient),
+		exempt:  apiClient{name: anonymousAPIClient, limits: &apiLimits{}, exempt: true},
+	}
+	for i := range a.config.Keys {
+		k := &a.config.Keys[i]
+		if k.Key == "" {
+			return nil, errors.Errorf("Missing key of API key %d", i)
+		}
+		if _, ok := a.keys[k.Key]; ok {
+			return nil, errors.Errorf("Duplicate API key %v", k.Name)
+		}
+		if !validAPIKeyName(k.Name) {
+			return nil, errors.Errorf("Invalid name of API key %d", i)
+		}
+		a.keys[k.Key] = k
+	}
+	if err := a.reloadKeys(time.Now()); err != nil {
+		return nil, err
+	}
+	glog.Info("apiaccess: ", len(a.keys), " API keys in config, ", len(a.dbKeys), " API keys in db, key required ", a.config.RequireKey)
+	return a, nil
+}
+
+func validAPIKeyName(name string) bool {
+	return name != "" && name != anonymousAPIClient
+}
+
+// reloadKeys loads the API keys from the database, the keys from the config file take precedence
+// it must be called with the lock held or from the constructor
+func (a *APIAccess) reloadKeys(now time.Time) error {
+	a.lastReload = now
+	if a.db == nil {
+		return nil
+	}
+	keys, err := a.db.GetAPIKeys()
+	if err != nil {
+		return err
+	}
+	dbKeys := make(map[string]*apiKeyConfig, len(keys))
+	for i := range keys {
+		k := &keys[i]
+		if !validAPIKeyName(k.Name) {
+			glog.Warning("apiaccess: skipping API key with invalid name ", k.Name)
+			continue
+		}
+		dbKeys[k.Key] = k
+	}
+	a.dbKeys = dbKeys
+	return nil
+}
+
+// getKey returns the configuration of the API key, it must be called with the lock held
+func (a *APIAccess) getKey(key string, now time.Time) (*apiKeyConfig, bool) {
+	if k, ok := a.keys[key]; ok {
+		return k, true
+	}
+	if a.db == nil {
+		return nil, false
+	}
+	if a.lastReload.Add(apiKeysReloadPeriod).Before(now) {
+		if err := a.reloadKeys(now); err != nil {
+			glog.Error("apiaccess: reload of API keys failed ", err)
+		}
+	}
+	k, ok := a.dbKeys[key]
+	return k, ok
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("apikey")
+}
+
+// matchOrigin checks if the origin matches any of the patterns, pattern *.domain matches the subdomains of the domain
+func matchOrigin(origin string, patterns []string) bool {
+	host := origin
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	for _, p := range patterns {
+		if p == "*" || p == origin || p == host {
+			return true
+		}
+		if strings.HasPrefix(p, "*.") && strings.HasSuffix(host, p[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func clientIP(r *http.Request) string {
+	ip := getIP(r)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
+	return ip
+}
+
+func (a *APIAccess) reject(name string, reason string, text string, httpStatus int) *apiAccessError {
+	a.metrics.APIRejections.With(common.Labels{"key": name, "reason": reason}).Inc()
+	return &apiAccessError{text, httpStatus}
+}
+
+// getClient returns the client with the id, it must be called with the lock held
+func (a *APIAccess) getClient(id string, name string, key string, limits *apiLimits, now time.Time) *apiClient {
+	if a.lastPrune.Add(apiClientsPrunePeriod).Before(now) {
+		a.lastPrune = now
+		threshold := now.Add(-apiClientIdleTimeout)
+		for k, c := range a.clients {
+			if c.connections == 0 && c.lastUsed.Before(threshold) {
+				delete(a.clients, k)
+			}
+		}
+	}
+	c, ok := a.clients[id]
+	if !ok {
+		c = &apiClient{name: name, key: key}
+		a.clients[id] = c
+	}
+	// the limits of the key may be changed by the reload of the keys
+	// the name of the key may be changed by the reload of the keys
+	c.name = name
+	c.limits = limits
+	c.lastUsed = now
+	return c
+}
+
+// authorize identifies the client of the request by the API key, origin or IP address
+// it must be called with the lock held
+func (a *APIAccess) authorize(r *http.Request, now time.Time) (*apiClient, *apiAccessError) {
+	origin := r.Header.Get("Origin")
+	key := apiKeyFromRequest(r)
+	var k *apiKeyConfig
+	if key != "" {
+		var ok bool
+		k, ok = a.getKey(key, now)
+		if !ok || k.Disabled {
+			return nil, a.reject(anonymousAPIClient, apiRejectInvalidKey, "Invalid API key", http.StatusUnauthorized)
+		}
+	}
+	if origin != "" && matchOrigin(origin, a.config.BlockedOrigins) {
+		name := anonymousAPIClient
+		if k != nil {
+			name = k.Name
+		}
+		return nil, a.reject(name, apiRejectBlockedOrigin, "Origin not allowed", http.StatusForbidden)
+	}
+	if k != nil {
+		return a.getClient("key:"+k.Key, k.Name, k.Key, &k.Limits, now), nil
+	}
+	if origin != "" && matchOrigin(origin, a.config.ExemptOrigins) {
+		return &a.exempt, nil
+	}
+	if a.config.RequireKey {
+		return nil, a.reject(anonymousAPIClient, apiRejectMissingKey, "Missing API key", http.StatusUnauthorized)
+	}
+	return a.getClient("ip:"+clientIP(r), anonymousAPIClient, "", &a.config.IPLimits, now), nil
+}
+
+// CheckRESTRequest authorizes the REST request and checks the rate limit of its client
+func (a *APIAccess) CheckRESTRequest(r *http.Request) error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	c, err := a.authorize(r, now)
+	if err != nil {
+		return err
+	}
+	if !c.exempt && !c.rest.take(c.limits.RESTRate, c.limits.RESTBurst, now) {
+		return a.reject(c.name, apiRejectRateLimit, "Rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// authorizeWebsocket authorizes the websocket connection and returns its client
+// the client is kept in memory until the connection is released by releaseWebsocket
+func (a *APIAccess) authorizeWebsocket(r *http.Request) (*apiClient, error) {
+	if a == nil {
+		return nil, nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	c, err := a.authorize(r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !c.exempt {
+		c.connections++
+	}
+	return c, nil
+}
+
+// releaseWebsocket releases the client of the closed websocket connection
+func (a *APIAccess) releaseWebsocket(c *apiClient) {
+	if a == nil || c == nil || c.exempt {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	c.connections--
+	c.lastUsed = time.Now()
+}
+
+// checkWebsocketRequest checks the API key and the rate limit of the client of the websocket connection
+// the key is checked on each request, the removed or disabled key is rejected also on the already open connections
+func (a *APIAccess) checkWebsocketRequest(c *apiClient) error {
+	if a == nil || c == nil || c.exempt {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	if c.key != "" {
+		k, ok := a.getKey(c.key, now)
+		if !ok || k.Disabled {
+			return a.reject(c.name, apiRejectInvalidKey, "Invalid API key", http.StatusUnauthorized)
+		}
+		c.name = k.Name
+		c.limits = &k.Limits
+	}
+	c.lastUsed = now
+	if !c.websocket.take(c.limits.WebsocketRate, c.limits.WebsocketBurst, now) {
+		return a.reject(c.name, apiRejectRateLimit, "Rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// setSubscriptions sets the number of subscribed items of the method in the connection,
+// checking the limit of subscriptions of the client
+func (a *APIAccess) setSubscriptions(c *apiClient, counts map[string]int, method string, n int) error {
+	if a == nil || c == nil || c.exempt {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delta := n - counts[method]
+	if delta > 0 && c.limits.MaxSubscriptions > 0 && c.subscriptions+delta > c.limits.MaxSubscriptions {
+		return a.reject(c.name, apiRejectSubscriptions, "Too many subscriptions", http.StatusTooManyRequests)
+	}
+	if n == 0 {
+		delete(counts, method)
+	} else {
+		counts[method] = n
+	}
+	c.subscriptions += delta
+	return nil
+}
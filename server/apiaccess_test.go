@@ -0,0 +1,301 @@
+// +build unittest
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/db"
+)
+
+func Test_tokenBucket_take(t *testing.T) {
+	now := time.Now()
+	var b tokenBucket
+	for i := 0; i < 3; i++ {
+		if !b.take(1, 3, now) {
+			t.Fatalf("take %d failed within burst", i)
+		}
+	}
+	if b.take(1, 3, now) {
+		t.Fatal("take succeeded over burst")
+	}
+	if !b.take(1, 3, now.Add(time.Second)) {
+		t.Fatal("take failed after refill")
+	}
+	if b.take(1, 3, now.Add(time.Second)) {
+		t.Fatal("take succeeded over refill")
+	}
+	if !b.take(0, 0, now) {
+		t.Fatal("take failed with unlimited rate")
+	}
+}
+
+func Test_matchOrigin(t *testing.T) {
+	patterns := []string{"https://wallet.example.com", "*.trusted.org"}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://wallet.example.com", true},
+		{"https://example.com", false},
+		{"https://app.trusted.org", true},
+		{"http://a.b.trusted.org", true},
+		{"https://trusted.org", false},
+		{"https://untrusted.org", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.origin, patterns); got != tt.want {
+			t.Errorf("matchOrigin(%v) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func newTestAPIAccess(t *testing.T, config *apiAccessConfig) *APIAccess {
+	return newTestAPIAccessDB(t, config, nil)
+}
+
+func newTestAPIAccessDB(t *testing.T, config *apiAccessConfig, d *db.RocksDB) *APIAccess {
+	metrics := &common.Metrics{
+		APIRejections: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_api_rejections"}, []string{"key", "reason"}),
+	}
+	a, err := newAPIAccess(config, d, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func newAPIAccessRequest(key string, origin string, ip string) *http.Request {
+	r := httptest.NewRequest("GET", "/api/v2/", nil)
+	if key != "" {
+		r.Header.Set("X-Api-Key", key)
+	}
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	r.RemoteAddr = ip + ":12345"
+	return r
+}
+
+func accessErrorStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return err.(*apiAccessError).httpStatus
+}
+
+func TestAPIAccess_CheckRESTRequest(t *testing.T) {
+	a := newTestAPIAccess(t, &apiAccessConfig{
+		Keys: []apiKeyConfig{
+			{Key: "key1", Name: "exchange", Limits: apiLimits{RESTRate: 1, RESTBurst: 2}},
+			{Key: "key2", Name: "disabled", Disabled: true},
+		},
+		IPLimits:       apiLimits{RESTRate: 1, RESTBurst: 1},
+		ExemptOrigins:  []string{"https://wallet.example.com"},
+		BlockedOrigins: []string{"*.blocked.com"},
+	})
+	tests := []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{"ip first", newAPIAccessRequest("", "", "10.0.0.1"), http.StatusOK},
+		{"ip limited", newAPIAccessRequest("", "", "10.0.0.1"), http.StatusTooManyRequests},
+		{"other ip", newAPIAccessRequest("", "", "10.0.0.2"), http.StatusOK},
+		{"key first", newAPIAccessRequest("key1", "", "10.0.0.1"), http.StatusOK},
+		{"key second", newAPIAccessRequest("key1", "", "10.0.0.2"), http.StatusOK},
+		{"key limited", newAPIAccessRequest("key1", "", "10.0.0.3"), http.StatusTooManyRequests},
+		{"invalid key", newAPIAccessRequest("key3", "", "10.0.0.3"), http.StatusUnauthorized},
+		{"disabled key", newAPIAccessRequest("key2", "", "10.0.0.3"), http.StatusUnauthorized},
+		{"exempt origin", newAPIAccessRequest("", "https://wallet.example.com", "10.0.0.1"), http.StatusOK},
+		{"exempt origin again", newAPIAccessRequest("", "https://wallet.example.com", "10.0.0.1"), http.StatusOK},
+		{"blocked origin", newAPIAccessRequest("", "https://www.blocked.com", "10.0.0.4"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accessErrorStatus(a.CheckRESTRequest(tt.r)); got != tt.want {
+				t.Errorf("CheckRESTRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	a = newTestAPIAccess(t, &apiAccessConfig{RequireKey: true, Keys: []apiKeyConfig{{Key: "key1", Name: "exchange"}}})
+	if got := accessErrorStatus(a.CheckRESTRequest(newAPIAccessRequest("", "", "10.0.0.1"))); got != http.StatusUnauthorized {
+		t.Errorf("CheckRESTRequest() without key = %v, want %v", got, http.StatusUnauthorized)
+	}
+	if got := accessErrorStatus(a.CheckRESTRequest(newAPIAccessRequest("key1", "", "10.0.0.1"))); got != http.StatusOK {
+		t.Errorf("CheckRESTRequest() with key = %v, want %v", got, http.StatusOK)
+	}
+
+	var nilAccess *APIAccess
+	if err := nilAccess.CheckRESTRequest(newAPIAccessRequest("", "", "10.0.0.1")); err != nil {
+		t.Errorf("CheckRESTRequest() of disabled access = %v, want nil", err)
+	}
+}
+
+func TestAPIAccess_setSubscriptions(t *testing.T) {
+	a := newTestAPIAccess(t, &apiAccessConfig{
+		IPLimits: apiLimits{MaxSubscriptions: 3},
+	})
+	c, err := a.authorizeWebsocket(newAPIAccessRequest("", "", "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two connections from the same IP share the limit
+	counts1 := make(map[string]int)
+	counts2 := make(map[string]int)
+	if err := a.setSubscriptions(c, counts1, "subscribeAddresses", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.setSubscriptions(c, counts2, "subscribeNewBlock", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.setSubscriptions(c, counts2, "subscribeReorgs", 1); accessErrorStatus(err) != http.StatusTooManyRequests {
+		t.Fatalf("setSubscriptions() over limit = %v", err)
+	}
+	// replacing the subscription counts only the difference
+	if err := a.setSubscriptions(c, counts1, "subscribeAddresses", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.setSubscriptions(c, counts2, "subscribeReorgs", 1); err != nil {
+		t.Fatal(err)
+	}
+	for m := range counts1 {
+		a.setSubscriptions(c, counts1, m, 0)
+	}
+	for m := range counts2 {
+		a.setSubscriptions(c, counts2, m, 0)
+	}
+	if c.subscriptions != 0 || len(counts1) != 0 || len(counts2) != 0 {
+		t.Errorf("subscriptions after unsubscribe = %v, %v, %v, want 0", c.subscriptions, counts1, counts2)
+	}
+}
+
+func TestAPIAccess_websocketClients(t *testing.T) {
+	a := newTestAPIAccess(t, &apiAccessConfig{
+		Keys: []apiKeyConfig{
+			{Key: "key1", Name: "exchange", Limits: apiLimits{WebsocketRate: 1, WebsocketBurst: 1}},
+			{Key: "key2", Name: "exchange", Limits: apiLimits{WebsocketRate: 1, WebsocketBurst: 1}},
+		},
+	})
+	c1, err := a.authorizeWebsocket(newAPIAccessRequest("key1", "", "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := a.authorizeWebsocket(newAPIAccessRequest("key2", "", "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the keys with the same name do not share the limits
+	if c1 == c2 {
+		t.Fatal("keys with the same name share the client")
+	}
+	if err := a.checkWebsocketRequest(c1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.checkWebsocketRequest(c2); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.checkWebsocketRequest(c1); accessErrorStatus(err) != http.StatusTooManyRequests {
+		t.Fatalf("checkWebsocketRequest() over limit = %v", err)
+	}
+
+	// the client of an open connection is not pruned even if it is idle
+	a.lock.Lock()
+	c1.lastUsed = time.Time{}
+	c := a.getClient("ip:10.0.0.2", anonymousAPIClient, "", &a.config.IPLimits, time.Now())
+	a.lock.Unlock()
+	if a.clients["key:key1"] != c1 {
+		t.Fatal("client of an open connection was pruned")
+	}
+	// the client of a closed connection is pruned after the idle timeout
+	a.releaseWebsocket(c1)
+	a.lock.Lock()
+	c1.lastUsed = time.Time{}
+	a.lastPrune = time.Time{}
+	a.getClient("ip:10.0.0.2", anonymousAPIClient, "", &a.config.IPLimits, time.Now())
+	a.lock.Unlock()
+	if _, ok := a.clients["key:key1"]; ok {
+		t.Fatal("client of a closed connection was not pruned")
+	}
+	if a.clients["ip:10.0.0.2"] != c {
+		t.Fatal("client of the request was not kept")
+	}
+
+	// the disabled key is rejected on the open connection
+	a.keys["key2"].Disabled = true
+	if err := a.checkWebsocketRequest(c2); accessErrorStatus(err) != http.StatusUnauthorized {
+		t.Fatalf("checkWebsocketRequest() of disabled key = %v", err)
+	}
+}
+
+// apiAccessTestsBitcoinType checks that all public interfaces pass through the API access, it is run from Test_PublicServer_BitcoinType
+func apiAccessTestsBitcoinType(t *testing.T, s *PublicServer) {
+	defer func() { s.apiAccess = nil }()
+	if err := s.db.EnableAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.StoreAPIKey(&db.APIKey{Key: "dbkey", Name: "wallet"}); err != nil {
+		t.Fatal(err)
+	}
+	s.apiAccess = newTestAPIAccessDB(t, &apiAccessConfig{RequireKey: true, Keys: []apiKeyConfig{{Key: "key1", Name: "exchange"}}}, s.db)
+	ts := httptest.NewServer(s.https.Handler)
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, strings.TrimSpace(string(b))
+	}
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"api v1 without key", "/api/v1/block-index/225494", http.StatusUnauthorized},
+		{"api v2 without key", "/api/v2/block-index/225494", http.StatusUnauthorized},
+		{"explorer without key", "/block/225494", http.StatusUnauthorized},
+		{"socket.io without key", "/socket.io/?EIO=3&transport=polling", http.StatusUnauthorized},
+		{"api v1 with config key", "/api/v1/block-index/225494?apikey=key1", http.StatusOK},
+		{"explorer with db key", "/block/225494?apikey=dbkey", http.StatusOK},
+		{"invalid key", "/api/v2/block-index/225494?apikey=key2", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, body := get(tt.path); got != tt.want {
+				t.Errorf("GET %v = %v %v, want %v", tt.path, got, body, tt.want)
+			}
+		})
+	}
+	if got, body := get("/api/v2/block-index/225494"); body != `{"error":"Missing API key"}` {
+		t.Errorf("api error = %v %v", got, body)
+	}
+	if got, _ := get("/favicon.ico"); got == http.StatusUnauthorized {
+		t.Errorf("static file = %v, want not limited", got)
+	}
+
+	// the removed key is rejected after the reload of the keys
+	if err := s.db.DeleteAPIKey("dbkey"); err != nil {
+		t.Fatal(err)
+	}
+	s.apiAccess.lock.Lock()
+	s.apiAccess.lastReload = time.Time{}
+	s.apiAccess.lock.Unlock()
+	if got, body := get("/block/225494?apikey=dbkey"); got != http.StatusUnauthorized {
+		t.Errorf("removed db key = %v %v, want %v", got, body, http.StatusUnauthorized)
+	}
+}
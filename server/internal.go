@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -54,6 +56,11 @@ func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.B
 
 	serveMux.Handle(path+"favicon.ico", http.FileServer(http.Dir("./static/")))
 	serveMux.HandleFunc(path+"metrics", promhttp.Handler().ServeHTTP)
+	if s.chainParser.GetChainType() == bchain.ChainEthereumType {
+		serveMux.HandleFunc(path+"admin/contract/", s.adminContract)
+	}
+	serveMux.HandleFunc(path+"admin/fiatrates", s.adminFiatRates)
+	serveMux.HandleFunc(path+"admin/apikey/", s.adminAPIKey)
 	serveMux.HandleFunc(path, s.index)
 
 	return s, nil
@@ -97,3 +104,167 @@ func (s *InternalServer) index(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(buf)
 }
+
+// adminContract returns (GET), sets (POST) or removes (DELETE) the override of the metadata of the contract
+// the override is passed in the body of the POST request as json, for example {"symbol":"XYZ","scam":true}
+func (s *InternalServer) adminContract(w http.ResponseWriter, r *http.Request) {
+	var address string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		address = r.URL.Path[i+1:]
+	}
+	contract, err := s.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid contract %v, %v", address, err), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var o db.ContractOverride
+		if err = json.Unmarshal(body, &o); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid override, %v", err), http.StatusBadRequest)
+			return
+		}
+		// 77 is the maximum number of decimal digits of uint256
+		if o.Decimals != nil && (*o.Decimals < 0 || *o.Decimals > 77) {
+			http.Error(w, fmt.Sprintf("Invalid override, decimals %v out of range 0..77", *o.Decimals), http.StatusBadRequest)
+			return
+		}
+		if err = s.db.SetContractOverride(contract, &o); err != nil {
+			glog.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		glog.Infof("internal server: contract %v override set to %+v", address, o)
+	case http.MethodDelete:
+		if err = s.db.SetContractOverride(contract, nil); err != nil {
+			glog.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		glog.Infof("internal server: contract %v override removed", address)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ci, err := s.db.GetContractInfo(contract)
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if ci == nil {
+		http.Error(w, fmt.Sprintf("Contract %v not found", address), http.StatusNotFound)
+		return
+	}
+	buf, err := json.MarshalIndent(ci, "", "    ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
+
+// adminAPIKey returns (GET), sets (POST) or removes (DELETE) the API key of the public server stored in the database
+// GET without the key returns all stored keys, the key is passed in the body of the POST request as json,
+// for example {"name":"exchange","limits":{"restRate":10,"restBurst":20}}
+// the public server applies the changes after it reloads the keys, within a minute
+func (s *InternalServer) adminAPIKey(w http.ResponseWriter, r *http.Request) {
+	var key string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i >= 0 {
+		key = r.URL.Path[i+1:]
+	}
+	if key == "" && r.Method != http.MethodGet {
+		http.Error(w, "Missing key", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var k db.APIKey
+		if err = json.Unmarshal(body, &k); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid API key, %v", err), http.StatusBadRequest)
+			return
+		}
+		k.Key = key
+		if !validAPIKeyName(k.Name) {
+			http.Error(w, fmt.Sprintf("Invalid name of API key %v", k.Name), http.StatusBadRequest)
+			return
+		}
+		if err = s.db.StoreAPIKey(&k); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("internal server: API key %v set to %+v", k.Name, k.Limits)
+	case http.MethodDelete:
+		if err := s.db.DeleteAPIKey(key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("internal server: API key removed")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	keys, err := s.db.GetAPIKeys()
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var data interface{} = keys
+	if key != "" {
+		data = nil
+		for i := range keys {
+			if keys[i].Key == key {
+				data = &keys[i]
+			}
+		}
+		if data == nil {
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				http.Error(w, "API key not found", http.StatusNotFound)
+			}
+			return
+		}
+	}
+	buf, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
+
+// adminFiatRates returns the coverage of the stored fiat rates, in total and per currency
+func (s *InternalServer) adminFiatRates(w http.ResponseWriter, r *http.Request) {
+	c, err := s.db.FiatRatesGetCoverage()
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	buf, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -39,6 +40,8 @@ const (
 type PublicServer struct {
 	binding          string
 	certFiles        string
+	path             string
+	serveMux         *http.ServeMux
 	socketio         *SocketIoServer
 	websocket        *WebsocketServer
 	https            *http.Server
@@ -54,11 +57,12 @@ type PublicServer struct {
 	is               *common.InternalState
 	templates        []*template.Template
 	debug            bool
+	apiAccess        *APIAccess
 }
 
 // NewPublicServer creates new public server http interface to blockbook and returns its handle
 // only basic functionality is mapped, to map all functions, call
-func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, explorerURL string, metrics *common.Metrics, is *common.InternalState, debugMode bool, enableSubNewTx bool) (*PublicServer, error) {
+func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, explorerURL string, metrics *common.Metrics, is *common.InternalState, debugMode bool, enableSubNewTx bool, eventLog *db.EventLog, apiAccess *APIAccess, broadcastQueue *db.BroadcastQueue) (*PublicServer, error) {
 
 	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
@@ -70,21 +74,29 @@ func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bch
 		return nil, err
 	}
 
-	websocket, err := NewWebsocketServer(db, chain, mempool, txCache, metrics, is, enableSubNewTx)
+	websocket, err := NewWebsocketServer(db, chain, mempool, txCache, metrics, is, enableSubNewTx, eventLog, apiAccess)
 	if err != nil {
 		return nil, err
 	}
 
+	// broadcastQueue is optional, if set, all interfaces send the transactions through it
+	if broadcastQueue != nil {
+		api.SetBroadcastQueue(broadcastQueue)
+		socketio.api.SetBroadcastQueue(broadcastQueue)
+		websocket.api.SetBroadcastQueue(broadcastQueue)
+	}
+
 	addr, path := splitBinding(binding)
 	serveMux := http.NewServeMux()
 	https := &http.Server{
-		Addr:    addr,
-		Handler: serveMux,
+		Addr: addr,
 	}
 
 	s := &PublicServer{
 		binding:          binding,
 		certFiles:        certFiles,
+		path:             path,
+		serveMux:         serveMux,
 		https:            https,
 		api:              api,
 		socketio:         socketio,
@@ -99,8 +111,11 @@ func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bch
 		metrics:          metrics,
 		is:               is,
 		debug:            debugMode,
+		apiAccess:        apiAccess,
 	}
 	s.templates = s.parseTemplates()
+	// all requests pass through the API access check in ServeHTTP
+	https.Handler = s
 
 	// map only basic functions, the rest is enabled by method MapFullPublicInterface
 	serveMux.Handle(path+"favicon.ico", http.FileServer(http.Dir("./static/")))
@@ -125,8 +140,8 @@ func (s *PublicServer) Run() error {
 
 // ConnectFullPublicInterface enables complete public functionality
 func (s *PublicServer) ConnectFullPublicInterface() {
-	serveMux := s.https.Handler.(*http.ServeMux)
-	_, path := splitBinding(s.binding)
+	serveMux := s.serveMux
+	path := s.path
 	// support for test pages
 	serveMux.Handle(path+"test-socketio.html", http.FileServer(http.Dir("./static/")))
 	serveMux.Handle(path+"test-websocket.html", http.FileServer(http.Dir("./static/")))
@@ -185,9 +200,15 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 	serveMux.HandleFunc(path+"api/v2/utxo/", s.jsonHandler(s.apiUtxo, apiV2))
 	serveMux.HandleFunc(path+"api/v2/block/", s.jsonHandler(s.apiBlock, apiV2))
 	serveMux.HandleFunc(path+"api/v2/sendtx/", s.jsonHandler(s.apiSendTx, apiV2))
+	serveMux.HandleFunc(path+"api/v2/decodetx/", s.jsonHandler(s.apiDecodeTx, apiV2))
+	serveMux.HandleFunc(path+"api/v2/broadcasts/", s.jsonHandler(s.apiBroadcast, apiV2))
+	serveMux.HandleFunc(path+"api/v2/psbt/analyze", s.jsonHandler(s.apiAnalyzePsbt, apiV2))
+	serveMux.HandleFunc(path+"api/v2/coinselect/", s.jsonHandler(s.apiCoinSelect, apiV2))
 	serveMux.HandleFunc(path+"api/v2/estimatefee/", s.jsonHandler(s.apiEstimateFee, apiV2))
 	serveMux.HandleFunc(path+"api/v2/feestats/", s.jsonHandler(s.apiFeeStats, apiV2))
 	serveMux.HandleFunc(path+"api/v2/balancehistory/", s.jsonHandler(s.apiBalanceHistory, apiDefault))
+	serveMux.HandleFunc(path+"api/v2/export/", s.apiExport)
+	serveMux.HandleFunc(path+"api/v2/logs/", s.jsonHandler(s.apiContractLogs, apiV2))
 	serveMux.HandleFunc(path+"api/v2/tickers/", s.jsonHandler(s.apiTickers, apiV2))
 	serveMux.HandleFunc(path+"api/v2/tickers-list/", s.jsonHandler(s.apiTickersList, apiV2))
 	// socket.io interface
@@ -214,11 +235,21 @@ func (s *PublicServer) OnNewBlock(hash string, height uint32) {
 	s.websocket.OnNewBlock(hash, height)
 }
 
+// OnReorg notifies websocket users subscribed to reorgs and affected addresses about disconnected blocks
+func (s *PublicServer) OnReorg(blocks []bchain.ReorgBlock, txs []bchain.ReorgTx) {
+	s.websocket.OnReorg(blocks, txs)
+}
+
 // OnNewFiatRatesTicker notifies users subscribed to bitcoind/fiatrates about new ticker
 func (s *PublicServer) OnNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
 	s.websocket.OnNewFiatRatesTicker(ticker)
 }
 
+// OnBroadcastStateChange notifies users subscribed to the broadcast queue about the new state of the transaction
+func (s *PublicServer) OnBroadcastStateChange(tx *db.BroadcastTx) {
+	s.websocket.OnBroadcastStateChange(tx)
+}
+
 // OnNewTxAddr notifies users subscribed to notification about new tx
 func (s *PublicServer) OnNewTxAddr(tx *bchain.Tx, desc bchain.AddressDescriptor) {
 	s.socketio.OnNewTxAddr(tx.Txid, desc)
@@ -229,6 +260,11 @@ func (s *PublicServer) OnNewTx(tx *bchain.MempoolTx) {
 	s.websocket.OnNewTx(tx)
 }
 
+// OnMempoolResync notifies users subscribed to tracking of transactions about changes after the mempool resync
+func (s *PublicServer) OnMempoolResync() {
+	s.websocket.OnMempoolResync()
+}
+
 func (s *PublicServer) txRedirect(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, joinURL(s.explorerURL, r.URL.Path), 302)
 	s.metrics.ExplorerViews.With(common.Labels{"action": "tx-redirect"}).Inc()
@@ -267,6 +303,30 @@ func getFunctionName(i interface{}) string {
 	return name
 }
 
+// ServeHTTP authorizes the request and checks the rate limit of its client before passing it to the handlers
+// the websocket connections are authorized and limited by the websocket server, the static files are not limited
+func (s *PublicServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.apiAccess != nil {
+		p := strings.TrimPrefix(r.URL.Path, s.path)
+		if p != "websocket" && p != "favicon.ico" && !strings.HasPrefix(p, "static/") {
+			if err := s.apiAccess.CheckRESTRequest(r); err != nil {
+				httpStatus := err.(*apiAccessError).httpStatus
+				if strings.HasPrefix(p, "api/") {
+					w.Header().Set("Content-Type", "application/json; charset=utf-8")
+					w.WriteHeader(httpStatus)
+					json.NewEncoder(w).Encode(struct {
+						Text string `json:"error"`
+					}{err.Error()})
+				} else {
+					http.Error(w, err.Error(), httpStatus)
+				}
+				return
+			}
+		}
+	}
+	s.serveMux.ServeHTTP(w, r)
+}
+
 func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int) (interface{}, error), apiVersion int) func(w http.ResponseWriter, r *http.Request) {
 	type jsonError struct {
 		Text       string `json:"error"`
@@ -675,6 +735,7 @@ func (s *PublicServer) getAddressQueryParams(r *http.Request, accountDetails api
 		FromHeight:     uint32(from),
 		ToHeight:       uint32(to),
 		Contract:       contract,
+		Currency:       r.URL.Query().Get("currency"),
 	}, filterParam, gap
 }
 
@@ -836,7 +897,7 @@ func (s *PublicServer) explorerSendTx(w http.ResponseWriter, r *http.Request) (t
 		}
 		hex := r.FormValue("hex")
 		if len(hex) > 0 {
-			res, err := s.chain.SendRawTransaction(hex)
+			res, err := s.api.SendRawTransaction(hex)
 			if err != nil {
 				data.SendTxHex = hex
 				data.Error = &api.APIError{Text: err.Error(), Public: true}
@@ -980,6 +1041,9 @@ func (s *PublicServer) apiTx(r *http.Request, apiVersion int) (interface{}, erro
 	if err == nil && apiVersion == apiV1 {
 		return s.api.TxToV1(tx), nil
 	}
+	if err == nil {
+		s.api.SetTxFiatValue(tx, r.URL.Query().Get("currency"))
+	}
 	return tx, err
 }
 
@@ -1112,13 +1176,183 @@ func (s *PublicServer) apiBalanceHistory(r *http.Request, apiVersion int) (inter
 		if err == nil {
 			s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-balancehistory"}).Inc()
 		} else {
-			history, err = s.api.GetBalanceHistory(r.URL.Path[i+1:], fromTimestamp, toTimestamp, fiatArray, uint32(groupBy))
+			history, err = s.api.GetBalanceHistory(r.URL.Path[i+1:], fromTimestamp, toTimestamp, fiatArray, uint32(groupBy), r.URL.Query().Get("contract"))
 			s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-balancehistory"}).Inc()
 		}
 	}
 	return history, err
 }
 
+// apiExport streams the confirmed transactions of an address or xpub in csv or json, the rows are written as they are loaded
+func (s *PublicServer) apiExport(w http.ResponseWriter, r *http.Request) {
+	s.metrics.ExplorerPendingRequests.With((common.Labels{"method": "apiExport"})).Inc()
+	defer s.metrics.ExplorerPendingRequests.With((common.Labels{"method": "apiExport"})).Dec()
+	writeError := func(text string, httpStatus int) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(httpStatus)
+		json.NewEncoder(w).Encode(struct {
+			Text string `json:"error"`
+		}{text})
+	}
+	var account string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		account = r.URL.Path[i+1:]
+	}
+	if len(account) == 0 {
+		writeError("Missing address or xpub", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		writeError(fmt.Sprintf("Unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+	var params api.ExportParams
+	var err error
+	if from := q.Get("from"); from != "" {
+		if params.FromTimestamp, err = strconv.ParseInt(from, 10, 64); err != nil {
+			writeError("Invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if params.ToTimestamp, err = strconv.ParseInt(to, 10, 64); err != nil {
+			writeError("Invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	params.Currency = q.Get("currency")
+	params.CostBasis, _ = strconv.ParseBool(q.Get("costbasis"))
+	params.Gap, _ = strconv.Atoi(q.Get("gap"))
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-export"}).Inc()
+	// the header is written with the first row, until then the errors can be returned with the error status
+	started := false
+	var cw *csv.Writer
+	start := func() {
+		started = true
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename=\"export.csv\"")
+			cw = csv.NewWriter(w)
+			header := []string{"txid", "blockHeight", "blockTime", "netAmount", "fee", "counterparties", "balance"}
+			if params.Currency != "" {
+				header = append(header, "fiatRate", "fiatValue")
+				if params.CostBasis {
+					header = append(header, "costBasis", "proceeds", "realizedGain")
+				}
+			}
+			cw.Write(header)
+		} else {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte("["))
+		}
+	}
+	rows := 0
+	err = s.api.ExportTxs(account, &params, func(row *api.ExportRow) error {
+		if !started {
+			start()
+		}
+		if format == "json" {
+			b, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if rows > 0 {
+				w.Write([]byte(","))
+			}
+			w.Write([]byte("\n"))
+			_, err = w.Write(b)
+			rows++
+			return err
+		}
+		rows++
+		return cw.Write(exportRowToCSV(row, &params))
+	})
+	if err != nil {
+		if !started {
+			if apiErr, ok := err.(*api.APIError); ok && apiErr.Public {
+				writeError(apiErr.Error(), http.StatusBadRequest)
+			} else {
+				glog.Error("apiExport error: ", err)
+				writeError("Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		// the response is already partially sent, it is not possible to change the status
+		glog.Error("apiExport error: ", err)
+	}
+	if !started {
+		start()
+	}
+	if format == "json" {
+		w.Write([]byte("\n]\n"))
+	} else {
+		cw.Flush()
+	}
+}
+
+func exportRowToCSV(row *api.ExportRow, params *api.ExportParams) []string {
+	record := []string{
+		row.Txid,
+		strconv.Itoa(row.BlockHeight),
+		strconv.FormatInt(row.BlockTime, 10),
+		row.NetAmount.String(),
+		row.Fee.String(),
+		strings.Join(row.Counterparties, " "),
+		row.Balance.String(),
+	}
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if params.Currency != "" {
+		// unknown rates are exported as empty values
+		if row.FiatValue != nil && row.FiatValue.Rate >= 0 {
+			record = append(record, formatFloat(row.FiatValue.Rate), formatFloat(row.FiatValue.Value))
+		} else {
+			record = append(record, "", "")
+		}
+		if params.CostBasis {
+			if row.RealizedGain != nil {
+				record = append(record, formatFloat(row.RealizedGain.CostBasis), formatFloat(row.RealizedGain.Proceeds), formatFloat(row.RealizedGain.Gain))
+			} else {
+				record = append(record, "", "", "")
+			}
+		}
+	}
+	return record
+}
+
+func (s *PublicServer) apiContractLogs(r *http.Request, apiVersion int) (interface{}, error) {
+	var from, to uint64
+	var err error
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-logs"}).Inc()
+	page, ec := strconv.Atoi(r.URL.Query().Get("page"))
+	if ec != nil {
+		page = 0
+	}
+	pageSize, ec := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if ec != nil || pageSize <= 0 || pageSize > txsInAPI {
+		pageSize = txsInAPI
+	}
+	if f := r.URL.Query().Get("from"); f != "" {
+		from, err = strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return nil, api.NewAPIError("Invalid from", true)
+		}
+	}
+	if t := r.URL.Query().Get("to"); t != "" {
+		to, err = strconv.ParseUint(t, 10, 32)
+		if err != nil {
+			return nil, api.NewAPIError("Invalid to", true)
+		}
+	}
+	return s.api.GetContractLogs(r.URL.Query().Get("contract"), r.URL.Query().Get("topic0"), page, pageSize, uint32(from), uint32(to))
+}
+
 func (s *PublicServer) apiBlock(r *http.Request, apiVersion int) (interface{}, error) {
 	var block *api.Block
 	var err error
@@ -1167,7 +1401,7 @@ func (s *PublicServer) apiSendTx(r *http.Request, apiVersion int) (interface{},
 		}
 	}
 	if len(hex) > 0 {
-		res.Result, err = s.chain.SendRawTransaction(hex)
+		res.Result, err = s.api.SendRawTransaction(hex)
 		if err != nil {
 			return nil, api.NewAPIError(err.Error(), true)
 		}
@@ -1176,6 +1410,83 @@ func (s *PublicServer) apiSendTx(r *http.Request, apiVersion int) (interface{},
 	return nil, api.NewAPIError("Missing tx blob", true)
 }
 
+// apiBroadcast returns the state of the transaction sent through the broadcast queue
+func (s *PublicServer) apiBroadcast(r *http.Request, apiVersion int) (interface{}, error) {
+	var txid string
+	i := strings.LastIndexByte(r.URL.Path, '/')
+	if i > 0 {
+		txid = r.URL.Path[i+1:]
+	}
+	if len(txid) == 0 {
+		return nil, api.NewAPIError("Missing txid", true)
+	}
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-broadcast"}).Inc()
+	return s.api.GetBroadcast(txid)
+}
+
+// apiDecodeTx returns the preview of a raw transaction with the warnings about its possible problems, without sending it
+func (s *PublicServer) apiDecodeTx(r *http.Request, apiVersion int) (interface{}, error) {
+	var hex string
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-decodetx"}).Inc()
+	if r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, api.NewAPIError("Missing tx blob", true)
+		}
+		hex = string(data)
+	} else {
+		if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+			hex = r.URL.Path[i+1:]
+		}
+	}
+	if len(hex) == 0 {
+		return nil, api.NewAPIError("Missing tx blob", true)
+	}
+	testMempoolAccept, _ := strconv.ParseBool(r.URL.Query().Get("testmempoolaccept"))
+	return s.api.DecodeTx(hex, testMempoolAccept)
+}
+
+// apiAnalyzePsbt returns the analysis of the PSBT sent in the body of the POST request, optionally finalizes and broadcasts it
+func (s *PublicServer) apiAnalyzePsbt(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-psbt-analyze"}).Inc()
+	if r.Method != http.MethodPost {
+		return nil, api.NewAPIError("Use POST with PSBT in the body", true)
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil || len(data) == 0 {
+		return nil, api.NewAPIError("Missing PSBT", true)
+	}
+	finalize, _ := strconv.ParseBool(r.URL.Query().Get("finalize"))
+	broadcast, _ := strconv.ParseBool(r.URL.Query().Get("broadcast"))
+	return s.api.AnalyzePsbt(string(data), finalize, broadcast)
+}
+
+// apiCoinSelect returns the utxos of the xpub selected to pay the amount with the fee rate
+func (s *PublicServer) apiCoinSelect(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-coinselect"}).Inc()
+	i := strings.LastIndexByte(r.URL.Path, '/')
+	if i < 0 || i+1 == len(r.URL.Path) {
+		return nil, api.NewAPIError("Missing xpub", true)
+	}
+	q := r.URL.Query()
+	var params api.CoinSelectionParams
+	if _, ok := params.Amount.SetString(q.Get("amount"), 10); !ok {
+		return nil, api.NewAPIError("Parameter 'amount' is not a valid number", true)
+	}
+	var err error
+	params.FeeRate, err = strconv.ParseFloat(q.Get("feeRate"), 64)
+	if err != nil {
+		return nil, api.NewAPIError("Parameter 'feeRate' is not a valid number", true)
+	}
+	params.Strategy = q.Get("strategy")
+	params.Unconfirmed = q.Get("unconfirmed")
+	params.Gap, err = strconv.Atoi(q.Get("gap"))
+	if err != nil {
+		params.Gap = 0
+	}
+	return s.api.SelectXpubCoins(r.URL.Path[i+1:], &params)
+}
+
 // apiTickersList returns a list of available FiatRates currencies
 func (s *PublicServer) apiTickersList(r *http.Request, apiVersion int) (interface{}, error) {
 	s.metrics.ExplorerViews.With(common.Labels{"action": "api-tickers-list"}).Inc()
@@ -1198,11 +1509,12 @@ func (s *PublicServer) apiTickers(r *http.Request, apiVersion int) (interface{},
 	if currency != "" {
 		currencies = []string{currency}
 	}
+	token := r.URL.Query().Get("token")
 
 	if block := r.URL.Query().Get("block"); block != "" {
 		// Get tickers for specified block height or block hash
 		s.metrics.ExplorerViews.With(common.Labels{"action": "api-tickers-block"}).Inc()
-		result, err = s.api.GetFiatRatesForBlockID(block, currencies)
+		result, err = s.api.GetFiatRatesForBlockID(block, currencies, token)
 	} else if timestampString := r.URL.Query().Get("timestamp"); timestampString != "" {
 		// Get tickers for specified timestamp
 		s.metrics.ExplorerViews.With(common.Labels{"action": "api-tickers-date"}).Inc()
@@ -1212,7 +1524,7 @@ func (s *PublicServer) apiTickers(r *http.Request, apiVersion int) (interface{},
 			return nil, api.NewAPIError("Parameter \"timestamp\" is not a valid Unix timestamp.", true)
 		}
 
-		resultTickers, err := s.api.GetFiatRatesForTimestamps([]int64{timestamp}, currencies)
+		resultTickers, err := s.api.GetFiatRatesForTimestamps([]int64{timestamp}, currencies, token)
 		if err != nil {
 			return nil, err
 		}
@@ -1220,7 +1532,7 @@ func (s *PublicServer) apiTickers(r *http.Request, apiVersion int) (interface{},
 	} else {
 		// No parameters - get the latest available ticker
 		s.metrics.ExplorerViews.With(common.Labels{"action": "api-tickers-last"}).Inc()
-		result, err = s.api.GetCurrentFiatRates(currencies)
+		result, err = s.api.GetCurrentFiatRates(currencies, token)
 	}
 	if err != nil {
 		return nil, err
@@ -3,14 +3,17 @@
 package server
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,6 +22,7 @@ import (
 	"github.com/martinboehm/btcutil/chaincfg"
 	gosocketio "github.com/martinboehm/golang-socketio"
 	"github.com/martinboehm/golang-socketio/transport"
+	"github.com/trezor/blockbook/api"
 	"github.com/trezor/blockbook/bchain"
 	"github.com/trezor/blockbook/bchain/coins/btc"
 	"github.com/trezor/blockbook/common"
@@ -108,8 +112,13 @@ func setupPublicHTTPServer(t *testing.T) (*PublicServer, string) {
 		glog.Fatal("txCache: ", err)
 	}
 
+	broadcastQueue, err := db.NewBroadcastQueue(d, chain, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// s.Run is never called, binding can be to any port
-	s, err := NewPublicServer("localhost:12345", "", d, chain, mempool, txCache, "", metrics, is, false, false)
+	s, err := NewPublicServer("localhost:12345", "", d, chain, mempool, txCache, "", metrics, is, false, false, nil, nil, broadcastQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -491,6 +500,15 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"txid":"05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","vin":[{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vout":2,"n":0,"addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true,"value":"9876"}],"vout":[{"value":"9000","n":0,"hex":"a914e921fc4912a315078f370d959f2c4f7b6d2a683c87","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true}],"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,"confirmations":1,"blockTime":1521595678,"value":"9000","valueIn":"9876","fees":"876"}`,
 			},
 		},
+		{
+			name:        "apiTx v2 currency=eur",
+			r:           newGetRequest(ts.URL + "/api/v2/tx/05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07?currency=EUR"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"blockTime":1521595678,"value":"9000","valueIn":"9876","fees":"876","fiatValue":{"currency":"eur","rate":1303,"value":0.11727000000000001}}`,
+			},
+		},
 		{
 			name:        "apiTx - not found v2",
 			r:           newGetRequest(ts.URL + "/api/v2/tx/1232e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07"),
@@ -653,6 +671,17 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2}`,
 			},
 		},
+		{
+			name:        "apiAddress v2 details=txslight&currency=usd",
+			r:           newGetRequest(ts.URL + "/api/v2/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?details=txslight&currency=usd"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25",`,
+				`"blockTime":1521595678,"value":"1234567902122","valueIn":"1234567902468","fees":"346","fiatValue":{"currency":"usd","rate":2003,"value":-24728394.83916369}}`,
+				`"blockTime":1521515026,"value":"1234567900000","valueIn":"0","fees":"0","fiatValue":{"currency":"usd","rate":2002,"value":24716049.160262458}}`,
+			},
+		},
 		{
 			name:        "apiAddress v2 details=txs",
 			r:           newGetRequest(ts.URL + "/api/v2/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?details=txs"),
@@ -725,6 +754,17 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"address":"upub5E1xjDmZ7Hhej6LPpS8duATdKXnRYui7bDYj6ehfFGzWDZtmCmQkZhc3Zb7kgRLtHWd16QFxyP86JKL3ShZEBFX88aciJ3xyocuyhZZ8g6q","balance":"118641975500","totalReceived":"118641975501","totalSent":"1","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":3,"usedTokens":2,"tokens":[{"type":"XPUBAddress","name":"2N6utyMZfPNUb1Bk8oz7p2JqJrXkq83gegu","path":"m/49'/1'/33'/1/3","transfers":1,"decimals":8,"balance":"118641975500","totalReceived":"118641975500","totalSent":"0"}]}`,
 			},
 		},
+		{
+			name:        "apiXpub v2 details=txslight&currency=usd",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "?details=txslight&currency=usd"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71"`,
+				`"fees":"62","fiatValue":{"currency":"usd","rate":2003,"value":2376398.76924497}}`,
+				`"fees":"0","fiatValue":{"currency":"usd","rate":2002,"value":0.00002002}}`,
+			},
+		},
 		{
 			name:        "apiXpub v2 details=txs&tokens=derived&gap=5&from=225494&to=225494&pageSize=3",
 			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "?details=txs&tokens=derived&gap=5&from=225494&to=225494&pageSize=3"),
@@ -779,6 +819,176 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`[{"time":1521514800,"txs":1,"received":"24690","sent":"0","sentToSelf":"0","rates":{"eur":1301,"usd":2001}},{"time":1521594000,"txs":1,"received":"0","sent":"12345","sentToSelf":"0","rates":{"eur":1303,"usd":2003}}]`,
 			},
 		},
+		{
+			name:        "apiDecodeTx warnings",
+			r:           newGetRequest(ts.URL + "/api/v2/decodetx/0200000003071b23c43f89bc9dbf22b5a7abc2134730ba56d7487bef5db7d9bdea8ae4e2050000000000fdffffff75acb49486d6bb2240fdbef2a421f5fb8e4c43bff58a1c6b533d3809f59efdef0100000000fdffffff11111111111111111111111111111111111111111111111111111111111111110000000000fdffffff0264000000000000001976a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac881300000000000017a914e921fc4912a315078f370d959f2c4f7b6d2a683c8700000000"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"blockHeight":-1,"confirmations":0,"blockTime":0,"size":199,"value":"5100","hex":"0200000003071b23c43f89bc9dbf22b5a7abc2134730ba56d7487bef5db7d9bdea8ae4e2050000000000fdffffff75acb49486d6bb2240fdbef2a421f5fb8e4c43bff58a1c6b533d3809f59efdef0100000000fdffffff11111111111111111111111111111111111111111111111111111111111111110000000000fdffffff0264000000000000001976a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac881300000000000017a914e921fc4912a315078f370d959f2c4f7b6d2a683c8700000000","rbf":true,"vsize":199,"warnings":[{"type":"spentInput","n":1,"message":"Input 1 spends already spent output effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75:1"},{"type":"missingInput","n":2,"message":"Input 2 spends unknown output 1111111111111111111111111111111111111111111111111111111111111111:0"},{"type":"dust","n":0,"message":"Output 0 value 100 is below the dust threshold 546"}]}`,
+			},
+		},
+		{
+			name:        "apiDecodeTx POST testmempoolaccept=true",
+			r:           newPostRequest(ts.URL+"/api/v2/decodetx/?testmempoolaccept=true", "0200000001071b23c43f89bc9dbf22b5a7abc2134730ba56d7487bef5db7d9bdea8ae4e2050000000000fdffffff01401f0000000000001976a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac00000000"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"0d5187819d6071344f23f266be934adac8097ac3a22b2bcc40098f29bfa07149","version":2,"vin":[{"txid":"05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","sequence":4294967293,"n":0,"addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true,"value":"9000"}]`,
+				`"size":85,"value":"8000","valueIn":"9000","fees":"1000"`,
+				`"rbf":true,"vsize":85,"feeRate":11.764705882352942,"mempoolAccept":{"allowed":false,"rejectReason":"missing-inputs"}}`,
+			},
+		},
+		{
+			name:        "apiDecodeTx invalid",
+			r:           newGetRequest(ts.URL + "/api/v2/decodetx/0200"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid transaction, unexpected EOF"}`,
+			},
+		},
+		{
+			name:        "apiAnalyzePsbt",
+			r:           newPostRequest(ts.URL+"/api/v2/psbt/analyze", "cHNidP8BAH4CAAAAAgcbI8Q/ibydvyK1p6vCE0cwulbXSHvvXbfZveqK5OIFAAAAAAD/////day0lIbWuyJA/b7ypCH1+45MQ7/1ihxrUz04CfWe/e8BAAAAAP////8BQB8AAAAAAAAZdqkUP4uj/aO6e2n1gYCG4SIjxt0l48iIrAAAAAAAIgICIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIJMAYCAQECAQEBAQQWABQREREREREREREREREREREREREREQAAAA=="),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"psbt":"cHNidP8BAH4CAAAAAgcbI8Q/ibydvyK1p6vCE0cwulbXSHvvXbfZveqK5OIFAAAAAAD/////day0lIbWuyJA/b7ypCH1+45MQ7/1ihxrUz04CfWe/e8BAAAAAP////8BQB8AAAAAAAAZdqkUP4uj/aO6e2n1gYCG4SIjxt0l48iIrAAAAAAAAQEgKCMAAAAAAAAXqRTpIfxJEqMVB483DZWfLE97bSpoPIciAgIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIgkwBgIBAQIBAQEBBBYAFBERERERERERERERERERERERERERAAAA","inputs":[{"n":0,"txid":"05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","vout":0,"value":"9000","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true,"nonWitnessUtxo":false,"witnessUtxo":true,"partialSigs":1,"requiredSigs":1,"status":"signed"},{"n":1,"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vout":1,"value":"1","addresses":["2MzmAKayJmja784jyHvRUW1bXPget1csRRG"],"isAddress":true,"spent":true,"nonWitnessUtxo":false,"witnessUtxo":false,"partialSigs":0,"requiredSigs":0,"status":"unsigned"}],"valueIn":"9001","value":"8000","fees":"1001","spentInputs":[1],"complete":false}`,
+			},
+		},
+		{
+			name:        "apiAnalyzePsbt finalize=true",
+			r:           newPostRequest(ts.URL+"/api/v2/psbt/analyze?finalize=true", "cHNidP8BAFUCAAAAAQcbI8Q/ibydvyK1p6vCE0cwulbXSHvvXbfZveqK5OIFAAAAAAD/////AUAfAAAAAAAAGXapFD+Lo/2juntp9YGAhuEiI8bdJePIiKwAAAAAACICAiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiCTAGAgEBAgEBAQEEFgAUEREREREREREREREREREREREREREAAA=="),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"psbt":"cHNidP8BAFUCAAAAAQcbI8Q/ibydvyK1p6vCE0cwulbXSHvvXbfZveqK5OIFAAAAAAD/////AUAfAAAAAAAAGXapFD+Lo/2juntp9YGAhuEiI8bdJePIiKwAAAAAAAEBICgjAAAAAAAAF6kU6SH8SRKjFQePNw2VnyxPe20qaDyHAQcXFgAUEREREREREREREREREREREREREREBCC0CCTAGAgEBAgEBASECIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIAAA==","inputs":[{"n":0,"txid":"05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","vout":0,"value":"9000","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true,"nonWitnessUtxo":false,"witnessUtxo":true,"partialSigs":1,"requiredSigs":1,"status":"finalized"}],"valueIn":"9000","value":"8000","fees":"1000","complete":true,"hex":"02000000000101071b23c43f89bc9dbf22b5a7abc2134730ba56d7487bef5db7d9bdea8ae4e20500000000171600141111111111111111111111111111111111111111ffffffff01401f0000000000001976a9143f8ba3fda3ba7b69f5818086e12223c6dd25e3c888ac02093006020101020101012102222222222222222222222222222222222222222222222222222222222222222200000000","txid":"3d3e447070daf4a57a67c2fff17ab6beb83d7e99726205e87ca91f36997d3bb6"}`,
+			},
+		},
+		{
+			name:        "apiAnalyzePsbt broadcast=true",
+			r:           newPostRequest(ts.URL+"/api/v2/psbt/analyze?broadcast=true", "cHNidP8BAFUCAAAAAQcbI8Q/ibydvyK1p6vCE0cwulbXSHvvXbfZveqK5OIFAAAAAAD/////AUAfAAAAAAAAGXapFD+Lo/2juntp9YGAhuEiI8bdJePIiKwAAAAAACICAiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiCTAGAgEBAgEBAQEEFgAUEREREREREREREREREREREREREREAAA=="),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid data"}`,
+			},
+		},
+		{
+			name:        "apiAnalyzePsbt not fully signed finalize=true",
+			r:           newPostRequest(ts.URL+"/api/v2/psbt/analyze?finalize=true", "cHNidP8BAH4CAAAAAgcbI8Q/ibydvyK1p6vCE0cwulbXSHvvXbfZveqK5OIFAAAAAAD/////day0lIbWuyJA/b7ypCH1+45MQ7/1ihxrUz04CfWe/e8BAAAAAP////8BQB8AAAAAAAAZdqkUP4uj/aO6e2n1gYCG4SIjxt0l48iIrAAAAAAAIgICIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIiIJMAYCAQECAQEBAQQWABQREREREREREREREREREREREREREQAAAA=="),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"PSBT is not fully signed"}`,
+			},
+		},
+		{
+			name:        "apiAnalyzePsbt invalid",
+			r:           newPostRequest(ts.URL+"/api/v2/psbt/analyze", "cHNidP8BAA=="),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid PSBT, global map: EOF"}`,
+			},
+		},
+		{
+			name:        "apiCoinSelect bnb fallback to largest",
+			r:           newGetRequest(ts.URL + "/api/v2/coinselect/" + dbtestdata.Xpub + "?amount=100000000&feeRate=10"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"strategy":"largest","inputs":[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"118641975500","height":225494,"confirmations":1,"address":"2N6utyMZfPNUb1Bk8oz7p2JqJrXkq83gegu","path":"m/49'/1'/33'/1/3"}],"valueIn":"118641975500","amount":"100000000","fees":"1660","feeRate":10,"vsize":166,"change":"118541973840","changeAddress":"2MzSBtRWHbBjeUcu3H5VRDqkvz5sfmDxJKo","changePath":"m/49'/1'/33'/1/0"}`,
+			},
+		},
+		{
+			name:        "apiCoinSelect bnb without change",
+			r:           newGetRequest(ts.URL + "/api/v2/coinselect/" + dbtestdata.Xpub + "?amount=118641974160&feeRate=10&strategy=bnb"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"strategy":"bnb","inputs":[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"118641975500","height":225494,"confirmations":1,"address":"2N6utyMZfPNUb1Bk8oz7p2JqJrXkq83gegu","path":"m/49'/1'/33'/1/3"}],"valueIn":"118641975500","amount":"118641974160","fees":"1340","feeRate":10,"vsize":134}`,
+			},
+		},
+		{
+			name:        "apiCoinSelect privacy unconfirmed=all",
+			r:           newGetRequest(ts.URL + "/api/v2/coinselect/" + dbtestdata.Xpub + "?amount=100000000&feeRate=2.5&strategy=privacy&unconfirmed=all"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"strategy":"privacy","inputs":[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"118641975500","height":225494,"confirmations":1,"address":"2N6utyMZfPNUb1Bk8oz7p2JqJrXkq83gegu","path":"m/49'/1'/33'/1/3"}],"valueIn":"118641975500","amount":"100000000","fees":"416","feeRate":2.5,"vsize":166,"change":"118541975084","changeAddress":"2MzSBtRWHbBjeUcu3H5VRDqkvz5sfmDxJKo","changePath":"m/49'/1'/33'/1/0"}`,
+			},
+		},
+		{
+			name:        "apiCoinSelect insufficient funds",
+			r:           newGetRequest(ts.URL + "/api/v2/coinselect/" + dbtestdata.Xpub + "?amount=118641974161&feeRate=10"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Insufficient funds"}`,
+			},
+		},
+		{
+			name:        "apiCoinSelect unknown strategy",
+			r:           newGetRequest(ts.URL + "/api/v2/coinselect/" + dbtestdata.Xpub + "?amount=1000&feeRate=10&strategy=random"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Unknown strategy random"}`,
+			},
+		},
+		{
+			name:        "apiExport Addr2 csv currency=usd&costbasis=true",
+			r:           newGetRequest(ts.URL + "/api/v2/export/mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz?currency=usd&costbasis=true"),
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: []string{
+				"txid,blockHeight,blockTime,netAmount,fee,counterparties,balance,fiatRate,fiatValue,costBasis,proceeds,realizedGain\n" +
+					"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840,225493,1521515026,24690,0,,24690,2002,0.49429379999999995,,,\n" +
+					"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25,225494,1521595678,-12345,346,mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL,12345,2003,-0.24727034999999997,0.24714689999999997,0.24727034999999997,0.00012344999999999717\n",
+			},
+		},
+		{
+			name:        "apiExport Addr2 csv from=1521595678&currency=usd&costbasis=true",
+			r:           newGetRequest(ts.URL + "/api/v2/export/mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz?from=1521595678&currency=usd&costbasis=true"),
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: []string{
+				"txid,blockHeight,blockTime,netAmount,fee,counterparties,balance,fiatRate,fiatValue,costBasis,proceeds,realizedGain\n" +
+					"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25,225494,1521595678,-12345,346,mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL,12345,2003,-0.24727034999999997,0.24714689999999997,0.24727034999999997,0.00012344999999999717\n",
+			},
+		},
+		{
+			name:        "apiExport Addr2 csv from=1521595678",
+			r:           newGetRequest(ts.URL + "/api/v2/export/mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz?from=1521595678"),
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: []string{
+				"txid,blockHeight,blockTime,netAmount,fee,counterparties,balance\n" +
+					"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25,225494,1521595678,-12345,346,mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL,12345\n",
+			},
+		},
+		{
+			name:        "apiExport Xpub json from=1521595678",
+			r:           newGetRequest(ts.URL + "/api/v2/export/" + dbtestdata.Xpub + "?format=json&from=1521595678&currency=usd"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[
+{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","blockHeight":225494,"blockTime":1521595678,"netAmount":"118641975499","fee":"62","counterparties":["mmJx9Y8ayz9h14yd9fgCW1bUKoEpkBAquP"],"balance":"118641975500","fiatValue":{"currency":"usd","rate":2003,"value":2376398.76924497}}
+]`,
+			},
+		},
+		{
+			name:        "apiExport costbasis without currency",
+			r:           newGetRequest(ts.URL + "/api/v2/export/mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz?costbasis=true"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Cost basis requires currency"}`,
+			},
+		},
 		{
 			name:        "apiBalanceHistory Addr5 v2",
 			r:           newGetRequest(ts.URL + "/api/v2/balancehistory/2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"),
@@ -860,6 +1070,25 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"result":"9876"}`,
 			},
 		},
+		{
+			name:        "apiBroadcast",
+			r:           newGetRequest(ts.URL + "/api/v2/broadcasts/9876"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"9876","hex":"123456","state":"pending",`,
+				`"attempts":1,`,
+			},
+		},
+		{
+			name:        "apiBroadcast not found",
+			r:           newGetRequest(ts.URL + "/api/v2/broadcasts/1234"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Broadcast not found"}`,
+			},
+		},
 		{
 			name:        "apiSendTx POST empty",
 			r:           newPostRequest(ts.URL+"/api/v2/sendtx", ""),
@@ -1449,6 +1678,115 @@ func websocketTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 			},
 			want: `{"id":"39","data":{"subscribed":false,"message":"unsubscribeNewTransaction not enabled, use -enablesubnewtx flag to enable."}}`,
 		},
+		{
+			name: "websocket subscribeReorgs",
+			req: websocketReq{
+				Method: "subscribeReorgs",
+			},
+			want: `{"id":"40","data":{"subscribed":true}}`,
+		},
+		{
+			name: "websocket unsubscribeReorgs",
+			req: websocketReq{
+				Method: "unsubscribeReorgs",
+			},
+			want: `{"id":"41","data":{"subscribed":false}}`,
+		},
+		{
+			name: "websocket subscribeAccounts",
+			req: websocketReq{
+				Method: "subscribeAccounts",
+				Params: map[string]interface{}{
+					"accounts": []string{dbtestdata.Xpub},
+					"gap":      5,
+				},
+			},
+			want: `{"id":"42","data":{"subscribed":true}}`,
+		},
+		{
+			name: "websocket subscribeAccounts invalid xpub",
+			req: websocketReq{
+				Method: "subscribeAccounts",
+				Params: map[string]interface{}{
+					"accounts": []string{"invalid"},
+				},
+			},
+			want: `{"id":"43","data":{"error":{"message":"bad extended key checksum"}}}`,
+		},
+		{
+			name: "websocket unsubscribeAccounts",
+			req: websocketReq{
+				Method: "unsubscribeAccounts",
+			},
+			want: `{"id":"44","data":{"subscribed":false}}`,
+		},
+		{
+			name: "websocket subscribeTransaction",
+			req: websocketReq{
+				Method: "subscribeTransaction",
+				Params: map[string]interface{}{
+					"txid":          dbtestdata.TxidB2T1,
+					"confirmations": 6,
+				},
+			},
+			want: `{"id":"45","data":{"subscribed":true,"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","status":"confirmed","confirmations":1,"blockHeight":225494,"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6"}}`,
+		},
+		{
+			name: "websocket subscribeTransaction completed",
+			req: websocketReq{
+				Method: "subscribeTransaction",
+				Params: map[string]interface{}{
+					"txid": dbtestdata.TxidB2T1,
+				},
+			},
+			want: `{"id":"46","data":{"subscribed":false,"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","status":"confirmed","confirmations":1,"blockHeight":225494,"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","completed":true}}`,
+		},
+		{
+			name: "websocket subscribeTransaction not found",
+			req: websocketReq{
+				Method: "subscribeTransaction",
+				Params: map[string]interface{}{
+					"txid":          "1234567890123456789012345678901234567890123456789012345678901234",
+					"confirmations": 3,
+				},
+			},
+			want: `{"id":"47","data":{"subscribed":true,"txid":"1234567890123456789012345678901234567890123456789012345678901234","status":"notFound","confirmations":0}}`,
+		},
+		{
+			name: "websocket unsubscribeTransaction",
+			req: websocketReq{
+				Method: "unsubscribeTransaction",
+				Params: map[string]interface{}{
+					"txid": "1234567890123456789012345678901234567890123456789012345678901234",
+				},
+			},
+			want: `{"id":"48","data":{"subscribed":false}}`,
+		},
+		{
+			name: "websocket subscribeBroadcasts",
+			req: websocketReq{
+				Method: "subscribeBroadcasts",
+				Params: map[string]interface{}{
+					"txids": []string{"9876"},
+				},
+			},
+			want: `{"id":"49","data":{"subscribed":true}}`,
+		},
+		{
+			name: "websocket subscribeBroadcasts missing txids",
+			req: websocketReq{
+				Method: "subscribeBroadcasts",
+				Params: map[string]interface{}{},
+			},
+			want: `{"id":"50","data":{"error":{"message":"Missing txids"}}}`,
+		},
+		{
+			name: "websocket unsubscribeBroadcasts",
+			req: websocketReq{
+				Method: "unsubscribeBroadcasts",
+			},
+			want: `{"id":"51","data":{"subscribed":false}}`,
+		},
 	}
 
 	// send all requests at once
@@ -1498,6 +1836,257 @@ func websocketTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 	}
 }
 
+// reorgTestsBitcoinType checks that the reorg notifications are delivered to the websocket subscribers
+func reorgTestsBitcoinType(t *testing.T, ps *PublicServer, ts *httptest.Server) {
+	url := strings.Replace(ts.URL, "http://", "ws://", 1)
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for _, req := range []string{
+		`{"id":"0","method":"subscribeReorgs"}`,
+		`{"id":"1","method":"subscribeAddresses","params":{"addresses":["` + dbtestdata.Addr9 + `"]}}`,
+	} {
+		if err = ws.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addrDesc, err := ps.chainParser.GetAddrDescFromAddress(dbtestdata.Addr9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removedTxid := "1234567890123456789012345678901234567890123456789012345678901234"
+	ps.OnReorg([]bchain.ReorgBlock{
+		{Hash: "0000000000000000000000000000000000000000000000000000000000225495", Height: 225495},
+	}, []bchain.ReorgTx{
+		{Txid: removedTxid, Height: 225495, AddrDescs: []bchain.AddressDescriptor{addrDesc}},
+	})
+
+	want := map[string]bool{
+		`{"id":"0","data":{"disconnected":[{"hash":"0000000000000000000000000000000000000000000000000000000000225495","height":225495}],"height":225494,"hash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6"}}`: false,
+		`{"id":"1","data":{"address":"` + dbtestdata.Addr9 + `","reorg":{"txid":"` + removedTxid + `","status":"removed","disconnectedHeight":225495}}}`: false,
+	}
+	ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for range want {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal("websocket reorg notification: ", err)
+		}
+		got := strings.TrimSpace(string(message))
+		if _, found := want[got]; !found {
+			t.Errorf("websocket reorg notification: got unexpected %v", got)
+		}
+		want[got] = true
+	}
+	for w, received := range want {
+		if !received {
+			t.Errorf("websocket reorg notification: missing %v", w)
+		}
+	}
+}
+
+func accountTestsBitcoinType(t *testing.T, ps *PublicServer, ts *httptest.Server) {
+	url := strings.Replace(ts.URL, "http://", "ws://", 1)
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err = ws.WriteMessage(websocket.TextMessage, []byte(`{"id":"0","method":"subscribeAccounts","params":{"accounts":["`+dbtestdata.Xpub+`"],"gap":5}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = ws.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := ps.websocket
+	var a *websocketAccount
+	s.accountSubscriptionsLock.Lock()
+	for _, sa := range s.accountSubscriptions {
+		for sac := range sa {
+			a = sac
+		}
+	}
+	s.accountSubscriptionsLock.Unlock()
+	if a == nil {
+		t.Fatal("subscribeAccounts: account not subscribed")
+	}
+	// Addr4 is m/49'/1'/33'/0/0, Addr8 is m/49'/1'/33'/1/3
+	if a.addresses.LastUsed != [2]int{0, 3} || len(a.addresses.Addresses[0]) != 6 || len(a.addresses.Addresses[1]) != 9 {
+		t.Fatalf("subscribeAccounts: got last used %v, %d and %d addresses", a.addresses.LastUsed, len(a.addresses.Addresses[0]), len(a.addresses.Addresses[1]))
+	}
+
+	// extendAccount keeps the gap after the last used address and subscribes the new addresses
+	s.accountSubscriptionsLock.Lock()
+	a.addresses.LastUsed[1] = 5
+	s.extendAccount(a, 1)
+	n := len(a.addresses.Addresses[1])
+	sa := s.accountSubscriptions[string(a.addresses.Addresses[1][n-1])]
+	s.accountSubscriptionsLock.Unlock()
+	if n != 11 {
+		t.Errorf("extendAccount: got %d change addresses, want 11", n)
+	}
+	if aa, ok := sa[a]; !ok || aa != (accountAddress{change: 1, index: 10}) {
+		t.Errorf("extendAccount: got subscription %v %v of the last change address", aa, ok)
+	}
+
+	// a mempool tx paying to the last receive address notifies the account and extends the receive addresses
+	addrDesc := a.addresses.Addresses[0][5]
+	addr, _, err := ps.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.OnNewTx(&bchain.MempoolTx{
+		Txid: "abcdef0000000000000000000000000000000000000000000000000000000001",
+		Vout: []bchain.Vout{
+			{
+				ValueSat:     *big.NewInt(12345),
+				ScriptPubKey: bchain.ScriptPubKey{Hex: hex.EncodeToString(addrDesc)},
+			},
+		},
+	})
+	ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, message, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal("account notification: ", err)
+	}
+	var got struct {
+		ID   string `json:"id"`
+		Data struct {
+			Account   string             `json:"account"`
+			Addresses []accountTxAddress `json:"addresses"`
+			Tx        struct {
+				Txid string `json:"txid"`
+			} `json:"tx"`
+			Balance            string `json:"balance"`
+			UnconfirmedBalance string `json:"unconfirmedBalance"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(message, &got); err != nil {
+		t.Fatal(err)
+	}
+	xa, err := ps.api.GetXpubAddress(dbtestdata.Xpub, 0, 1, api.AccountDetailsBasic, &api.AddressFilter{Vout: api.AddressFilterVoutOff}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "0" || got.Data.Account != dbtestdata.Xpub || got.Data.Tx.Txid != "abcdef0000000000000000000000000000000000000000000000000000000001" {
+		t.Errorf("account notification: got %v", string(message))
+	}
+	if len(got.Data.Addresses) != 1 || got.Data.Addresses[0].Address != addr[0] || got.Data.Addresses[0].Path != "m/49'/1'/33'/0/5" {
+		t.Errorf("account notification: got addresses %v", got.Data.Addresses)
+	}
+	if got.Data.Balance != xa.BalanceSat.String() || got.Data.UnconfirmedBalance != xa.UnconfirmedBalanceSat.String() {
+		t.Errorf("account notification: got balance %v %v, want %v %v", got.Data.Balance, got.Data.UnconfirmedBalance, xa.BalanceSat, xa.UnconfirmedBalanceSat)
+	}
+	// the balances of the addresses are cached until a new block
+	a.balancesLock.Lock()
+	if a.balances == nil || a.balancesNewBlocks != atomic.LoadUint64(&s.newBlocks) {
+		t.Errorf("account notification: balances not cached")
+	}
+	a.balancesLock.Unlock()
+	// the next notification reloads only the affected address, the balance of the account stays the same
+	ps.OnNewTx(&bchain.MempoolTx{
+		Txid: "abcdef0000000000000000000000000000000000000000000000000000000002",
+		Vout: []bchain.Vout{
+			{
+				ValueSat:     *big.NewInt(12345),
+				ScriptPubKey: bchain.ScriptPubKey{Hex: hex.EncodeToString(a.addresses.Addresses[1][0])},
+			},
+		},
+	})
+	ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, message, err = ws.ReadMessage(); err != nil {
+		t.Fatal("account notification: ", err)
+	}
+	if err = json.Unmarshal(message, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Data.Balance != xa.BalanceSat.String() || got.Data.UnconfirmedBalance != xa.UnconfirmedBalanceSat.String() {
+		t.Errorf("account notification from cache: got balance %v %v, want %v %v", got.Data.Balance, got.Data.UnconfirmedBalance, xa.BalanceSat, xa.UnconfirmedBalanceSat)
+	}
+	s.accountSubscriptionsLock.Lock()
+	n = len(a.addresses.Addresses[0])
+	s.accountSubscriptionsLock.Unlock()
+	if n != 11 {
+		t.Errorf("account notification: got %d receive addresses, want 11", n)
+	}
+}
+
+func txSubscriptionTestsBitcoinType(t *testing.T, ps *PublicServer, ts *httptest.Server) {
+	url := strings.Replace(ts.URL, "http://", "ws://", 1)
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	pendingTxid := "feed000000000000000000000000000000000000000000000000000000000001"
+	replacingTxid := "feed000000000000000000000000000000000000000000000000000000000002"
+	for _, req := range []string{
+		`{"id":"0","method":"subscribeTransaction","params":{"txid":"` + dbtestdata.TxidB2T1 + `","confirmations":6}}`,
+		`{"id":"1","method":"subscribeTransaction","params":{"txid":"` + pendingTxid + `"}}`,
+	} {
+		if err = ws.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := ps.websocket
+	getSubscription := func(txid string) *txSubscription {
+		s.transactionSubscriptionsLock.Lock()
+		defer s.transactionSubscriptionsLock.Unlock()
+		for sub := range s.transactionSubscriptions[txid] {
+			return sub
+		}
+		t.Fatal("subscribeTransaction: missing subscription of ", txid)
+		return nil
+	}
+	setPending := func(sub *txSubscription, inputs []string) {
+		s.transactionCheckLock.Lock()
+		defer s.transactionCheckLock.Unlock()
+		sub.status = txStatusData{Txid: sub.txid, Status: txStatusMempool}
+		if inputs != nil {
+			s.transactionSubscriptionsLock.Lock()
+			s.setTxSubscriptionInputs(sub, inputs)
+			s.transactionSubscriptionsLock.Unlock()
+		}
+	}
+	expect := func(name, want string) {
+		ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(name, ": ", err)
+		}
+		if got := strings.TrimSpace(string(message)); got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+
+	// pending -> confirmed, the transaction is found in the txids of the new block
+	setPending(getSubscription(dbtestdata.TxidB2T1), nil)
+	ps.OnNewBlock("00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6", 225494)
+	expect("pending to confirmed", `{"id":"0","data":{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","status":"confirmed","confirmations":1,"blockHeight":225494,"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6"}}`)
+
+	// pending -> replaced, a new mempool transaction spends the same input
+	setPending(getSubscription(pendingTxid), []string{txInputKey(dbtestdata.TxidB1T1, 0)})
+	ps.OnNewTx(&bchain.MempoolTx{
+		Txid: replacingTxid,
+		Vin:  []bchain.MempoolVin{{Vin: bchain.Vin{Txid: dbtestdata.TxidB1T1, Vout: 0}}},
+	})
+	expect("pending to replaced", `{"id":"1","data":{"txid":"`+pendingTxid+`","status":"doubleSpent","confirmations":0,"doubleSpentBy":"`+replacingTxid+`"}}`)
+
+	// pending -> dropped, the transaction disappeared from the mempool, the confirmed transaction is not looked up
+	setPending(getSubscription(pendingTxid), nil)
+	ps.OnMempoolResync()
+	expect("pending to dropped", `{"id":"1","data":{"txid":"`+pendingTxid+`","status":"dropped","confirmations":0}}`)
+}
+
 func Test_PublicServer_BitcoinType(t *testing.T) {
 	s, dbpath := setupPublicHTTPServer(t)
 	defer closeAndDestroyPublicServer(t, s, dbpath)
@@ -1509,4 +2098,8 @@ func Test_PublicServer_BitcoinType(t *testing.T) {
 	httpTestsBitcoinType(t, ts)
 	socketioTestsBitcoinType(t, ts)
 	websocketTestsBitcoinType(t, ts)
+	reorgTestsBitcoinType(t, s, ts)
+	accountTestsBitcoinType(t, s, ts)
+	txSubscriptionTestsBitcoinType(t, s, ts)
+	apiAccessTestsBitcoinType(t, s)
 }
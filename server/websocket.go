@@ -24,6 +24,15 @@ const upgradeFailed = "Upgrade failed: "
 const outChannelSize = 500
 const defaultTimeout = 60 * time.Second
 
+// maximum number of transactions tracked by one connection
+const maxTransactionSubscriptions = 1000
+
+// maximum number of missed events replayed to a resumed subscription, must fit into the out channel
+const maxReplayedEvents = outChannelSize / 2
+
+// size of the queue of the mempool transactions waiting to be written to the event log
+const newTxEventsQueueSize = 10000
+
 // allRates is a special "currency" parameter that means all available currencies
 const allFiatRates = "!ALL!"
 
@@ -54,10 +63,25 @@ type websocketChannel struct {
 	alive         bool
 	aliveLock     sync.Mutex
 	addrDescs     []string // subscribed address descriptors as strings
+	accounts      []*websocketAccount
+	client        *apiClient
+	subscriptions map[string]int             // number of subscribed items by method, counted to the limit of the client
+	transactions  map[string]*txSubscription // tracked transactions by txid
+	broadcasts    []string                   // txids of the subscribed transactions of the broadcast queue
+	// events up to these sequence numbers were replayed when the subscriptions were resumed
+	newBlockResumeSeq uint64
+	addrResumeSeq     uint64
+	// while the address events are being replayed, the new address notifications are held back in addrPending
+	// both fields are guarded by addressSubscriptionsLock
+	addrReplays int
+	addrPending []*websocketRes
 }
 
 // WebsocketServer is a handle to websocket server
 type WebsocketServer struct {
+	// the number of the new blocks, the cached balances of the accounts are reloaded after a new block
+	// it is the first field to be 64-bit aligned for the atomic operations
+	newBlocks                       uint64
 	socket                          *websocket.Conn
 	upgrader                        *websocket.Upgrader
 	db                              *db.RocksDB
@@ -71,17 +95,34 @@ type WebsocketServer struct {
 	block0hash                      string
 	newBlockSubscriptions           map[*websocketChannel]string
 	newBlockSubscriptionsLock       sync.Mutex
+	reorgSubscriptions              map[*websocketChannel]string
+	reorgSubscriptionsLock          sync.Mutex
 	newTransactionEnabled           bool
 	newTransactionSubscriptions     map[*websocketChannel]string
 	newTransactionSubscriptionsLock sync.Mutex
 	addressSubscriptions            map[string]map[*websocketChannel]string
 	addressSubscriptionsLock        sync.Mutex
-	fiatRatesSubscriptions          map[string]map[*websocketChannel]string
-	fiatRatesSubscriptionsLock      sync.Mutex
+	accountSubscriptions            map[string]map[*websocketAccount]accountAddress
+	accountSubscriptionsLock        sync.Mutex
+	transactionSubscriptions        map[string]map[*txSubscription]struct{}
+	transactionInputs               map[string]map[*txSubscription]struct{} // inputs of the tracked transactions as txid:vout
+	transactionSubscriptionsLock    sync.Mutex
+	// serializes the updates of the status of the tracked transactions
+	transactionCheckLock       sync.Mutex
+	fiatRatesSubscriptions     map[string]map[*websocketChannel]string
+	fiatRatesSubscriptionsLock sync.Mutex
+	broadcastSubscriptions     map[string]map[*websocketChannel]string
+	broadcastSubscriptionsLock sync.Mutex
+	eventLog                   *db.EventLog
+	// the mempool transactions are written to the event log and notified by newTxEventsLoop
+	newTxEvents chan *bchain.MempoolTx
+	apiAccess   *APIAccess
 }
 
 // NewWebsocketServer creates new websocket interface to blockbook and returns its handle
-func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState, enableSubNewTx bool) (*WebsocketServer, error) {
+// eventLog is optional, if set, the subscriptions of new blocks and addresses can be resumed
+// apiAccess is optional, if set, the connections are authorized and the requests limited
+func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState, enableSubNewTx bool, eventLog *db.EventLog, apiAccess *APIAccess) (*WebsocketServer, error) {
 	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return nil, err
@@ -106,10 +147,21 @@ func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.
 		api:                         api,
 		block0hash:                  b0,
 		newBlockSubscriptions:       make(map[*websocketChannel]string),
+		reorgSubscriptions:          make(map[*websocketChannel]string),
 		newTransactionEnabled:       enableSubNewTx,
 		newTransactionSubscriptions: make(map[*websocketChannel]string),
 		addressSubscriptions:        make(map[string]map[*websocketChannel]string),
+		accountSubscriptions:        make(map[string]map[*websocketAccount]accountAddress),
+		transactionSubscriptions:    make(map[string]map[*txSubscription]struct{}),
+		transactionInputs:           make(map[string]map[*txSubscription]struct{}),
 		fiatRatesSubscriptions:      make(map[string]map[*websocketChannel]string),
+		broadcastSubscriptions:      make(map[string]map[*websocketChannel]string),
+		eventLog:                    eventLog,
+		apiAccess:                   apiAccess,
+	}
+	if eventLog != nil {
+		s.newTxEvents = make(chan *bchain.MempoolTx, newTxEventsQueueSize)
+		go s.newTxEventsLoop()
 	}
 	return s, nil
 }
@@ -133,8 +185,14 @@ func (s *WebsocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, upgradeFailed+ErrorMethodNotAllowed.Error(), 503)
 		return
 	}
+	client, err := s.apiAccess.authorizeWebsocket(r)
+	if err != nil {
+		http.Error(w, upgradeFailed+err.Error(), err.(*apiAccessError).httpStatus)
+		return
+	}
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		s.apiAccess.releaseWebsocket(client)
 		http.Error(w, upgradeFailed+err.Error(), 503)
 		return
 	}
@@ -145,6 +203,8 @@ func (s *WebsocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ip:            getIP(r),
 		requestHeader: r.Header,
 		alive:         true,
+		client:        client,
+		subscriptions: make(map[string]int),
 	}
 	go s.inputLoop(c)
 	go s.outputLoop(c)
@@ -257,9 +317,14 @@ func (s *WebsocketServer) onConnect(c *websocketChannel) {
 
 func (s *WebsocketServer) onDisconnect(c *websocketChannel) {
 	s.unsubscribeNewBlock(c)
+	s.unsubscribeReorgs(c)
 	s.unsubscribeNewTransaction(c)
 	s.unsubscribeAddresses(c)
+	s.unsubscribeAccounts(c)
+	s.unsubscribeTransactions(c, "")
 	s.unsubscribeFiatRates(c)
+	s.unsubscribeBroadcasts(c)
+	s.apiAccess.releaseWebsocket(c.client)
 	glog.Info("Client disconnected ", c.id, ", ", c.ip)
 	s.metrics.WebsocketClients.Dec()
 }
@@ -303,6 +368,7 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 			Currencies []string `json:"currencies"`
 			Gap        int      `json:"gap"`
 			GroupBy    uint32   `json:"groupBy"`
+			Contract   string   `json:"contract"`
 		}{}
 		err = json.Unmarshal(req.Params, &r)
 		if err == nil {
@@ -317,7 +383,7 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 			}
 			rv, err = s.api.GetXpubBalanceHistory(r.Descriptor, r.From, r.To, r.Currencies, r.Gap, r.GroupBy)
 			if err != nil {
-				rv, err = s.api.GetBalanceHistory(r.Descriptor, r.From, r.To, r.Currencies, r.GroupBy)
+				rv, err = s.api.GetBalanceHistory(r.Descriptor, r.From, r.To, r.Currencies, r.GroupBy, r.Contract)
 			}
 		}
 		return
@@ -361,6 +427,12 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 	"unsubscribeNewBlock": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		return s.unsubscribeNewBlock(c)
 	},
+	"subscribeReorgs": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		return s.subscribeReorgs(c, req)
+	},
+	"unsubscribeReorgs": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		return s.unsubscribeReorgs(c)
+	},
 	"subscribeNewTransaction": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		return s.subscribeNewTransaction(c, req)
 	},
@@ -377,6 +449,43 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 	"unsubscribeAddresses": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		return s.unsubscribeAddresses(c)
 	},
+	"subscribeAccounts": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Accounts []string `json:"accounts"`
+			Gap      int      `json:"gap"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err != nil {
+			return nil, err
+		}
+		return s.subscribeAccounts(c, r.Accounts, r.Gap, req)
+	},
+	"unsubscribeAccounts": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		return s.unsubscribeAccounts(c)
+	},
+	"subscribeTransaction": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Txid          string `json:"txid"`
+			Confirmations uint32 `json:"confirmations"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err != nil {
+			return nil, err
+		}
+		return s.subscribeTransaction(c, r.Txid, r.Confirmations, req)
+	},
+	"unsubscribeTransaction": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Txid string `json:"txid"`
+		}{}
+		if len(req.Params) > 0 {
+			err = json.Unmarshal(req.Params, &r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return s.unsubscribeTransactions(c, r.Txid)
+	},
 	"subscribeFiatRates": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		r := struct {
 			Currency string `json:"currency"`
@@ -390,6 +499,19 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 	"unsubscribeFiatRates": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		return s.unsubscribeFiatRates(c)
 	},
+	"subscribeBroadcasts": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Txids []string `json:"txids"`
+		}{}
+		err = json.Unmarshal(req.Params, &r)
+		if err != nil {
+			return nil, err
+		}
+		return s.subscribeBroadcasts(c, r.Txids, req)
+	},
+	"unsubscribeBroadcasts": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		return s.unsubscribeBroadcasts(c)
+	},
 	"ping": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		r := struct{}{}
 		return r, nil
@@ -397,10 +519,11 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 	"getCurrentFiatRates": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		r := struct {
 			Currencies []string `json:"currencies"`
+			Token      string   `json:"token"`
 		}{}
 		err = json.Unmarshal(req.Params, &r)
 		if err == nil {
-			rv, err = s.getCurrentFiatRates(r.Currencies)
+			rv, err = s.getCurrentFiatRates(r.Currencies, r.Token)
 		}
 		return
 	},
@@ -408,10 +531,11 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 		r := struct {
 			Timestamps []int64  `json:"timestamps"`
 			Currencies []string `json:"currencies"`
+			Token      string   `json:"token"`
 		}{}
 		err = json.Unmarshal(req.Params, &r)
 		if err == nil {
-			rv, err = s.getFiatRatesForTimestamps(r.Timestamps, r.Currencies)
+			rv, err = s.getFiatRatesForTimestamps(r.Timestamps, r.Currencies, r.Token)
 		}
 		return
 	},
@@ -445,6 +569,12 @@ func (s *WebsocketServer) onRequest(c *websocketChannel, req *websocketReq) {
 				Data: data,
 			})
 		}
+		if accessErr, ok := err.(*apiAccessError); ok && accessErr.httpStatus == http.StatusUnauthorized {
+			// the API key of the connection was removed or disabled, the connection and its subscriptions are closed
+			// the closed connection causes break in the inputLoop, which calls CloseOut
+			glog.Info("Client ", c.id, ", ", c.ip, " API key is not valid, closing the connection")
+			c.conn.Close()
+		}
 		s.metrics.WebsocketPendingRequests.With((common.Labels{"method": req.Method})).Dec()
 	}()
 	t := time.Now()
@@ -452,12 +582,15 @@ func (s *WebsocketServer) onRequest(c *websocketChannel, req *websocketReq) {
 	defer s.metrics.WebsocketReqDuration.With(common.Labels{"method": req.Method}).Observe(float64(time.Since(t)) / 1e3) // in microseconds
 	f, ok := requestHandlers[req.Method]
 	if ok {
-		data, err = f(s, c, req)
+		if err = s.apiAccess.checkWebsocketRequest(c.client); err == nil {
+			data, err = f(s, c, req)
+		}
 		if err == nil {
 			glog.V(1).Info("Client ", c.id, " onRequest ", req.Method, " success")
 			s.metrics.WebsocketRequests.With(common.Labels{"method": req.Method, "status": "success"}).Inc()
 		} else {
-			if apiErr, ok := err.(*api.APIError); !ok || !apiErr.Public {
+			_, accessErr := err.(*apiAccessError)
+			if apiErr, ok := err.(*api.APIError); !accessErr && (!ok || !apiErr.Public) {
 				glog.Error("Client ", c.id, " onMessage ", req.Method, ": ", errors.ErrorStack(err), ", data ", string(req.Params))
 			}
 			s.metrics.WebsocketRequests.With(common.Labels{"method": req.Method, "status": "failure"}).Inc()
@@ -480,6 +613,7 @@ type accountInfoReq struct {
 	ToHeight       int    `json:"to"`
 	ContractFilter string `json:"contractFilter"`
 	Gap            int    `json:"gap"`
+	Currency       string `json:"currency"`
 }
 
 func unmarshalGetAccountInfoRequest(params []byte) (*accountInfoReq, error) {
@@ -522,6 +656,7 @@ func (s *WebsocketServer) getAccountInfo(req *accountInfoReq) (res *api.Address,
 		Contract:       req.ContractFilter,
 		Vout:           api.AddressFilterVoutOff,
 		TokensToReturn: tokensToReturn,
+		Currency:       req.Currency,
 	}
 	if req.PageSize == 0 {
 		req.PageSize = txsOnPage
@@ -607,10 +742,16 @@ func (s *WebsocketServer) estimateFee(c *websocketChannel, params []byte) (inter
 		Blocks   []int                  `json:"blocks"`
 		Specific map[string]interface{} `json:"specific"`
 	}
+	type eip1559Fee struct {
+		BaseFeePerGas        string `json:"baseFeePerGas"`
+		MaxFeePerGas         string `json:"maxFeePerGas"`
+		MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+	}
 	type estimateFeeRes struct {
-		FeePerTx   string `json:"feePerTx,omitempty"`
-		FeePerUnit string `json:"feePerUnit,omitempty"`
-		FeeLimit   string `json:"feeLimit,omitempty"`
+		FeePerTx   string      `json:"feePerTx,omitempty"`
+		FeePerUnit string      `json:"feePerUnit,omitempty"`
+		FeeLimit   string      `json:"feeLimit,omitempty"`
+		Eip1559    *eip1559Fee `json:"eip1559,omitempty"`
 	}
 	var r estimateFeeReq
 	err := json.Unmarshal(params, &r)
@@ -624,10 +765,27 @@ func (s *WebsocketServer) estimateFee(c *websocketChannel, params []byte) (inter
 			return nil, err
 		}
 		sg := strconv.FormatUint(gas, 10)
+		// chains without EIP-1559 do not return the fees, on error fall back to the gas price estimate
+		fees, err := s.chain.EthereumTypeGetEip1559Fees()
+		if err != nil {
+			glog.Error("EthereumTypeGetEip1559Fees error ", err)
+			fees = nil
+		}
 		for i, b := range r.Blocks {
-			fee, err := s.chain.EstimateSmartFee(b, true)
-			if err != nil {
-				return nil, err
+			var fee big.Int
+			if fees != nil {
+				tier := fees.TierForBlocks(b)
+				fee.Add(&fees.BaseFeePerGas, &tier.MaxPriorityFeePerGas)
+				res[i].Eip1559 = &eip1559Fee{
+					BaseFeePerGas:        fees.BaseFeePerGas.String(),
+					MaxFeePerGas:         tier.MaxFeePerGas.String(),
+					MaxPriorityFeePerGas: tier.MaxPriorityFeePerGas.String(),
+				}
+			} else {
+				fee, err = s.chain.EstimateSmartFee(b, true)
+				if err != nil {
+					return nil, err
+				}
 			}
 			res[i].FeePerUnit = fee.String()
 			res[i].FeeLimit = sg
@@ -669,7 +827,7 @@ func (s *WebsocketServer) estimateFee(c *websocketChannel, params []byte) (inter
 }
 
 func (s *WebsocketServer) sendTransaction(tx string) (res resultSendTransaction, err error) {
-	txid, err := s.chain.SendRawTransaction(tx)
+	txid, err := s.api.SendRawTransaction(tx)
 	if err != nil {
 		return res, err
 	}
@@ -684,10 +842,139 @@ type subscriptionResponseMessage struct {
 	Subscribed bool   `json:"subscribed"`
 	Message    string `json:"message"`
 }
+type resumableSubscriptionResponse struct {
+	Subscribed  bool   `json:"subscribed"`
+	ResumeToken string `json:"resumeToken"`
+	Replayed    int    `json:"replayed,omitempty"`
+	Incomplete  bool   `json:"incomplete,omitempty"`
+}
+
+func resumeTokenFromSeq(seq uint64) string {
+	return strconv.FormatUint(seq, 10)
+}
+
+// unmarshalResumeToken returns the sequence number of the last event received by the client
+// and false if the client does not resume the subscription
+func unmarshalResumeToken(params []byte) (uint64, bool, error) {
+	r := struct {
+		ResumeToken string `json:"resumeToken"`
+	}{}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &r); err != nil {
+			return 0, false, err
+		}
+	}
+	if r.ResumeToken == "" {
+		return 0, false, nil
+	}
+	seq, err := strconv.ParseUint(r.ResumeToken, 10, 64)
+	if err != nil {
+		return 0, false, api.NewAPIError("Invalid resumeToken", true)
+	}
+	return seq, true, nil
+}
+
+// eventReplay holds the missed events of a resumed subscription
+type eventReplay struct {
+	res    resumableSubscriptionResponse
+	events []db.Event
+	seq    uint64
+	resume bool
+}
+
+// getReplayEvents reads the missed events matching the filter up to lastSeq from the event log
+func (s *WebsocketServer) getReplayEvents(req *websocketReq, lastSeq uint64, filter func(e *db.Event) bool) (*eventReplay, error) {
+	r := eventReplay{res: resumableSubscriptionResponse{Subscribed: true, ResumeToken: resumeTokenFromSeq(lastSeq)}}
+	var err error
+	r.seq, r.resume, err = unmarshalResumeToken(req.Params)
+	if err != nil {
+		return nil, err
+	}
+	if r.resume {
+		events, complete, err := s.eventLog.GetEventsAfter(r.seq, filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range events {
+			if events[i].Seq > lastSeq {
+				events = events[:i]
+				break
+			}
+		}
+		if len(events) > maxReplayedEvents {
+			events = events[len(events)-maxReplayedEvents:]
+			complete = false
+		}
+		r.events = events
+		r.res.Incomplete = !complete
+	}
+	return &r, nil
+}
+
+// sendReplayEvents sends the missed events to the channel after the response to the subscription request
+// eventData may be expensive, the function should not be called with a subscription lock held if possible
+func (s *WebsocketServer) sendReplayEvents(c *websocketChannel, req *websocketReq, r *eventReplay, eventData func(e *db.Event) interface{}) {
+	data := make([]interface{}, 0, len(r.events))
+	for i := range r.events {
+		if d := eventData(&r.events[i]); d != nil {
+			data = append(data, d)
+		}
+	}
+	r.res.Replayed = len(data)
+	c.DataOut(&websocketRes{
+		ID:   req.ID,
+		Data: &r.res,
+	})
+	for _, d := range data {
+		c.DataOut(&websocketRes{
+			ID:   req.ID,
+			Data: d,
+		})
+	}
+	if r.resume {
+		glog.Info("Client ", c.id, " resumed ", req.Method, " from ", r.seq, ", replayed ", r.res.Replayed, " events")
+	}
+}
+
+type newBlockData struct {
+	Height      uint32 `json:"height"`
+	Hash        string `json:"hash"`
+	ResumeToken string `json:"resumeToken,omitempty"`
+}
+
+// setSubscriptions sets the number of subscribed items of the method in the channel, checking the limit of the client
+func (s *WebsocketServer) setSubscriptions(c *websocketChannel, method string, n int) error {
+	return s.apiAccess.setSubscriptions(c.client, c.subscriptions, method, n)
+}
 
 func (s *WebsocketServer) subscribeNewBlock(c *websocketChannel, req *websocketReq) (res interface{}, err error) {
+	if err = s.setSubscriptions(c, "subscribeNewBlock", 1); err != nil {
+		return nil, err
+	}
 	s.newBlockSubscriptionsLock.Lock()
 	defer s.newBlockSubscriptionsLock.Unlock()
+	if s.eventLog != nil {
+		// new block events are logged under newBlockSubscriptionsLock, no new block event can be added during the replay
+		// the replay of new blocks does not need any lookups, it is sent under the lock
+		lastSeq := s.eventLog.LastSeq()
+		r, err := s.getReplayEvents(req, lastSeq, func(e *db.Event) bool {
+			return e.Type == db.EventNewBlock
+		})
+		if err != nil {
+			if _, ok := s.newBlockSubscriptions[c]; !ok {
+				s.setSubscriptions(c, "subscribeNewBlock", 0)
+			}
+			return nil, err
+		}
+		s.sendReplayEvents(c, req, r, func(e *db.Event) interface{} {
+			return &newBlockData{Height: e.Height, Hash: e.Hash, ResumeToken: resumeTokenFromSeq(e.Seq)}
+		})
+		c.newBlockResumeSeq = lastSeq
+		s.newBlockSubscriptions[c] = req.ID
+		s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeNewBlock"})).Set(float64(len(s.newBlockSubscriptions)))
+		// the response was already sent by sendReplayEvents
+		return nil, nil
+	}
 	s.newBlockSubscriptions[c] = req.ID
 	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeNewBlock"})).Set(float64(len(s.newBlockSubscriptions)))
 	return &subscriptionResponse{true}, nil
@@ -697,16 +984,40 @@ func (s *WebsocketServer) unsubscribeNewBlock(c *websocketChannel) (res interfac
 	s.newBlockSubscriptionsLock.Lock()
 	defer s.newBlockSubscriptionsLock.Unlock()
 	delete(s.newBlockSubscriptions, c)
+	s.setSubscriptions(c, "subscribeNewBlock", 0)
 	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeNewBlock"})).Set(float64(len(s.newBlockSubscriptions)))
 	return &subscriptionResponse{false}, nil
 }
 
+func (s *WebsocketServer) subscribeReorgs(c *websocketChannel, req *websocketReq) (res interface{}, err error) {
+	if err = s.setSubscriptions(c, "subscribeReorgs", 1); err != nil {
+		return nil, err
+	}
+	s.reorgSubscriptionsLock.Lock()
+	defer s.reorgSubscriptionsLock.Unlock()
+	s.reorgSubscriptions[c] = req.ID
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeReorgs"})).Set(float64(len(s.reorgSubscriptions)))
+	return &subscriptionResponse{true}, nil
+}
+
+func (s *WebsocketServer) unsubscribeReorgs(c *websocketChannel) (res interface{}, err error) {
+	s.reorgSubscriptionsLock.Lock()
+	defer s.reorgSubscriptionsLock.Unlock()
+	delete(s.reorgSubscriptions, c)
+	s.setSubscriptions(c, "subscribeReorgs", 0)
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeReorgs"})).Set(float64(len(s.reorgSubscriptions)))
+	return &subscriptionResponse{false}, nil
+}
+
 func (s *WebsocketServer) subscribeNewTransaction(c *websocketChannel, req *websocketReq) (res interface{}, err error) {
 	s.newTransactionSubscriptionsLock.Lock()
 	defer s.newTransactionSubscriptionsLock.Unlock()
 	if !s.newTransactionEnabled {
 		return &subscriptionResponseMessage{false, "subscribeNewTransaction not enabled, use -enablesubnewtx flag to enable."}, nil
 	}
+	if err = s.setSubscriptions(c, "subscribeNewTransaction", 1); err != nil {
+		return nil, err
+	}
 	s.newTransactionSubscriptions[c] = req.ID
 	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeNewTransaction"})).Set(float64(len(s.newTransactionSubscriptions)))
 	return &subscriptionResponse{true}, nil
@@ -719,6 +1030,7 @@ func (s *WebsocketServer) unsubscribeNewTransaction(c *websocketChannel) (res in
 		return &subscriptionResponseMessage{false, "unsubscribeNewTransaction not enabled, use -enablesubnewtx flag to enable."}, nil
 	}
 	delete(s.newTransactionSubscriptions, c)
+	s.setSubscriptions(c, "subscribeNewTransaction", 0)
 	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeNewTransaction"})).Set(float64(len(s.newTransactionSubscriptions)))
 	return &subscriptionResponse{false}, nil
 }
@@ -761,10 +1073,37 @@ func (s *WebsocketServer) doUnsubscribeAddresses(c *websocketChannel) {
 }
 
 func (s *WebsocketServer) subscribeAddresses(c *websocketChannel, addrDesc []string, req *websocketReq) (res interface{}, err error) {
+	if err = s.setSubscriptions(c, "subscribeAddresses", len(addrDesc)); err != nil {
+		return nil, err
+	}
 	s.addressSubscriptionsLock.Lock()
-	defer s.addressSubscriptionsLock.Unlock()
 	// unsubscribe all previous subscriptions
 	s.doUnsubscribeAddresses(c)
+	var lastSeq uint64
+	var r *eventReplay
+	if s.eventLog != nil {
+		// address events are logged before the subscriptions are checked,
+		// the events up to lastSeq are replayed, the later events are sent as notifications to the new subscription
+		lastSeq = s.eventLog.LastSeq()
+		subscribed := make(map[string]struct{}, len(addrDesc))
+		for _, ads := range addrDesc {
+			subscribed[ads] = struct{}{}
+		}
+		r, err = s.getReplayEvents(req, lastSeq, func(e *db.Event) bool {
+			if e.Type != db.EventAddressTx && e.Type != db.EventAddressReorgTx {
+				return false
+			}
+			_, ok := subscribed[string(e.AddrDesc)]
+			return ok
+		})
+		if err != nil {
+			s.setSubscriptions(c, "subscribeAddresses", 0)
+			s.addressSubscriptionsLock.Unlock()
+			return nil, err
+		}
+		// hold back the notifications until the replayed events are sent
+		c.addrReplays++
+	}
 	for _, ads := range addrDesc {
 		as, ok := s.addressSubscriptions[ads]
 		if !ok {
@@ -774,8 +1113,97 @@ func (s *WebsocketServer) subscribeAddresses(c *websocketChannel, addrDesc []str
 		as[c] = req.ID
 	}
 	c.addrDescs = addrDesc
+	c.addrResumeSeq = lastSeq
 	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeAddresses"})).Set(float64(len(s.addressSubscriptions)))
-	return &subscriptionResponse{true}, nil
+	s.addressSubscriptionsLock.Unlock()
+	if r == nil {
+		return &subscriptionResponse{true}, nil
+	}
+	// the transactions of the replayed events are fetched without addressSubscriptionsLock
+	s.sendReplayEvents(c, req, r, s.addressEventData)
+	s.addressSubscriptionsLock.Lock()
+	c.addrReplays--
+	if c.addrReplays == 0 {
+		for _, p := range c.addrPending {
+			c.DataOut(p)
+		}
+		c.addrPending = nil
+	}
+	s.addressSubscriptionsLock.Unlock()
+	// the response was already sent by sendReplayEvents
+	return nil, nil
+}
+
+// addrDataOut sends the address notification to the channel or holds it back if the address events are being replayed to the channel
+// it must be called with addressSubscriptionsLock held
+func (c *websocketChannel) addrDataOut(data *websocketRes) {
+	if c.addrReplays > 0 {
+		c.addrPending = append(c.addrPending, data)
+		return
+	}
+	c.DataOut(data)
+}
+
+// addressEventData reconstructs the notification of a logged address event, returns nil if the transaction is not available
+func (s *WebsocketServer) addressEventData(e *db.Event) interface{} {
+	addr, _, err := s.chainParser.GetAddressesFromAddrDesc(e.AddrDesc)
+	if err != nil || len(addr) != 1 {
+		return nil
+	}
+	token := resumeTokenFromSeq(e.Seq)
+	if e.Type == db.EventAddressReorgTx {
+		return &reorgTxAddrData{
+			Address:     addr[0],
+			Reorg:       s.getReorgTx(e.Txid, e.Height),
+			ResumeToken: token,
+		}
+	}
+	tx, err := s.api.GetTransaction(e.Txid, false, false)
+	if err != nil {
+		glog.V(1).Info("replay of tx ", e.Txid, " skipped: ", err)
+		return nil
+	}
+	return &newTxAddrData{
+		Address:     addr[0],
+		Tx:          tx,
+		ResumeToken: token,
+	}
+}
+
+// addressEvents appends the events of the transaction for the address descriptors to events
+func addressEvents(events []db.Event, t db.EventType, txid string, height uint32, addrDescs map[string]struct{}) []db.Event {
+	for sad := range addrDescs {
+		events = append(events, db.Event{
+			Type:     t,
+			Txid:     txid,
+			Height:   height,
+			AddrDesc: bchain.AddressDescriptor(sad),
+		})
+	}
+	return events
+}
+
+// eventSeqs returns the sequence numbers of the logged address events by address descriptor
+func eventSeqs(events []db.Event) map[string]uint64 {
+	seqs := make(map[string]uint64, len(events))
+	for i := range events {
+		seqs[string(events[i].AddrDesc)] = events[i].Seq
+	}
+	return seqs
+}
+
+// logAddressEvents stores the events of all affected addresses to the event log in one batch,
+// the clients which are offline may resume their subscriptions later
+// it must be called before the subscriptions are checked and without addressSubscriptionsLock, see subscribeAddresses
+func (s *WebsocketServer) logAddressEvents(events []db.Event) bool {
+	if len(events) == 0 {
+		return false
+	}
+	if err := s.eventLog.Append(events); err != nil {
+		glog.Error("eventLog.Append error ", err, " for ", events[0].Txid)
+		return false
+	}
+	return true
 }
 
 // unsubscribeAddresses unsubscribes all address subscriptions by this channel
@@ -783,10 +1211,614 @@ func (s *WebsocketServer) unsubscribeAddresses(c *websocketChannel) (res interfa
 	s.addressSubscriptionsLock.Lock()
 	defer s.addressSubscriptionsLock.Unlock()
 	s.doUnsubscribeAddresses(c)
+	s.setSubscriptions(c, "subscribeAddresses", 0)
 	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeAddresses"})).Set(float64(len(s.addressSubscriptions)))
 	return &subscriptionResponse{false}, nil
 }
 
+// websocketAccount is an xpub subscribed by a channel
+// the addresses are derived up to the gap after the last used address and extended as the addresses are used
+type websocketAccount struct {
+	c            *websocketChannel
+	id           string
+	xpub         string
+	addresses    *api.XpubAddresses
+	unsubscribed bool
+	// the cached balances of the addresses with a non zero balance, guarded by balancesLock
+	balancesLock sync.Mutex
+	balances     map[string]*api.AddressBalanceSat
+	// the value of newBlocks when the balances were loaded
+	balancesNewBlocks uint64
+}
+
+// accountAddress is the position of a derived address in the account
+type accountAddress struct {
+	change int
+	index  int
+}
+
+type accountTxAddress struct {
+	Address  string `json:"address"`
+	Path     string `json:"path"`
+	addrDesc bchain.AddressDescriptor
+}
+
+type accountTxData struct {
+	Account            string             `json:"account"`
+	Addresses          []accountTxAddress `json:"addresses"`
+	Tx                 *api.Tx            `json:"tx"`
+	Balance            *api.Amount        `json:"balance"`
+	UnconfirmedBalance *api.Amount        `json:"unconfirmedBalance"`
+}
+
+// unsubscribe accounts without accountSubscriptionsLock - can be called only from subscribeAccounts and unsubscribeAccounts
+func (s *WebsocketServer) doUnsubscribeAccounts(c *websocketChannel) {
+	for _, a := range c.accounts {
+		for change := range a.addresses.Addresses {
+			for _, ad := range a.addresses.Addresses[change] {
+				sad := string(ad)
+				sa, e := s.accountSubscriptions[sad]
+				if e {
+					delete(sa, a)
+					if len(sa) == 0 {
+						delete(s.accountSubscriptions, sad)
+					}
+				}
+			}
+		}
+		a.unsubscribed = true
+	}
+	c.accounts = nil
+}
+
+// addAccountAddresses adds the addresses of the account from the index to the subscriptions
+// it must be called with accountSubscriptionsLock held
+func (s *WebsocketServer) addAccountAddresses(a *websocketAccount, change int, from int) {
+	for i := from; i < len(a.addresses.Addresses[change]); i++ {
+		sad := string(a.addresses.Addresses[change][i])
+		sa, ok := s.accountSubscriptions[sad]
+		if !ok {
+			sa = make(map[*websocketAccount]accountAddress)
+			s.accountSubscriptions[sad] = sa
+		}
+		sa[a] = accountAddress{change: change, index: i}
+	}
+}
+
+func (s *WebsocketServer) subscribeAccounts(c *websocketChannel, xpubs []string, gap int, req *websocketReq) (res interface{}, err error) {
+	if err = s.setSubscriptions(c, "subscribeAccounts", len(xpubs)); err != nil {
+		return nil, err
+	}
+	// derive the addresses before taking the lock, it can take some time
+	accounts := make([]*websocketAccount, len(xpubs))
+	for i, xpub := range xpubs {
+		xa, err := s.api.GetXpubAddresses(xpub, gap)
+		if err != nil {
+			// the previous subscription stays active
+			s.accountSubscriptionsLock.Lock()
+			s.setSubscriptions(c, "subscribeAccounts", len(c.accounts))
+			s.accountSubscriptionsLock.Unlock()
+			return nil, err
+		}
+		accounts[i] = &websocketAccount{
+			c:         c,
+			id:        req.ID,
+			xpub:      xpub,
+			addresses: xa,
+		}
+	}
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	// unsubscribe all previous subscriptions
+	s.doUnsubscribeAccounts(c)
+	for _, a := range accounts {
+		for change := range a.addresses.Addresses {
+			s.addAccountAddresses(a, change, 0)
+		}
+	}
+	c.accounts = accounts
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeAccounts"})).Set(float64(len(s.accountSubscriptions)))
+	return &subscriptionResponse{true}, nil
+}
+
+func (s *WebsocketServer) unsubscribeAccounts(c *websocketChannel) (res interface{}, err error) {
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	s.doUnsubscribeAccounts(c)
+	s.setSubscriptions(c, "subscribeAccounts", 0)
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeAccounts"})).Set(float64(len(s.accountSubscriptions)))
+	return &subscriptionResponse{false}, nil
+}
+
+// getAccountSubscriptions returns the subscribed accounts with the affected addresses
+// the accounts are extended so that there is the gap of derived addresses after the used addresses
+func (s *WebsocketServer) getAccountSubscriptions(addrDescs map[string]struct{}) map[*websocketAccount][]accountTxAddress {
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	if len(s.accountSubscriptions) == 0 {
+		return nil
+	}
+	subscribed := make(map[*websocketAccount][]accountTxAddress)
+	for sad := range addrDescs {
+		sa, ok := s.accountSubscriptions[sad]
+		if !ok {
+			continue
+		}
+		var address string
+		addr, _, err := s.chainParser.GetAddressesFromAddrDesc(bchain.AddressDescriptor(sad))
+		if err == nil && len(addr) == 1 {
+			address = addr[0]
+		}
+		for a, aa := range sa {
+			subscribed[a] = append(subscribed[a], accountTxAddress{
+				Address:  address,
+				Path:     a.addresses.Path(aa.change, aa.index),
+				addrDesc: bchain.AddressDescriptor(sad),
+			})
+			if aa.index > a.addresses.LastUsed[aa.change] {
+				a.addresses.LastUsed[aa.change] = aa.index
+				s.extendAccount(a, aa.change)
+			}
+		}
+	}
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeAccounts"})).Set(float64(len(s.accountSubscriptions)))
+	return subscribed
+}
+
+// extendAccount derives new addresses of the account so that the gap after the last used address is kept
+// it must be called with accountSubscriptionsLock held
+func (s *WebsocketServer) extendAccount(a *websocketAccount, change int) {
+	xa := a.addresses
+	from := len(xa.Addresses[change])
+	to := xa.LastUsed[change] + 1 + xa.Gap
+	if to <= from {
+		return
+	}
+	descriptors, err := s.chainParser.DeriveAddressDescriptorsFromTo(a.xpub, uint32(change), uint32(from), uint32(to))
+	if err != nil {
+		glog.Error("DeriveAddressDescriptorsFromTo error ", err, " for ", a.xpub)
+		return
+	}
+	xa.Addresses[change] = append(xa.Addresses[change], descriptors...)
+	s.addAccountAddresses(a, change, from)
+	glog.V(1).Info("Client ", a.c.id, " account ", a.xpub[:16], " extended to ", len(xa.Addresses[change]), " addresses in chain ", change)
+}
+
+// getAccountBalance returns the confirmed and unconfirmed balance of the account from the cached balances of its addresses
+// all addresses are loaded after a new block, otherwise only the addresses of the notified transaction
+// and the addresses with mempool transactions, which can be removed from the mempool, are reloaded
+func (s *WebsocketServer) getAccountBalance(a *websocketAccount, xa *api.XpubAddresses, addresses []accountTxAddress) (*api.Amount, *api.Amount, error) {
+	a.balancesLock.Lock()
+	defer a.balancesLock.Unlock()
+	// read the counter before loading the balances, OnNewBlock is called after the block is stored
+	newBlocks := atomic.LoadUint64(&s.newBlocks)
+	var addrDescs []bchain.AddressDescriptor
+	if a.balances == nil || a.balancesNewBlocks != newBlocks {
+		a.balances = make(map[string]*api.AddressBalanceSat)
+		for change := range xa.Addresses {
+			addrDescs = append(addrDescs, xa.Addresses[change]...)
+		}
+	} else {
+		reload := make(map[string]struct{}, len(addresses))
+		for i := range addresses {
+			reload[string(addresses[i].addrDesc)] = struct{}{}
+		}
+		for sad, b := range a.balances {
+			if b.UnconfirmedBalance.Sign() != 0 {
+				reload[sad] = struct{}{}
+			}
+		}
+		for sad := range reload {
+			addrDescs = append(addrDescs, bchain.AddressDescriptor(sad))
+		}
+	}
+	balances, err := s.api.GetAddressesBalances(addrDescs)
+	if err != nil {
+		a.balances = nil
+		return nil, nil, err
+	}
+	for i := range addrDescs {
+		if balances[i].Balance.Sign() == 0 && balances[i].UnconfirmedBalance.Sign() == 0 {
+			delete(a.balances, string(addrDescs[i]))
+		} else {
+			a.balances[string(addrDescs[i])] = &balances[i]
+		}
+	}
+	a.balancesNewBlocks = newBlocks
+	var balance, unconfirmedBalance big.Int
+	for _, b := range a.balances {
+		balance.Add(&balance, &b.Balance)
+		unconfirmedBalance.Add(&unconfirmedBalance, &b.UnconfirmedBalance)
+	}
+	return (*api.Amount)(&balance), (*api.Amount)(&unconfirmedBalance), nil
+}
+
+func (s *WebsocketServer) sendOnNewTxAccount(a *websocketAccount, addresses []accountTxAddress, tx *api.Tx) {
+	// the addresses of the account can be extended by getAccountSubscriptions, take a snapshot of them under the lock
+	// extendAccount only appends to the slices, the snapshot is not modified
+	s.accountSubscriptionsLock.Lock()
+	if a.unsubscribed {
+		s.accountSubscriptionsLock.Unlock()
+		return
+	}
+	xa := *a.addresses
+	s.accountSubscriptionsLock.Unlock()
+	balance, unconfirmedBalance, err := s.getAccountBalance(a, &xa, addresses)
+	if err != nil {
+		glog.Error("getAccountBalance error ", err, " for ", a.xpub)
+		return
+	}
+	data := accountTxData{
+		Account:            a.xpub,
+		Addresses:          addresses,
+		Tx:                 tx,
+		Balance:            balance,
+		UnconfirmedBalance: unconfirmedBalance,
+	}
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	if !a.unsubscribed {
+		a.c.DataOut(&websocketRes{
+			ID:   a.id,
+			Data: &data,
+		})
+		glog.Info("broadcasting new tx ", tx.Txid, ", account ", a.xpub[:16], " to channel ", a.c.id)
+	}
+}
+
+const (
+	txStatusNotFound    = "notFound"
+	txStatusMempool     = "mempool"
+	txStatusConfirmed   = "confirmed"
+	txStatusDropped     = "dropped"
+	txStatusDoubleSpent = "doubleSpent"
+)
+
+type txStatusData struct {
+	Txid          string `json:"txid"`
+	Status        string `json:"status"`
+	Confirmations uint32 `json:"confirmations"`
+	BlockHeight   uint32 `json:"blockHeight,omitempty"`
+	BlockHash     string `json:"blockHash,omitempty"`
+	DoubleSpentBy string `json:"doubleSpentBy,omitempty"`
+	// the target number of confirmations was reached, the subscription is finished
+	Completed bool `json:"completed,omitempty"`
+}
+
+// txSubscription is a transaction tracked by a channel until it reaches the target number of confirmations
+type txSubscription struct {
+	c             *websocketChannel
+	id            string
+	txid          string
+	confirmations uint32
+	inputs        []string
+	status        txStatusData
+}
+
+func txInputKey(txid string, vout uint32) string {
+	return txid + ":" + strconv.FormatUint(uint64(vout), 10)
+}
+
+// getTxStatus gets the current status of the tracked transaction and its inputs, if they are not known yet
+// the transaction is looked up in the index and in the mempool, if it is not found, the previous status decides
+// if it is not yet broadcasted, it was dropped or replaced by a double spend
+func (s *WebsocketServer) getTxStatus(ts *txSubscription) (txStatusData, []string) {
+	st := txStatusData{
+		Txid:          ts.txid,
+		DoubleSpentBy: ts.status.DoubleSpentBy,
+	}
+	var inputs []string
+	tx, err := s.api.GetTransaction(ts.txid, false, false)
+	if err != nil {
+		if st.DoubleSpentBy != "" {
+			st.Status = txStatusDoubleSpent
+		} else if ts.status.Status == "" || ts.status.Status == txStatusNotFound {
+			st.Status = txStatusNotFound
+		} else {
+			st.Status = txStatusDropped
+		}
+		return st, nil
+	}
+	if ts.inputs == nil {
+		inputs = make([]string, 0, len(tx.Vin))
+		for i := range tx.Vin {
+			if tx.Vin[i].Txid != "" {
+				inputs = append(inputs, txInputKey(tx.Vin[i].Txid, tx.Vin[i].Vout))
+			}
+		}
+	}
+	if tx.Confirmations > 0 {
+		st.Status = txStatusConfirmed
+		st.Confirmations = tx.Confirmations
+		st.BlockHeight = uint32(tx.Blockheight)
+		st.BlockHash = tx.Blockhash
+		// the transaction won, it is not double spent
+		st.DoubleSpentBy = ""
+		st.Completed = st.Confirmations >= ts.confirmations
+	} else if st.DoubleSpentBy != "" {
+		st.Status = txStatusDoubleSpent
+	} else {
+		st.Status = txStatusMempool
+	}
+	return st, inputs
+}
+
+// setTxSubscriptionInputs stores the inputs of the tracked transaction to detect double spends
+// it must be called with transactionSubscriptionsLock held
+func (s *WebsocketServer) setTxSubscriptionInputs(ts *txSubscription, inputs []string) {
+	ts.inputs = inputs
+	for _, in := range inputs {
+		ti, ok := s.transactionInputs[in]
+		if !ok {
+			ti = make(map[*txSubscription]struct{})
+			s.transactionInputs[in] = ti
+		}
+		ti[ts] = struct{}{}
+	}
+}
+
+// removeTxSubscription removes the tracked transaction, it must be called with transactionSubscriptionsLock held
+func (s *WebsocketServer) removeTxSubscription(ts *txSubscription) {
+	if sa, ok := s.transactionSubscriptions[ts.txid]; ok {
+		delete(sa, ts)
+		if len(sa) == 0 {
+			delete(s.transactionSubscriptions, ts.txid)
+		}
+	}
+	for _, in := range ts.inputs {
+		if ti, ok := s.transactionInputs[in]; ok {
+			delete(ti, ts)
+			if len(ti) == 0 {
+				delete(s.transactionInputs, in)
+			}
+		}
+	}
+	if ts.c.transactions[ts.txid] == ts {
+		delete(ts.c.transactions, ts.txid)
+		s.setSubscriptions(ts.c, "subscribeTransaction", len(ts.c.transactions))
+	}
+}
+
+func (s *WebsocketServer) subscribeTransaction(c *websocketChannel, txid string, confirmations uint32, req *websocketReq) (res interface{}, err error) {
+	if txid == "" {
+		return nil, api.NewAPIError("Missing txid", true)
+	}
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	ts := &txSubscription{
+		c:             c,
+		id:            req.ID,
+		txid:          txid,
+		confirmations: confirmations,
+	}
+	s.transactionCheckLock.Lock()
+	defer s.transactionCheckLock.Unlock()
+	st, inputs := s.getTxStatus(ts)
+	ts.status = st
+	s.transactionSubscriptionsLock.Lock()
+	defer s.transactionSubscriptionsLock.Unlock()
+	// replace the previous subscription of the same transaction
+	if prev, ok := c.transactions[txid]; ok {
+		s.removeTxSubscription(prev)
+	}
+	if !st.Completed {
+		if len(c.transactions) >= maxTransactionSubscriptions {
+			return nil, api.NewAPIError("Too many tracked transactions", true)
+		}
+		if err = s.setSubscriptions(c, "subscribeTransaction", len(c.transactions)+1); err != nil {
+			return nil, err
+		}
+		if c.transactions == nil {
+			c.transactions = make(map[string]*txSubscription)
+		}
+		c.transactions[txid] = ts
+		sa, ok := s.transactionSubscriptions[txid]
+		if !ok {
+			sa = make(map[*txSubscription]struct{})
+			s.transactionSubscriptions[txid] = sa
+		}
+		sa[ts] = struct{}{}
+		if inputs != nil {
+			s.setTxSubscriptionInputs(ts, inputs)
+		}
+	}
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeTransaction"})).Set(float64(len(s.transactionSubscriptions)))
+	return &struct {
+		Subscribed bool `json:"subscribed"`
+		txStatusData
+	}{
+		Subscribed:   !st.Completed,
+		txStatusData: st,
+	}, nil
+}
+
+// unsubscribeTransactions stops tracking of the transaction, or of all transactions of the channel if txid is empty
+func (s *WebsocketServer) unsubscribeTransactions(c *websocketChannel, txid string) (res interface{}, err error) {
+	s.transactionSubscriptionsLock.Lock()
+	defer s.transactionSubscriptionsLock.Unlock()
+	for t, ts := range c.transactions {
+		if txid == "" || t == txid {
+			s.removeTxSubscription(ts)
+		}
+	}
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeTransaction"})).Set(float64(len(s.transactionSubscriptions)))
+	return &subscriptionResponse{false}, nil
+}
+
+// checkTxSubscriptions updates the status of the tracked transactions and notifies the channels about the changes
+// the tracking of the transaction is finished when it reaches the target number of confirmations
+func (s *WebsocketServer) checkTxSubscriptions(subscriptions []*txSubscription) {
+	s.transactionCheckLock.Lock()
+	defer s.transactionCheckLock.Unlock()
+	for _, ts := range subscriptions {
+		st, inputs := s.getTxStatus(ts)
+		s.setTxSubscriptionStatus(ts, st, inputs)
+	}
+}
+
+// setTxSubscriptionStatus stores the new status of the tracked transaction and notifies the channel if it changed
+// it must be called with transactionCheckLock held
+func (s *WebsocketServer) setTxSubscriptionStatus(ts *txSubscription, st txStatusData, inputs []string) {
+	s.transactionSubscriptionsLock.Lock()
+	defer s.transactionSubscriptionsLock.Unlock()
+	if _, ok := s.transactionSubscriptions[ts.txid][ts]; !ok {
+		return
+	}
+	if inputs != nil {
+		s.setTxSubscriptionInputs(ts, inputs)
+	}
+	if st != ts.status {
+		ts.status = st
+		ts.c.DataOut(&websocketRes{
+			ID:   ts.id,
+			Data: &st,
+		})
+		if st.Completed {
+			s.removeTxSubscription(ts)
+		}
+	}
+}
+
+// getAllTxSubscriptions returns all tracked transactions
+func (s *WebsocketServer) getAllTxSubscriptions() []*txSubscription {
+	s.transactionSubscriptionsLock.Lock()
+	defer s.transactionSubscriptionsLock.Unlock()
+	var subscriptions []*txSubscription
+	for _, sa := range s.transactionSubscriptions {
+		for ts := range sa {
+			subscriptions = append(subscriptions, ts)
+		}
+	}
+	return subscriptions
+}
+
+// getNewTxTrackedTxs returns the tracked transactions affected by a new mempool transaction,
+// i.e. the transaction itself and the transactions with inputs spent by the new transaction
+func (s *WebsocketServer) getNewTxTrackedTxs(tx *bchain.MempoolTx) (map[*txSubscription]struct{}, map[*txSubscription]struct{}) {
+	s.transactionSubscriptionsLock.Lock()
+	defer s.transactionSubscriptionsLock.Unlock()
+	if len(s.transactionSubscriptions) == 0 {
+		return nil, nil
+	}
+	subscribed := s.transactionSubscriptions[tx.Txid]
+	var doubleSpent map[*txSubscription]struct{}
+	// the replaced transaction of the same sender and nonce is reported as double spent
+	if tx.Replaces != "" && len(s.transactionSubscriptions[tx.Replaces]) > 0 {
+		doubleSpent = make(map[*txSubscription]struct{})
+		for ts := range s.transactionSubscriptions[tx.Replaces] {
+			doubleSpent[ts] = struct{}{}
+		}
+	}
+	for i := range tx.Vin {
+		if tx.Vin[i].Txid == "" {
+			continue
+		}
+		for ts := range s.transactionInputs[txInputKey(tx.Vin[i].Txid, tx.Vin[i].Vout)] {
+			if ts.txid != tx.Txid {
+				if doubleSpent == nil {
+					doubleSpent = make(map[*txSubscription]struct{})
+				}
+				doubleSpent[ts] = struct{}{}
+			}
+		}
+	}
+	if len(subscribed) == 0 && len(doubleSpent) == 0 {
+		return nil, nil
+	}
+	r := make(map[*txSubscription]struct{}, len(subscribed))
+	for ts := range subscribed {
+		r[ts] = struct{}{}
+	}
+	return r, doubleSpent
+}
+
+func (s *WebsocketServer) onNewTxTrackedTxsAsync(txid string, subscribed, doubleSpent map[*txSubscription]struct{}) {
+	subscriptions := make([]*txSubscription, 0, len(subscribed)+len(doubleSpent))
+	for ts := range subscribed {
+		subscriptions = append(subscriptions, ts)
+	}
+	if len(doubleSpent) > 0 {
+		s.transactionCheckLock.Lock()
+		for ts := range doubleSpent {
+			ts.status.DoubleSpentBy = txid
+			subscriptions = append(subscriptions, ts)
+		}
+		s.transactionCheckLock.Unlock()
+	}
+	s.checkTxSubscriptions(subscriptions)
+}
+
+// onNewBlockTxSubscriptionsAsync updates the tracked transactions after a new block is connected
+// the confirmations of the transactions from the blocks which are still in the best chain are computed from the height,
+// only the transactions of the new block and of the disconnected blocks are looked up
+func (s *WebsocketServer) onNewBlockTxSubscriptionsAsync(height uint32) {
+	subscriptions := s.getAllTxSubscriptions()
+	if len(subscriptions) == 0 {
+		return
+	}
+	var inBlock map[string]struct{}
+	txids, err := s.db.GetBlockTxids(height)
+	if err != nil {
+		glog.Error("GetBlockTxids error ", err, " for block ", height)
+	}
+	if txids != nil {
+		inBlock = make(map[string]struct{}, len(txids))
+		for _, txid := range txids {
+			inBlock[txid] = struct{}{}
+		}
+	}
+	s.transactionCheckLock.Lock()
+	check := make([]*txSubscription, 0)
+	for _, ts := range subscriptions {
+		if ts.status.Status == txStatusConfirmed && ts.status.BlockHeight <= height {
+			hash, err := s.db.GetBlockHash(ts.status.BlockHeight)
+			if err == nil && hash == ts.status.BlockHash {
+				st := ts.status
+				st.Confirmations = height - st.BlockHeight + 1
+				st.Completed = st.Confirmations >= ts.confirmations
+				s.setTxSubscriptionStatus(ts, st, nil)
+				continue
+			}
+		} else if inBlock != nil {
+			// if the txids of the block are not known, all not confirmed transactions are checked
+			if _, ok := inBlock[ts.txid]; !ok {
+				continue
+			}
+		}
+		check = append(check, ts)
+	}
+	s.transactionCheckLock.Unlock()
+	if len(check) > 0 {
+		s.checkTxSubscriptions(check)
+	}
+}
+
+// onMempoolResyncTxSubscriptionsAsync checks the tracked transactions which disappeared from the mempool,
+// the transactions added to the mempool are handled by OnNewTx
+func (s *WebsocketServer) onMempoolResyncTxSubscriptionsAsync() {
+	subscriptions := s.getAllTxSubscriptions()
+	if len(subscriptions) == 0 {
+		return
+	}
+	s.transactionCheckLock.Lock()
+	check := make([]*txSubscription, 0)
+	for _, ts := range subscriptions {
+		if ts.status.Status == txStatusMempool && s.mempool.GetTransactionTime(ts.txid) == 0 {
+			check = append(check, ts)
+		}
+	}
+	s.transactionCheckLock.Unlock()
+	if len(check) > 0 {
+		s.checkTxSubscriptions(check)
+	}
+}
+
+// OnMempoolResync is a callback that updates the status of the tracked transactions after the mempool resync
+func (s *WebsocketServer) OnMempoolResync() {
+	go s.onMempoolResyncTxSubscriptionsAsync()
+}
+
 // unsubscribe fiat rates without fiatRatesSubscriptionsLock - can be called only from subscribeFiatRates and unsubscribeFiatRates
 func (s *WebsocketServer) doUnsubscribeFiatRates(c *websocketChannel) {
 	for fr, sa := range s.fiatRatesSubscriptions {
@@ -803,6 +1835,9 @@ func (s *WebsocketServer) doUnsubscribeFiatRates(c *websocketChannel) {
 
 // subscribeFiatRates subscribes all FiatRates subscriptions by this channel
 func (s *WebsocketServer) subscribeFiatRates(c *websocketChannel, currency string, req *websocketReq) (res interface{}, err error) {
+	if err = s.setSubscriptions(c, "subscribeFiatRates", 1); err != nil {
+		return nil, err
+	}
 	s.fiatRatesSubscriptionsLock.Lock()
 	defer s.fiatRatesSubscriptionsLock.Unlock()
 	// unsubscribe all previous subscriptions
@@ -825,21 +1860,77 @@ func (s *WebsocketServer) unsubscribeFiatRates(c *websocketChannel) (res interfa
 	s.fiatRatesSubscriptionsLock.Lock()
 	defer s.fiatRatesSubscriptionsLock.Unlock()
 	s.doUnsubscribeFiatRates(c)
+	s.setSubscriptions(c, "subscribeFiatRates", 0)
 	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeFiatRates"})).Set(float64(len(s.fiatRatesSubscriptions)))
 	return &subscriptionResponse{false}, nil
 }
 
-func (s *WebsocketServer) onNewBlockAsync(hash string, height uint32) {
+// unsubscribe broadcasts without broadcastSubscriptionsLock - can be called only from subscribeBroadcasts and unsubscribeBroadcasts
+func (s *WebsocketServer) doUnsubscribeBroadcasts(c *websocketChannel) {
+	for _, txid := range c.broadcasts {
+		sa, e := s.broadcastSubscriptions[txid]
+		if e {
+			delete(sa, c)
+			if len(sa) == 0 {
+				delete(s.broadcastSubscriptions, txid)
+			}
+		}
+	}
+	c.broadcasts = nil
+}
+
+// subscribeBroadcasts subscribes the state changes of the transactions in the broadcast queue, replacing the previous subscription
+func (s *WebsocketServer) subscribeBroadcasts(c *websocketChannel, txids []string, req *websocketReq) (res interface{}, err error) {
+	if len(txids) == 0 {
+		return nil, errors.New("Missing txids")
+	}
+	if err = s.setSubscriptions(c, "subscribeBroadcasts", len(txids)); err != nil {
+		return nil, err
+	}
+	s.broadcastSubscriptionsLock.Lock()
+	defer s.broadcastSubscriptionsLock.Unlock()
+	// unsubscribe all previous subscriptions
+	s.doUnsubscribeBroadcasts(c)
+	for i := range txids {
+		txid := strings.ToLower(strings.TrimSpace(txids[i]))
+		txids[i] = txid
+		as, ok := s.broadcastSubscriptions[txid]
+		if !ok {
+			as = make(map[*websocketChannel]string)
+			s.broadcastSubscriptions[txid] = as
+		}
+		as[c] = req.ID
+	}
+	c.broadcasts = txids
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeBroadcasts"})).Set(float64(len(s.broadcastSubscriptions)))
+	return &subscriptionResponse{true}, nil
+}
+
+// unsubscribeBroadcasts unsubscribes all broadcast subscriptions by this channel
+func (s *WebsocketServer) unsubscribeBroadcasts(c *websocketChannel) (res interface{}, err error) {
+	s.broadcastSubscriptionsLock.Lock()
+	defer s.broadcastSubscriptionsLock.Unlock()
+	s.doUnsubscribeBroadcasts(c)
+	s.setSubscriptions(c, "subscribeBroadcasts", 0)
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeBroadcasts"})).Set(float64(len(s.broadcastSubscriptions)))
+	return &subscriptionResponse{false}, nil
+}
+
+func (s *WebsocketServer) onNewBlockAsync(hash string, height uint32, seq uint64) {
 	s.newBlockSubscriptionsLock.Lock()
 	defer s.newBlockSubscriptionsLock.Unlock()
-	data := struct {
-		Height uint32 `json:"height"`
-		Hash   string `json:"hash"`
-	}{
+	data := newBlockData{
 		Height: height,
 		Hash:   hash,
 	}
+	if seq > 0 {
+		data.ResumeToken = resumeTokenFromSeq(seq)
+	}
 	for c, id := range s.newBlockSubscriptions {
+		// skip the channels to which the event was already replayed
+		if seq > 0 && seq <= c.newBlockResumeSeq {
+			continue
+		}
 		c.DataOut(&websocketRes{
 			ID:   id,
 			Data: &data,
@@ -850,7 +1941,176 @@ func (s *WebsocketServer) onNewBlockAsync(hash string, height uint32) {
 
 // OnNewBlock is a callback that broadcasts info about new block to subscribed clients
 func (s *WebsocketServer) OnNewBlock(hash string, height uint32) {
-	go s.onNewBlockAsync(hash, height)
+	atomic.AddUint64(&s.newBlocks, 1)
+	var seq uint64
+	if s.eventLog != nil {
+		s.newBlockSubscriptionsLock.Lock()
+		events := []db.Event{{Type: db.EventNewBlock, Height: height, Hash: hash}}
+		if err := s.eventLog.Append(events); err != nil {
+			glog.Error("eventLog.Append error ", err, " for block ", height)
+		} else {
+			seq = events[0].Seq
+		}
+		s.newBlockSubscriptionsLock.Unlock()
+	}
+	go s.onNewBlockAsync(hash, height, seq)
+	// the confirmations of the tracked transactions are updated also after a reorg, as OnNewBlock is called for the new best block
+	go s.onNewBlockTxSubscriptionsAsync(height)
+}
+
+// status of a transaction from a disconnected block, as sent to the address subscribers
+const (
+	reorgTxStatusConfirmed = "confirmed"
+	reorgTxStatusMempool   = "mempool"
+	reorgTxStatusRemoved   = "removed"
+)
+
+type reorgTx struct {
+	Txid               string  `json:"txid"`
+	Status             string  `json:"status"`
+	DisconnectedHeight uint32  `json:"disconnectedHeight"`
+	Tx                 *api.Tx `json:"tx,omitempty"`
+}
+
+type reorgTxAddrData struct {
+	Address     string   `json:"address"`
+	Reorg       *reorgTx `json:"reorg"`
+	ResumeToken string   `json:"resumeToken,omitempty"`
+}
+
+// getReorgTx looks up the transaction from a disconnected block after the new branch was connected
+// it can be in a block of the new branch, back in the mempool or gone completely
+func (s *WebsocketServer) getReorgTx(txid string, disconnectedHeight uint32) *reorgTx {
+	rt := reorgTx{
+		Txid:               txid,
+		DisconnectedHeight: disconnectedHeight,
+	}
+	atx, err := s.api.GetTransaction(txid, false, false)
+	if err != nil {
+		rt.Status = reorgTxStatusRemoved
+	} else {
+		if atx.Blockheight > 0 {
+			rt.Status = reorgTxStatusConfirmed
+		} else {
+			rt.Status = reorgTxStatusMempool
+		}
+		rt.Tx = atx
+	}
+	return &rt
+}
+
+func (s *WebsocketServer) onReorgAsync(blocks []bchain.ReorgBlock, txs []bchain.ReorgTx, seqs []map[string]uint64) {
+	height, hash, err := s.db.GetBestBlock()
+	if err != nil {
+		glog.Error("GetBestBlock error ", err)
+		return
+	}
+	data := struct {
+		Disconnected []bchain.ReorgBlock `json:"disconnected"`
+		Height       uint32              `json:"height"`
+		Hash         string              `json:"hash"`
+	}{
+		Disconnected: blocks,
+		Height:       height,
+		Hash:         hash,
+	}
+	s.reorgSubscriptionsLock.Lock()
+	for c, id := range s.reorgSubscriptions {
+		c.DataOut(&websocketRes{
+			ID:   id,
+			Data: &data,
+		})
+	}
+	glog.Info("broadcasting reorg of ", len(blocks), " blocks, new best block ", height, " ", hash, " to ", len(s.reorgSubscriptions), " channels")
+	s.reorgSubscriptionsLock.Unlock()
+	for i := range txs {
+		subscribed := s.getReorgTxSubscriptions(&txs[i])
+		if len(subscribed) == 0 {
+			continue
+		}
+		rt := s.getReorgTx(txs[i].Txid, txs[i].Height)
+		for stringAddressDescriptor := range subscribed {
+			var seq uint64
+			if seqs != nil {
+				seq = seqs[i][stringAddressDescriptor]
+			}
+			s.sendOnReorgTxAddr(stringAddressDescriptor, rt, seq)
+		}
+	}
+}
+
+// OnReorg is a callback that broadcasts info about disconnected blocks and about their transactions affecting subscribed addresses
+func (s *WebsocketServer) OnReorg(blocks []bchain.ReorgBlock, txs []bchain.ReorgTx) {
+	var seqs []map[string]uint64
+	if s.eventLog != nil {
+		var events []db.Event
+		ends := make([]int, len(txs))
+		for i := range txs {
+			addrDescs := make(map[string]struct{}, len(txs[i].AddrDescs))
+			for _, ad := range txs[i].AddrDescs {
+				addrDescs[string(ad)] = struct{}{}
+			}
+			events = addressEvents(events, db.EventAddressReorgTx, txs[i].Txid, txs[i].Height, addrDescs)
+			ends[i] = len(events)
+		}
+		if s.logAddressEvents(events) {
+			seqs = make([]map[string]uint64, len(txs))
+			start := 0
+			for i := range txs {
+				seqs[i] = eventSeqs(events[start:ends[i]])
+				start = ends[i]
+			}
+		}
+	}
+	go s.onReorgAsync(blocks, txs, seqs)
+}
+
+func (s *WebsocketServer) getReorgTxSubscriptions(tx *bchain.ReorgTx) map[string]struct{} {
+	s.addressSubscriptionsLock.Lock()
+	defer s.addressSubscriptionsLock.Unlock()
+	subscribed := make(map[string]struct{})
+	for _, addrDesc := range tx.AddrDescs {
+		sad := string(addrDesc)
+		as, ok := s.addressSubscriptions[sad]
+		if ok && len(as) > 0 {
+			subscribed[sad] = struct{}{}
+		}
+	}
+	return subscribed
+}
+
+func (s *WebsocketServer) sendOnReorgTxAddr(stringAddressDescriptor string, rt *reorgTx, seq uint64) {
+	addrDesc := bchain.AddressDescriptor(stringAddressDescriptor)
+	addr, _, err := s.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil {
+		glog.Error("GetAddressesFromAddrDesc error ", err, " for ", addrDesc)
+		return
+	}
+	if len(addr) == 1 {
+		data := reorgTxAddrData{
+			Address: addr[0],
+			Reorg:   rt,
+		}
+		if seq > 0 {
+			data.ResumeToken = resumeTokenFromSeq(seq)
+		}
+		s.addressSubscriptionsLock.Lock()
+		defer s.addressSubscriptionsLock.Unlock()
+		as, ok := s.addressSubscriptions[stringAddressDescriptor]
+		if ok {
+			for c, id := range as {
+				// skip the channels to which the event was already replayed
+				if seq > 0 && seq <= c.addrResumeSeq {
+					continue
+				}
+				c.addrDataOut(&websocketRes{
+					ID:   id,
+					Data: &data,
+				})
+			}
+			glog.Info("broadcasting reorg tx ", rt.Txid, " (", rt.Status, "), addr ", addr[0], " to ", len(as), " channels")
+		}
+	}
 }
 
 func (s *WebsocketServer) sendOnNewTx(tx *api.Tx) {
@@ -865,7 +2125,14 @@ func (s *WebsocketServer) sendOnNewTx(tx *api.Tx) {
 	glog.Info("broadcasting new tx ", tx.Txid, " to ", len(s.newTransactionSubscriptions), " channels")
 }
 
-func (s *WebsocketServer) sendOnNewTxAddr(stringAddressDescriptor string, tx *api.Tx) {
+type newTxAddrData struct {
+	Address     string  `json:"address"`
+	Tx          *api.Tx `json:"tx"`
+	Replaces    string  `json:"replaces,omitempty"`
+	ResumeToken string  `json:"resumeToken,omitempty"`
+}
+
+func (s *WebsocketServer) sendOnNewTxAddr(stringAddressDescriptor string, tx *api.Tx, replaces string, seq uint64) {
 	addrDesc := bchain.AddressDescriptor(stringAddressDescriptor)
 	addr, _, err := s.chainParser.GetAddressesFromAddrDesc(addrDesc)
 	if err != nil {
@@ -873,19 +2140,24 @@ func (s *WebsocketServer) sendOnNewTxAddr(stringAddressDescriptor string, tx *ap
 		return
 	}
 	if len(addr) == 1 {
-		data := struct {
-			Address string  `json:"address"`
-			Tx      *api.Tx `json:"tx"`
-		}{
-			Address: addr[0],
-			Tx:      tx,
+		data := newTxAddrData{
+			Address:  addr[0],
+			Tx:       tx,
+			Replaces: replaces,
+		}
+		if seq > 0 {
+			data.ResumeToken = resumeTokenFromSeq(seq)
 		}
 		s.addressSubscriptionsLock.Lock()
 		defer s.addressSubscriptionsLock.Unlock()
 		as, ok := s.addressSubscriptions[stringAddressDescriptor]
 		if ok {
 			for c, id := range as {
-				c.DataOut(&websocketRes{
+				// skip the channels to which the event was already replayed
+				if seq > 0 && seq <= c.addrResumeSeq {
+					continue
+				}
+				c.addrDataOut(&websocketRes{
 					ID:   id,
 					Data: &data,
 				})
@@ -895,52 +2167,50 @@ func (s *WebsocketServer) sendOnNewTxAddr(stringAddressDescriptor string, tx *ap
 	}
 }
 
-func (s *WebsocketServer) getNewTxSubscriptions(tx *bchain.MempoolTx) map[string]struct{} {
-	// check if there is any subscription in inputs, outputs and erc20
-	s.addressSubscriptionsLock.Lock()
-	defer s.addressSubscriptionsLock.Unlock()
-	subscribed := make(map[string]struct{})
+// getNewTxAddrDescs returns all addresses in inputs, outputs and erc20 transfers of the tx
+func (s *WebsocketServer) getNewTxAddrDescs(tx *bchain.MempoolTx) map[string]struct{} {
+	addrDescs := make(map[string]struct{})
 	for i := range tx.Vin {
 		sad := string(tx.Vin[i].AddrDesc)
 		if len(sad) > 0 {
-			as, ok := s.addressSubscriptions[sad]
-			if ok && len(as) > 0 {
-				subscribed[sad] = struct{}{}
-			}
+			addrDescs[sad] = struct{}{}
 		}
 	}
 	for i := range tx.Vout {
 		addrDesc, err := s.chainParser.GetAddrDescFromVout(&tx.Vout[i])
 		if err == nil && len(addrDesc) > 0 {
-			sad := string(addrDesc)
-			as, ok := s.addressSubscriptions[sad]
-			if ok && len(as) > 0 {
-				subscribed[sad] = struct{}{}
-			}
+			addrDescs[string(addrDesc)] = struct{}{}
 		}
 	}
-	for i := range tx.Erc20 {
-		addrDesc, err := s.chainParser.GetAddrDescFromAddress(tx.Erc20[i].From)
+	for i := range tx.TokenTransfers {
+		addrDesc, err := s.chainParser.GetAddrDescFromAddress(tx.TokenTransfers[i].From)
 		if err == nil && len(addrDesc) > 0 {
-			sad := string(addrDesc)
-			as, ok := s.addressSubscriptions[sad]
-			if ok && len(as) > 0 {
-				subscribed[sad] = struct{}{}
-			}
+			addrDescs[string(addrDesc)] = struct{}{}
 		}
-		addrDesc, err = s.chainParser.GetAddrDescFromAddress(tx.Erc20[i].To)
+		addrDesc, err = s.chainParser.GetAddrDescFromAddress(tx.TokenTransfers[i].To)
 		if err == nil && len(addrDesc) > 0 {
-			sad := string(addrDesc)
-			as, ok := s.addressSubscriptions[sad]
-			if ok && len(as) > 0 {
-				subscribed[sad] = struct{}{}
-			}
+			addrDescs[string(addrDesc)] = struct{}{}
+		}
+	}
+	return addrDescs
+}
+
+// getNewTxSubscriptions returns the subscribed addresses affected by the tx
+func (s *WebsocketServer) getNewTxSubscriptions(addrDescs map[string]struct{}) map[string]struct{} {
+	// check if there is any subscription
+	s.addressSubscriptionsLock.Lock()
+	defer s.addressSubscriptionsLock.Unlock()
+	subscribed := make(map[string]struct{})
+	for sad := range addrDescs {
+		as, ok := s.addressSubscriptions[sad]
+		if ok && len(as) > 0 {
+			subscribed[sad] = struct{}{}
 		}
 	}
 	return subscribed
 }
 
-func (s *WebsocketServer) onNewTxAsync(tx *bchain.MempoolTx, subscribed map[string]struct{}) {
+func (s *WebsocketServer) onNewTxAsync(tx *bchain.MempoolTx, subscribed map[string]struct{}, seqs map[string]uint64, accounts map[*websocketAccount][]accountTxAddress) {
 	atx, err := s.api.GetTransactionFromMempoolTx(tx)
 	if err != nil {
 		glog.Error("GetTransactionFromMempoolTx error ", err, " for ", tx.Txid)
@@ -948,15 +2218,47 @@ func (s *WebsocketServer) onNewTxAsync(tx *bchain.MempoolTx, subscribed map[stri
 	}
 	s.sendOnNewTx(atx)
 	for stringAddressDescriptor := range subscribed {
-		s.sendOnNewTxAddr(stringAddressDescriptor, atx)
+		s.sendOnNewTxAddr(stringAddressDescriptor, atx, tx.Replaces, seqs[stringAddressDescriptor])
+	}
+	for a, addresses := range accounts {
+		s.sendOnNewTxAccount(a, addresses, atx)
 	}
 }
 
-// OnNewTx is a callback that broadcasts info about a tx affecting subscribed address
+// OnNewTx is a callback that broadcasts info about a tx affecting subscribed address or account
+// if the event log is enabled, the tx is queued so that the event log is not written in the mempool synchronization
 func (s *WebsocketServer) OnNewTx(tx *bchain.MempoolTx) {
-	subscribed := s.getNewTxSubscriptions(tx)
-	if len(s.newTransactionSubscriptions) > 0 || len(subscribed) > 0 {
-		go s.onNewTxAsync(tx, subscribed)
+	if s.newTxEvents != nil {
+		s.newTxEvents <- tx
+		return
+	}
+	s.onNewTx(tx)
+}
+
+// newTxEventsLoop writes the events of the queued mempool transactions to the event log and notifies the subscribers,
+// the transactions are processed one by one to keep the order of the sequence numbers of the events
+func (s *WebsocketServer) newTxEventsLoop() {
+	for tx := range s.newTxEvents {
+		s.onNewTx(tx)
+	}
+}
+
+func (s *WebsocketServer) onNewTx(tx *bchain.MempoolTx) {
+	addrDescs := s.getNewTxAddrDescs(tx)
+	var seqs map[string]uint64
+	if s.eventLog != nil {
+		events := addressEvents(make([]db.Event, 0, len(addrDescs)), db.EventAddressTx, tx.Txid, 0, addrDescs)
+		if s.logAddressEvents(events) {
+			seqs = eventSeqs(events)
+		}
+	}
+	subscribed := s.getNewTxSubscriptions(addrDescs)
+	accounts := s.getAccountSubscriptions(addrDescs)
+	if len(s.newTransactionSubscriptions) > 0 || len(subscribed) > 0 || len(accounts) > 0 {
+		go s.onNewTxAsync(tx, subscribed, seqs, accounts)
+	}
+	if txSubscribed, doubleSpent := s.getNewTxTrackedTxs(tx); len(txSubscribed) > 0 || len(doubleSpent) > 0 {
+		go s.onNewTxTrackedTxsAsync(tx.Txid, txSubscribed, doubleSpent)
 	}
 }
 
@@ -988,13 +2290,13 @@ func (s *WebsocketServer) OnNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
 	s.broadcastTicker(allFiatRates, ticker.Rates)
 }
 
-func (s *WebsocketServer) getCurrentFiatRates(currencies []string) (interface{}, error) {
-	ret, err := s.api.GetCurrentFiatRates(currencies)
+func (s *WebsocketServer) getCurrentFiatRates(currencies []string, token string) (interface{}, error) {
+	ret, err := s.api.GetCurrentFiatRates(currencies, token)
 	return ret, err
 }
 
-func (s *WebsocketServer) getFiatRatesForTimestamps(timestamps []int64, currencies []string) (interface{}, error) {
-	ret, err := s.api.GetFiatRatesForTimestamps(timestamps, currencies)
+func (s *WebsocketServer) getFiatRatesForTimestamps(timestamps []int64, currencies []string, token string) (interface{}, error) {
+	ret, err := s.api.GetFiatRatesForTimestamps(timestamps, currencies, token)
 	return ret, err
 }
 
@@ -1002,3 +2304,19 @@ func (s *WebsocketServer) getFiatRatesTickersList(timestamp int64) (interface{},
 	ret, err := s.api.GetFiatRatesTickersList(timestamp)
 	return ret, err
 }
+
+// OnBroadcastStateChange is a callback that sends the new state of the transaction in the broadcast queue to the subscribers
+func (s *WebsocketServer) OnBroadcastStateChange(tx *db.BroadcastTx) {
+	s.broadcastSubscriptionsLock.Lock()
+	defer s.broadcastSubscriptionsLock.Unlock()
+	as, ok := s.broadcastSubscriptions[tx.Txid]
+	if ok && len(as) > 0 {
+		for c, id := range as {
+			c.DataOut(&websocketRes{
+				ID:   id,
+				Data: tx,
+			})
+		}
+		glog.Info("broadcasting state ", tx.State, " of tx ", tx.Txid, " to ", len(as), " channels")
+	}
+}
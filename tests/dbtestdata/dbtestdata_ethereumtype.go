@@ -22,6 +22,7 @@ const (
 	EthTx1Packed         = "08e8dd870210a6a6f0db051a6908ece40212050430e234001888a40122081bc0159d530e60003220cd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b3a14555ee11fbddc0e49a9bab358a8941ad95ffdb48f42143e3a3d69dc66ba10737f531ed088954a9ec89d97480a22070a025208120101"
 	EthTx1FailedPacked   = "08e8dd870210a6a6f0db051a6908ece40212050430e234001888a40122081bc0159d530e60003220cd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b3a14555ee11fbddc0e49a9bab358a8941ad95ffdb48f42143e3a3d69dc66ba10737f531ed088954a9ec89d97480a22040a025208"
 	EthTx1NoStatusPacked = "08e8dd870210a6a6f0db051a6908ece40212050430e234001888a40122081bc0159d530e60003220cd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b3a14555ee11fbddc0e49a9bab358a8941ad95ffdb48f42143e3a3d69dc66ba10737f531ed088954a9ec89d97480a22070a025208120155"
+	EthTx1InternalPacked = "08e8dd870210a6a6f0db051a6908ece40212050430e234001888a40122081bc0159d530e60003220cd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b3a14555ee11fbddc0e49a9bab358a8941ad95ffdb48f42143e3a3d69dc66ba10737f531ed088954a9ec89d97480a22070a0252081201012a351214555ee11fbddc0e49a9bab358a8941ad95ffdb48f1a149f4981531fda132e83c44680787dfa7ee31e4f8d22072386f26fc100002a3608011214555ee11fbddc0e49a9bab358a8941ad95ffdb48f1a14479cc461fecd078f766ecc58533d6f69580cf3ac22065af3107a40002a3608021214479cc461fecd078f766ecc58533d6f69580cf3ac1a1420cd153de35d469ba46127a0c8f18626b59a256a22065af3107a4000"
 	EthTxidB1T2          = "a9cd088aba2131000da6f38a33c20169baee476218deea6b78720700b895b101"
 	EthTx2Packed         = "08e8dd870210a6a6f0db051aa20108d001120509502f900018d5e1042a44a9059cbb000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f00000000000000000000000000000000000000000000021e19e0c9bab24000003220a9cd088aba2131000da6f38a33c20169baee476218deea6b78720700b895b1013a144af4114f73d1c1c903ac9e0361b379d1291808a2421420cd153de35d469ba46127a0c8f18626b59a256a22a8010a02cb391201011a9e010a144af4114f73d1c1c903ac9e0361b379d1291808a2122000000000000000000000000000000000000000000000021e19e0c9bab24000001a20ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef1a2000000000000000000000000020cd153de35d469ba46127a0c8f18626b59a256a1a20000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f"
 	EthTxidB2T1          = "c2c3dd1ecb00e8a6d81f793d24387cf2947a313e94ab03b1fb22cd63320f6c91"
@@ -60,6 +61,13 @@ func GetTestEthereumTypeBlock1(parser bchain.BlockChainParser) *bchain.Block {
 	}
 }
 
+// GetTestEthereumTypeBlock1InternalTransfers returns block #1 with internal transfers in the first transaction
+func GetTestEthereumTypeBlock1InternalTransfers(parser bchain.BlockChainParser) *bchain.Block {
+	b := GetTestEthereumTypeBlock1(parser)
+	b.Txs = unpackTxs([]string{EthTx1InternalPacked, EthTx2Packed}, parser)
+	return b
+}
+
 // GetTestEthereumTypeBlock2 returns block #2
 func GetTestEthereumTypeBlock2(parser bchain.BlockChainParser) *bchain.Block {
 	return &bchain.Block{
@@ -204,6 +204,10 @@ func (c *fakeBlockChain) SendRawTransaction(tx string) (v string, err error) {
 	return "", errors.New("Invalid data")
 }
 
+func (c *fakeBlockChain) TestMempoolAccept(tx string) (*bchain.MempoolAcceptResult, error) {
+	return &bchain.MempoolAcceptResult{Allowed: false, RejectReason: "missing-inputs"}, nil
+}
+
 // GetChainParser returns parser for the blockchain
 func (c *fakeBlockChain) GetChainParser() bchain.BlockChainParser {
 	return c.Parser
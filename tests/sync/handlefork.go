@@ -51,7 +51,7 @@ func testHandleFork(t *testing.T, h *TestHandler) {
 				if hash == upperHash {
 					close(ch)
 				}
-			}, true)
+			}, nil, true)
 
 			realBlocks := getRealBlocks(h, rng)
 			realTxs, err := getTxs(h, d, rng, realBlocks)